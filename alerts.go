@@ -0,0 +1,17 @@
+package main
+
+import "encoding/json"
+
+// writeAlertsFile writes the breaching records to path as a JSON array. The
+// file is written on every cycle, as [] when nothing breaches, so consumers
+// always find the latest state.
+func writeAlertsFile(path string, alerts []AlertRecord) error {
+	if alerts == nil {
+		alerts = []AlertRecord{}
+	}
+	data, err := json.MarshalIndent(alerts, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, append(data, '\n'))
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Test that the alerts file lists only breaching records, and [] when none
+func TestWriteAlertsFile(t *testing.T) {
+	config := NewDefaultConfig()
+	aggregation := aggregateData([]AggregatedData{
+		{Application: "Memcache2", Version: "1.0.1", TotalRequests: 100, TotalSuccesses: 100},
+		{Application: "Memcache2", Version: "1.0.2", TotalRequests: 100, TotalSuccesses: 95},
+		{Application: "Cassandra", Version: "2.0.0", TotalRequests: 100, TotalSuccesses: 50},
+	})
+	annotateSeverity(aggregation, config)
+
+	path := filepath.Join(t.TempDir(), "alerts.json")
+	if err := writeAlertsFile(path, breachingRecords(aggregation, config)); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read alerts file: %v", err)
+	}
+	var alerts []AlertRecord
+	if err := json.Unmarshal(data, &alerts); err != nil {
+		t.Fatalf("Failed to decode alerts file: %v", err)
+	}
+
+	expected := []AlertRecord{
+		{Application: "Cassandra", Version: "2.0.0", SuccessRate: 50, EvaluatedRate: 50, Threshold: config.CriticalThreshold, Severity: SeverityCritical},
+		{Application: "Memcache2", Version: "1.0.2", SuccessRate: 95, EvaluatedRate: 95, Threshold: config.WarningThreshold, Severity: SeverityWarning},
+	}
+	if len(alerts) != len(expected) {
+		t.Fatalf("Expected %d alerts, got %+v", len(expected), alerts)
+	}
+	for i := range expected {
+		if alerts[i] != expected[i] {
+			t.Errorf("Expected alert %+v, got %+v", expected[i], alerts[i])
+		}
+	}
+
+	if err := writeAlertsFile(path, breachingRecords(aggregateData(nil), config)); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if data, _ := os.ReadFile(path); strings.TrimSpace(string(data)) != "[]" {
+		t.Errorf("Expected an empty array, got %s", data)
+	}
+}
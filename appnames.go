@@ -0,0 +1,85 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// Policies for application names that differ only in casing
+const (
+	// AppNameCaseSensitive keeps names as reported, so differently cased
+	// names are aggregated apart
+	AppNameCaseSensitive = "sensitive"
+	// AppNameCaseFold merges names that differ only in casing under the
+	// casing reported by most instances
+	AppNameCaseFold = "fold"
+	// AppNameCaseLower lowercases every name
+	AppNameCaseLower = "lower"
+)
+
+// canonicalizeApplications renames the applications of a cycle's results in
+// place according to APP_NAME_MAP and APP_NAME_CASE, so instances reporting
+// the same application under different names are aggregated together. It
+// reports whether any name changed.
+func canonicalizeApplications(results []ServerResult, config *Config) bool {
+	var names []*string
+	for i := range results {
+		switch {
+		case results[i].Health != nil:
+			names = append(names, &results[i].Health.Application)
+		case results[i].Application != "":
+			names = append(names, &results[i].Application)
+		}
+	}
+
+	canonical := func(name string) string {
+		if mapped, ok := config.AppNameMap[name]; ok {
+			return mapped
+		}
+		if config.AppNameCase != AppNameCaseSensitive {
+			for alias, mapped := range config.AppNameMap {
+				if strings.EqualFold(alias, name) {
+					return mapped
+				}
+			}
+		}
+		return name
+	}
+
+	// With fold, the display name of each group is its most common casing,
+	// ties going to the lexically smallest so the choice is stable
+	display := make(map[string]string)
+	if config.AppNameCase == AppNameCaseFold {
+		counts := make(map[string]int)
+		for _, name := range names {
+			counts[canonical(*name)]++
+		}
+		casings := make([]string, 0, len(counts))
+		for casing := range counts {
+			casings = append(casings, casing)
+		}
+		sort.Strings(casings)
+		for _, casing := range casings {
+			key := strings.ToLower(casing)
+			if best, ok := display[key]; !ok || counts[casing] > counts[best] {
+				display[key] = casing
+			}
+		}
+	}
+
+	changed := false
+	for _, name := range names {
+		renamed := canonical(*name)
+		switch config.AppNameCase {
+		case AppNameCaseFold:
+			renamed = display[strings.ToLower(renamed)]
+		case AppNameCaseLower:
+			renamed = strings.ToLower(renamed)
+		}
+		if renamed != *name {
+			*name = renamed
+			changed = true
+		}
+	}
+	return changed
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+)
+
+// Test that application names differing only in casing merge under the most
+// common casing with APP_NAME_CASE=fold, and stay apart by default
+func TestCanonicalizeApplications(t *testing.T) {
+	cycle := func() []ServerResult {
+		var results []ServerResult
+		for _, app := range []string{"Memcache2", "memcache2", "Memcache2", "MEMCACHE2", "memcached", "Webapp"} {
+			results = append(results, ServerResult{Health: &HealthResponse{Application: app, Version: "1.0.1", RequestCount: 100, SuccessCount: 90}})
+		}
+		return results
+	}
+	aggregate := func(results []ServerResult) map[string]map[string]AggregatedData {
+		var data []AggregatedData
+		for _, result := range results {
+			data = append(data, toAggregatedData(*result.Health))
+		}
+		return aggregateData(data)
+	}
+
+	config := NewDefaultConfig()
+	results := cycle()
+	if canonicalizeApplications(results, config) {
+		t.Errorf("Expected names to be kept by default")
+	}
+	if aggregation := aggregate(results); len(aggregation) != 5 {
+		t.Errorf("Expected differently cased names to stay apart by default, got %d applications", len(aggregation))
+	}
+
+	config.AppNameCase = AppNameCaseFold
+	results = cycle()
+	if !canonicalizeApplications(results, config) {
+		t.Errorf("Expected names to be folded")
+	}
+	aggregation := aggregate(results)
+	if len(aggregation) != 3 {
+		t.Errorf("Expected Memcache2, memcached and Webapp, got %v", aggregation)
+	}
+	if memcache := aggregation["Memcache2"]["1.0.1"]; memcache.TotalRequests != 400 || memcache.TotalSuccesses != 360 {
+		t.Errorf("Expected the four casings merged under Memcache2, got %+v", memcache)
+	}
+
+	config.AppNameCase = AppNameCaseLower
+	results = cycle()
+	canonicalizeApplications(results, config)
+	if memcache := aggregate(results)["memcache2"]["1.0.1"]; memcache.TotalRequests != 400 {
+		t.Errorf("Expected the four casings merged under memcache2, got %+v", memcache)
+	}
+
+	// A mapping merges genuinely different names, matched case-insensitively
+	// unless names are case sensitive
+	config.AppNameCase = AppNameCaseFold
+	config.AppNameMap = map[string]string{"MemcacheD": "Memcache2"}
+	results = cycle()
+	canonicalizeApplications(results, config)
+	aggregation = aggregate(results)
+	if memcache := aggregation["Memcache2"]["1.0.1"]; len(aggregation) != 2 || memcache.TotalRequests != 500 {
+		t.Errorf("Expected memcached mapped onto Memcache2, got %v", aggregation)
+	}
+
+	config.AppNameCase = AppNameCaseSensitive
+	results = cycle()
+	canonicalizeApplications(results, config)
+	if _, ok := aggregate(results)["memcached"]; !ok {
+		t.Errorf("Expected a case-sensitive mapping not to match memcached")
+	}
+}
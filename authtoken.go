@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// commandToken is a bearer token obtained by running AUTH_TOKEN_COMMAND, like
+// the credential helpers of docker and git. The token is never logged.
+type commandToken struct {
+	command string
+	timeout time.Duration
+	ttl     time.Duration
+	// logLimit caps the stderr shown when the command fails
+	logLimit int
+	now      func() time.Time
+
+	mu        sync.Mutex
+	token     string
+	fetchedAt time.Time
+}
+
+// newCommandToken creates the token source for AUTH_TOKEN_COMMAND
+func newCommandToken(config *Config) *commandToken {
+	return &commandToken{
+		command:  config.AuthTokenCommand,
+		timeout:  config.AuthTokenTimeout,
+		ttl:      config.AuthTokenTTL,
+		logLimit: config.BodyLogLimit,
+		now:      time.Now,
+	}
+}
+
+// Refresh runs the command at the start of a cycle unless the current token is
+// younger than AUTH_TOKEN_TTL; without a TTL every cycle gets a fresh token.
+// On failure the previous token is dropped rather than reused past its TTL.
+func (t *commandToken) Refresh(ctx context.Context) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.token != "" && t.ttl > 0 && t.now().Sub(t.fetchedAt) < t.ttl {
+		return nil
+	}
+	t.token = ""
+
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "sh", "-c", t.command)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to run auth token command: %v", err)
+	}
+	// The shell is killed on timeout, but children it started may hold its
+	// output open and keep Wait blocked, so the timeout does not wait for it
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		return fmt.Errorf("auth token command timed out after %v", t.timeout)
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("auth token command timed out after %v", t.timeout)
+		}
+		// Only stderr is shown, redacted, as stdout may hold a token
+		return fmt.Errorf("auth token command failed: %v: %s", err, bodySnippet(bytes.TrimSpace(stderr.Bytes()), t.logLimit))
+	}
+	token := strings.TrimSpace(stdout.String())
+	if token == "" {
+		return fmt.Errorf("auth token command printed no token")
+	}
+	t.token, t.fetchedAt = token, t.now()
+	return nil
+}
+
+// current returns the token of the latest refresh
+func (t *commandToken) current() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.token
+}
+
+// wrap returns a transport adding the token to every health check
+func (t *commandToken) wrap(base http.RoundTripper) http.RoundTripper {
+	return &bearerTransport{base: base, token: t}
+}
+
+// bearerTransport sets the Authorization header of each request to the current
+// token. A redirect to a host other than the one first requested does not
+// carry it, however many hops later, so the token is not handed to whichever
+// server a health endpoint points at.
+type bearerTransport struct {
+	base  http.RoundTripper
+	token *commandToken
+}
+
+func (t *bearerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// A redirected request links back through the responses to the first
+	first := req
+	for first.Response != nil && first.Response.Request != nil {
+		first = first.Response.Request
+	}
+	token := t.token.current()
+	if token == "" || first.URL.Host != req.URL.Host {
+		return t.base.RoundTrip(req)
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Test that the token printed by AUTH_TOKEN_COMMAND is sent as a bearer token
+// with every health check
+func TestAuthTokenCommand(t *testing.T) {
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		w.Write([]byte(mockResponse))
+	}))
+	defer server.Close()
+
+	config := NewDefaultConfig()
+	config.AuthTokenCommand = "echo '  s3cr3t-token  '"
+	state := &scanState{token: newCommandToken(config)}
+	if err := state.token.Refresh(context.Background()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	resultChannel := make(chan ServerResult, 1)
+	go fetchHealthDataWithDelayAndConcurrency(context.Background(), []ServerEntry{{Address: server.URL}}, resultChannel, config, state)
+	for result := range resultChannel {
+		if result.Error != "" {
+			t.Fatalf("Expected no error, got %s", result.Error)
+		}
+	}
+	if authorization != "Bearer s3cr3t-token" {
+		t.Errorf("Expected the trimmed token as a bearer token, got %q", authorization)
+	}
+}
+
+// Test that the token is only sent to the host first requested, also when a
+// redirect chain leaves it and then stays on the other host
+func TestAuthTokenRedirectChain(t *testing.T) {
+	var mu sync.Mutex
+	authorizations := make(map[string]string)
+	record := func(r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		authorizations[r.URL.Path] = r.Header.Get("Authorization")
+	}
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		record(r)
+		if r.URL.Path == "/first" {
+			http.Redirect(w, r, "/second", http.StatusFound)
+			return
+		}
+		w.Write([]byte(mockResponse))
+	}))
+	defer other.Close()
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		record(r)
+		http.Redirect(w, r, other.URL+"/first", http.StatusFound)
+	}))
+	defer origin.Close()
+
+	config := NewDefaultConfig()
+	config.RedirectPolicy = RedirectPolicyFollow
+	config.AuthTokenCommand = "echo s3cr3t-token"
+	state := &scanState{token: newCommandToken(config)}
+	if err := state.token.Refresh(context.Background()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	resultChannel := make(chan ServerResult, 1)
+	go fetchHealthDataWithDelayAndConcurrency(context.Background(), []ServerEntry{{Address: origin.URL}}, resultChannel, config, state)
+	for result := range resultChannel {
+		if result.Error != "" {
+			t.Fatalf("Expected no error, got %s", result.Error)
+		}
+	}
+	expected := map[string]string{config.HealthPath: "Bearer s3cr3t-token", "/first": "", "/second": ""}
+	if !reflect.DeepEqual(authorizations, expected) {
+		t.Errorf("Expected the token only on the first host, got %v", authorizations)
+	}
+}
+
+// Test that a token is reused until AUTH_TOKEN_TTL passes and that failures
+// do not reveal the command's output
+func TestAuthTokenRefresh(t *testing.T) {
+	counter := filepath.Join(t.TempDir(), "runs")
+	config := NewDefaultConfig()
+	config.AuthTokenCommand = "echo run >> " + counter + "; echo token-$(wc -l < " + counter + " | tr -d ' ')"
+	config.AuthTokenTTL = time.Minute
+	token := newCommandToken(config)
+	now := time.Now()
+	token.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	for i, expected := range []string{"token-1", "token-1", "token-2"} {
+		if i == 2 {
+			now = now.Add(time.Minute)
+		}
+		if err := token.Refresh(ctx); err != nil {
+			t.Fatalf("Refresh %d: expected no error, got %v", i, err)
+		}
+		if got := token.current(); got != expected {
+			t.Errorf("Refresh %d: expected %s, got %s", i, expected, got)
+		}
+	}
+
+	config.AuthTokenTTL = 0
+	config.AuthTokenCommand = "echo leaked-token; echo 'bad credentials' >&2; exit 3"
+	failing := newCommandToken(config)
+	err := failing.Refresh(ctx)
+	if err == nil || strings.Contains(err.Error(), "leaked-token") || !strings.Contains(err.Error(), "bad credentials") {
+		t.Errorf("Expected the failure to show stderr but not the token, got %v", err)
+	}
+	if failing.current() != "" {
+		t.Error("Expected no token after a failed command")
+	}
+
+	config.AuthTokenCommand = "sleep 5"
+	config.AuthTokenTimeout = 50 * time.Millisecond
+	if err := newCommandToken(config).Refresh(ctx); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("Expected the command to time out, got %v", err)
+	}
+}
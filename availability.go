@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// historicalReport is a report loaded from the history directory
+type historicalReport struct {
+	At     time.Time
+	Path   string
+	Report Report
+}
+
+// AvailabilitySummary describes an application/version over a window of
+// historical reports
+type AvailabilitySummary struct {
+	Application string
+	Version     string
+	// AverageSuccessRate is the time-weighted average success rate in percent
+	AverageSuccessRate float64
+	// MinSuccessRate is the lowest success rate seen in any report
+	MinSuccessRate float64
+	// RequestVolume is the growth of the request counter across the window
+	RequestVolume int64
+	// Reports is the number of reports the application/version appears in
+	Reports int
+	// EverBelowThreshold is set when any report was below the threshold
+	EverBelowThreshold bool
+}
+
+// loadReport reads a JSON report from path, decompressing it when gzipped,
+// nesting it again when it was flattened and wrapping it when it is a bare
+// application and version map
+func loadReport(path string) (Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Report{}, err
+	}
+	if data, err = maybeGunzip(data); err != nil {
+		return Report{}, fmt.Errorf("failed to decompress report %s: %v", path, err)
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return Report{}, fmt.Errorf("failed to decode report %s: %v", path, err)
+	}
+	if _, enveloped := fields["schemaVersion"]; !enveloped {
+		var applications map[string]map[string]AggregatedData
+		if err := json.Unmarshal(data, &applications); err != nil {
+			return Report{}, fmt.Errorf("failed to decode report %s: %v", path, err)
+		}
+		return Report{Applications: applications}, nil
+	}
+	var report flatReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return Report{}, fmt.Errorf("failed to decode report %s: %v", path, err)
+	}
+	return report.nested(), nil
+}
+
+// loadHistory reads every timestamped JSON report in dir, oldest first
+func loadHistory(dir string) ([]historicalReport, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var history []historicalReport
+	for _, match := range matches {
+		at, ok := parseHistoryTimestamp(match)
+		if !ok {
+			continue
+		}
+		report, err := loadReport(match)
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, historicalReport{At: at, Path: match, Report: report})
+	}
+	sort.Slice(history, func(i, j int) bool { return history[i].At.Before(history[j].At) })
+	return history, nil
+}
+
+// computeAvailability summarises each application/version across the history.
+// Every report is weighted by the time until the next one; the last report
+// reuses the preceding interval. Request counters are cumulative, so the
+// volume is their growth between the first and last report, or the last value
+// if the counter was reset in between.
+func computeAvailability(history []historicalReport, threshold float64) []AvailabilitySummary {
+	type accumulator struct {
+		summary      AvailabilitySummary
+		weightedRate float64
+		totalWeight  float64
+		firstCount   int64
+		lastCount    int64
+	}
+	accumulators := make(map[string]map[string]*accumulator)
+
+	for i, entry := range history {
+		weight := 1.0
+		if i+1 < len(history) {
+			weight = history[i+1].At.Sub(entry.At).Seconds()
+		} else if i > 0 {
+			weight = entry.At.Sub(history[i-1].At).Seconds()
+		}
+
+		for app, versions := range entry.Report.Applications {
+			if accumulators[app] == nil {
+				accumulators[app] = make(map[string]*accumulator)
+			}
+			for version, data := range versions {
+				acc := accumulators[app][version]
+				rate := successRate(data)
+				if acc == nil {
+					acc = &accumulator{firstCount: data.TotalRequests}
+					acc.summary = AvailabilitySummary{Application: app, Version: version, MinSuccessRate: rate}
+					accumulators[app][version] = acc
+				}
+				acc.weightedRate += rate * weight
+				acc.totalWeight += weight
+				acc.lastCount = data.TotalRequests
+				acc.summary.Reports++
+				if rate < acc.summary.MinSuccessRate {
+					acc.summary.MinSuccessRate = rate
+				}
+				if rate < threshold {
+					acc.summary.EverBelowThreshold = true
+				}
+			}
+		}
+	}
+
+	var summaries []AvailabilitySummary
+	for _, versions := range accumulators {
+		for _, acc := range versions {
+			if acc.totalWeight > 0 {
+				acc.summary.AverageSuccessRate = acc.weightedRate / acc.totalWeight
+			}
+			acc.summary.RequestVolume = acc.lastCount - acc.firstCount
+			if acc.summary.RequestVolume < 0 {
+				acc.summary.RequestVolume = acc.lastCount
+			}
+			summaries = append(summaries, acc.summary)
+		}
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].Application != summaries[j].Application {
+			return summaries[i].Application < summaries[j].Application
+		}
+		return summaries[i].Version < summaries[j].Version
+	})
+	return summaries
+}
+
+// runAvailability implements the availability command, which summarises the
+// timestamped reports written by KEEP_HISTORY
+func runAvailability(args []string, config *Config, out io.Writer) error {
+	flags := flag.NewFlagSet("availability", flag.ContinueOnError)
+	dir := flags.String("dir", ".", "directory holding the timestamped reports")
+	threshold := flags.Float64("threshold", config.WarningThreshold, "success rate percentage to flag")
+	asJSON := flags.Bool("json", false, "print the summary as JSON")
+	strictSchema := flags.Bool("strict-schema", false, "refuse to summarise reports with different schema versions")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	history, err := loadHistory(*dir)
+	if err != nil {
+		return err
+	}
+	if len(history) == 0 {
+		return fmt.Errorf("no timestamped reports found in %s", *dir)
+	}
+	if *strictSchema {
+		names := make([]string, len(history))
+		reports := make([]Report, len(history))
+		for i, entry := range history {
+			names[i], reports[i] = entry.Path, entry.Report
+		}
+		if err := checkSchemaVersions(names, reports); err != nil {
+			return err
+		}
+	}
+	summaries := computeAvailability(history, *threshold)
+
+	if *asJSON {
+		data, err := json.MarshalIndent(summaries, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(out, string(data))
+		return nil
+	}
+
+	fmt.Fprintf(out, "Availability over %d reports from %s to %s:\n", len(history),
+		history[0].At.Format(time.RFC3339), history[len(history)-1].At.Format(time.RFC3339))
+	for _, s := range summaries {
+		flagged := ""
+		if s.EverBelowThreshold {
+			flagged = fmt.Sprintf(" [below %.2f%% at least once]", *threshold)
+		}
+		fmt.Fprintf(out, "  Application: %s, Version: %s, Average Success Rate: %.2f%%, Min: %.2f%%, Requests: %d%s\n",
+			s.Application, s.Version, s.AverageSuccessRate, s.MinSuccessRate, s.RequestVolume, flagged)
+	}
+	return nil
+}
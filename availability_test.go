@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test window averages computed from synthetic historical reports
+func TestComputeAvailability(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "report.json")
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	snapshots := []struct {
+		offset    time.Duration
+		requests  int64
+		successes int64
+	}{
+		{0, 1000, 1000},
+		{10 * time.Minute, 2000, 1800},
+		{40 * time.Minute, 3000, 2400},
+	}
+	for _, snap := range snapshots {
+		report := Report{Applications: map[string]map[string]AggregatedData{
+			"Memcache2": {"1.0.1": {Application: "Memcache2", Version: "1.0.1", TotalRequests: snap.requests, TotalSuccesses: snap.successes}},
+			"Cassandra": {"2.0.0": {Application: "Cassandra", Version: "2.0.0", TotalRequests: snap.requests, TotalSuccesses: snap.requests}},
+		}}
+		data, err := json.Marshal(report)
+		if err != nil {
+			t.Fatalf("Failed to encode report: %v", err)
+		}
+		if err := saveReportWithHistory(path, data, 10, start.Add(snap.offset)); err != nil {
+			t.Fatalf("Failed to write report: %v", err)
+		}
+	}
+
+	history, err := loadHistory(dir)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	// report.json itself carries no timestamp and must be skipped
+	if len(history) != 3 {
+		t.Fatalf("Expected 3 historical reports, got %d", len(history))
+	}
+
+	summaries := computeAvailability(history, 85)
+	if len(summaries) != 2 {
+		t.Fatalf("Expected 2 summaries, got %d", len(summaries))
+	}
+
+	cassandra, memcache := summaries[0], summaries[1]
+	if cassandra.AverageSuccessRate != 100 || cassandra.EverBelowThreshold {
+		t.Errorf("Expected Cassandra at 100%% and never flagged, got %+v", cassandra)
+	}
+
+	// Rates 100%, 90% and 80% weighted by 10, 30 and 30 minutes
+	expected := (100*10 + 90*30 + 80*30) / 70.0
+	if math.Abs(memcache.AverageSuccessRate-expected) > 1e-9 {
+		t.Errorf("Expected average success rate %.4f, got %.4f", expected, memcache.AverageSuccessRate)
+	}
+	if memcache.MinSuccessRate != 80 || !memcache.EverBelowThreshold {
+		t.Errorf("Expected a minimum of 80%% flagged below threshold, got %+v", memcache)
+	}
+	if memcache.RequestVolume != 2000 || memcache.Reports != 3 {
+		t.Errorf("Expected 2000 requests over 3 reports, got %d over %d", memcache.RequestVolume, memcache.Reports)
+	}
+}
+
+// Test that reports carry a schema version and that strict mode rejects a
+// window mixing schema versions
+func TestAvailabilityStrictSchema(t *testing.T) {
+	report := buildReport(aggregateData(nil), nil, NewDefaultConfig())
+	if report.SchemaVersion != reportSchemaVersion {
+		t.Fatalf("Expected schemaVersion %d, got %d", reportSchemaVersion, report.SchemaVersion)
+	}
+	data, err := json.Marshal(report)
+	if err != nil {
+		t.Fatalf("Failed to encode report: %v", err)
+	}
+	if !strings.Contains(string(data), `"schemaVersion":2`) {
+		t.Errorf("Expected schemaVersion in the encoded report, got %s", data)
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "report.json")
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	legacy := []byte(`{"applications":{}}`)
+	if err := saveReportWithHistory(path, legacy, 10, start); err != nil {
+		t.Fatalf("Failed to write report: %v", err)
+	}
+	if err := saveReportWithHistory(path, data, 10, start.Add(time.Minute)); err != nil {
+		t.Fatalf("Failed to write report: %v", err)
+	}
+
+	config := NewDefaultConfig()
+	var out bytes.Buffer
+	if err := runAvailability([]string{"-dir", dir}, config, &out); err != nil {
+		t.Errorf("Expected mixed schemas to be accepted without -strict-schema, got %v", err)
+	}
+	err = runAvailability([]string{"-dir", dir, "-strict-schema"}, config, &out)
+	if err == nil || !strings.Contains(err.Error(), "schemaVersion 2") || !strings.Contains(err.Error(), "schemaVersion 0") {
+		t.Errorf("Expected a schema mismatch error, got %v", err)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+)
+
+// BaselineRegression is an application/version whose success rate dropped
+// below that of the BASELINE_FILE report by more than REGRESSION_TOLERANCE
+type BaselineRegression struct {
+	Application  string  `json:"application"`
+	Version      string  `json:"version"`
+	BaselineRate float64 `json:"baselineSuccessRate"`
+	CurrentRate  float64 `json:"currentSuccessRate"`
+}
+
+// String describes the regression for the console
+func (r BaselineRegression) String() string {
+	return fmt.Sprintf("Application: %s, Version: %s, Success Rate: %.2f%% (baseline %.2f%%, -%.2f points)",
+		r.Application, r.Version, r.CurrentRate, r.BaselineRate, r.BaselineRate-r.CurrentRate)
+}
+
+// findRegressions compares the current records with the baseline's and
+// returns those whose success rate dropped by more than tolerance percentage
+// points, sorted by application and version. Records missing from the
+// baseline are new and ignored, as are records with insufficient data or no
+// requests on either side.
+func findRegressions(baseline, current map[string]map[string]AggregatedData, tolerance float64) []BaselineRegression {
+	var regressions []BaselineRegression
+	for _, data := range sortedRecords(current) {
+		before, ok := baseline[data.Application][data.Version]
+		if !ok || before.TotalRequests == 0 || data.TotalRequests == 0 {
+			continue
+		}
+		if before.Severity == SeverityInsufficientData || data.Severity == SeverityInsufficientData {
+			continue
+		}
+		if rate, baselineRate := successRate(data), successRate(before); baselineRate-rate > tolerance {
+			regressions = append(regressions, BaselineRegression{
+				Application:  data.Application,
+				Version:      data.Version,
+				BaselineRate: baselineRate,
+				CurrentRate:  rate,
+			})
+		}
+	}
+	return regressions
+}
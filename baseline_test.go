@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Test that a run regressed from the committed baseline fails with
+// FAIL_ON_REGRESSION, ignoring versions the baseline does not know
+func TestBaselineRegression(t *testing.T) {
+	server := setupMockServer()
+	defer server.Close()
+	dir := t.TempDir()
+	serversFile := filepath.Join(dir, "servers.txt")
+	if err := os.WriteFile(serversFile, []byte(server.URL+"\n"), 0644); err != nil {
+		t.Fatalf("Failed to write servers file: %v", err)
+	}
+
+	// The mock server reports 79.93% for Memcache2 1.0.1
+	baseline := Report{Applications: map[string]map[string]AggregatedData{
+		"Memcache2": {"1.0.1": {Application: "Memcache2", Version: "1.0.1", TotalRequests: 1000, TotalSuccesses: 990, Severity: SeverityWarning}},
+	}}
+	baselineFile := filepath.Join(dir, "baseline.json")
+	data, _ := json.Marshal(baseline)
+	if err := os.WriteFile(baselineFile, data, 0644); err != nil {
+		t.Fatalf("Failed to write baseline: %v", err)
+	}
+
+	scan := func(configure func(*Config)) error {
+		config := NewDefaultConfig()
+		config.ServersFile = serversFile
+		config.OutputFile = filepath.Join(dir, "report.json")
+		config.FailuresFile = ""
+		config.RequestDelay = 0
+		config.BaselineFile = baselineFile
+		config.ReportEnvelope = true
+		configure(config)
+		return runScan(nil, config, io.Discard)
+	}
+
+	err := scan(func(config *Config) { config.FailOnRegression = true })
+	exitErr, ok := err.(*exitError)
+	if !ok || exitErr.code != exitCodePolicyFailed {
+		t.Fatalf("Expected the regression to fail the run, got %v", err)
+	}
+	report, err := loadReport(filepath.Join(dir, "report.json"))
+	if err != nil {
+		t.Fatalf("Failed to load report: %v", err)
+	}
+	if len(report.BaselineRegressions) != 1 || report.BaselineRegressions[0].BaselineRate != 99 {
+		t.Errorf("Expected Memcache2 1.0.1 to be reported as regressed, got %+v", report.BaselineRegressions)
+	}
+
+	if err := scan(func(config *Config) {}); err != nil {
+		t.Errorf("Expected regressions to only be reported without FAIL_ON_REGRESSION, got %v", err)
+	}
+	if err := scan(func(config *Config) {
+		config.FailOnRegression = true
+		config.RegressionTolerance = 20
+	}); err != nil {
+		t.Errorf("Expected a drop within the tolerance to pass, got %v", err)
+	}
+
+	current := map[string]map[string]AggregatedData{
+		"Memcache2": {"1.0.2": {Application: "Memcache2", Version: "1.0.2", TotalRequests: 100, TotalSuccesses: 10}},
+	}
+	if regressions := findRegressions(baseline.Applications, current, 1); len(regressions) != 0 {
+		t.Errorf("Expected a version missing from the baseline to be ignored, got %+v", regressions)
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// bastionDialer tunnels connections to the servers through an SSH bastion.
+// A single SSH client is shared by every connection of the run; it is dialed
+// on first use and redialed if the bastion connection drops.
+type bastionDialer struct {
+	addr      string
+	sshConfig *ssh.ClientConfig
+
+	mu     sync.Mutex
+	client *ssh.Client
+}
+
+// newBastionDialer prepares a dialer for BASTION_HOST, authenticating as
+// BASTION_USER with the private key in BASTION_KEY_FILE. The bastion's host
+// key is checked against BASTION_KNOWN_HOSTS unless BASTION_INSECURE_HOST_KEY
+// is set.
+func newBastionDialer(config *Config) (*bastionDialer, error) {
+	if config.BastionUser == "" || config.BastionKeyFile == "" {
+		return nil, fmt.Errorf("BASTION_HOST requires BASTION_USER and BASTION_KEY_FILE")
+	}
+	key, err := os.ReadFile(config.BastionKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bastion key: %v", err)
+	}
+	signer, err := ssh.ParsePrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse bastion key %s: %v", config.BastionKeyFile, err)
+	}
+
+	var hostKeyCallback ssh.HostKeyCallback
+	switch {
+	case config.BastionInsecureHostKey:
+		hostKeyCallback = ssh.InsecureIgnoreHostKey()
+	case config.BastionKnownHosts != "":
+		if hostKeyCallback, err = knownhosts.New(config.BastionKnownHosts); err != nil {
+			return nil, fmt.Errorf("failed to load bastion known hosts: %v", err)
+		}
+	default:
+		return nil, fmt.Errorf("BASTION_HOST requires BASTION_KNOWN_HOSTS or BASTION_INSECURE_HOST_KEY")
+	}
+
+	addr := config.BastionHost
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "22")
+	}
+	timeout := config.ConnectTimeout
+	if timeout <= 0 {
+		timeout = config.HTTPTimeout
+	}
+	return &bastionDialer{
+		addr: addr,
+		sshConfig: &ssh.ClientConfig{
+			User:            config.BastionUser,
+			Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+			HostKeyCallback: hostKeyCallback,
+			Timeout:         timeout,
+		},
+	}, nil
+}
+
+// sshClient returns the shared SSH client, dialing the bastion if needed
+func (d *bastionDialer) sshClient() (*ssh.Client, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.client != nil {
+		return d.client, nil
+	}
+	client, err := ssh.Dial("tcp", d.addr, d.sshConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to bastion %s: %v", d.addr, err)
+	}
+	d.client = client
+	go func() {
+		// Forget the client once the bastion connection drops so the next
+		// dial reconnects
+		client.Wait()
+		d.mu.Lock()
+		if d.client == client {
+			d.client = nil
+		}
+		d.mu.Unlock()
+	}()
+	return client, nil
+}
+
+// DialContext opens a connection to addr forwarded by the bastion
+func (d *bastionDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	client, err := d.sshClient()
+	if err != nil {
+		return nil, err
+	}
+	return client.DialContext(ctx, network, addr)
+}
+
+// LookupIPAddr resolves host on the bastion, which may see names the scanner
+// cannot, so the addresses it tunnels to can be checked against DENY_CIDRS.
+// The bastion must be able to run getent. Only plain host names are looked up
+// since the name is passed to a remote command.
+func (d *bastionDialer) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	if !isPlainHostName(host) {
+		return nil, fmt.Errorf("refusing to resolve %q on the bastion", host)
+	}
+	client, err := d.sshClient()
+	if err != nil {
+		return nil, err
+	}
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s on the bastion: %v", host, err)
+	}
+	defer session.Close()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			session.Close()
+		case <-done:
+		}
+	}()
+	output, err := session.Output("getent ahosts " + host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s on the bastion: %v", host, err)
+	}
+
+	// Each line holds an address, a socket type and the name; every address
+	// is listed once per socket type
+	var addrs []net.IPAddr
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || seen[fields[0]] {
+			continue
+		}
+		if ip := net.ParseIP(fields[0]); ip != nil {
+			seen[fields[0]] = true
+			addrs = append(addrs, net.IPAddr{IP: ip})
+		}
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no addresses found for %s on the bastion", host)
+	}
+	return addrs, nil
+}
+
+// isPlainHostName reports whether host consists of letters, digits, dots,
+// hyphens and underscores only
+func isPlainHostName(host string) bool {
+	if host == "" || strings.HasPrefix(host, "-") {
+		return false
+	}
+	for _, r := range host {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Close closes the shared SSH client
+func (d *bastionDialer) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.client == nil {
+		return nil
+	}
+	err := d.client.Close()
+	d.client = nil
+	return err
+}
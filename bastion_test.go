@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// testBastionHosts are the names the test bastion resolves with getent
+var testBastionHosts = map[string]string{
+	"health.internal":   "127.0.0.1",
+	"metadata.internal": "169.254.169.254",
+}
+
+// serveTestGetent answers a "getent ahosts" exec request on a session
+// channel from testBastionHosts
+func serveTestGetent(newChannel ssh.NewChannel) {
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		return
+	}
+	defer channel.Close()
+	for req := range requests {
+		if req.Type != "exec" {
+			req.Reply(false, nil)
+			continue
+		}
+		var exec struct{ Command string }
+		ssh.Unmarshal(req.Payload, &exec)
+		req.Reply(true, nil)
+		status := uint32(2)
+		if ip, ok := testBastionHosts[strings.TrimPrefix(exec.Command, "getent ahosts ")]; ok {
+			fmt.Fprintf(channel, "%s STREAM\n%s DGRAM\n", ip, ip)
+			status = 0
+		}
+		channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+		return
+	}
+}
+
+// startTestBastion runs an SSH server on a local port that accepts
+// clientKey, forwards direct-tcpip channels, counting them, and resolves
+// testBastionHosts
+func startTestBastion(t *testing.T, clientKey ssh.PublicKey) (string, ssh.PublicKey, *int32) {
+	_, hostPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate host key: %v", err)
+	}
+	hostSigner, err := ssh.NewSignerFromKey(hostPriv)
+	if err != nil {
+		t.Fatalf("Failed to create host signer: %v", err)
+	}
+	serverConfig := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if conn.User() == "probe" && string(key.Marshal()) == string(clientKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, io.EOF
+		},
+	}
+	serverConfig.AddHostKey(hostSigner)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	var forwarded int32
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, channels, requests, err := ssh.NewServerConn(conn, serverConfig)
+				if err != nil {
+					conn.Close()
+					return
+				}
+				go ssh.DiscardRequests(requests)
+				for newChannel := range channels {
+					if newChannel.ChannelType() == "session" {
+						go serveTestGetent(newChannel)
+						continue
+					}
+					if newChannel.ChannelType() != "direct-tcpip" {
+						newChannel.Reject(ssh.UnknownChannelType, "unsupported")
+						continue
+					}
+					// The payload starts with the target host and port
+					payload := newChannel.ExtraData()
+					hostLen := binary.BigEndian.Uint32(payload)
+					host := string(payload[4 : 4+hostLen])
+					port := binary.BigEndian.Uint32(payload[4+hostLen:])
+					target, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(int(port))))
+					if err != nil {
+						newChannel.Reject(ssh.ConnectionFailed, err.Error())
+						continue
+					}
+					channel, channelRequests, err := newChannel.Accept()
+					if err != nil {
+						target.Close()
+						continue
+					}
+					atomic.AddInt32(&forwarded, 1)
+					go ssh.DiscardRequests(channelRequests)
+					go func() {
+						io.Copy(channel, target)
+						channel.Close()
+					}()
+					go func() {
+						io.Copy(target, channel)
+						target.Close()
+					}()
+				}
+			}()
+		}
+	}()
+	return listener.Addr().String(), hostSigner.PublicKey(), &forwarded
+}
+
+// Test that health checks are tunneled through an SSH bastion
+func TestBastionTunnel(t *testing.T) {
+	server := setupMockServer()
+	defer server.Close()
+
+	clientPub, clientPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate client key: %v", err)
+	}
+	sshClientPub, err := ssh.NewPublicKey(clientPub)
+	if err != nil {
+		t.Fatalf("Failed to convert client key: %v", err)
+	}
+	bastionAddr, hostKey, forwarded := startTestBastion(t, sshClientPub)
+
+	dir := t.TempDir()
+	block, err := ssh.MarshalPrivateKey(clientPriv, "")
+	if err != nil {
+		t.Fatalf("Failed to marshal client key: %v", err)
+	}
+	keyFile := filepath.Join(dir, "id_ed25519")
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatalf("Failed to write client key: %v", err)
+	}
+	knownHostsFile := filepath.Join(dir, "known_hosts")
+	if err := os.WriteFile(knownHostsFile, []byte(knownhosts.Line([]string{bastionAddr}, hostKey)+"\n"), 0600); err != nil {
+		t.Fatalf("Failed to write known hosts: %v", err)
+	}
+
+	config := NewDefaultConfig()
+	config.RequestDelay = 0
+	config.BastionHost = bastionAddr
+	config.BastionUser = "probe"
+	config.BastionKeyFile = keyFile
+	config.BastionKnownHosts = knownHostsFile
+	bastion, err := newBastionDialer(config)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer bastion.Close()
+	state := &scanState{bastion: bastion}
+
+	servers := []ServerEntry{{Address: server.URL}, {Address: server.URL + "/?second"}}
+	resultChannel := make(chan ServerResult, len(servers))
+	go fetchHealthDataWithDelayAndConcurrency(context.Background(), servers, resultChannel, config, state)
+	for result := range resultChannel {
+		if result.Error != "" || result.Health == nil {
+			t.Errorf("Expected a health check through the bastion, got %+v", result)
+		}
+	}
+	if atomic.LoadInt32(forwarded) == 0 {
+		t.Errorf("Expected connections to be forwarded by the bastion")
+	}
+
+	// Names are resolved on the bastion and checked against the denied
+	// ranges before a connection is tunneled
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	servers = []ServerEntry{
+		{Address: "http://health.internal:" + port},
+		{Address: "http://metadata.internal:" + port},
+		{Address: "http://bad;name:" + port},
+	}
+	results := make(map[string]ServerResult)
+	resultChannel = make(chan ServerResult, len(servers))
+	go fetchHealthDataWithDelayAndConcurrency(context.Background(), servers, resultChannel, config, state)
+	for result := range resultChannel {
+		results[result.Server] = result
+	}
+	if result := results[servers[0].Address]; result.Error != "" {
+		t.Errorf("Expected a name resolved by the bastion to be checked, got %+v", result)
+	}
+	if result := results[servers[1].Address]; result.ErrorClass != ErrorClassDenied {
+		t.Errorf("Expected a name resolving to the metadata endpoint to be denied, got %+v", result)
+	}
+	if result := results[servers[2].Address]; result.Error == "" {
+		t.Errorf("Expected a name unsafe to pass to the bastion to be refused, got %+v", result)
+	}
+
+	// An unknown host key is refused
+	if err := os.WriteFile(knownHostsFile, nil, 0600); err != nil {
+		t.Fatalf("Failed to write known hosts: %v", err)
+	}
+	untrusted, err := newBastionDialer(config)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := untrusted.DialContext(context.Background(), "tcp", server.Listener.Addr().String()); err == nil {
+		t.Errorf("Expected a bastion with an unknown host key to be refused")
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// redactedValue replaces credentials found in logged response bodies
+const redactedValue = "[REDACTED]"
+
+// bodyRedactions match credentials that should never end up in logs: bearer
+// tokens and the values of token, secret, password and key fields in JSON or
+// form encoded bodies. The first group is kept.
+var bodyRedactions = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9._~+/=-]+`),
+	regexp.MustCompile(`(?i)("?[a-z_]*(?:token|secret|password|passwd|api[_-]?key|authorization)"?\s*[:=]\s*"?)[^"&,\s}]+`),
+}
+
+// redactBody masks the credentials in body
+func redactBody(body string) string {
+	for _, re := range bodyRedactions {
+		body = re.ReplaceAllString(body, "${1}"+redactedValue)
+	}
+	return body
+}
+
+// bodySnippet returns body redacted and capped at limit bytes for inclusion
+// in an error message
+func bodySnippet(body []byte, limit int) string {
+	if limit == 0 {
+		return "(body omitted)"
+	}
+	snippet := redactBody(string(body))
+	if len(snippet) <= limit {
+		return snippet
+	}
+	return fmt.Sprintf("%s... (%d more bytes)", snippet[:limit], len(snippet)-limit)
+}
+
+// debugBodyPath returns the file in dir the body of serverURL is saved to;
+// characters other than letters, digits, dots and dashes become underscores
+func debugBodyPath(dir, serverURL string) string {
+	name := strings.TrimPrefix(strings.TrimPrefix(serverURL, "https://"), "http://")
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+	return filepath.Join(dir, name+".body")
+}
+
+// saveDebugBody writes the full, unredacted body of serverURL's response to
+// DEBUG_BODY_DIR, replacing the one saved by a previous check
+func saveDebugBody(dir, serverURL string, body []byte) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(debugBodyPath(dir, serverURL), body, 0600)
+}
+
+// logDebugBody saves body with saveDebugBody, logging a failure to save it
+func logDebugBody(config *Config, serverURL string, body []byte) {
+	if err := saveDebugBody(config.DebugBodyDir, serverURL, body); err != nil {
+		fmt.Fprintf(config.Console, "Error saving response body of %s: %v\n", serverURL, err)
+	}
+}
+
+// encodeRawBody returns body as a string for the raw results, base64 encoded
+// along with its encoding when it is not valid UTF-8 and would not survive
+// JSON encoding intact
+func encodeRawBody(body []byte) (string, string) {
+	if utf8.Valid(body) {
+		return string(body), ""
+	}
+	return base64.StdEncoding.EncodeToString(body), "base64"
+}
+
+// lastJSONValue returns the last of the JSON values making up a streamed
+// body, e.g. progress objects followed by the final health object, whether
+// they are newline delimited or simply concatenated
+func lastJSONValue(body []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	var last json.RawMessage
+	for {
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		last = value
+	}
+	if last == nil {
+		return nil, fmt.Errorf("stream ended without a JSON value")
+	}
+	return last, nil
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test that logged bodies are redacted and truncated
+func TestBodySnippet(t *testing.T) {
+	body := []byte(`{"error": "denied", "access_token": "abc123", "auth": "Bearer eyJhbGciOi.payload.sig"}`)
+	snippet := bodySnippet(body, 1000)
+	if strings.Contains(snippet, "abc123") || strings.Contains(snippet, "eyJhbGciOi") {
+		t.Errorf("Expected credentials to be redacted, got %s", snippet)
+	}
+	if !strings.Contains(snippet, `"access_token": "[REDACTED]"`) || !strings.Contains(snippet, "Bearer [REDACTED]") {
+		t.Errorf("Expected redaction markers, got %s", snippet)
+	}
+
+	long := []byte(strings.Repeat("x", 100))
+	if got := bodySnippet(long, 10); got != strings.Repeat("x", 10)+"... (90 more bytes)" {
+		t.Errorf("Expected truncation to 10 bytes, got %s", got)
+	}
+	if got := bodySnippet(long, 0); got != "(body omitted)" {
+		t.Errorf("Expected the body to be omitted, got %s", got)
+	}
+}
+
+// Test that the full body of an invalid response is saved to DEBUG_BODY_DIR
+// while the error message carries only a truncated snippet
+func TestDebugBodySaved(t *testing.T) {
+	body := `{"application": "Memcache2", ` + strings.Repeat(`"padding": "xxxxxxxxxx", `, 50)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	config := NewDefaultConfig()
+	config.HealthMethod = http.MethodGet
+	config.BodyLogLimit = 32
+	config.DebugBodyDir = t.TempDir()
+
+	_, _, err := fetchHealthData(context.Background(), server.Client(), server.URL+"/healthz", config)
+	if classifyError(err) != ErrorClassDecode {
+		t.Fatalf("Expected a decode error, got %v", err)
+	}
+	if strings.Contains(err.Error(), body) || !strings.Contains(err.Error(), "more bytes") {
+		t.Errorf("Expected a truncated body in the error, got %v", err)
+	}
+
+	saved, err := os.ReadFile(debugBodyPath(config.DebugBodyDir, server.URL+"/healthz"))
+	if err != nil {
+		t.Fatalf("Expected the body to be saved, got %v", err)
+	}
+	if string(saved) != body {
+		t.Errorf("Expected the full body to be saved, got %q", saved)
+	}
+
+	// A body that decodes but fails validation is saved as well
+	empty := `{"application": "", "version": "1.0.1", "requestCount": 10, "successCount": 10}`
+	invalid := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(empty))
+	}))
+	defer invalid.Close()
+	config.EmptyAppPolicy = EmptyPolicyError
+	config.RequestDelay = 0
+	results := collectResults([]ServerEntry{{Address: invalid.URL}}, config)
+	if results[0].ErrorClass != ErrorClassInvalidResponse {
+		t.Fatalf("Expected an invalid response, got %+v", results[0])
+	}
+	saved, err = os.ReadFile(debugBodyPath(config.DebugBodyDir, results[0].URL))
+	if err != nil || string(saved) != empty {
+		t.Errorf("Expected the invalid body to be saved, got %q, %v", saved, err)
+	}
+}
+
+// Test that a body beyond MAX_BODY_BYTES fails the check instead of being
+// read without bound
+func TestMaxBodyBytes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(mockResponse))
+		w.Write([]byte(strings.Repeat(" ", 1<<20)))
+	}))
+	defer server.Close()
+
+	config := NewDefaultConfig()
+	if _, _, err := fetchHealthData(context.Background(), newHTTPClient(config), server.URL, config); classifyError(err) != ErrorClassInvalidResponse {
+		t.Errorf("Expected a body beyond MAX_BODY_BYTES to be refused, got %v", err)
+	}
+
+	config.MaxBodyBytes = 2 << 20
+	if _, _, err := fetchHealthData(context.Background(), newHTTPClient(config), server.URL, config); err != nil {
+		t.Errorf("Expected a body within MAX_BODY_BYTES to be decoded, got %v", err)
+	}
+}
+
+// Test that the raw body is kept per server when INCLUDE_RAW_BODY is enabled
+func TestIncludeRawBody(t *testing.T) {
+	server := setupMockServer()
+	defer server.Close()
+
+	config := NewDefaultConfig()
+	config.RequestDelay = 0
+	results := collectResults([]ServerEntry{{Address: server.URL}}, config)
+	if results[0].RawBody != "" {
+		t.Errorf("Expected no raw body by default, got %q", results[0].RawBody)
+	}
+
+	config.IncludeRawBody = true
+	results = collectResults([]ServerEntry{{Address: server.URL}}, config)
+	if results[0].RawBody != mockResponse || results[0].RawBodyEncoding != "" || results[0].RawBodyTruncated {
+		t.Errorf("Expected the mock response as the raw body, got %+v", results[0])
+	}
+
+	config.MaxBodyBytes = 10
+	results = collectResults([]ServerEntry{{Address: server.URL}}, config)
+	if results[0].RawBody != mockResponse[:10] || !results[0].RawBodyTruncated {
+		t.Errorf("Expected the raw body cut at 10 bytes, got %q", results[0].RawBody)
+	}
+
+	// The body of an error status is read no further than the cap either
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(strings.Repeat("x", 1<<20)))
+	}))
+	defer failing.Close()
+	_, meta, _ := fetchHealthData(context.Background(), newHTTPClient(config), failing.URL, config)
+	if string(meta.Body) != "xxxxxxxxxx" || !meta.BodyTruncated {
+		t.Errorf("Expected the error body cut at 10 bytes, got %q", meta.Body)
+	}
+
+	if body, encoding := encodeRawBody([]byte{0xff, 0xfe}); body != "//4=" || encoding != "base64" {
+		t.Errorf("Expected invalid UTF-8 to be base64 encoded, got %q (%s)", body, encoding)
+	}
+}
+
+// Test that a health response streamed in chunks is read to its end and its
+// final JSON object decoded
+func TestHealthStreaming(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flusher := w.(http.Flusher)
+		for _, chunk := range []string{
+			`{"application": "Memcache2", "progress": "checking db"}` + "\n",
+			`{"application": "Memcache2", "progress": "checking ca`,
+			`che"}` + "\n",
+			mockResponse,
+		} {
+			w.Write([]byte(chunk))
+			flusher.Flush()
+			time.Sleep(5 * time.Millisecond)
+		}
+	}))
+	defer server.Close()
+
+	config := NewDefaultConfig()
+	config.HealthStreaming = true
+	health, _, err := fetchHealthData(context.Background(), newHTTPClient(config), server.URL, config)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if health.Version != "1.0.1" || health.RequestCount != 5194800029 {
+		t.Errorf("Expected the final object to be decoded, got %+v", health)
+	}
+
+	// Without streaming only the first object is decoded
+	config.HealthStreaming = false
+	if health, _, _ := fetchHealthData(context.Background(), newHTTPClient(config), server.URL, config); health.RequestCount != 0 {
+		t.Errorf("Expected the first object without HEALTH_STREAMING, got %+v", health)
+	}
+
+	config.HealthStreaming = true
+	config.MaxBodyBytes = 64
+	if _, _, err := fetchHealthData(context.Background(), newHTTPClient(config), server.URL, config); classifyError(err) != ErrorClassInvalidResponse {
+		t.Errorf("Expected a stream beyond MAX_BODY_BYTES to be refused, got %v", err)
+	}
+
+	if _, err := lastJSONValue([]byte(`{"a": 1} {"b": `)); err == nil {
+		t.Error("Expected a stream cut mid-object to fail")
+	}
+}
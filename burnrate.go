@@ -0,0 +1,126 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+// burnSample is a snapshot of the cumulative counters of an application/version
+type burnSample struct {
+	At        time.Time
+	Requests  int64
+	Successes int64
+}
+
+// BurnAlert is raised when an application/version burns its error budget too
+// fast over both the short and the long window
+type BurnAlert struct {
+	Application   string
+	Version       string
+	ShortBurnRate float64
+	LongBurnRate  float64
+}
+
+// burnRateTracker implements multiwindow burn-rate alerting. Health endpoints
+// report cumulative counters, so the error rate over a window is derived from
+// the counter deltas between the oldest sample in the window and the newest.
+type burnRateTracker struct {
+	budget      float64
+	factor      float64
+	shortWindow time.Duration
+	longWindow  time.Duration
+	samples     map[string]map[string][]burnSample
+	// counters works out the traffic between cycles for RecordResults
+	counters *requestDeltaTracker
+}
+
+// newBurnRateTracker creates a tracker for the configured SLO target
+func newBurnRateTracker(config *Config) *burnRateTracker {
+	return &burnRateTracker{
+		budget:      1 - config.SLOTarget/100,
+		factor:      config.BurnRateFactor,
+		shortWindow: config.BurnShortWindow,
+		longWindow:  config.BurnLongWindow,
+		samples:     make(map[string]map[string][]burnSample),
+		counters:    newRequestDeltaTracker(config.CounterResetGrace),
+	}
+}
+
+// Record stores the counters of a cycle's aggregation and forgets samples
+// older than the long window
+func (b *burnRateTracker) Record(aggregation map[string]map[string]AggregatedData, now time.Time) {
+	for app, versions := range aggregation {
+		if _, exists := b.samples[app]; !exists {
+			b.samples[app] = make(map[string][]burnSample)
+		}
+		for version, data := range versions {
+			samples := append(b.samples[app][version], burnSample{
+				At:        now,
+				Requests:  data.TotalRequests,
+				Successes: data.TotalSuccesses,
+			})
+			for len(samples) > 1 && now.Sub(samples[0].At) > b.longWindow {
+				samples = samples[1:]
+			}
+			b.samples[app][version] = samples
+		}
+	}
+}
+
+// RecordResults stores the counters of a cycle's results. The samples sum the
+// traffic each server served since the previous cycle rather than the
+// cumulative counters, which go down when an instance restarts and would skew
+// or invert the rates of every window spanning the restart.
+func (b *burnRateTracker) RecordResults(results []ServerResult, now time.Time) {
+	b.counters.Observe(results, now)
+	b.Record(b.counters.Totals(), now)
+}
+
+// burnRate returns the burn rate over the window ending at now, and false when
+// the window holds too little data to compute one
+func (b *burnRateTracker) burnRate(samples []burnSample, window time.Duration, now time.Time) (float64, bool) {
+	var first *burnSample
+	for i := range samples {
+		if now.Sub(samples[i].At) <= window {
+			first = &samples[i]
+			break
+		}
+	}
+	last := samples[len(samples)-1]
+	if first == nil {
+		return 0, false
+	}
+
+	requests := last.Requests - first.Requests
+	if requests <= 0 {
+		return 0, false
+	}
+	errorRate := 1 - float64(last.Successes-first.Successes)/float64(requests)
+	return errorRate / b.budget, true
+}
+
+// Evaluate returns an alert for every application/version whose short and
+// long window burn rates both reach the configured factor
+func (b *burnRateTracker) Evaluate(now time.Time) []BurnAlert {
+	var alerts []BurnAlert
+	for app, versions := range b.samples {
+		for version, samples := range versions {
+			short, ok := b.burnRate(samples, b.shortWindow, now)
+			if !ok || short < b.factor {
+				continue
+			}
+			long, ok := b.burnRate(samples, b.longWindow, now)
+			if !ok || long < b.factor {
+				continue
+			}
+			alerts = append(alerts, BurnAlert{Application: app, Version: version, ShortBurnRate: short, LongBurnRate: long})
+		}
+	}
+	sort.Slice(alerts, func(i, j int) bool {
+		if alerts[i].Application != alerts[j].Application {
+			return alerts[i].Application < alerts[j].Application
+		}
+		return alerts[i].Version < alerts[j].Version
+	})
+	return alerts
+}
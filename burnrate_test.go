@@ -0,0 +1,118 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// Test that burn-rate alerts fire only when both windows breach
+func TestBurnRateTracker(t *testing.T) {
+	config := NewDefaultConfig()
+	config.SLOTarget = 99
+	config.BurnRateFactor = 2
+	config.BurnShortWindow = 5 * time.Minute
+	config.BurnLongWindow = time.Hour
+	tracker := newBurnRateTracker(config)
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var requests, successes int64
+
+	// cycle records one minute of traffic with the given number of errors per
+	// 1000 requests and returns the alerts after it
+	cycle := func(minute int, errors int64) []BurnAlert {
+		requests += 1000
+		successes += 1000 - errors
+		now := start.Add(time.Duration(minute) * time.Minute)
+		tracker.Record(map[string]map[string]AggregatedData{
+			"Memcache2": {"1.0.1": {Application: "Memcache2", Version: "1.0.1", TotalRequests: requests, TotalSuccesses: successes}},
+		}, now)
+		return tracker.Evaluate(now)
+	}
+
+	minute := 0
+	for ; minute < 60; minute++ {
+		if alerts := cycle(minute, 0); len(alerts) != 0 {
+			t.Fatalf("Minute %d: expected no alert for a healthy service, got %v", minute, alerts)
+		}
+	}
+
+	// A 10% error spike breaches the short window immediately but the long
+	// window only after enough of the hour is affected
+	for ; minute < 65; minute++ {
+		if alerts := cycle(minute, 100); len(alerts) != 0 {
+			t.Fatalf("Minute %d: expected no alert while only the short window breaches, got %v", minute, alerts)
+		}
+	}
+	var alerts []BurnAlert
+	for ; minute < 75; minute++ {
+		alerts = cycle(minute, 100)
+	}
+	if len(alerts) != 1 {
+		t.Fatalf("Expected an alert once both windows breach, got %v", alerts)
+	}
+	if alerts[0].ShortBurnRate < 9.9 || alerts[0].LongBurnRate < 2 {
+		t.Errorf("Expected short burn rate ~10 and long >= 2, got %.2f and %.2f", alerts[0].ShortBurnRate, alerts[0].LongBurnRate)
+	}
+
+	// Once the spike ends the short window recovers and the alert clears even
+	// though the long window is still burning
+	for end := minute + 6; minute < end; minute++ {
+		alerts = cycle(minute, 0)
+	}
+	if len(alerts) != 0 {
+		t.Errorf("Expected the alert to clear after recovery, got %v", alerts)
+	}
+}
+
+// Test that a restarted instance does not hide a burn across the restart, as
+// its cumulative counters dropping would
+func TestBurnRateCounterReset(t *testing.T) {
+	config := NewDefaultConfig()
+	config.SLOTarget = 99
+	config.BurnRateFactor = 2
+	config.BurnShortWindow = 5 * time.Minute
+	config.BurnLongWindow = time.Hour
+	tracker := newBurnRateTracker(config)
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	counters := map[string]*HealthResponse{
+		"https://a/healthz": {Application: "Memcache2", Version: "1.0.1", Uptime: int64(time.Hour)},
+		"https://b/healthz": {Application: "Memcache2", Version: "1.0.1", Uptime: int64(time.Hour)},
+	}
+	// cycle records one minute of traffic at a 10% error rate on every
+	// instance and returns the alerts after it
+	cycle := func(minute int) []BurnAlert {
+		var results []ServerResult
+		for _, url := range []string{"https://a/healthz", "https://b/healthz"} {
+			health := counters[url]
+			health.RequestCount += 1000
+			health.SuccessCount += 900
+			health.Uptime += int64(time.Minute)
+			reported := *health
+			results = append(results, ServerResult{URL: url, Health: &reported})
+		}
+		now := start.Add(time.Duration(minute) * time.Minute)
+		tracker.RecordResults(results, now)
+		return tracker.Evaluate(now)
+	}
+
+	minute := 0
+	var alerts []BurnAlert
+	for ; minute < 70; minute++ {
+		alerts = cycle(minute)
+	}
+	if len(alerts) != 1 {
+		t.Fatalf("Expected an alert for the burning service, got %v", alerts)
+	}
+
+	// b restarts with its counters and uptime back near zero
+	*counters["https://b/healthz"] = HealthResponse{Application: "Memcache2", Version: "1.0.1"}
+	for end := minute + 3; minute < end; minute++ {
+		if alerts = cycle(minute); len(alerts) != 1 {
+			t.Fatalf("Minute %d: expected the alert to hold through the restart, got %v", minute, alerts)
+		}
+	}
+	if alerts[0].ShortBurnRate < 9.9 || alerts[0].ShortBurnRate > 10.1 {
+		t.Errorf("Expected a short burn rate of ~10, got %.2f", alerts[0].ShortBurnRate)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// revalidatedHeader marks a response rebuilt from the cache after the server
+// answered 304 Not Modified
+const revalidatedHeader = "X-Healthcheck-Revalidated"
+
+// cachedResponse is the last full response of a health endpoint along with
+// the validators needed to revalidate it
+type cachedResponse struct {
+	etag         string
+	lastModified string
+	header       http.Header
+	body         []byte
+}
+
+// responseCache remembers health endpoint responses across watch cycles so
+// unchanged data can be revalidated with a conditional request instead of
+// being fetched again
+type responseCache struct {
+	mu        sync.Mutex
+	responses map[string]cachedResponse
+	// maxBytes caps the bodies kept; larger ones are not cached
+	maxBytes int
+}
+
+// newResponseCache creates an empty response cache keeping bodies of up to
+// maxBytes
+func newResponseCache(maxBytes int) *responseCache {
+	return &responseCache{responses: make(map[string]cachedResponse), maxBytes: maxBytes}
+}
+
+// wrap returns a transport that sends conditional requests through base using
+// the cached validators
+func (c *responseCache) wrap(base http.RoundTripper) http.RoundTripper {
+	return &conditionalTransport{base: base, cache: c}
+}
+
+func (c *responseCache) get(url string) (cachedResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cached, ok := c.responses[url]
+	return cached, ok
+}
+
+func (c *responseCache) put(url string, cached cachedResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.responses[url] = cached
+}
+
+// conditionalTransport adds If-None-Match/If-Modified-Since to requests with a
+// cached response and turns a 304 into the cached response, so callers reuse
+// the prior counts as if the server had sent them again
+type conditionalTransport struct {
+	base  http.RoundTripper
+	cache *responseCache
+}
+
+func (t *conditionalTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Only GET responses are safe to revalidate and replay
+	if req.Method != http.MethodGet {
+		return t.base.RoundTrip(req)
+	}
+	url := req.URL.String()
+	cached, ok := t.cache.get(url)
+	if ok {
+		req = req.Clone(req.Context())
+		if cached.etag != "" {
+			req.Header.Set("If-None-Match", cached.etag)
+		}
+		if cached.lastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.lastModified)
+		}
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && ok:
+		resp.Body.Close()
+		header := cached.header.Clone()
+		header.Set(revalidatedHeader, "true")
+		return &http.Response{
+			Status:        "200 OK",
+			StatusCode:    http.StatusOK,
+			Proto:         resp.Proto,
+			ProtoMajor:    resp.ProtoMajor,
+			ProtoMinor:    resp.ProtoMinor,
+			Header:        header,
+			Body:          io.NopCloser(bytes.NewReader(cached.body)),
+			ContentLength: int64(len(cached.body)),
+			Request:       req,
+		}, nil
+	case resp.StatusCode == http.StatusOK:
+		etag, lastModified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+		if etag == "" && lastModified == "" {
+			return resp, nil
+		}
+		header := resp.Header.Clone()
+		resp.Body = &cachingBody{ReadCloser: resp.Body, limit: t.cache.maxBytes, store: func(body []byte) {
+			t.cache.put(url, cachedResponse{etag: etag, lastModified: lastModified, header: header, body: body})
+		}}
+	}
+	return resp, nil
+}
+
+// cachingBody copies a response body as the caller reads it and stores the
+// copy once it has been read to the end. The body is left to the caller's
+// reader, so its size cap and body timeout apply and its errors are
+// classified there; a body cut short or larger than limit is not cached.
+type cachingBody struct {
+	io.ReadCloser
+	limit    int
+	buf      []byte
+	overflow bool
+	stored   bool
+	store    func(body []byte)
+}
+
+func (b *cachingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if !b.overflow {
+		if b.buf = append(b.buf, p[:n]...); len(b.buf) > b.limit {
+			b.buf, b.overflow = nil, true
+		}
+	}
+	if err == io.EOF && !b.overflow && !b.stored {
+		b.stored = true
+		b.store(b.buf)
+	}
+	return n, err
+}
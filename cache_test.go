@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Test that a 304 answer to a conditional request reuses the prior counts
+func TestConditionalRequests(t *testing.T) {
+	var full, notModified int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			atomic.AddInt32(&notModified, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		atomic.AddInt32(&full, 1)
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(mockResponse))
+	}))
+	defer server.Close()
+
+	config := NewDefaultConfig()
+	config.RequestDelay = 0
+	cache := newResponseCache(config.MaxBodyBytes)
+	servers := []ServerEntry{{Address: server.URL}}
+
+	var cycles [][]ServerResult
+	for i := 0; i < 2; i++ {
+		resultChannel := make(chan ServerResult, len(servers))
+		go fetchHealthDataWithDelayAndConcurrency(context.Background(), servers, resultChannel, config, &scanState{responses: cache})
+		var results []ServerResult
+		for result := range resultChannel {
+			results = append(results, result)
+		}
+		cycles = append(cycles, results)
+	}
+
+	if full != 1 || notModified != 1 {
+		t.Errorf("Expected 1 full fetch and 1 revalidation, got %d and %d", full, notModified)
+	}
+	first, second := cycles[0][0], cycles[1][0]
+	if first.Revalidated || !second.Revalidated {
+		t.Errorf("Expected only the second cycle to be revalidated, got %v and %v", first.Revalidated, second.Revalidated)
+	}
+	if second.Health == nil || !reflect.DeepEqual(*second.Health, *first.Health) {
+		t.Errorf("Expected the prior counts to be reused, got %+v", second.Health)
+	}
+}
+
+// Test that a cached endpoint body is read under BODY_TIMEOUT, so a stalled
+// body is classified as such, and that a body over MAX_BODY_BYTES is never
+// cached
+func TestConditionalRequestsBody(t *testing.T) {
+	stalled := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(mockResponse[:20]))
+		w.(http.Flusher).Flush()
+		select {
+		case <-time.After(2 * time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer stalled.Close()
+
+	config := NewDefaultConfig()
+	config.HTTPTimeout = 5 * time.Second
+	config.BodyTimeout = 100 * time.Millisecond
+	cache := newResponseCache(config.MaxBodyBytes)
+	client := newHTTPClient(config)
+	client.Transport = cache.wrap(client.Transport)
+
+	_, _, err := fetchHealthData(context.Background(), client, stalled.URL, config)
+	if class := classifyError(err); class != ErrorClassBodyTimeout {
+		t.Errorf("Expected error class %s, got %s (%v)", ErrorClassBodyTimeout, class, err)
+	}
+	if _, ok := cache.get(stalled.URL); ok {
+		t.Error("Expected a body cut short not to be cached")
+	}
+
+	var full int32
+	large := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&full, 1)
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(mockResponse))
+	}))
+	defer large.Close()
+
+	config = NewDefaultConfig()
+	config.MaxBodyBytes = 16
+	cache = newResponseCache(config.MaxBodyBytes)
+	client = newHTTPClient(config)
+	client.Transport = cache.wrap(client.Transport)
+	fetchHealthData(context.Background(), client, large.URL, config)
+	if _, ok := cache.get(large.URL); ok {
+		t.Error("Expected a body over MAX_BODY_BYTES not to be cached")
+	}
+}
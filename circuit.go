@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Circuit states of a server
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half-open"
+)
+
+// circuit is the breaker state of a single server
+type circuit struct {
+	state    string
+	failures int
+	openedAt time.Time
+}
+
+// circuitBreaker stops contacting servers that failed CircuitThreshold cycles
+// in a row. After CircuitCooldown an open circuit lets a single probe through
+// (half-open): success closes it, failure opens it again.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	circuits  map[string]*circuit
+	now       func() time.Time
+	out       io.Writer
+}
+
+// newCircuitBreaker creates a breaker from config
+func newCircuitBreaker(config *Config) *circuitBreaker {
+	return &circuitBreaker{
+		threshold: config.CircuitThreshold,
+		cooldown:  config.CircuitCooldown,
+		circuits:  make(map[string]*circuit),
+		now:       time.Now,
+		out:       config.Console,
+	}
+}
+
+// allow reports whether server may be contacted, moving an open circuit whose
+// cooldown has passed to half-open, and returns the circuit state
+func (b *circuitBreaker) allow(server string) (string, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := b.circuits[server]
+	if c == nil {
+		return CircuitClosed, true
+	}
+	if c.state == CircuitOpen {
+		if b.now().Sub(c.openedAt) < b.cooldown {
+			return CircuitOpen, false
+		}
+		c.state = CircuitHalfOpen
+	}
+	return c.state, true
+}
+
+// record updates the circuit of server with the outcome of a check and
+// returns its new state. Transitions are logged.
+func (b *circuitBreaker) record(server string, success bool) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := b.circuits[server]
+	if c == nil {
+		c = &circuit{state: CircuitClosed}
+		b.circuits[server] = c
+	}
+	previous := c.state
+	if success {
+		c.state, c.failures = CircuitClosed, 0
+	} else {
+		c.failures++
+		if c.state == CircuitHalfOpen || c.failures >= b.threshold {
+			c.state, c.openedAt = CircuitOpen, b.now()
+		}
+	}
+	if c.state != previous {
+		fmt.Fprintf(b.out, "Circuit for %s %s -> %s\n", server, previous, c.state)
+	}
+	return c.state
+}
+
+// skippedResult is the result of a server whose circuit is open
+func (b *circuitBreaker) skippedResult(entry ServerEntry, serverURL string) ServerResult {
+	err := &FetchError{Class: ErrorClassCircuitOpen, Err: fmt.Errorf("circuit open for server %s, skipping it", serverURL)}
+	return ServerResult{
+		Server:       entry.name(),
+		URL:          serverURL,
+		Tags:         entry.Tags,
+		Error:        err.Error(),
+		ErrorClass:   ErrorClassCircuitOpen,
+		CircuitState: CircuitOpen,
+	}
+}
+
+// CircuitSummary counts the retried servers and the circuit states of a cycle.
+// HalfOpen counts the half-open probes made during the cycle.
+type CircuitSummary struct {
+	RetriedServers int `json:"retriedServers"`
+	Retries        int `json:"retries"`
+	Closed         int `json:"closed"`
+	Open           int `json:"open"`
+	HalfOpen       int `json:"halfOpen"`
+}
+
+// summarizeCircuits counts the retries and circuit states recorded in results
+func summarizeCircuits(results []ServerResult) CircuitSummary {
+	var summary CircuitSummary
+	for _, result := range results {
+		if result.Retries > 0 {
+			summary.RetriedServers++
+			summary.Retries += result.Retries
+		}
+		switch result.CircuitState {
+		case CircuitClosed:
+			summary.Closed++
+		case CircuitOpen:
+			summary.Open++
+		}
+		if result.CircuitProbe {
+			summary.HalfOpen++
+		}
+	}
+	return summary
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Test the closed -> open -> half-open -> closed transitions of a circuit
+func TestCircuitBreakerTransitions(t *testing.T) {
+	config := NewDefaultConfig()
+	config.CircuitThreshold = 2
+	config.CircuitCooldown = time.Minute
+	breaker := newCircuitBreaker(config)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	breaker.now = func() time.Time { return now }
+
+	if state := breaker.record("a", false); state != CircuitClosed {
+		t.Errorf("Expected the circuit to stay closed below the threshold, got %s", state)
+	}
+	if state := breaker.record("a", false); state != CircuitOpen {
+		t.Errorf("Expected the circuit to open at the threshold, got %s", state)
+	}
+	if state, allowed := breaker.allow("a"); allowed || state != CircuitOpen {
+		t.Errorf("Expected an open circuit to skip the server, got %s, %v", state, allowed)
+	}
+
+	now = now.Add(time.Minute)
+	if state, allowed := breaker.allow("a"); !allowed || state != CircuitHalfOpen {
+		t.Errorf("Expected a half-open probe after the cooldown, got %s, %v", state, allowed)
+	}
+	if state := breaker.record("a", false); state != CircuitOpen {
+		t.Errorf("Expected a failed probe to reopen the circuit, got %s", state)
+	}
+
+	now = now.Add(time.Minute)
+	breaker.allow("a")
+	if state := breaker.record("a", true); state != CircuitClosed {
+		t.Errorf("Expected a successful probe to close the circuit, got %s", state)
+	}
+	if state, allowed := breaker.allow("b"); !allowed || state != CircuitClosed {
+		t.Errorf("Expected an unknown server to be allowed, got %s, %v", state, allowed)
+	}
+}
+
+// Test that retries and circuit states are recorded in the results and the
+// report summary across cycles
+func TestCircuitStateInResults(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	config := NewDefaultConfig()
+	config.RequestDelay = 0
+	config.MaxRetries = 1
+	config.RetryBackoff = time.Millisecond
+	config.CircuitThreshold = 1
+	state := &scanState{breaker: newCircuitBreaker(config)}
+	servers := []ServerEntry{{Address: server.URL}}
+
+	cycle := func() ServerResult {
+		resultChannel := make(chan ServerResult, 1)
+		go fetchHealthDataWithDelayAndConcurrency(context.Background(), servers, resultChannel, config, state)
+		return <-resultChannel
+	}
+
+	first := cycle()
+	if first.Retries != 1 || first.CircuitState != CircuitOpen {
+		t.Errorf("Expected 1 retry and an open circuit, got %d and %q", first.Retries, first.CircuitState)
+	}
+	second := cycle()
+	if second.ErrorClass != ErrorClassCircuitOpen || second.CircuitState != CircuitOpen || second.Attempts != 0 {
+		t.Errorf("Expected the server to be skipped, got %+v", second)
+	}
+	if requests != 2 {
+		t.Errorf("Expected no requests while the circuit is open, got %d in total", requests)
+	}
+
+	report := buildReport(aggregateData(nil), []ServerResult{first, second}, config)
+	if report.Circuits == nil || *report.Circuits != (CircuitSummary{RetriedServers: 1, Retries: 1, Open: 2}) {
+		t.Errorf("Unexpected circuit summary %+v", report.Circuits)
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Treatments of 3xx health responses
+const (
+	// RedirectPolicyFollow follows redirects to the health response
+	RedirectPolicyFollow = "follow"
+	// RedirectPolicySuccess counts a 3xx as an up server without counts
+	RedirectPolicySuccess = "success"
+	// RedirectPolicyFailure fails the check on a 3xx
+	RedirectPolicyFailure = "failure"
+)
+
+// dialFunc opens a network connection, e.g. net.Dialer.DialContext
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// newHTTPClient builds the HTTP client shared by all health checks in a run so
+// connections are pooled across servers. The transport is cloned from the
+// default one, so proxy settings from the environment apply; HTTP/2 is only
+// attempted over the custom dialer set below when FORCE_HTTP2 asks for it.
+func newHTTPClient(config *Config) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// A proxy connects to the servers on our behalf, leaving guardDial to
+	// check only the proxy's address. IGNORE_PROXY dials the servers directly
+	// instead, as does a bastion, which tunnels to them itself.
+	if config.IgnoreProxy || config.BastionHost != "" {
+		transport.Proxy = nil
+	}
+	transport.ForceAttemptHTTP2 = config.ForceHTTP2
+	transport.MaxIdleConns = config.MaxIdleConns
+	transport.IdleConnTimeout = config.IdleConnTimeout
+	transport.MaxConnsPerHost = config.MaxConnsPerHost
+	transport.ResponseHeaderTimeout = config.ResponseHeaderTimeout
+	transport.DialContext = guardDial(config, newDialer(config).DialContext, net.DefaultResolver)
+	client := &http.Client{Timeout: config.HTTPTimeout, Transport: transport}
+	if config.RedirectPolicy != RedirectPolicyFollow {
+		// Hand the 3xx itself to fetchHealthData to succeed or fail on
+		client.CheckRedirect = func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	}
+	return client
+}
+
+// newDialer returns the dialer opening direct connections to the servers
+func newDialer(config *Config) *net.Dialer {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if config.ConnectTimeout > 0 {
+		// Bound connection setup separately so unreachable hosts fail fast
+		// while slow but alive servers get the full HTTP timeout
+		dialer.Timeout = config.ConnectTimeout
+	}
+	return dialer
+}
+
+// newCachedDNSHTTPClient builds the HTTP client like newHTTPClient, resolving
+// host names through cache
+func newCachedDNSHTTPClient(config *Config, cache *dnsCache) *http.Client {
+	client := newHTTPClient(config)
+	client.Transport.(*http.Transport).DialContext = guardDial(config, newDialer(config).DialContext, cache)
+	return client
+}
+
+// newTunneledHTTPClient builds the HTTP client like newHTTPClient, opening
+// every connection with dial instead, e.g. through an SSH bastion, and
+// resolving host names with r on the far side of the tunnel
+func newTunneledHTTPClient(config *Config, dial dialFunc, r resolver) *http.Client {
+	client := newHTTPClient(config)
+	client.Transport.(*http.Transport).DialContext = guardDial(config, dial, r)
+	return client
+}
+
+// serverNameClients hands out the clients of a run by the TLS server name
+// they present. A server checked under a Host header other than its address
+// needs its own transport, as SNI and certificate verification follow
+// TLSClientConfig.ServerName rather than the Host header; the transport of
+// each name is cloned from the shared client's once and reused.
+type serverNameClients struct {
+	base *http.Client
+	wrap func(http.RoundTripper) http.RoundTripper
+
+	mu      sync.Mutex
+	clients map[string]*http.Client
+}
+
+// newServerNameClients creates the clients cloned from base, whose transport
+// must be an *http.Transport, each with its transport passed through wrap,
+// e.g. to add the response cache
+func newServerNameClients(base *http.Client, wrap func(http.RoundTripper) http.RoundTripper) *serverNameClients {
+	c := &serverNameClients{base: base, wrap: wrap, clients: make(map[string]*http.Client)}
+	c.clients[""] = c.clone("")
+	return c
+}
+
+// get returns the client presenting host, a Host header possibly with a
+// port, as TLS server name; an empty host uses the address being dialed
+func (c *serverNameClients) get(host string) *http.Client {
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		host = name
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	client, ok := c.clients[host]
+	if !ok {
+		client = c.clone(host)
+		c.clients[host] = client
+	}
+	return client
+}
+
+func (c *serverNameClients) clone(serverName string) *http.Client {
+	client := *c.base
+	var transport http.RoundTripper = c.base.Transport
+	if serverName != "" {
+		cloned := c.base.Transport.(*http.Transport).Clone()
+		if cloned.TLSClientConfig == nil {
+			cloned.TLSClientConfig = &tls.Config{}
+		}
+		cloned.TLSClientConfig.ServerName = serverName
+		transport = cloned
+	}
+	if c.wrap != nil {
+		transport = c.wrap(transport)
+	}
+	client.Transport = transport
+	return &client
+}
+
+// handshakeTrace records the TLS handshake failure of a request, if any, as
+// the error reported by the transport does not always say it happened during
+// the handshake, e.g. a plain EOF from a load balancer dropping it
+type handshakeTrace struct {
+	mu  sync.Mutex
+	err error
+}
+
+// withHandshakeTrace returns ctx tracing the TLS handshakes of its requests
+// into trace
+func withHandshakeTrace(ctx context.Context, trace *handshakeTrace) context.Context {
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			if err == nil {
+				return
+			}
+			trace.mu.Lock()
+			defer trace.mu.Unlock()
+			trace.err = err
+		},
+	})
+}
+
+// classify returns the class of err, a failed request traced by trace
+func (trace *handshakeTrace) classify(err error) string {
+	trace.mu.Lock()
+	handshakeErr := trace.err
+	trace.mu.Unlock()
+	var netErr net.Error
+	if handshakeErr == nil || errors.As(handshakeErr, &netErr) && netErr.Timeout() {
+		// Slow handshakes are timeouts like any slow server
+		return classifyNetworkError(err)
+	}
+	if class := classifyTLSError(handshakeErr); class != "" {
+		return class
+	}
+	return ErrorClassTLSHandshake
+}
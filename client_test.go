@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+// Test that the transport is tuned with the configured connection limits
+func TestNewHTTPClientTransport(t *testing.T) {
+	os.Setenv("MAX_IDLE_CONNS", "20")
+	os.Setenv("IDLE_CONN_TIMEOUT", "45")
+	os.Setenv("MAX_CONNS_PER_HOST", "4")
+	os.Setenv("RESPONSE_HEADER_TIMEOUT", "1500")
+	defer func() {
+		os.Unsetenv("MAX_IDLE_CONNS")
+		os.Unsetenv("IDLE_CONN_TIMEOUT")
+		os.Unsetenv("MAX_CONNS_PER_HOST")
+		os.Unsetenv("RESPONSE_HEADER_TIMEOUT")
+	}()
+
+	transport := newHTTPClient(LoadConfigFromEnv()).Transport.(*http.Transport)
+	if transport.MaxIdleConns != 20 {
+		t.Errorf("Expected MaxIdleConns 20, got %d", transport.MaxIdleConns)
+	}
+	if transport.IdleConnTimeout != 45*time.Second {
+		t.Errorf("Expected IdleConnTimeout 45s, got %v", transport.IdleConnTimeout)
+	}
+	if transport.MaxConnsPerHost != 4 {
+		t.Errorf("Expected MaxConnsPerHost 4, got %d", transport.MaxConnsPerHost)
+	}
+	if transport.ResponseHeaderTimeout != 1500*time.Millisecond {
+		t.Errorf("Expected ResponseHeaderTimeout 1.5s, got %v", transport.ResponseHeaderTimeout)
+	}
+
+	// The defaults apply without the variables
+	defaults := newHTTPClient(NewDefaultConfig()).Transport.(*http.Transport)
+	if defaults.MaxIdleConns != defaultMaxIdleConns || defaults.IdleConnTimeout != defaultIdleConnTimeout {
+		t.Errorf("Expected default pool %d/%v, got %d/%v", defaultMaxIdleConns, defaultIdleConnTimeout, defaults.MaxIdleConns, defaults.IdleConnTimeout)
+	}
+	if defaults.MaxConnsPerHost != 0 || defaults.ResponseHeaderTimeout != 0 {
+		t.Errorf("Expected no per-host limit or header timeout, got %d/%v", defaults.MaxConnsPerHost, defaults.ResponseHeaderTimeout)
+	}
+	if defaults.ForceAttemptHTTP2 {
+		t.Error("Expected HTTP/2 to be attempted only with FORCE_HTTP2")
+	}
+	config := NewDefaultConfig()
+	config.ForceHTTP2 = true
+	if !newHTTPClient(config).Transport.(*http.Transport).ForceAttemptHTTP2 {
+		t.Error("Expected FORCE_HTTP2 to attempt HTTP/2")
+	}
+}
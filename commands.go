@@ -0,0 +1,89 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// appVersion is the version printed by the version command, set at build
+// time with -ldflags "-X main.appVersion=..."
+var appVersion = "dev"
+
+// command is a subcommand of the tool. run receives the arguments following
+// the command name.
+type command struct {
+	name    string
+	summary string
+	run     func(args []string, config *Config, out io.Writer) error
+}
+
+// commands lists the subcommands in the order they are shown in the usage
+var commands = []command{
+	{"scan", "check every server and write the report (default)", runScan},
+	{"merge", "combine several reports into one", runMerge},
+	{"diff", "compare the success rates of two reports", runDiff},
+	{"validate", "check the servers list without contacting any server", runValidate},
+	{"availability", "summarise the timestamped reports written by KEEP_HISTORY", runAvailability},
+	{"version", "print the version and report schema", runVersion},
+}
+
+// findCommand resolves the command named by the first argument and returns
+// it with the remaining arguments. Without a command name, including when the
+// first argument is a flag, scan runs so existing invocations keep working. A
+// nil command with no error means usage was requested.
+func findCommand(args []string) (*command, []string, error) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return &commands[0], args, nil
+	}
+	if args[0] == "help" {
+		return nil, nil, nil
+	}
+	for i := range commands {
+		if commands[i].name == args[0] {
+			return &commands[i], args[1:], nil
+		}
+	}
+	return nil, nil, fmt.Errorf("unknown command %q", args[0])
+}
+
+// printUsage lists the available commands
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: cloud-ops-interview-edeediong [command] [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-13s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Run a command with -h to list its flags.")
+}
+
+// parseScanFlags applies the scan command's flags to config
+func parseScanFlags(args []string, config *Config) error {
+	flags := flag.NewFlagSet("scan", flag.ContinueOnError)
+	flags.StringVar(&config.ServersFile, "servers", config.ServersFile, "servers list file or directory (SERVERS_FILE)")
+	flags.StringVar(&config.OutputFile, "output", config.OutputFile, "report destination (OUTPUT_FILE)")
+	flags.DurationVar(&config.WatchInterval, "watch", config.WatchInterval, "pause between scan cycles, 0 for a single scan (WATCH_INTERVAL)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		return fmt.Errorf("scan takes no arguments, got %q", flags.Args())
+	}
+	return nil
+}
+
+// runVersion implements the version command
+func runVersion(args []string, _ *Config, out io.Writer) error {
+	flags := flag.NewFlagSet("version", flag.ContinueOnError)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		return fmt.Errorf("version takes no arguments, got %q", flags.Args())
+	}
+	fmt.Fprintf(out, "cloud-ops-interview-edeediong %s (report schema %d)\n", appVersion, reportSchemaVersion)
+	return nil
+}
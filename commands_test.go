@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test that the command name is resolved and scan stays the default
+func TestFindCommand(t *testing.T) {
+	tests := []struct {
+		args     []string
+		expected string
+		rest     int
+	}{
+		{nil, "scan", 0},
+		{[]string{"-servers", "other.txt"}, "scan", 2},
+		{[]string{"scan", "-watch", "30s"}, "scan", 2},
+		{[]string{"merge", "a.json", "b.json"}, "merge", 2},
+		{[]string{"diff", "a.json", "b.json"}, "diff", 2},
+		{[]string{"validate"}, "validate", 0},
+		{[]string{"availability", "-json"}, "availability", 1},
+		{[]string{"version"}, "version", 0},
+	}
+	for _, tt := range tests {
+		cmd, rest, err := findCommand(tt.args)
+		if err != nil {
+			t.Fatalf("Args %q: expected no error, got %v", tt.args, err)
+		}
+		if cmd == nil || cmd.name != tt.expected || len(rest) != tt.rest {
+			t.Errorf("Args %q: expected %s with %d args, got %+v with %q", tt.args, tt.expected, tt.rest, cmd, rest)
+		}
+	}
+
+	if cmd, _, err := findCommand([]string{"help"}); cmd != nil || err != nil {
+		t.Errorf("Expected help to request usage, got %+v, %v", cmd, err)
+	}
+	if _, _, err := findCommand([]string{"bogus"}); err == nil {
+		t.Error("Expected an error for an unknown command")
+	}
+}
+
+// Test that scan flags override the environment configuration
+func TestParseScanFlags(t *testing.T) {
+	config := NewDefaultConfig()
+	if err := parseScanFlags([]string{"-servers", "fleet.txt", "-output", "out.json", "-watch", "1m"}, config); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if config.ServersFile != "fleet.txt" || config.OutputFile != "out.json" || config.WatchInterval != time.Minute {
+		t.Errorf("Expected flags applied, got servers=%s output=%s watch=%v", config.ServersFile, config.OutputFile, config.WatchInterval)
+	}
+
+	config = NewDefaultConfig()
+	if err := parseScanFlags(nil, config); err != nil || config.ServersFile != defaultServersFile {
+		t.Errorf("Expected defaults without flags, got %s, %v", config.ServersFile, err)
+	}
+	if err := parseScanFlags([]string{"extra"}, config); err == nil {
+		t.Error("Expected an error for a positional argument")
+	}
+	if err := parseScanFlags([]string{"-h"}, config); !errors.Is(err, flag.ErrHelp) {
+		t.Errorf("Expected flag.ErrHelp, got %v", err)
+	}
+}
+
+// Test merge argument parsing
+func TestParseMergeFlags(t *testing.T) {
+	opts, err := parseMergeFlags([]string{"-output", "merged.json", "eu.json", "us.json"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if opts.Output != "merged.json" || len(opts.Inputs) != 2 {
+		t.Errorf("Unexpected options %+v", opts)
+	}
+	if opts, _ := parseMergeFlags([]string{"a.json", "b.json"}); opts.Output != "-" {
+		t.Errorf("Expected stdout by default, got %s", opts.Output)
+	}
+	if _, err := parseMergeFlags([]string{"a.json"}); err == nil {
+		t.Error("Expected an error for a single report")
+	}
+}
+
+// Test diff argument parsing
+func TestParseDiffFlags(t *testing.T) {
+	opts, err := parseDiffFlags([]string{"-json", "old.json", "new.json"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !opts.JSON || opts.Old != "old.json" || opts.New != "new.json" {
+		t.Errorf("Unexpected options %+v", opts)
+	}
+	if _, err := parseDiffFlags([]string{"old.json"}); err == nil {
+		t.Error("Expected an error for a single report")
+	}
+}
+
+// Test validate argument parsing
+func TestParseValidateFlags(t *testing.T) {
+	config := NewDefaultConfig()
+	if _, err := parseValidateFlags([]string{"-servers", "fleet.txt"}, config); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if config.ServersFile != "fleet.txt" {
+		t.Errorf("Expected servers file fleet.txt, got %s", config.ServersFile)
+	}
+	if opts, err := parseValidateFlags([]string{"-errors-json"}, config); err != nil || !opts.ErrorsJSON {
+		t.Errorf("Expected -errors-json to be set, got %+v, %v", opts, err)
+	}
+	if _, err := parseValidateFlags([]string{"fleet.txt"}, config); err == nil {
+		t.Error("Expected an error for a positional argument")
+	}
+}
+
+// Test the version and availability commands' argument handling
+func TestRunVersionAndAvailabilityFlags(t *testing.T) {
+	var buf bytes.Buffer
+	if err := runVersion(nil, NewDefaultConfig(), &buf); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !strings.Contains(buf.String(), appVersion) || !strings.Contains(buf.String(), "report schema 2") {
+		t.Errorf("Unexpected version output %q", buf.String())
+	}
+	if err := runVersion([]string{"extra"}, NewDefaultConfig(), &buf); err == nil {
+		t.Error("Expected an error for a positional argument")
+	}
+	if err := runAvailability([]string{"-dir", t.TempDir()}, NewDefaultConfig(), &buf); err == nil || !strings.Contains(err.Error(), "no timestamped reports") {
+		t.Errorf("Expected the empty directory to be parsed and rejected, got %v", err)
+	}
+}
+
+// Test that usage lists every command
+func TestPrintUsage(t *testing.T) {
+	var buf bytes.Buffer
+	printUsage(&buf)
+	for _, cmd := range commands {
+		if !strings.Contains(buf.String(), cmd.name) {
+			t.Errorf("Expected %s in usage, got:\n%s", cmd.name, buf.String())
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+)
+
+// gzipExtension marks an output file that is written gzip compressed
+const gzipExtension = ".gz"
+
+// compressOutput reports whether the report written to path is gzip
+// compressed, either because COMPRESS is set or path ends in .gz
+func compressOutput(path string, config *Config) bool {
+	return config.Compress || strings.HasSuffix(path, gzipExtension)
+}
+
+// gzipBytes compresses data into a complete gzip stream
+func gzipBytes(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// maybeGunzip returns data decompressed when it starts with the gzip magic
+// bytes, so compressed reports can be read back wherever plain ones are
+func maybeGunzip(data []byte) ([]byte, error) {
+	if len(data) < 2 || data[0] != 0x1f || data[1] != 0x8b {
+		return data, nil
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
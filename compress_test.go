@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Test that a .gz output file, or any file with COMPRESS, is written as a
+// gzip stream holding the report, and read back by loadReport
+func TestCompressedReport(t *testing.T) {
+	report := Report{Applications: map[string]map[string]AggregatedData{
+		"Memcache2": {"1.0.1": {Application: "Memcache2", Version: "1.0.1", TotalRequests: 100, TotalSuccesses: 99}},
+	}}
+	dir := t.TempDir()
+
+	for name, compress := range map[string]bool{"report.json.gz": false, "report.json": true, "plain.json": false} {
+		config := NewDefaultConfig()
+		config.Compress = compress
+		config.ReportEnvelope = true
+		path := filepath.Join(dir, name)
+		writer := &fileReportWriter{path: path, config: config}
+		if err := writer.Write(context.Background(), report); err != nil {
+			t.Fatalf("%s: expected no error, got %v", name, err)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("%s: failed to read report: %v", name, err)
+		}
+		if compressed := compressOutput(path, config); compressed {
+			zr, err := gzip.NewReader(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("%s: expected a gzip stream, got %v", name, err)
+			}
+			if data, err = io.ReadAll(zr); err != nil {
+				t.Fatalf("%s: failed to decompress report: %v", name, err)
+			}
+		} else if !json.Valid(data) {
+			t.Fatalf("%s: expected an uncompressed JSON report, got %q", name, data)
+		}
+		var decoded Report
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatalf("%s: failed to decode report: %v", name, err)
+		}
+		if got := decoded.Applications["Memcache2"]["1.0.1"]; got.TotalRequests != 100 || got.TotalSuccesses != 99 {
+			t.Errorf("%s: expected the report contents back, got %+v", name, got)
+		}
+
+		loaded, err := loadReport(path)
+		if err != nil {
+			t.Fatalf("%s: expected loadReport to read the report, got %v", name, err)
+		}
+		if got := loaded.Applications["Memcache2"]["1.0.1"]; got.TotalRequests != 100 {
+			t.Errorf("%s: expected loadReport to return the contents, got %+v", name, got)
+		}
+	}
+}
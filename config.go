@@ -1,34 +1,533 @@
 package main
 
 import (
+	"io"
+	"net"
+	"net/http"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
 // Config holds all configuration settings
 type Config struct {
+	// ServersFile defines the file listing the servers to check, or a directory
+	// of *.txt files
+	ServersFile string
+	// CSVColumns renames the header columns of a CSV inventory to the host,
+	// name or tag they hold, e.g. hostname=host
+	CSVColumns map[string]string
+	// Environment labels reports and metrics, e.g. staging or prod
+	Environment string
+	// Region labels reports with the region they were scanned from, so merge
+	// can break numbers down per region
+	Region string
+	// Shard identifies this run among several splitting the fleet, used by
+	// the {shard} placeholder of OUTPUT_FILE
+	Shard string
+	// ServersRecursive descends into subdirectories when ServersFile is a directory
+	ServersRecursive bool
+	// CacheServers keeps the parsed servers list between watch cycles,
+	// parsing a file again only once its modification time changes
+	CacheServers bool
+	// ServersReloadInterval defines how often a cached servers directory is
+	// read again (0 reads it every cycle)
+	ServersReloadInterval time.Duration
+	// NormalizeHosts lowercases hosts and strips trailing dots before servers
+	// are deduplicated and reported
+	NormalizeHosts bool
+	// NormalizeStripPort also strips the port when normalizing hosts
+	NormalizeStripPort bool
+	// HealthPath defines the path queried on each server
+	HealthPath string
+	// HealthMethod defines the HTTP method of health checks: GET, POST, or HEAD
+	// for liveness-only checks that skip the body and its counts
+	HealthMethod string
+	// HealthBooleanField defines a boolean field of the health response that
+	// alone decides whether a server is up; counts are then not expected
+	HealthBooleanField string
+	// HealthComponentsField defines the field of the health response holding
+	// component sub-checks, e.g. components (empty disables them)
+	HealthComponentsField string
+	// PrometheusMetrics maps health response fields (requestCount, errorCount,
+	// successCount, uptime) to the metrics read from a Prometheus text body
+	// (empty expects JSON only)
+	PrometheusMetrics map[string]string
+	// AuthTokenCommand defines a shell command printing the bearer token sent
+	// with every health check (empty sends none)
+	AuthTokenCommand string
+	// AuthTokenTimeout bounds each run of AuthTokenCommand
+	AuthTokenTimeout time.Duration
+	// AuthTokenTTL defines how long a token is reused across watch cycles (0
+	// runs the command every cycle)
+	AuthTokenTTL time.Duration
+	// RedirectPolicy defines how a 3xx health response is treated: followed,
+	// counted as an up server without counts, or failed (follow, success or
+	// failure)
+	RedirectPolicy string
+	// HealthBody defines the request body sent by POST health checks
+	HealthBody string
+	// HostHeader defines the Host header sent instead of the server's address,
+	// for name-based virtual hosts listed by IP (empty sends the address)
+	HostHeader string
+	// HealthContentType defines the Content-Type of the POST request body
+	HealthContentType string
+	// HealthPaths maps an application (the app tag) to its own health path
+	HealthPaths map[string]string
 	// HTTPTimeout defines the maximum duration for HTTP requests
 	HTTPTimeout time.Duration
 	// RequestDelay defines the delay between consecutive requests
 	RequestDelay time.Duration
 	// MaxConcurrency defines the maximum number of concurrent operations
 	MaxConcurrency int
+	// ClassConcurrency caps the concurrent checks of servers tagged with each
+	// class, within MaxConcurrency; unlisted classes share the global limit only
+	ClassConcurrency map[string]int
+	// ResultConsumers defines how many goroutines fold results into the
+	// aggregation as they arrive
+	ResultConsumers int
+	// Compress writes the report file gzip compressed, as does an OUTPUT_FILE
+	// ending in .gz
+	Compress bool
+	// KeepHistory defines how many timestamped reports to retain (0 disables history)
+	KeepHistory int
+	// SuccessPercentiles defines percentiles of the per-instance success rates
+	// reported for each application/version, e.g. 50 and 10 (empty disables it)
+	SuccessPercentiles []float64
+	// VolumeShares adds each version's share of its application's requests to the report
+	VolumeShares bool
+	// CriticalThreshold defines the success rate percentage below which a record is critical
+	CriticalThreshold float64
+	// WarningThreshold defines the success rate percentage below which a record is a warning
+	WarningThreshold float64
+	// ForceHTTP2 rejects responses that were not served over HTTP/2
+	ForceHTTP2 bool
+	// IncludeRaw adds the per-server results to the report
+	IncludeRaw bool
+	// Console receives the log lines of a run: stdout, or stderr when the
+	// report or the result stream is written to stdout so that output stays
+	// parseable. It is set by the scan rather than read from the environment.
+	Console io.Writer
+	// ReportEnvelope writes the JSON report as an envelope holding the
+	// schema version, meta and every section instead of the bare application
+	// and version map
+	ReportEnvelope bool
+	// IncludeRawBody keeps the response body of every server in its raw result
+	IncludeRawBody bool
+	// MaxBodyBytes caps the response body read from a server, failing the
+	// check beyond it, and the body kept by IncludeRawBody
+	MaxBodyBytes int
+	// HealthStreaming reads health responses streamed as a sequence of JSON
+	// values and decodes the last one
+	HealthStreaming bool
+	// EmptyAppPolicy defines how records with an empty application are handled
+	// (placeholder, drop or error)
+	EmptyAppPolicy string
+	// EmptyAppPlaceholder defines the application name used by the placeholder policy
+	EmptyAppPlaceholder string
+	// EmptyVersionPolicy defines how records with an empty version are handled
+	// (placeholder, drop or error)
+	EmptyVersionPolicy string
+	// EmptyVersionPlaceholder defines the version used by the placeholder policy
+	EmptyVersionPlaceholder string
+	// AppNameCase defines how application names differing only in casing are
+	// aggregated: sensitive, fold or lower
+	AppNameCase string
+	// AppNameMap renames reported application names to a canonical one
+	// before aggregation
+	AppNameMap map[string]string
+	// OutputFile defines where the report is written, a local path or s3://bucket/key
+	OutputFile string
+	// OutputFallbackStdout writes the report to stdout with a warning when the
+	// output directory is not writable, instead of failing before the scan
+	OutputFallbackStdout bool
+	// StreamOutput defines where each result is written as an NDJSON line as
+	// soon as it is fetched: "-" for stdout or a file path (empty disables it)
+	StreamOutput string
+	// FailuresFile defines where a CSV of failed servers is written when any
+	// fetch fails (empty disables it)
+	FailuresFile string
+	// AlertsFile defines where the breaching records are written as a JSON
+	// array after each cycle, empty when none breach (empty disables it)
+	AlertsFile string
+	// OutputFormat defines the report format (json, html or grafana-json)
+	OutputFormat string
+	// SlowestN defines how many of the slowest endpoints are listed (0 disables it)
+	SlowestN int
+	// ReportSlowest adds the slowest endpoints to the report
+	ReportSlowest bool
+	// FlattenSingleApp writes a JSON report whose servers all share one
+	// application as a flat version->record map
+	FlattenSingleApp bool
+	// JSONIndent defines the indentation of JSON reports (empty means compact)
+	JSONIndent string
+	// OutputGranularity defines whether the report breaks applications down by
+	// version or collapses them into one record per application
+	OutputGranularity string
+	// S3Endpoint overrides the S3 endpoint for S3-compatible object stores
+	S3Endpoint string
+	// S3Region defines the region used to sign S3 uploads
+	S3Region string
+	// MaxRetries defines how many times a failed health check or report upload is retried
+	MaxRetries int
+	// MaxTotalRetries caps the health check retries shared by all servers in a
+	// cycle (0 means unlimited)
+	MaxTotalRetries int
+	// MaxTotalRequests caps the health check requests of a cycle, retries
+	// included; servers beyond it are skipped (0 means unlimited)
+	MaxTotalRequests int
+	// CircuitThreshold defines after how many consecutive failed cycles a
+	// server's circuit opens and it is skipped (0 disables the breaker)
+	CircuitThreshold int
+	// CircuitCooldown defines how long a circuit stays open before a single
+	// half-open probe is let through
+	CircuitCooldown time.Duration
+	// RetryDecode defines whether health checks whose body failed to decode are
+	// retried; opt-in since it can mask a persistently broken endpoint
+	RetryDecode bool
+	// RetryOnReset defines whether a connection reset by the peer is retried
+	// once straight away, outside MaxRetries and the retry budget; POST checks
+	// are never retried this way since the server may have acted on the body
+	RetryOnReset bool
+	// RetryTLSHandshake defines whether TLS handshake failures are retried;
+	// certificates that failed validation never are
+	RetryTLSHandshake bool
+	// RetryStatusCodes defines the HTTP statuses a health check is retried on
+	// (nil retries every 5xx and 429)
+	RetryStatusCodes map[int]bool
+	// RetryBackoff defines the delay between retries
+	RetryBackoff time.Duration
+	// LatencyMode defines whether a retried check's latency is that of the
+	// final attempt or the total across attempts (final or cumulative)
+	LatencyMode string
+	// TargetApp limits the run to servers tagged app=TargetApp
+	TargetApp string
+	// TargetAppStrict excludes servers without an app tag when TargetApp is set
+	TargetAppStrict bool
+	// TUI shows a live dashboard instead of the console output in watch mode
+	// when running in a terminal
+	TUI bool
+	// WatchInterval defines the pause between scan cycles (0 runs a single scan)
+	WatchInterval time.Duration
+	// WatchJitter defines the percentage of WatchInterval by which each pause
+	// randomly varies either way (0 disables it)
+	WatchJitter float64
+	// WatchJitterSeed seeds the jitter for reproducible pauses (0 picks a random seed)
+	WatchJitterSeed int64
+	// ReadyMaxAge defines how long after the last completed cycle /readyz
+	// keeps reporting ready (0 derives it from WatchInterval and RunTimeout)
+	ReadyMaxAge time.Duration
+	// RunTimeout bounds each scan cycle; in-flight requests are canceled once
+	// it passes (0 disables it)
+	RunTimeout time.Duration
+	// WatchdogFactor defines the multiple of RunTimeout after which a cycle
+	// that still has not returned is abandoned
+	WatchdogFactor float64
+	// SLOTarget defines the success rate objective in percent used for burn-rate
+	// alerting (0 disables burn-rate alerts)
+	SLOTarget float64
+	// SLOFile defines a JSON file mapping an application or application/version
+	// to its own target success rate
+	SLOFile string
+	// BurnRateFactor defines the burn rate both windows must reach to alert
+	BurnRateFactor float64
+	// BurnShortWindow defines the short burn-rate window
+	BurnShortWindow time.Duration
+	// BurnLongWindow defines the long burn-rate window
+	BurnLongWindow time.Duration
+	// MetricsAddr defines the address serving Prometheus metrics (empty disables it)
+	MetricsAddr string
+	// MetricsLabels defines the server tags exposed as metric labels
+	MetricsLabels []string
+	// MaxInstancesPerVersion defines how many instances may report the same
+	// application and version before a data warning is logged (0 disables it)
+	MaxInstancesPerVersion int
+	// OutlierFactor defines how far apart per-instance request counts for the
+	// same application and version may be before a data warning is logged (0 disables it)
+	OutlierFactor float64
+	// MinRequests defines the request count below which an application/version
+	// is reported as insufficient data and excluded from alerting (0 disables it)
+	MinRequests int64
+	// VolumeCurve defines how request volume scales the failure rate severity
+	// is classified on: none, linear, sqrt or log
+	VolumeCurve string
+	// VolumeReference defines the request count whose failure rate is
+	// classified unscaled; busier versions are escalated, quieter ones softened
+	VolumeReference int64
+	// VolumeMaxWeight caps the scaling in both directions
+	VolumeMaxWeight float64
+	// StatsdAddr defines the StatsD server gauges are pushed to (empty disables it)
+	StatsdAddr string
+	// PushgatewayURL defines the Prometheus Pushgateway gauges are pushed to
+	// after each cycle (empty disables it)
+	PushgatewayURL string
+	// PushgatewayJob defines the job name the gauges are grouped under
+	PushgatewayJob string
+	// KafkaBrokers defines the Kafka brokers each cycle's results are
+	// published to (empty disables it)
+	KafkaBrokers []string
+	// KafkaTopic defines the topic the results are published to
+	KafkaTopic string
+	// KafkaMessages defines whether each record or the whole report is
+	// published as a message (record or report)
+	KafkaMessages string
+	// OTLPEndpoint defines the OTLP/HTTP collector fetch spans and metrics are
+	// exported to (empty disables it)
+	OTLPEndpoint string
+	// OTelServiceName defines the service.name of the exported telemetry
+	OTelServiceName string
+	// OTelResourceAttributes defines further resource attributes of the
+	// exported telemetry
+	OTelResourceAttributes map[string]string
+	// MetricsFlushDelay defines how long to wait before exiting when StatsD or
+	// a Pushgateway is configured, so the last batch can drain
+	MetricsFlushDelay time.Duration
+	// EnablePprof exposes the pprof profiling endpoints on MetricsAddr
+	EnablePprof bool
+	// ConnectTimeout defines the maximum duration for establishing a connection
+	// (0 leaves it bounded by HTTPTimeout only)
+	ConnectTimeout time.Duration
+	// MaxIdleConns defines how many idle keep-alive connections are pooled
+	// across all servers (0 pools without limit)
+	MaxIdleConns int
+	// IdleConnTimeout defines how long a keep-alive connection stays idle in
+	// the pool before it is closed, kept below load balancer idle timeouts so
+	// long watch runs do not reuse connections they silently dropped
+	IdleConnTimeout time.Duration
+	// MaxConnsPerHost defines the maximum connections to a single server,
+	// idle or in use (0 leaves it unlimited)
+	MaxConnsPerHost int
+	// ResponseHeaderTimeout defines the maximum wait for response headers once
+	// the request is sent (0 leaves it bounded by HTTPTimeout only)
+	ResponseHeaderTimeout time.Duration
+	// DNSCacheMaxAge defines how long host lookups are reused across watch
+	// cycles before they are resolved again (0 disables the cache)
+	DNSCacheMaxAge time.Duration
+	// DenyNetworks defines the ranges the servers may not resolve to, checked
+	// before connecting (link-local by default, so 169.254.169.254 is refused)
+	DenyNetworks []*net.IPNet
+	// AllowNetworks defines ranges exempt from DenyNetworks
+	AllowNetworks []*net.IPNet
+	// IgnoreProxy defines whether proxy settings from the environment are
+	// ignored so every server is dialed directly and checked by the guard
+	IgnoreProxy bool
+	// BastionHost defines an SSH bastion (host or host:port) that connections
+	// to the servers are tunneled through (empty connects directly)
+	BastionHost string
+	// BastionUser defines the SSH user on the bastion
+	BastionUser string
+	// BastionKeyFile defines the private key used to authenticate to the bastion
+	BastionKeyFile string
+	// BastionKnownHosts defines the known_hosts file the bastion's host key is
+	// checked against
+	BastionKnownHosts string
+	// BastionInsecureHostKey skips the bastion host key check
+	BastionInsecureHostKey bool
+	// ConditionalRequests revalidates health responses carrying an ETag or
+	// Last-Modified header across watch cycles instead of fetching them again
+	ConditionalRequests bool
+	// BodyTimeout defines the maximum duration for reading the response body once
+	// the headers have arrived (0 leaves it bounded by HTTPTimeout only)
+	BodyTimeout time.Duration
+	// PinIdentity defines how each server's application/version is smoothed
+	// across watch cycles: off, first or majority
+	PinIdentity string
+	// PinIdentityWindow defines how many recent cycles the pinning considers
+	PinIdentityWindow int
+	// UptimeTolerance defines how far a server's uptime may go backwards
+	// between watch cycles before it is reported as a regression
+	UptimeTolerance time.Duration
+	// RequestDeltas reports the requests each application version served
+	// since the previous watch cycle
+	RequestDeltas bool
+	// CounterResetGrace defines for how many watch cycles after its counters
+	// reset a restarted server is left out of request deltas and burn rates
+	CounterResetGrace int
+	// BodyLogLimit defines how many bytes of a failed response's body are kept
+	// in its error message, after redacting credentials (0 omits the body)
+	BodyLogLimit int
+	// DebugBodyDir defines a directory where the full body of every successful
+	// response that failed validation is saved, one file per server (empty disables it)
+	DebugBodyDir string
+	// Shuffle randomizes the order in which servers are processed
+	Shuffle bool
+	// ShuffleSeed seeds the shuffle for reproducible orders (0 picks a random seed)
+	ShuffleSeed int64
+	// StatusCriticalFraction defines the fraction of critical records above
+	// which the report's overall status is critical
+	StatusCriticalFraction float64
+	// StatusDegradedFraction defines the fraction of critical or warning
+	// records above which the overall status is degraded
+	StatusDegradedFraction float64
+	// BaselineFile defines a committed report each scan is compared with to
+	// detect regressions (empty disables it)
+	BaselineFile string
+	// RegressionTolerance defines how many percentage points a success rate
+	// may drop below the baseline before it is a regression
+	RegressionTolerance float64
+	// FailOnRegression makes a single scan exit with a failure status when any
+	// application/version regressed from the baseline
+	FailOnRegression bool
+	// ExitPolicy decides when a single scan exits with a failure status
+	// (none, any-fetch-error, threshold or error-fraction)
+	ExitPolicy string
+	// ExitThreshold defines the success rate percentage used by the threshold
+	// policy (0 falls back to CriticalThreshold)
+	ExitThreshold float64
+	// ExitErrorFraction defines the fraction of failed servers tolerated by the
+	// error-fraction policy
+	ExitErrorFraction float64
+	// GlobalRateGate defines the fleet-wide success rate percentage below
+	// which a single scan fails, independently of ExitPolicy (0 disables it)
+	GlobalRateGate float64
+	// WebhookURL defines the webhook receiving alerts (empty disables it)
+	WebhookURL string
+	// WebhookTimeout bounds each webhook request
+	WebhookTimeout time.Duration
+	// WebhookFlushTimeout bounds how long pending notifications delay exit
+	WebhookFlushTimeout time.Duration
 }
 
 // Configuration constants with default values
 const (
-	defaultHTTPTimeout    = 10 * time.Second
-	defaultRequestDelay   = 200 * time.Millisecond
-	defaultMaxConcurrency = 5
+	defaultHTTPTimeout     = 10 * time.Second
+	defaultRequestDelay    = 200 * time.Millisecond
+	defaultMaxConcurrency  = 5
+	defaultResultConsumers = 1
+
+	defaultMaxIdleConns    = 100
+	defaultIdleConnTimeout = 30 * time.Second
+
+	defaultCriticalThreshold = 90.0
+	defaultWarningThreshold  = 99.0
+
+	defaultEmptyAppPolicy          = EmptyPolicyPlaceholder
+	defaultEmptyAppPlaceholder     = "unknown"
+	defaultEmptyVersionPolicy      = EmptyPolicyPlaceholder
+	defaultEmptyVersionPlaceholder = "unknown"
+	defaultAppNameCase             = AppNameCaseSensitive
+
+	defaultServersFile       = "servers.txt"
+	defaultCacheServers      = true
+	defaultHealthPath        = "/healthz"
+	defaultHealthMethod      = http.MethodGet
+	defaultVolumeCurve       = VolumeCurveNone
+	defaultVolumeReference   = 10000
+	defaultVolumeMaxWeight   = 4
+	defaultRedirectPolicy    = RedirectPolicyFollow
+	defaultContentType       = "application/json"
+	defaultOutputFile        = "report.json"
+	defaultOutputFormat      = OutputFormatJSON
+	defaultGranularity       = GranularityVersion
+	defaultJSONIndent        = "  "
+	defaultSlowestN          = 10
+	defaultFailuresFile      = "failures.csv"
+	defaultBodyLogLimit      = 512
+	defaultMaxBodyBytes      = 64 * 1024
+	defaultPushgatewayJob    = "healthcheck"
+	defaultOTelServiceName   = "healthcheck"
+	defaultKafkaMessages     = KafkaMessagesRecord
+	defaultMetricsFlushDelay = 100 * time.Millisecond
+	defaultS3Region          = "us-east-1"
+	defaultMaxRetries        = 0
+	defaultRetryBackoff      = 500 * time.Millisecond
+	defaultRetryOnReset      = false
+	defaultRetryTLSHandshake = true
+	defaultIgnoreProxy       = false
+	defaultLatencyMode       = LatencyModeFinal
+
+	defaultCircuitCooldown = 5 * time.Minute
+	defaultUptimeTolerance = 5 * time.Second
+
+	defaultPinIdentity       = PinIdentityOff
+	defaultPinIdentityWindow = 3
+
+	defaultWatchdogFactor = 2.0
+
+	defaultRegressionTolerance = 1.0
+
+	defaultExitPolicy        = ExitPolicyNone
+	defaultExitErrorFraction = 0.1
+	defaultAuthTokenTimeout  = 10 * time.Second
+
+	defaultWebhookTimeout      = 5 * time.Second
+	defaultWebhookFlushTimeout = 10 * time.Second
+
+	defaultBurnRateFactor  = 14.4
+	defaultBurnShortWindow = 5 * time.Minute
+	defaultBurnLongWindow  = time.Hour
 )
 
 // NewDefaultConfig creates a Config with default values
 func NewDefaultConfig() *Config {
 	return &Config{
-		HTTPTimeout:    defaultHTTPTimeout,
-		RequestDelay:   defaultRequestDelay,
-		MaxConcurrency: defaultMaxConcurrency,
+		HTTPTimeout:     defaultHTTPTimeout,
+		RequestDelay:    defaultRequestDelay,
+		MaxConcurrency:  defaultMaxConcurrency,
+		ResultConsumers: defaultResultConsumers,
+		MaxIdleConns:    defaultMaxIdleConns,
+		IdleConnTimeout: defaultIdleConnTimeout,
+
+		CriticalThreshold: defaultCriticalThreshold,
+		WarningThreshold:  defaultWarningThreshold,
+
+		EmptyAppPolicy:          defaultEmptyAppPolicy,
+		EmptyAppPlaceholder:     defaultEmptyAppPlaceholder,
+		EmptyVersionPolicy:      defaultEmptyVersionPolicy,
+		EmptyVersionPlaceholder: defaultEmptyVersionPlaceholder,
+		AppNameCase:             defaultAppNameCase,
+
+		ServersFile:       defaultServersFile,
+		HealthPath:        defaultHealthPath,
+		HealthMethod:      defaultHealthMethod,
+		CacheServers:      defaultCacheServers,
+		VolumeCurve:       defaultVolumeCurve,
+		VolumeReference:   defaultVolumeReference,
+		VolumeMaxWeight:   defaultVolumeMaxWeight,
+		RedirectPolicy:    defaultRedirectPolicy,
+		HealthContentType: defaultContentType,
+		Console:           os.Stdout,
+		OutputFile:        defaultOutputFile,
+		OutputFormat:      defaultOutputFormat,
+		OutputGranularity: defaultGranularity,
+		JSONIndent:        defaultJSONIndent,
+		SlowestN:          defaultSlowestN,
+		FailuresFile:      defaultFailuresFile,
+		BodyLogLimit:      defaultBodyLogLimit,
+		MaxBodyBytes:      defaultMaxBodyBytes,
+		DenyNetworks:      parseCIDRs(defaultDenyCIDRs),
+		IgnoreProxy:       defaultIgnoreProxy,
+		PushgatewayJob:    defaultPushgatewayJob,
+		OTelServiceName:   defaultOTelServiceName,
+		KafkaMessages:     defaultKafkaMessages,
+		MetricsFlushDelay: defaultMetricsFlushDelay,
+		S3Region:          defaultS3Region,
+		MaxRetries:        defaultMaxRetries,
+		RetryBackoff:      defaultRetryBackoff,
+		RetryOnReset:      defaultRetryOnReset,
+		RetryTLSHandshake: defaultRetryTLSHandshake,
+		LatencyMode:       defaultLatencyMode,
+
+		CircuitCooldown: defaultCircuitCooldown,
+		UptimeTolerance: defaultUptimeTolerance,
+
+		PinIdentity:       defaultPinIdentity,
+		PinIdentityWindow: defaultPinIdentityWindow,
+		WatchdogFactor:    defaultWatchdogFactor,
+
+		RegressionTolerance: defaultRegressionTolerance,
+
+		ExitPolicy:        defaultExitPolicy,
+		ExitErrorFraction: defaultExitErrorFraction,
+		AuthTokenTimeout:  defaultAuthTokenTimeout,
+
+		WebhookTimeout:      defaultWebhookTimeout,
+		WebhookFlushTimeout: defaultWebhookFlushTimeout,
+
+		BurnRateFactor:  defaultBurnRateFactor,
+		BurnShortWindow: defaultBurnShortWindow,
+		BurnLongWindow:  defaultBurnLongWindow,
 	}
 }
 
@@ -42,6 +541,106 @@ func LoadConfigFromEnv() *Config {
 		}
 	}
 
+	if timeout := os.Getenv("CONNECT_TIMEOUT"); timeout != "" {
+		if v, err := strconv.Atoi(timeout); err == nil && v >= 0 {
+			config.ConnectTimeout = time.Duration(v) * time.Millisecond
+		}
+	}
+
+	if idle := os.Getenv("MAX_IDLE_CONNS"); idle != "" {
+		if v, err := strconv.Atoi(idle); err == nil && v >= 0 {
+			config.MaxIdleConns = v
+		}
+	}
+
+	if timeout := os.Getenv("IDLE_CONN_TIMEOUT"); timeout != "" {
+		if v, err := strconv.Atoi(timeout); err == nil && v >= 0 {
+			config.IdleConnTimeout = time.Duration(v) * time.Second
+		}
+	}
+
+	if conns := os.Getenv("MAX_CONNS_PER_HOST"); conns != "" {
+		if v, err := strconv.Atoi(conns); err == nil && v >= 0 {
+			config.MaxConnsPerHost = v
+		}
+	}
+
+	if timeout := os.Getenv("RESPONSE_HEADER_TIMEOUT"); timeout != "" {
+		if v, err := strconv.Atoi(timeout); err == nil && v >= 0 {
+			config.ResponseHeaderTimeout = time.Duration(v) * time.Millisecond
+		}
+	}
+
+	if maxAge := os.Getenv("DNS_CACHE_MAX_AGE"); maxAge != "" {
+		if v, err := strconv.Atoi(maxAge); err == nil && v >= 0 {
+			config.DNSCacheMaxAge = time.Duration(v) * time.Second
+		}
+	}
+
+	if cidrs := os.Getenv("DENY_CIDRS"); cidrs != "" {
+		config.DenyNetworks = append(config.DenyNetworks, parseCIDRs(splitList(cidrs))...)
+	}
+
+	if denyPrivate := os.Getenv("DENY_PRIVATE_RANGES"); denyPrivate != "" {
+		if v, err := strconv.ParseBool(denyPrivate); err == nil && v {
+			config.DenyNetworks = append(config.DenyNetworks, parseCIDRs(privateCIDRs)...)
+		}
+	}
+
+	if cidrs := os.Getenv("ALLOW_CIDRS"); cidrs != "" {
+		config.AllowNetworks = parseCIDRs(splitList(cidrs))
+	}
+
+	if ignoreProxy := os.Getenv("IGNORE_PROXY"); ignoreProxy != "" {
+		if v, err := strconv.ParseBool(ignoreProxy); err == nil {
+			config.IgnoreProxy = v
+		}
+	}
+
+	if timeout := os.Getenv("BODY_TIMEOUT"); timeout != "" {
+		if v, err := strconv.Atoi(timeout); err == nil && v >= 0 {
+			config.BodyTimeout = time.Duration(v) * time.Millisecond
+		}
+	}
+
+	if deltas := os.Getenv("REQUEST_DELTAS"); deltas != "" {
+		if v, err := strconv.ParseBool(deltas); err == nil {
+			config.RequestDeltas = v
+		}
+	}
+
+	if grace := os.Getenv("COUNTER_RESET_GRACE"); grace != "" {
+		if v, err := strconv.Atoi(grace); err == nil && v >= 0 {
+			config.CounterResetGrace = v
+		}
+	}
+
+	if tolerance := os.Getenv("UPTIME_TOLERANCE"); tolerance != "" {
+		if v, err := strconv.Atoi(tolerance); err == nil && v >= 0 {
+			config.UptimeTolerance = time.Duration(v) * time.Second
+		}
+	}
+
+	if mode := strings.ToLower(os.Getenv("PIN_IDENTITY")); mode == PinIdentityOff || mode == PinIdentityFirst || mode == PinIdentityMajority {
+		config.PinIdentity = mode
+	}
+
+	if window := os.Getenv("PIN_IDENTITY_WINDOW"); window != "" {
+		if v, err := strconv.Atoi(window); err == nil && v > 0 {
+			config.PinIdentityWindow = v
+		}
+	}
+
+	if limit := os.Getenv("BODY_LOG_LIMIT"); limit != "" {
+		if v, err := strconv.Atoi(limit); err == nil && v >= 0 {
+			config.BodyLogLimit = v
+		}
+	}
+
+	if dir := os.Getenv("DEBUG_BODY_DIR"); dir != "" {
+		config.DebugBodyDir = dir
+	}
+
 	if delay := os.Getenv("REQUEST_DELAY"); delay != "" {
 		if v, err := strconv.Atoi(delay); err == nil {
 			config.RequestDelay = time.Duration(v) * time.Millisecond
@@ -54,5 +653,732 @@ func LoadConfigFromEnv() *Config {
 		}
 	}
 
+	if columns := os.Getenv("CSV_COLUMNS"); columns != "" {
+		config.CSVColumns = make(map[string]string)
+		for _, item := range splitList(columns) {
+			column, field, ok := strings.Cut(item, "=")
+			if !ok || strings.TrimSpace(column) == "" {
+				continue
+			}
+			config.CSVColumns[strings.TrimSpace(column)] = strings.TrimSpace(field)
+		}
+	}
+
+	if limits := os.Getenv("CLASS_CONCURRENCY"); limits != "" {
+		config.ClassConcurrency = make(map[string]int)
+		for _, item := range splitList(limits) {
+			class, limit, ok := strings.Cut(item, "=")
+			if !ok || strings.TrimSpace(class) == "" {
+				continue
+			}
+			if v, err := strconv.Atoi(strings.TrimSpace(limit)); err == nil && v > 0 {
+				config.ClassConcurrency[strings.TrimSpace(class)] = v
+			}
+		}
+	}
+
+	if consumers := os.Getenv("RESULT_CONSUMERS"); consumers != "" {
+		if v, err := strconv.Atoi(consumers); err == nil && v > 0 {
+			config.ResultConsumers = v
+		}
+	}
+
+	if compress := os.Getenv("COMPRESS"); compress != "" {
+		if v, err := strconv.ParseBool(compress); err == nil {
+			config.Compress = v
+		}
+	}
+
+	if shuffle := os.Getenv("SHUFFLE"); shuffle != "" {
+		if v, err := strconv.ParseBool(shuffle); err == nil {
+			config.Shuffle = v
+		}
+	}
+
+	if seed := os.Getenv("SHUFFLE_SEED"); seed != "" {
+		if v, err := strconv.ParseInt(seed, 10, 64); err == nil {
+			config.ShuffleSeed = v
+		}
+	}
+
+	if keep := os.Getenv("KEEP_HISTORY"); keep != "" {
+		if v, err := strconv.Atoi(keep); err == nil && v >= 0 {
+			config.KeepHistory = v
+		}
+	}
+
+	if threshold := os.Getenv("CRITICAL_THRESHOLD"); threshold != "" {
+		if v, err := strconv.ParseFloat(threshold, 64); err == nil {
+			config.CriticalThreshold = v
+		}
+	}
+
+	if threshold := os.Getenv("WARNING_THRESHOLD"); threshold != "" {
+		if v, err := strconv.ParseFloat(threshold, 64); err == nil {
+			config.WarningThreshold = v
+		}
+	}
+
+	if host := os.Getenv("BASTION_HOST"); host != "" {
+		config.BastionHost = host
+	}
+
+	if user := os.Getenv("BASTION_USER"); user != "" {
+		config.BastionUser = user
+	}
+
+	if key := os.Getenv("BASTION_KEY_FILE"); key != "" {
+		config.BastionKeyFile = key
+	}
+
+	if knownHosts := os.Getenv("BASTION_KNOWN_HOSTS"); knownHosts != "" {
+		config.BastionKnownHosts = knownHosts
+	}
+
+	if insecure := os.Getenv("BASTION_INSECURE_HOST_KEY"); insecure != "" {
+		if v, err := strconv.ParseBool(insecure); err == nil {
+			config.BastionInsecureHostKey = v
+		}
+	}
+
+	if conditional := os.Getenv("CONDITIONAL_REQUESTS"); conditional != "" {
+		if v, err := strconv.ParseBool(conditional); err == nil {
+			config.ConditionalRequests = v
+		}
+	}
+
+	if force := os.Getenv("FORCE_HTTP2"); force != "" {
+		if v, err := strconv.ParseBool(force); err == nil {
+			config.ForceHTTP2 = v
+		}
+	}
+
+	if percentiles := os.Getenv("SUCCESS_PERCENTILES"); percentiles != "" {
+		config.SuccessPercentiles = nil
+		for _, item := range splitList(percentiles) {
+			if v, err := strconv.ParseFloat(strings.TrimPrefix(strings.ToLower(item), "p"), 64); err == nil && v >= 0 && v <= 100 {
+				config.SuccessPercentiles = append(config.SuccessPercentiles, v)
+			}
+		}
+	}
+
+	if shares := os.Getenv("VOLUME_SHARES"); shares != "" {
+		if v, err := strconv.ParseBool(shares); err == nil {
+			config.VolumeShares = v
+		}
+	}
+
+	if envelope := os.Getenv("REPORT_ENVELOPE"); envelope != "" {
+		if v, err := strconv.ParseBool(envelope); err == nil {
+			config.ReportEnvelope = v
+		}
+	}
+
+	if raw := os.Getenv("INCLUDE_RAW"); raw != "" {
+		if v, err := strconv.ParseBool(raw); err == nil {
+			config.IncludeRaw = v
+		}
+	}
+
+	if rawBody := os.Getenv("INCLUDE_RAW_BODY"); rawBody != "" {
+		if v, err := strconv.ParseBool(rawBody); err == nil {
+			config.IncludeRawBody = v
+		}
+	}
+
+	if maxBody := os.Getenv("MAX_BODY_BYTES"); maxBody != "" {
+		if v, err := strconv.Atoi(maxBody); err == nil && v > 0 {
+			config.MaxBodyBytes = v
+		}
+	}
+
+	if streaming := os.Getenv("HEALTH_STREAMING"); streaming != "" {
+		if v, err := strconv.ParseBool(streaming); err == nil {
+			config.HealthStreaming = v
+		}
+	}
+
+	if policy := os.Getenv("EMPTY_APP_POLICY"); isValidEmptyPolicy(policy) {
+		config.EmptyAppPolicy = policy
+	}
+
+	if placeholder := os.Getenv("EMPTY_APP_PLACEHOLDER"); placeholder != "" {
+		config.EmptyAppPlaceholder = placeholder
+	}
+
+	if policy := os.Getenv("EMPTY_VERSION_POLICY"); isValidEmptyPolicy(policy) {
+		config.EmptyVersionPolicy = policy
+	}
+
+	if placeholder := os.Getenv("EMPTY_VERSION_PLACEHOLDER"); placeholder != "" {
+		config.EmptyVersionPlaceholder = placeholder
+	}
+
+	if mode := strings.ToLower(os.Getenv("APP_NAME_CASE")); mode == AppNameCaseSensitive || mode == AppNameCaseFold || mode == AppNameCaseLower {
+		config.AppNameCase = mode
+	}
+
+	if names := os.Getenv("APP_NAME_MAP"); names != "" {
+		config.AppNameMap = make(map[string]string)
+		for _, item := range splitList(names) {
+			alias, name, ok := strings.Cut(item, "=")
+			if alias, name = strings.TrimSpace(alias), strings.TrimSpace(name); ok && alias != "" && name != "" {
+				config.AppNameMap[alias] = name
+			}
+		}
+	}
+
+	if servers := os.Getenv("SERVERS_FILE"); servers != "" {
+		config.ServersFile = servers
+	}
+
+	if environment := os.Getenv("ENVIRONMENT"); environment != "" {
+		config.Environment = environment
+	}
+
+	if region := os.Getenv("REGION"); region != "" {
+		config.Region = region
+	}
+
+	if shard := os.Getenv("SHARD"); shard != "" {
+		config.Shard = shard
+	}
+
+	if recursive := os.Getenv("SERVERS_RECURSIVE"); recursive != "" {
+		if v, err := strconv.ParseBool(recursive); err == nil {
+			config.ServersRecursive = v
+		}
+	}
+
+	if cache := os.Getenv("SERVERS_CACHE"); cache != "" {
+		if v, err := strconv.ParseBool(cache); err == nil {
+			config.CacheServers = v
+		}
+	}
+
+	if interval := os.Getenv("SERVERS_RELOAD_INTERVAL"); interval != "" {
+		if v, err := strconv.Atoi(interval); err == nil && v >= 0 {
+			config.ServersReloadInterval = time.Duration(v) * time.Second
+		}
+	}
+
+	if normalize := os.Getenv("NORMALIZE_HOSTS"); normalize != "" {
+		if v, err := strconv.ParseBool(normalize); err == nil {
+			config.NormalizeHosts = v
+		}
+	}
+
+	if strip := os.Getenv("NORMALIZE_STRIP_PORT"); strip != "" {
+		if v, err := strconv.ParseBool(strip); err == nil {
+			config.NormalizeStripPort = v
+		}
+	}
+
+	if path := os.Getenv("HEALTH_PATH"); path != "" {
+		config.HealthPath = path
+	}
+
+	if method := strings.ToUpper(os.Getenv("HEALTH_METHOD")); method == http.MethodGet || method == http.MethodHead || method == http.MethodPost {
+		config.HealthMethod = method
+	}
+
+	if policy := strings.ToLower(os.Getenv("REDIRECT_POLICY")); policy == RedirectPolicyFollow || policy == RedirectPolicySuccess || policy == RedirectPolicyFailure {
+		config.RedirectPolicy = policy
+	}
+
+	if field := os.Getenv("HEALTH_BOOLEAN_FIELD"); field != "" {
+		config.HealthBooleanField = field
+	}
+
+	if field := os.Getenv("HEALTH_COMPONENTS_FIELD"); field != "" {
+		config.HealthComponentsField = field
+	}
+
+	if command := os.Getenv("AUTH_TOKEN_COMMAND"); command != "" {
+		config.AuthTokenCommand = command
+	}
+
+	if timeout := os.Getenv("AUTH_TOKEN_TIMEOUT"); timeout != "" {
+		if v, err := strconv.Atoi(timeout); err == nil && v > 0 {
+			config.AuthTokenTimeout = time.Duration(v) * time.Second
+		}
+	}
+
+	if ttl := os.Getenv("AUTH_TOKEN_TTL"); ttl != "" {
+		if v, err := strconv.Atoi(ttl); err == nil && v >= 0 {
+			config.AuthTokenTTL = time.Duration(v) * time.Second
+		}
+	}
+
+	if metrics := os.Getenv("PROMETHEUS_METRICS"); metrics != "" {
+		config.PrometheusMetrics = make(map[string]string)
+		for _, item := range splitList(metrics) {
+			if field, metric, ok := strings.Cut(item, "="); ok && isPrometheusField(strings.TrimSpace(field)) && strings.TrimSpace(metric) != "" {
+				config.PrometheusMetrics[strings.TrimSpace(field)] = strings.TrimSpace(metric)
+			}
+		}
+	}
+
+	if body := os.Getenv("HEALTH_BODY"); body != "" {
+		config.HealthBody = body
+	}
+
+	if host := os.Getenv("HOST_HEADER"); host != "" {
+		config.HostHeader = host
+	}
+
+	if contentType := os.Getenv("HEALTH_CONTENT_TYPE"); contentType != "" {
+		config.HealthContentType = contentType
+	}
+
+	if paths := os.Getenv("HEALTH_PATHS"); paths != "" {
+		config.HealthPaths = make(map[string]string)
+		for _, item := range splitList(paths) {
+			if app, path, ok := strings.Cut(item, "="); ok && strings.TrimSpace(app) != "" && strings.TrimSpace(path) != "" {
+				config.HealthPaths[strings.TrimSpace(app)] = strings.TrimSpace(path)
+			}
+		}
+	}
+
+	if output := os.Getenv("OUTPUT_FILE"); output != "" {
+		config.OutputFile = output
+	}
+
+	if fallback := os.Getenv("OUTPUT_FALLBACK_STDOUT"); fallback != "" {
+		if v, err := strconv.ParseBool(fallback); err == nil {
+			config.OutputFallbackStdout = v
+		}
+	}
+
+	if stream := os.Getenv("STREAM_OUTPUT"); stream != "" {
+		config.StreamOutput = stream
+	}
+
+	if failures := os.Getenv("FAILURES_FILE"); failures != "" {
+		config.FailuresFile = failures
+	}
+
+	if alerts := os.Getenv("ALERTS_FILE"); alerts != "" {
+		config.AlertsFile = alerts
+	}
+
+	if format := os.Getenv("OUTPUT_FORMAT"); format != "" {
+		config.OutputFormat = strings.ToLower(format)
+	}
+	if os.Getenv("OUTPUT_FILE") == "" {
+		config.OutputFile = defaultOutputFileFor(config.OutputFormat)
+	}
+
+	if slowest := os.Getenv("SLOWEST_N"); slowest != "" {
+		if v, err := strconv.Atoi(slowest); err == nil && v >= 0 {
+			config.SlowestN = v
+		}
+	}
+
+	if report := os.Getenv("REPORT_SLOWEST"); report != "" {
+		if v, err := strconv.ParseBool(report); err == nil {
+			config.ReportSlowest = v
+		}
+	}
+
+	if flatten := os.Getenv("FLATTEN_SINGLE_APP"); flatten != "" {
+		if v, err := strconv.ParseBool(flatten); err == nil {
+			config.FlattenSingleApp = v
+		}
+	}
+
+	if indent := os.Getenv("JSON_INDENT"); indent != "" {
+		if v, ok := parseJSONIndent(indent); ok {
+			config.JSONIndent = v
+		}
+	}
+
+	if granularity := strings.ToLower(os.Getenv("OUTPUT_GRANULARITY")); granularity == GranularityApplication || granularity == GranularityVersion {
+		config.OutputGranularity = granularity
+	}
+
+	if endpoint := os.Getenv("S3_ENDPOINT"); endpoint != "" {
+		config.S3Endpoint = endpoint
+	}
+
+	if region := os.Getenv("AWS_REGION"); region != "" {
+		config.S3Region = region
+	}
+
+	if retries := os.Getenv("MAX_RETRIES"); retries != "" {
+		if v, err := strconv.Atoi(retries); err == nil && v >= 0 {
+			config.MaxRetries = v
+		}
+	}
+
+	if requests := os.Getenv("MAX_TOTAL_REQUESTS"); requests != "" {
+		if v, err := strconv.Atoi(requests); err == nil && v >= 0 {
+			config.MaxTotalRequests = v
+		}
+	}
+
+	if retries := os.Getenv("MAX_TOTAL_RETRIES"); retries != "" {
+		if v, err := strconv.Atoi(retries); err == nil && v >= 0 {
+			config.MaxTotalRetries = v
+		}
+	}
+
+	if threshold := os.Getenv("CIRCUIT_THRESHOLD"); threshold != "" {
+		if v, err := strconv.Atoi(threshold); err == nil && v >= 0 {
+			config.CircuitThreshold = v
+		}
+	}
+
+	if cooldown := os.Getenv("CIRCUIT_COOLDOWN"); cooldown != "" {
+		if v, err := strconv.Atoi(cooldown); err == nil && v >= 0 {
+			config.CircuitCooldown = time.Duration(v) * time.Second
+		}
+	}
+
+	if decode := os.Getenv("RETRY_DECODE"); decode != "" {
+		if v, err := strconv.ParseBool(decode); err == nil {
+			config.RetryDecode = v
+		}
+	}
+
+	if handshake := os.Getenv("RETRY_TLS_HANDSHAKE"); handshake != "" {
+		if v, err := strconv.ParseBool(handshake); err == nil {
+			config.RetryTLSHandshake = v
+		}
+	}
+
+	if codes := os.Getenv("RETRY_STATUS_CODES"); codes != "" {
+		config.RetryStatusCodes = parseRetryStatusCodes(splitList(codes))
+	}
+
+	if reset := os.Getenv("RETRY_ON_RESET"); reset != "" {
+		if v, err := strconv.ParseBool(reset); err == nil {
+			config.RetryOnReset = v
+		}
+	}
+
+	if backoff := os.Getenv("RETRY_BACKOFF"); backoff != "" {
+		if v, err := strconv.Atoi(backoff); err == nil && v >= 0 {
+			config.RetryBackoff = time.Duration(v) * time.Millisecond
+		}
+	}
+
+	if mode := strings.ToLower(os.Getenv("LATENCY_MODE")); mode == LatencyModeFinal || mode == LatencyModeCumulative {
+		config.LatencyMode = mode
+	}
+
+	if app := os.Getenv("TARGET_APP"); app != "" {
+		config.TargetApp = app
+	}
+
+	if strict := os.Getenv("TARGET_APP_STRICT"); strict != "" {
+		if v, err := strconv.ParseBool(strict); err == nil {
+			config.TargetAppStrict = v
+		}
+	}
+
+	if tui := os.Getenv("TUI"); tui != "" {
+		if v, err := strconv.ParseBool(tui); err == nil {
+			config.TUI = v
+		}
+	}
+
+	if interval := os.Getenv("WATCH_INTERVAL"); interval != "" {
+		if v, err := strconv.Atoi(interval); err == nil && v >= 0 {
+			config.WatchInterval = time.Duration(v) * time.Second
+		}
+	}
+
+	if jitter := os.Getenv("WATCH_JITTER"); jitter != "" {
+		if v, err := strconv.ParseFloat(jitter, 64); err == nil && v >= 0 && v <= 100 {
+			config.WatchJitter = v
+		}
+	}
+
+	if seed := os.Getenv("WATCH_JITTER_SEED"); seed != "" {
+		if v, err := strconv.ParseInt(seed, 10, 64); err == nil {
+			config.WatchJitterSeed = v
+		}
+	}
+
+	if timeout := os.Getenv("RUN_TIMEOUT"); timeout != "" {
+		if v, err := strconv.Atoi(timeout); err == nil && v >= 0 {
+			config.RunTimeout = time.Duration(v) * time.Second
+		}
+	}
+
+	if age := os.Getenv("READY_MAX_AGE"); age != "" {
+		if v, err := strconv.Atoi(age); err == nil && v >= 0 {
+			config.ReadyMaxAge = time.Duration(v) * time.Second
+		}
+	}
+
+	if factor := os.Getenv("WATCHDOG_FACTOR"); factor != "" {
+		if v, err := strconv.ParseFloat(factor, 64); err == nil && v >= 1 {
+			config.WatchdogFactor = v
+		}
+	}
+
+	if file := os.Getenv("SLO_FILE"); file != "" {
+		config.SLOFile = file
+	}
+
+	if target := os.Getenv("SLO_TARGET"); target != "" {
+		if v, err := strconv.ParseFloat(target, 64); err == nil && v >= 0 && v < 100 {
+			config.SLOTarget = v
+		}
+	}
+
+	if factor := os.Getenv("BURN_RATE_FACTOR"); factor != "" {
+		if v, err := strconv.ParseFloat(factor, 64); err == nil && v > 0 {
+			config.BurnRateFactor = v
+		}
+	}
+
+	if window := os.Getenv("BURN_SHORT_WINDOW"); window != "" {
+		if v, err := strconv.Atoi(window); err == nil && v > 0 {
+			config.BurnShortWindow = time.Duration(v) * time.Minute
+		}
+	}
+
+	if window := os.Getenv("BURN_LONG_WINDOW"); window != "" {
+		if v, err := strconv.Atoi(window); err == nil && v > 0 {
+			config.BurnLongWindow = time.Duration(v) * time.Minute
+		}
+	}
+
+	if addr := os.Getenv("METRICS_ADDR"); addr != "" {
+		config.MetricsAddr = addr
+	}
+
+	if labels := os.Getenv("METRICS_LABELS"); labels != "" {
+		config.MetricsLabels = splitList(labels)
+	}
+
+	if instances := os.Getenv("MAX_INSTANCES_PER_VERSION"); instances != "" {
+		if v, err := strconv.Atoi(instances); err == nil && v >= 0 {
+			config.MaxInstancesPerVersion = v
+		}
+	}
+
+	if minRequests := os.Getenv("MIN_REQUESTS"); minRequests != "" {
+		if v, err := strconv.ParseInt(minRequests, 10, 64); err == nil && v >= 0 {
+			config.MinRequests = v
+		}
+	}
+
+	if curve := strings.ToLower(os.Getenv("SEVERITY_VOLUME_CURVE")); curve == VolumeCurveNone || curve == VolumeCurveLinear || curve == VolumeCurveSqrt || curve == VolumeCurveLog {
+		config.VolumeCurve = curve
+	}
+
+	if reference := os.Getenv("SEVERITY_VOLUME_REFERENCE"); reference != "" {
+		if v, err := strconv.ParseInt(reference, 10, 64); err == nil && v > 0 {
+			config.VolumeReference = v
+		}
+	}
+
+	if weight := os.Getenv("SEVERITY_VOLUME_MAX_WEIGHT"); weight != "" {
+		if v, err := strconv.ParseFloat(weight, 64); err == nil && v >= 1 {
+			config.VolumeMaxWeight = v
+		}
+	}
+
+	if factor := os.Getenv("OUTLIER_FACTOR"); factor != "" {
+		if v, err := strconv.ParseFloat(factor, 64); err == nil && v >= 1 {
+			config.OutlierFactor = v
+		}
+	}
+
+	if addr := os.Getenv("STATSD_ADDR"); addr != "" {
+		config.StatsdAddr = addr
+	}
+
+	if gateway := os.Getenv("PUSHGATEWAY_URL"); gateway != "" {
+		config.PushgatewayURL = strings.TrimSuffix(gateway, "/")
+	}
+
+	if job := os.Getenv("PUSHGATEWAY_JOB"); job != "" {
+		config.PushgatewayJob = job
+	}
+
+	if endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); endpoint != "" {
+		config.OTLPEndpoint = endpoint
+	}
+
+	if service := os.Getenv("OTEL_SERVICE_NAME"); service != "" {
+		config.OTelServiceName = service
+	}
+
+	if attributes := os.Getenv("OTEL_RESOURCE_ATTRIBUTES"); attributes != "" {
+		config.OTelResourceAttributes = make(map[string]string)
+		for _, item := range splitList(attributes) {
+			key, value, ok := strings.Cut(item, "=")
+			if key = strings.TrimSpace(key); ok && key != "" {
+				config.OTelResourceAttributes[key] = strings.TrimSpace(value)
+			}
+		}
+	}
+
+	if brokers := os.Getenv("KAFKA_BROKERS"); brokers != "" {
+		config.KafkaBrokers = splitList(brokers)
+	}
+
+	if topic := os.Getenv("KAFKA_TOPIC"); topic != "" {
+		config.KafkaTopic = topic
+	}
+
+	if mode := strings.ToLower(os.Getenv("KAFKA_MESSAGES")); mode == KafkaMessagesRecord || mode == KafkaMessagesReport {
+		config.KafkaMessages = mode
+	}
+
+	if delay := os.Getenv("METRICS_FLUSH_DELAY"); delay != "" {
+		if v, err := strconv.Atoi(delay); err == nil && v >= 0 {
+			config.MetricsFlushDelay = time.Duration(v) * time.Millisecond
+		}
+	}
+
+	if pprof := os.Getenv("ENABLE_PPROF"); pprof != "" {
+		if v, err := strconv.ParseBool(pprof); err == nil {
+			config.EnablePprof = v
+		}
+	}
+
+	if fraction := os.Getenv("STATUS_CRITICAL_FRACTION"); fraction != "" {
+		if v, err := strconv.ParseFloat(fraction, 64); err == nil && v >= 0 && v < 1 {
+			config.StatusCriticalFraction = v
+		}
+	}
+
+	if fraction := os.Getenv("STATUS_DEGRADED_FRACTION"); fraction != "" {
+		if v, err := strconv.ParseFloat(fraction, 64); err == nil && v >= 0 && v < 1 {
+			config.StatusDegradedFraction = v
+		}
+	}
+
+	if baseline := os.Getenv("BASELINE_FILE"); baseline != "" {
+		config.BaselineFile = baseline
+	}
+
+	if tolerance := os.Getenv("REGRESSION_TOLERANCE"); tolerance != "" {
+		if v, err := strconv.ParseFloat(tolerance, 64); err == nil && v >= 0 {
+			config.RegressionTolerance = v
+		}
+	}
+
+	if fail := os.Getenv("FAIL_ON_REGRESSION"); fail != "" {
+		if v, err := strconv.ParseBool(fail); err == nil {
+			config.FailOnRegression = v
+		}
+	}
+
+	if policy := os.Getenv("EXIT_POLICY"); isValidExitPolicy(policy) {
+		config.ExitPolicy = policy
+	}
+
+	if threshold := os.Getenv("EXIT_THRESHOLD"); threshold != "" {
+		if v, err := strconv.ParseFloat(threshold, 64); err == nil {
+			config.ExitThreshold = v
+		}
+	}
+
+	if fraction := os.Getenv("EXIT_ERROR_FRACTION"); fraction != "" {
+		if v, err := strconv.ParseFloat(fraction, 64); err == nil && v >= 0 && v <= 1 {
+			config.ExitErrorFraction = v
+		}
+	}
+
+	if gate := os.Getenv("GLOBAL_RATE_GATE"); gate != "" {
+		if v, err := strconv.ParseFloat(gate, 64); err == nil && v >= 0 && v <= 100 {
+			config.GlobalRateGate = v
+		}
+	}
+
+	if url := os.Getenv("WEBHOOK_URL"); url != "" {
+		config.WebhookURL = url
+	}
+
+	if timeout := os.Getenv("WEBHOOK_TIMEOUT"); timeout != "" {
+		if v, err := strconv.Atoi(timeout); err == nil && v > 0 {
+			config.WebhookTimeout = time.Duration(v) * time.Second
+		}
+	}
+
+	if timeout := os.Getenv("WEBHOOK_FLUSH_TIMEOUT"); timeout != "" {
+		if v, err := strconv.Atoi(timeout); err == nil && v > 0 {
+			config.WebhookFlushTimeout = time.Duration(v) * time.Second
+		}
+	}
+
+	// A warning band below the critical one makes no sense, collapse it
+	if config.WarningThreshold < config.CriticalThreshold {
+		config.WarningThreshold = config.CriticalThreshold
+	}
+
 	return config
 }
+
+// isLivenessOnly reports whether health checks only tell whether servers are
+// up, without counts: HEAD checks and boolean health fields
+func isLivenessOnly(config *Config) bool {
+	return config.HealthMethod == http.MethodHead || config.HealthBooleanField != ""
+}
+
+// countDependentSettings names the enabled settings that need the request
+// counts liveness-only health checks do not return
+func countDependentSettings(config *Config) []string {
+	var settings []string
+	if config.SLOTarget > 0 {
+		settings = append(settings, "SLO_TARGET")
+	}
+	if config.ExitPolicy == ExitPolicyThreshold {
+		settings = append(settings, "EXIT_POLICY=threshold")
+	}
+	if config.StatsdAddr != "" {
+		settings = append(settings, "STATSD_ADDR")
+	}
+	if config.PushgatewayURL != "" {
+		settings = append(settings, "PUSHGATEWAY_URL")
+	}
+	if len(config.KafkaBrokers) > 0 && config.KafkaMessages == KafkaMessagesRecord {
+		settings = append(settings, "KAFKA_BROKERS")
+	}
+	if config.WebhookURL != "" {
+		settings = append(settings, "WEBHOOK_URL")
+	}
+	if config.VolumeShares {
+		settings = append(settings, "VOLUME_SHARES")
+	}
+	return settings
+}
+
+// parseJSONIndent parses JSON_INDENT: a number of spaces (0 for compact
+// output), "tab", or a literal indent made of spaces and tabs where \t may
+// also be written escaped
+func parseJSONIndent(value string) (string, bool) {
+	if n, err := strconv.Atoi(value); err == nil {
+		if n < 0 || n > 16 {
+			return "", false
+		}
+		return strings.Repeat(" ", n), true
+	}
+	if strings.EqualFold(value, "tab") {
+		return "\t", true
+	}
+	value = strings.ReplaceAll(value, `\t`, "\t")
+	if strings.Trim(value, " \t") != "" {
+		return "", false
+	}
+	return value, true
+}
+
+// splitList splits a comma separated list, trimming whitespace and dropping
+// empty items
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
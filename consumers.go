@@ -0,0 +1,64 @@
+package main
+
+import (
+	"sort"
+	"sync"
+)
+
+// resultShard is the share of results folded by one consumer goroutine
+type resultShard struct {
+	results     []ServerResult
+	data        []AggregatedData
+	aggregation map[string]map[string]AggregatedData
+}
+
+// consumeResults drains resultChannel with the given number of consumer
+// goroutines, each folding into its own shard of the aggregation. Shards are
+// merged in a fixed order once the channel is closed and the results and
+// per-instance data are sorted by server, so the outcome does not depend on
+// the number of consumers or on scheduling. When onResult is set it is called
+// with every result as it arrives.
+func consumeResults(resultChannel <-chan ServerResult, consumers int, onResult func(ServerResult)) ([]ServerResult, []AggregatedData, map[string]map[string]AggregatedData) {
+	if consumers < 1 {
+		consumers = 1
+	}
+	shards := make([]resultShard, consumers)
+	var wg sync.WaitGroup
+	for i := range shards {
+		wg.Add(1)
+		go func(shard *resultShard) {
+			defer wg.Done()
+			shard.aggregation = make(map[string]map[string]AggregatedData)
+			for result := range resultChannel {
+				if onResult != nil {
+					onResult(result)
+				}
+				shard.results = append(shard.results, result)
+				if result.Health != nil && !result.Dropped {
+					data := toAggregatedData(*result.Health)
+					shard.data = append(shard.data, data)
+					foldAggregatedData(shard.aggregation, data)
+				}
+			}
+		}(&shards[i])
+	}
+	wg.Wait()
+
+	var results []ServerResult
+	aggregation := make(map[string]map[string]AggregatedData)
+	for _, shard := range shards {
+		results = append(results, shard.results...)
+		for _, data := range sortedRecords(shard.aggregation) {
+			foldAggregatedData(aggregation, data)
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Server < results[j].Server })
+
+	var collectedData []AggregatedData
+	for _, result := range results {
+		if result.Health != nil && !result.Dropped {
+			collectedData = append(collectedData, toAggregatedData(*result.Health))
+		}
+	}
+	return results, collectedData, aggregation
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// Test that sharded consumers produce the same outcome as a single consumer
+func TestConsumeResultsSharded(t *testing.T) {
+	var results []ServerResult
+	for i := 0; i < 200; i++ {
+		result := ServerResult{Server: fmt.Sprintf("server-%04d", i)}
+		switch i % 4 {
+		case 0:
+			result.Error = "connection refused"
+		case 1:
+			result.Health = &HealthResponse{Application: "Cache", Version: "1.0", RequestCount: int64(i), SuccessCount: int64(i / 2), Status: "ok"}
+		case 2:
+			result.Health = &HealthResponse{Application: "Cache", Version: "2.0", RequestCount: int64(i), SuccessCount: int64(i), Status: "degraded"}
+		default:
+			result.Health = &HealthResponse{Application: fmt.Sprintf("App%d", i%3), Version: "1.0", RequestCount: 10, SuccessCount: 9}
+		}
+		results = append(results, result)
+	}
+
+	consume := func(consumers int) ([]ServerResult, []AggregatedData, map[string]map[string]AggregatedData) {
+		resultChannel := make(chan ServerResult, len(results))
+		for _, result := range results {
+			resultChannel <- result
+		}
+		close(resultChannel)
+		return consumeResults(resultChannel, consumers, nil)
+	}
+
+	baseResults, baseData, baseAggregation := consume(1)
+	if len(baseResults) != 200 || len(baseData) != 150 {
+		t.Fatalf("Expected 200 results and 150 records, got %d and %d", len(baseResults), len(baseData))
+	}
+	if !reflect.DeepEqual(baseAggregation, aggregateData(baseData)) {
+		t.Errorf("Expected the folded aggregation to match aggregateData")
+	}
+
+	for _, consumers := range []int{2, 8, 32} {
+		shardedResults, shardedData, shardedAggregation := consume(consumers)
+		if !reflect.DeepEqual(shardedResults, baseResults) || !reflect.DeepEqual(shardedData, baseData) {
+			t.Errorf("Expected %d consumers to collect the same results as one", consumers)
+		}
+		if !reflect.DeepEqual(shardedAggregation, baseAggregation) {
+			t.Errorf("Expected %d consumers to aggregate the same as one, got %v, expected %v", consumers, shardedAggregation, baseAggregation)
+		}
+	}
+}
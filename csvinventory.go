@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// Fields a CSV inventory column can map to besides tags
+const (
+	// csvHostField is the column holding the address to check
+	csvHostField = "host"
+	// csvNameField is the column holding the server's display name
+	csvNameField = "name"
+)
+
+// isCSVInventory reports whether path is a CSV inventory rather than a plain
+// servers list
+func isCSVInventory(path string) bool {
+	return strings.ToLower(filepath.Ext(path)) == ".csv"
+}
+
+// parseCSVInventory maps the rows of a CSV inventory with a header row onto
+// server entries. columns renames header columns to fields: the host column
+// is the address, the name column the display name, and every other non-empty
+// cell becomes a tag named after its (renamed) column. Columns mapped to "-"
+// are dropped. Malformed rows are skipped and returned as issues with their
+// line number.
+func parseCSVInventory(data []byte, columns map[string]string) ([]ServerEntry, []ValidationIssue, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.Comment = '#'
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil, fmt.Errorf("missing header row")
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid header row: %v", err)
+	}
+	fields := make([]string, len(header))
+	hostColumn := -1
+	for i, column := range header {
+		column = strings.TrimSpace(column)
+		fields[i] = column
+		if mapped, ok := columns[column]; ok {
+			fields[i] = mapped
+		}
+		if fields[i] == csvHostField {
+			hostColumn = i
+		}
+	}
+	if hostColumn < 0 {
+		return nil, nil, fmt.Errorf("no %q column in header %q", csvHostField, strings.Join(header, ","))
+	}
+
+	var entries []ServerEntry
+	var issues []ValidationIssue
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return nil, nil, err
+			}
+			issues = append(issues, ValidationIssue{Line: parseErr.Line, Message: parseErr.Err.Error()})
+			continue
+		}
+		line, _ := reader.FieldPos(0)
+		entry, err := csvInventoryEntry(record, fields, hostColumn)
+		if err != nil {
+			issues = append(issues, ValidationIssue{Line: line, Message: err.Error()})
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, issues, nil
+}
+
+// csvInventoryEntry converts a CSV inventory row to a server entry
+func csvInventoryEntry(record, fields []string, hostColumn int) (ServerEntry, error) {
+	if len(record) != len(fields) {
+		return ServerEntry{}, fmt.Errorf("expected %d columns, got %d", len(fields), len(record))
+	}
+	entry := ServerEntry{Address: strings.TrimSpace(record[hostColumn])}
+	if entry.Address == "" {
+		return ServerEntry{}, fmt.Errorf("empty %s", csvHostField)
+	}
+	for i, value := range record {
+		value = strings.TrimSpace(value)
+		switch field := fields[i]; {
+		case i == hostColumn || field == "-" || field == "" || value == "":
+		case field == csvNameField:
+			entry.Name = value
+		default:
+			if err := checkServerTag(field, value); err != nil {
+				return ServerEntry{}, err
+			}
+			if entry.Tags == nil {
+				entry.Tags = make(map[string]string)
+			}
+			entry.Tags[field] = value
+		}
+	}
+	return entry, nil
+}
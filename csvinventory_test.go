@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testCSVInventory = `host,app,version-expected,region
+server-0001.example.org,Memcache2,1.0.1,eu-west-1
+# decommissioned
+server-0002.example.org,Cassandra,,us-east-1
+server-0003.example.org,Memcache2
+,Memcache2,1.0.1,eu-west-1
+"server-0004.example.org",Memcache2,1.0.2,"us-east-1"
+`
+
+// Test that CSV inventory rows become tagged entries and malformed rows are
+// skipped with their line number
+func TestParseCSVInventory(t *testing.T) {
+	entries, issues, err := parseCSVInventory([]byte(testCSVInventory), map[string]string{"version-expected": "expected_version"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	expected := []ServerEntry{
+		{Address: "server-0001.example.org", Tags: map[string]string{"app": "Memcache2", "expected_version": "1.0.1", "region": "eu-west-1"}},
+		{Address: "server-0002.example.org", Tags: map[string]string{"app": "Cassandra", "region": "us-east-1"}},
+		{Address: "server-0004.example.org", Tags: map[string]string{"app": "Memcache2", "expected_version": "1.0.2", "region": "us-east-1"}},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("Expected entries %+v, got %+v", expected, entries)
+	}
+
+	if len(issues) != 2 || issues[0].Line != 5 || issues[1].Line != 6 {
+		t.Errorf("Expected issues on lines 5 and 6, got %+v", issues)
+	}
+
+	if _, _, err := parseCSVInventory([]byte("hostname,app\nserver-0001.example.org,Memcache2\n"), nil); err == nil {
+		t.Error("Expected an inventory without a host column to be refused")
+	}
+	entries, _, err = parseCSVInventory([]byte("hostname,fqdn,app\nweb1,web1.example.org,Web\n"), map[string]string{"hostname": "name", "fqdn": "host"})
+	if err != nil || len(entries) != 1 || entries[0].Name != "web1" || entries[0].Address != "web1.example.org" {
+		t.Errorf("Expected renamed host and name columns, got %+v, %v", entries, err)
+	}
+}
+
+// Test that a CSV SERVERS_FILE is loaded and validated as an inventory
+func TestLoadServerEntriesCSV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "inventory.csv")
+	if err := os.WriteFile(path, []byte(testCSVInventory), 0644); err != nil {
+		t.Fatalf("Failed to write inventory: %v", err)
+	}
+	config := NewDefaultConfig()
+	config.ServersFile = path
+
+	entries, err := loadServerEntries(config)
+	if err != nil || len(entries) != 3 {
+		t.Fatalf("Expected 3 entries, got %d, %v", len(entries), err)
+	}
+
+	var buf bytes.Buffer
+	if err := runValidate(nil, config, &buf); err == nil {
+		t.Error("Expected validate to fail on the malformed rows")
+	}
+	if !strings.Contains(buf.String(), "line 5: expected 4 columns, got 2") {
+		t.Errorf("Expected the malformed row to be reported, got %s", buf.String())
+	}
+}
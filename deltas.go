@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// RequestDelta is the number of requests an application version served
+// between two watch cycles
+type RequestDelta struct {
+	Application string `json:"application"`
+	Version     string `json:"version"`
+	Requests    int64  `json:"requests"`
+	// PerSecond is Requests over the time since the previous cycle
+	PerSecond float64 `json:"perSecond"`
+	// Resets counts the instances whose counters were reset since the
+	// previous cycle; they only count from this cycle on
+	Resets int `json:"resets,omitempty"`
+}
+
+// String describes the delta for the console
+func (d RequestDelta) String() string {
+	s := fmt.Sprintf("Application: %s, Version: %s, Requests: %d (%.1f/s)", d.Application, d.Version, d.Requests, d.PerSecond)
+	if d.Resets > 0 {
+		s += fmt.Sprintf(", %d counter resets", d.Resets)
+	}
+	return s
+}
+
+// counterSample is the counters a server reported in a cycle
+type counterSample struct {
+	identity  identity
+	requests  int64
+	successes int64
+	uptime    int64
+	// grace is the number of cycles the server is still left out after a
+	// counter reset
+	grace int
+}
+
+// resetSince reports whether the counters were reset since previous: the
+// server's uptime or a counter went down, so it was restarted, or it reports
+// another application or version, so it was redeployed
+func (s counterSample) resetSince(previous counterSample) bool {
+	return s.uptime < previous.uptime || s.requests < previous.requests || s.successes < previous.successes || s.identity != previous.identity
+}
+
+// requestDeltaTracker remembers the counters of each server URL across watch
+// cycles to work out the requests served in between
+type requestDeltaTracker struct {
+	grace  int
+	last   map[string]counterSample
+	lastAt time.Time
+	// totals sums the requests and successes served between cycles per
+	// application version, counters that never go down on a restart
+	totals map[identity]*AggregatedData
+}
+
+// newRequestDeltaTracker creates an empty tracker leaving servers out for
+// grace cycles after their counters reset
+func newRequestDeltaTracker(grace int) *requestDeltaTracker {
+	return &requestDeltaTracker{grace: grace, last: make(map[string]counterSample), totals: make(map[identity]*AggregatedData)}
+}
+
+// total returns the running totals of id, creating them at zero
+func (d *requestDeltaTracker) total(id identity) *AggregatedData {
+	total, ok := d.totals[id]
+	if !ok {
+		total = &AggregatedData{Application: id.Application, Version: id.Version}
+		d.totals[id] = total
+	}
+	return total
+}
+
+// Totals returns the requests and successes served per application and
+// version over all observed cycles, starting from zero when each server was
+// first seen. Unlike the cumulative counters the servers report, they never go
+// down when an instance restarts.
+func (d *requestDeltaTracker) Totals() map[string]map[string]AggregatedData {
+	totals := make(map[string]map[string]AggregatedData)
+	for _, total := range d.totals {
+		foldAggregatedData(totals, *total)
+	}
+	return totals
+}
+
+// Observe records the counters of a cycle's results and returns the requests
+// served per application and version since the previous cycle, sorted. A
+// server whose uptime or counters went down was restarted and its counters
+// reset, and one reporting another application or version was redeployed:
+// either way its current counters become a fresh baseline rather than a
+// negative delta, and the server is left out for the grace cycles after.
+// Servers first seen this cycle only set their baseline, so the first cycle
+// reports nothing.
+func (d *requestDeltaTracker) Observe(results []ServerResult, now time.Time) []RequestDelta {
+	elapsed := now.Sub(d.lastAt).Seconds()
+	d.lastAt = now
+
+	deltas := make(map[identity]*RequestDelta)
+	for _, result := range results {
+		if result.Health == nil || result.Dropped {
+			continue
+		}
+		current := counterSample{
+			identity:  identity{Application: result.Health.Application, Version: result.Health.Version},
+			requests:  result.Health.RequestCount,
+			successes: result.Health.SuccessCount,
+			uptime:    result.Health.Uptime,
+		}
+		total := d.total(current.identity)
+		previous, ok := d.last[result.URL]
+		if !ok {
+			d.last[result.URL] = current
+			continue
+		}
+
+		delta, ok := deltas[current.identity]
+		if !ok {
+			delta = &RequestDelta{Application: current.identity.Application, Version: current.identity.Version}
+			deltas[current.identity] = delta
+		}
+		switch {
+		case current.resetSince(previous):
+			current.grace = d.grace
+			delta.Resets++
+		case previous.grace > 0:
+			current.grace = previous.grace - 1
+		default:
+			delta.Requests += current.requests - previous.requests
+			total.TotalRequests += current.requests - previous.requests
+			total.TotalSuccesses += current.successes - previous.successes
+		}
+		d.last[result.URL] = current
+	}
+
+	sorted := make([]RequestDelta, 0, len(deltas))
+	for _, delta := range deltas {
+		if elapsed > 0 {
+			delta.PerSecond = float64(delta.Requests) / elapsed
+		}
+		sorted = append(sorted, *delta)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Application != sorted[j].Application {
+			return sorted[i].Application < sorted[j].Application
+		}
+		return sorted[i].Version < sorted[j].Version
+	})
+	return sorted
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Test the requests served between cycles, with a restarted instance and a
+// redeployed one starting a fresh baseline instead of a negative delta
+func TestRequestDeltas(t *testing.T) {
+	tracker := newRequestDeltaTracker(0)
+	result := func(url, version string, requests int64, uptime time.Duration) ServerResult {
+		return ServerResult{URL: url, Health: &HealthResponse{Application: "Memcache2", Version: version, RequestCount: requests, Uptime: int64(uptime)}}
+	}
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	if first := tracker.Observe([]ServerResult{
+		result("https://a/healthz", "1.0.1", 1000, time.Hour),
+		result("https://b/healthz", "1.0.1", 5000, time.Hour),
+		result("https://c/healthz", "1.0.1", 700, time.Hour),
+	}, start); len(first) != 0 {
+		t.Fatalf("Expected no deltas on the first cycle, got %+v", first)
+	}
+
+	second := tracker.Observe([]ServerResult{
+		result("https://a/healthz", "1.0.1", 1600, time.Hour+time.Minute),
+		// Restarted: both counters went down
+		result("https://b/healthz", "1.0.1", 40, 30*time.Second),
+		// Redeployed to a new version
+		result("https://c/healthz", "1.0.2", 900, time.Hour+time.Minute),
+		{URL: "https://d/healthz", Error: "connection refused"},
+	}, start.Add(time.Minute))
+	expected := []RequestDelta{
+		{Application: "Memcache2", Version: "1.0.1", Requests: 600, PerSecond: 10, Resets: 1},
+		{Application: "Memcache2", Version: "1.0.2", Resets: 1},
+	}
+	if !reflect.DeepEqual(second, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, second)
+	}
+
+	// The reset counters are the baseline of the next cycle
+	third := tracker.Observe([]ServerResult{
+		result("https://a/healthz", "1.0.1", 1600, time.Hour+2*time.Minute),
+		result("https://b/healthz", "1.0.1", 340, 90*time.Second),
+		result("https://c/healthz", "1.0.2", 1200, time.Hour+2*time.Minute),
+	}, start.Add(2*time.Minute))
+	expected = []RequestDelta{
+		{Application: "Memcache2", Version: "1.0.1", Requests: 300, PerSecond: 5},
+		{Application: "Memcache2", Version: "1.0.2", Requests: 300, PerSecond: 5},
+	}
+	if !reflect.DeepEqual(third, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, third)
+	}
+}
+
+// Test that a restarted instance is left out for the grace cycles and that the
+// running totals never go down
+func TestCounterResetGrace(t *testing.T) {
+	tracker := newRequestDeltaTracker(1)
+	result := func(url string, requests, successes int64, uptime time.Duration) ServerResult {
+		return ServerResult{URL: url, Health: &HealthResponse{Application: "Memcache2", Version: "1.0.1", RequestCount: requests, SuccessCount: successes, Uptime: int64(uptime)}}
+	}
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cycles := [][]ServerResult{
+		{result("https://a/healthz", 1000, 990, time.Hour), result("https://b/healthz", 5000, 5000, time.Hour)},
+		// b restarts: the reset cycle contributes nothing
+		{result("https://a/healthz", 1600, 1590, time.Hour+time.Minute), result("https://b/healthz", 40, 40, 30*time.Second)},
+		// b is still within its grace cycle
+		{result("https://a/healthz", 2200, 2190, time.Hour+2*time.Minute), result("https://b/healthz", 640, 600, 90*time.Second)},
+		// b counts again from its last counters
+		{result("https://a/healthz", 2800, 2790, time.Hour+3*time.Minute), result("https://b/healthz", 940, 900, 150*time.Second)},
+	}
+	expected := [][]RequestDelta{
+		{},
+		{{Application: "Memcache2", Version: "1.0.1", Requests: 600, PerSecond: 10, Resets: 1}},
+		{{Application: "Memcache2", Version: "1.0.1", Requests: 600, PerSecond: 10}},
+		{{Application: "Memcache2", Version: "1.0.1", Requests: 900, PerSecond: 15}},
+	}
+	expectedTotals := []AggregatedData{
+		{TotalRequests: 0, TotalSuccesses: 0},
+		{TotalRequests: 600, TotalSuccesses: 600},
+		{TotalRequests: 1200, TotalSuccesses: 1200},
+		{TotalRequests: 2100, TotalSuccesses: 2100},
+	}
+	for i, cycle := range cycles {
+		if deltas := tracker.Observe(cycle, start.Add(time.Duration(i)*time.Minute)); !reflect.DeepEqual(deltas, expected[i]) {
+			t.Errorf("Cycle %d: expected %+v, got %+v", i, expected[i], deltas)
+		}
+		total := tracker.Totals()["Memcache2"]["1.0.1"]
+		if total.TotalRequests != expectedTotals[i].TotalRequests || total.TotalSuccesses != expectedTotals[i].TotalSuccesses {
+			t.Errorf("Cycle %d: expected totals %+v, got %+v", i, expectedTotals[i], total)
+		}
+	}
+}
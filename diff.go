@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+)
+
+// Kinds of change between two reports
+const (
+	DiffAdded   = "added"
+	DiffRemoved = "removed"
+	DiffChanged = "changed"
+)
+
+// RecordDiff describes how an application/version differs between two reports
+type RecordDiff struct {
+	Application string  `json:"application"`
+	Version     string  `json:"version"`
+	Change      string  `json:"change"`
+	OldRate     float64 `json:"oldSuccessRate"`
+	NewRate     float64 `json:"newSuccessRate"`
+	OldSeverity string  `json:"oldSeverity,omitempty"`
+	NewSeverity string  `json:"newSeverity,omitempty"`
+}
+
+// diffReports returns the records added, removed or whose success rate or
+// severity changed between older and newer, sorted by application and version
+func diffReports(older, newer Report) []RecordDiff {
+	var diffs []RecordDiff
+	for _, data := range sortedRecords(newer.Applications) {
+		rate := successRate(data)
+		before, existed := older.Applications[data.Application][data.Version]
+		switch {
+		case !existed:
+			diffs = append(diffs, RecordDiff{Application: data.Application, Version: data.Version, Change: DiffAdded,
+				NewRate: rate, NewSeverity: data.Severity})
+		case successRate(before) != rate || before.Severity != data.Severity:
+			diffs = append(diffs, RecordDiff{Application: data.Application, Version: data.Version, Change: DiffChanged,
+				OldRate: successRate(before), NewRate: rate, OldSeverity: before.Severity, NewSeverity: data.Severity})
+		}
+	}
+	for _, data := range sortedRecords(older.Applications) {
+		if _, exists := newer.Applications[data.Application][data.Version]; !exists {
+			diffs = append(diffs, RecordDiff{Application: data.Application, Version: data.Version, Change: DiffRemoved,
+				OldRate: successRate(data), OldSeverity: data.Severity})
+		}
+	}
+	return diffs
+}
+
+// diffOptions are the parsed arguments of the diff command
+type diffOptions struct {
+	JSON bool
+	Old  string
+	New  string
+}
+
+// parseDiffFlags parses the diff command's arguments
+func parseDiffFlags(args []string) (diffOptions, error) {
+	var opts diffOptions
+	flags := flag.NewFlagSet("diff", flag.ContinueOnError)
+	flags.BoolVar(&opts.JSON, "json", false, "print the differences as JSON")
+	if err := flags.Parse(args); err != nil {
+		return opts, err
+	}
+	if flags.NArg() != 2 {
+		return opts, fmt.Errorf("diff needs exactly two reports, got %d", flags.NArg())
+	}
+	opts.Old, opts.New = flags.Arg(0), flags.Arg(1)
+	return opts, nil
+}
+
+// runDiff implements the diff command, which compares an older report with a
+// newer one
+func runDiff(args []string, _ *Config, out io.Writer) error {
+	opts, err := parseDiffFlags(args)
+	if err != nil {
+		return err
+	}
+
+	older, err := loadReport(opts.Old)
+	if err != nil {
+		return err
+	}
+	newer, err := loadReport(opts.New)
+	if err != nil {
+		return err
+	}
+	names, reports := []string{opts.Old, opts.New}, []Report{older, newer}
+	if err := checkSchemaVersions(names, reports); err != nil {
+		return err
+	}
+	if err := checkGranularities(names, reports); err != nil {
+		return err
+	}
+	diffs := diffReports(older, newer)
+
+	if opts.JSON {
+		data, err := json.MarshalIndent(diffs, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(out, string(data))
+		return nil
+	}
+
+	if len(diffs) == 0 {
+		fmt.Fprintln(out, "No differences")
+		return nil
+	}
+	for _, d := range diffs {
+		switch d.Change {
+		case DiffAdded:
+			fmt.Fprintf(out, "+ Application: %s, Version: %s, Success Rate: %.2f%%\n", d.Application, d.Version, d.NewRate)
+		case DiffRemoved:
+			fmt.Fprintf(out, "- Application: %s, Version: %s, Success Rate: %.2f%%\n", d.Application, d.Version, d.OldRate)
+		default:
+			fmt.Fprintf(out, "~ Application: %s, Version: %s, Success Rate: %.2f%% -> %.2f%% (%+.2f)\n",
+				d.Application, d.Version, d.OldRate, d.NewRate, d.NewRate-d.OldRate)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// Test that added, removed and changed records are reported
+func TestDiffReports(t *testing.T) {
+	older := Report{Applications: map[string]map[string]AggregatedData{
+		"Memcache2": {
+			"1.0.1": {Application: "Memcache2", Version: "1.0.1", TotalRequests: 100, TotalSuccesses: 100, Severity: SeverityOK},
+			"1.0.2": {Application: "Memcache2", Version: "1.0.2", TotalRequests: 100, TotalSuccesses: 100, Severity: SeverityOK},
+		},
+		"Cassandra": {"2.0.0": {Application: "Cassandra", Version: "2.0.0", TotalRequests: 10, TotalSuccesses: 10, Severity: SeverityOK}},
+	}}
+	newer := Report{Applications: map[string]map[string]AggregatedData{
+		"Memcache2": {
+			"1.0.1": {Application: "Memcache2", Version: "1.0.1", TotalRequests: 200, TotalSuccesses: 200, Severity: SeverityOK},
+			"1.0.2": {Application: "Memcache2", Version: "1.0.2", TotalRequests: 200, TotalSuccesses: 150, Severity: SeverityCritical},
+			"1.0.3": {Application: "Memcache2", Version: "1.0.3", TotalRequests: 10, TotalSuccesses: 10, Severity: SeverityOK},
+		},
+	}}
+
+	diffs := diffReports(older, newer)
+	expected := []struct{ version, change string }{
+		{"1.0.2", DiffChanged},
+		{"1.0.3", DiffAdded},
+		{"2.0.0", DiffRemoved},
+	}
+	if len(diffs) != len(expected) {
+		t.Fatalf("Expected %d differences, got %+v", len(expected), diffs)
+	}
+	for i, e := range expected {
+		if diffs[i].Version != e.version || diffs[i].Change != e.change {
+			t.Errorf("Difference %d: expected %s %s, got %+v", i, e.version, e.change, diffs[i])
+		}
+	}
+	if diffs[0].OldRate != 100 || diffs[0].NewRate != 75 {
+		t.Errorf("Expected 100%% -> 75%%, got %+v", diffs[0])
+	}
+}
+
+// Test the diff command's text output
+func TestRunDiff(t *testing.T) {
+	dir := t.TempDir()
+	records := func(successes int64) map[string]map[string]AggregatedData {
+		return map[string]map[string]AggregatedData{
+			"Memcache2": {"1.0.1": {Application: "Memcache2", Version: "1.0.1", TotalRequests: 100, TotalSuccesses: successes}},
+		}
+	}
+	older := writeTestReport(t, dir, "old.json", Report{SchemaVersion: reportSchemaVersion, Applications: records(100)})
+	newer := writeTestReport(t, dir, "new.json", Report{SchemaVersion: reportSchemaVersion, Applications: records(90)})
+
+	var buf bytes.Buffer
+	if err := runDiff([]string{older, newer}, NewDefaultConfig(), &buf); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !strings.Contains(buf.String(), "100.00% -> 90.00% (-10.00)") {
+		t.Errorf("Unexpected diff output %q", buf.String())
+	}
+
+	collapsed := writeTestReport(t, dir, "collapsed.json", Report{SchemaVersion: reportSchemaVersion, Meta: ReportMeta{Granularity: GranularityApplication}, Applications: records(90)})
+	if err := runDiff([]string{older, collapsed}, NewDefaultConfig(), &buf); err == nil || !strings.Contains(err.Error(), "granularity") {
+		t.Errorf("Expected reports of different granularities to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// resolver looks up the addresses of a host name, e.g. net.DefaultResolver
+type resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// dnsCacheEntry is a cached lookup and when it was resolved
+type dnsCacheEntry struct {
+	addrs      []net.IPAddr
+	resolvedAt time.Time
+}
+
+// dnsCache remembers host lookups across watch cycles for at most
+// DNS_CACHE_MAX_AGE. A connection failure to every cached address
+// invalidates the entry, so a failover is picked up on the next dial rather
+// than after the entry expires.
+type dnsCache struct {
+	maxAge   time.Duration
+	resolver resolver
+	now      func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]dnsCacheEntry
+}
+
+// newDNSCache creates an empty cache resolving with the system resolver
+func newDNSCache(config *Config) *dnsCache {
+	return &dnsCache{
+		maxAge:   config.DNSCacheMaxAge,
+		resolver: net.DefaultResolver,
+		now:      time.Now,
+		entries:  make(map[string]dnsCacheEntry),
+	}
+}
+
+// LookupIPAddr returns the cached addresses of host, resolving it again when
+// the entry is missing or older than the maximum age
+func (c *dnsCache) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	addrs, _, err := c.lookup(ctx, host)
+	return addrs, err
+}
+
+// lookup is LookupIPAddr also reporting whether the addresses came from the
+// cache
+func (c *dnsCache) lookup(ctx context.Context, host string) ([]net.IPAddr, bool, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[host]
+	c.mu.Unlock()
+	if ok && c.now().Sub(entry.resolvedAt) < c.maxAge {
+		return entry.addrs, true, nil
+	}
+
+	addrs, err := c.resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, false, err
+	}
+	c.mu.Lock()
+	c.entries[host] = dnsCacheEntry{addrs: addrs, resolvedAt: c.now()}
+	c.mu.Unlock()
+	return addrs, false, nil
+}
+
+// Invalidate forgets the cached addresses of host
+func (c *dnsCache) Invalidate(host string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, host)
+}
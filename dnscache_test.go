@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeResolver answers every lookup with its current address
+type fakeResolver struct {
+	mu      sync.Mutex
+	ip      string
+	lookups int
+}
+
+func (r *fakeResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lookups++
+	return []net.IPAddr{{IP: net.ParseIP(r.ip)}}, nil
+}
+
+// startServerOn serves the mock health response on ip:port
+func startServerOn(t *testing.T, ip string, port int) *httptest.Server {
+	listener, err := net.Listen("tcp", fmt.Sprintf("%s:%d", ip, port))
+	if err != nil {
+		t.Skipf("Cannot listen on %s: %v", ip, err)
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(mockResponse))
+	}))
+	server.Listener.Close()
+	server.Listener = listener
+	server.Start()
+	return server
+}
+
+// Test that a failover is picked up at once when the cached address stops
+// accepting connections, and that entries expire after DNS_CACHE_MAX_AGE
+func TestDNSCacheFailover(t *testing.T) {
+	primary := startServerOn(t, "127.0.0.2", 0)
+	port := primary.Listener.Addr().(*net.TCPAddr).Port
+
+	config := NewDefaultConfig()
+	config.RequestDelay = 0
+	config.DNSCacheMaxAge = time.Hour
+	resolver := &fakeResolver{ip: "127.0.0.2"}
+	cache := newDNSCache(config)
+	cache.resolver = resolver
+	state := &scanState{dns: cache}
+
+	check := func() ServerResult {
+		resultChannel := make(chan ServerResult, 1)
+		servers := []ServerEntry{{Address: fmt.Sprintf("http://failover.test:%d", port)}}
+		fetchHealthDataWithDelayAndConcurrency(context.Background(), servers, resultChannel, config, state)
+		return <-resultChannel
+	}
+
+	for i := 0; i < 2; i++ {
+		if result := check(); result.Error != "" {
+			t.Fatalf("Expected the primary to be reached, got %s", result.Error)
+		}
+	}
+	if resolver.lookups != 1 {
+		t.Errorf("Expected the second cycle to reuse the cached lookup, got %d lookups", resolver.lookups)
+	}
+
+	// Fail over: the primary goes away and the name now points at the standby
+	primary.Close()
+	standby := startServerOn(t, "127.0.0.3", port)
+	defer standby.Close()
+	resolver.mu.Lock()
+	resolver.ip = "127.0.0.3"
+	resolver.mu.Unlock()
+
+	if result := check(); result.Error != "" {
+		t.Errorf("Expected the standby to be reached after re-resolving, got %s", result.Error)
+	}
+	if resolver.lookups != 2 {
+		t.Errorf("Expected the failed cached address to be resolved again, got %d lookups", resolver.lookups)
+	}
+
+	// Entries older than the maximum age are resolved again
+	now := time.Now()
+	cache.now = func() time.Time { return now.Add(2 * time.Hour) }
+	if _, err := cache.LookupIPAddr(context.Background(), "failover.test"); err != nil || resolver.lookups != 3 {
+		t.Errorf("Expected an expired entry to be resolved again, got %d lookups (%v)", resolver.lookups, err)
+	}
+}
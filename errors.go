@@ -0,0 +1,96 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"syscall"
+)
+
+// Classifications of failed health checks
+const (
+	ErrorClassNetwork         = "network"
+	ErrorClassConnect         = "connect"
+	ErrorClassReset           = "connection_reset"
+	ErrorClassTimeout         = "timeout"
+	ErrorClassTLSHandshake    = "tls_handshake"
+	ErrorClassCertificate     = "tls_certificate"
+	ErrorClassBodyTimeout     = "body_timeout"
+	ErrorClassProtocol        = "protocol"
+	ErrorClassStatus          = "http_status"
+	ErrorClassDecode          = "decode"
+	ErrorClassInvalidCount    = "invalid_count"
+	ErrorClassInvalidUptime   = "invalid_uptime"
+	ErrorClassInvalidResponse = "invalid_response"
+	ErrorClassCircuitOpen     = "circuit_open"
+	ErrorClassUnhealthy       = "unhealthy"
+	ErrorClassDenied          = "denied"
+	ErrorClassSkippedBudget   = "skipped-budget"
+)
+
+// FetchError is a failed health check annotated with its classification
+type FetchError struct {
+	Class string
+	Err   error
+}
+
+func (e *FetchError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+// classifyError returns the classification of err, or an empty string when the
+// error carries none
+func classifyError(err error) string {
+	var fetchErr *FetchError
+	if errors.As(err, &fetchErr) {
+		return fetchErr.Class
+	}
+	return ""
+}
+
+// classifyNetworkError distinguishes hosts that could not be connected to from
+// hosts that accepted the connection but were too slow to answer, and both
+// from connections reset by the peer
+func classifyNetworkError(err error) string {
+	if class := classifyError(err); class != "" {
+		// Already classified where it was raised, e.g. by the destination guard
+		return class
+	}
+	if class := classifyTLSError(err); class != "" {
+		return class
+	}
+	if errors.Is(err, syscall.ECONNRESET) {
+		return ErrorClassReset
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return ErrorClassConnect
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ErrorClassTimeout
+	}
+	return ErrorClassNetwork
+}
+
+// classifyTLSError separates certificates that failed validation, which a
+// retry cannot fix, from other TLS handshake failures, often a flaky load
+// balancer. It returns an empty string when err is not a TLS error.
+func classifyTLSError(err error) string {
+	var unknownAuthority x509.UnknownAuthorityError
+	var invalid x509.CertificateInvalidError
+	var hostname x509.HostnameError
+	if errors.As(err, &unknownAuthority) || errors.As(err, &invalid) || errors.As(err, &hostname) {
+		return ErrorClassCertificate
+	}
+	var recordErr tls.RecordHeaderError
+	if errors.As(err, &recordErr) {
+		return ErrorClassTLSHandshake
+	}
+	return ""
+}
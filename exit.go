@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+)
+
+// Exit policies deciding when a scan fails
+const (
+	// ExitPolicyNone always exits successfully
+	ExitPolicyNone = "none"
+	// ExitPolicyAnyFetchError fails if any server could not be checked
+	ExitPolicyAnyFetchError = "any-fetch-error"
+	// ExitPolicyThreshold fails if any application/version is below EXIT_THRESHOLD
+	ExitPolicyThreshold = "threshold"
+	// ExitPolicyErrorFraction fails if more than EXIT_ERROR_FRACTION of servers failed
+	ExitPolicyErrorFraction = "error-fraction"
+)
+
+// Process exit codes
+const (
+	exitCodeOK           = 0
+	exitCodeError        = 1
+	exitCodePolicyFailed = 2
+)
+
+// exitError ends a command with a specific exit code, printing reason
+// instead of a generic error
+type exitError struct {
+	code   int
+	reason string
+}
+
+func (e *exitError) Error() string {
+	return e.reason
+}
+
+// isValidExitPolicy reports whether policy is a known exit policy
+func isValidExitPolicy(policy string) bool {
+	switch policy {
+	case ExitPolicyNone, ExitPolicyAnyFetchError, ExitPolicyThreshold, ExitPolicyErrorFraction:
+		return true
+	}
+	return false
+}
+
+// decideExitCode evaluates the configured exit policy against the outcome of
+// a scan and returns the process exit code along with the reason for failure
+func decideExitCode(outcome *cycleOutcome, config *Config) (int, string) {
+	switch config.ExitPolicy {
+	case ExitPolicyAnyFetchError:
+		if failed := countFailed(outcome.Results); failed > 0 {
+			return exitCodePolicyFailed, fmt.Sprintf("%d servers failed their health check", failed)
+		}
+
+	case ExitPolicyThreshold:
+		threshold := config.ExitThreshold
+		if threshold == 0 {
+			threshold = config.CriticalThreshold
+		}
+		for _, data := range sortedRecords(outcome.Report.Applications) {
+			if data.Severity == SeverityInsufficientData {
+				continue
+			}
+			if rate := successRate(data); rate < threshold {
+				return exitCodePolicyFailed, fmt.Sprintf("%s %s success rate %.2f%% is below %.2f%%",
+					data.Application, data.Version, rate, threshold)
+			}
+		}
+
+	case ExitPolicyErrorFraction:
+		if len(outcome.Results) == 0 {
+			break
+		}
+		failed := countFailed(outcome.Results)
+		fraction := float64(failed) / float64(len(outcome.Results))
+		if fraction > config.ExitErrorFraction {
+			return exitCodePolicyFailed, fmt.Sprintf("%.2f%% of servers failed, more than the allowed %.2f%%",
+				fraction*100, config.ExitErrorFraction*100)
+		}
+	}
+	return exitCodeOK, ""
+}
+
+// countFailed returns the number of results whose health check failed
+func countFailed(results []ServerResult) int {
+	failed := 0
+	for _, result := range results {
+		if result.Error != "" {
+			failed++
+		}
+	}
+	return failed
+}
+
+// globalSuccessRate returns the success rate of the whole fleet, weighted by
+// request volume, and the requests it was computed over
+func globalSuccessRate(aggregation map[string]map[string]AggregatedData) (float64, int64) {
+	var total AggregatedData
+	for _, versions := range aggregation {
+		for _, data := range versions {
+			total.TotalRequests += data.TotalRequests
+			total.TotalSuccesses += data.TotalSuccesses
+		}
+	}
+	return successRate(total), total.TotalRequests
+}
+
+// decideGlobalRateGate fails a scan whose fleet-wide success rate is below
+// GLOBAL_RATE_GATE, or that served no requests to compute it from. A rate
+// equal to the gate passes.
+func decideGlobalRateGate(outcome *cycleOutcome, config *Config) (int, string) {
+	rate, requests := globalSuccessRate(outcome.Report.Applications)
+	if requests == 0 {
+		return exitCodePolicyFailed, "no requests were reported to compute the global success rate from"
+	}
+	if rate < config.GlobalRateGate {
+		return exitCodePolicyFailed, fmt.Sprintf("global success rate %.2f%% is below %.2f%%", rate, config.GlobalRateGate)
+	}
+	return exitCodeOK, ""
+}
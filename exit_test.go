@@ -0,0 +1,86 @@
+package main
+
+import (
+	"testing"
+)
+
+// Test each exit policy against crafted scan outcomes
+func TestDecideExitCode(t *testing.T) {
+	healthy := AggregatedData{Application: "Memcache2", Version: "1.0.1", TotalRequests: 100, TotalSuccesses: 100}
+	degraded := AggregatedData{Application: "Memcache2", Version: "1.0.2", TotalRequests: 100, TotalSuccesses: 85}
+
+	outcome := func(records []AggregatedData, ok, failed int) *cycleOutcome {
+		var results []ServerResult
+		for i := 0; i < ok; i++ {
+			results = append(results, ServerResult{Health: &HealthResponse{}})
+		}
+		for i := 0; i < failed; i++ {
+			results = append(results, ServerResult{Error: "unreachable"})
+		}
+		return &cycleOutcome{Report: Report{Applications: aggregateData(records)}, Results: results}
+	}
+
+	tests := []struct {
+		name     string
+		policy   string
+		outcome  *cycleOutcome
+		expected int
+	}{
+		{"none ignores failures", ExitPolicyNone, outcome([]AggregatedData{degraded}, 1, 9), exitCodeOK},
+		{"any-fetch-error passes", ExitPolicyAnyFetchError, outcome([]AggregatedData{degraded}, 10, 0), exitCodeOK},
+		{"any-fetch-error fails", ExitPolicyAnyFetchError, outcome([]AggregatedData{healthy}, 9, 1), exitCodePolicyFailed},
+		{"threshold passes", ExitPolicyThreshold, outcome([]AggregatedData{healthy}, 9, 1), exitCodeOK},
+		{"threshold fails", ExitPolicyThreshold, outcome([]AggregatedData{healthy, degraded}, 10, 0), exitCodePolicyFailed},
+		{"error-fraction at limit passes", ExitPolicyErrorFraction, outcome(nil, 8, 2), exitCodeOK},
+		{"error-fraction above limit fails", ExitPolicyErrorFraction, outcome(nil, 7, 3), exitCodePolicyFailed},
+	}
+
+	for _, tt := range tests {
+		config := NewDefaultConfig()
+		config.ExitPolicy = tt.policy
+		config.ExitErrorFraction = 0.2
+		// The threshold policy falls back to CRITICAL_THRESHOLD (90%)
+		code, reason := decideExitCode(tt.outcome, config)
+		if code != tt.expected {
+			t.Errorf("%s: expected exit code %d, got %d (%s)", tt.name, tt.expected, code, reason)
+		}
+		if code != exitCodeOK && reason == "" {
+			t.Errorf("%s: expected a reason for the failure", tt.name)
+		}
+	}
+}
+
+// Test that the global rate gate weighs every application by its requests and
+// passes a rate equal to the gate
+func TestDecideGlobalRateGate(t *testing.T) {
+	records := []AggregatedData{
+		{Application: "Memcache2", Version: "1.0.1", TotalRequests: 900, TotalSuccesses: 890},
+		{Application: "Cassandra", Version: "2.0.0", TotalRequests: 100, TotalSuccesses: 60},
+	}
+	outcome := &cycleOutcome{Report: Report{Applications: aggregateData(records)}}
+	if rate, requests := globalSuccessRate(outcome.Report.Applications); rate != 95 || requests != 1000 {
+		t.Fatalf("Expected 95%% over 1000 requests, got %v%% over %d", rate, requests)
+	}
+
+	tests := []struct {
+		gate     float64
+		expected int
+	}{
+		{94.99, exitCodeOK},
+		{95, exitCodeOK},
+		{95.01, exitCodePolicyFailed},
+	}
+	for _, tt := range tests {
+		config := NewDefaultConfig()
+		config.GlobalRateGate = tt.gate
+		if code, reason := decideGlobalRateGate(outcome, config); code != tt.expected {
+			t.Errorf("Gate %v: expected exit code %d, got %d (%s)", tt.gate, tt.expected, code, reason)
+		}
+	}
+
+	config := NewDefaultConfig()
+	config.GlobalRateGate = 50
+	if code, _ := decideGlobalRateGate(&cycleOutcome{}, config); code != exitCodePolicyFailed {
+		t.Errorf("Expected a scan without requests to fail the gate, got %d", code)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// failuresCSVHeader lists the columns of the failures file
+var failuresCSVHeader = []string{"server", "classification", "status", "attempts", "lastError"}
+
+// failedResults returns the results whose fetch failed, sorted by server
+func failedResults(results []ServerResult) []ServerResult {
+	var failed []ServerResult
+	for _, result := range results {
+		if result.Error != "" {
+			failed = append(failed, result)
+		}
+	}
+	sort.SliceStable(failed, func(i, j int) bool { return failed[i].Server < failed[j].Server })
+	return failed
+}
+
+// encodeFailuresCSV renders failed results as CSV with a header row. A missing
+// status code is left empty.
+func encodeFailuresCSV(failed []ServerResult) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.Write(failuresCSVHeader); err != nil {
+		return nil, err
+	}
+	for _, result := range failed {
+		status := ""
+		if result.StatusCode != 0 {
+			status = strconv.Itoa(result.StatusCode)
+		}
+		row := []string{result.Server, result.ErrorClass, status, strconv.Itoa(result.Attempts), result.Error}
+		if err := w.Write(row); err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// writeFailuresCSV writes the failed results to path, reporting whether any
+// fetch failed. When every fetch succeeded the file of a previous run is
+// removed, so a stale list is never mistaken for the current one.
+func writeFailuresCSV(path string, results []ServerResult) (bool, error) {
+	failed := failedResults(results)
+	if len(failed) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return false, err
+		}
+		return false, nil
+	}
+	data, err := encodeFailuresCSV(failed)
+	if err != nil {
+		return true, err
+	}
+	return true, writeFileAtomic(path, data)
+}
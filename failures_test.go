@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Test that only failed servers are written to the failures CSV
+func TestWriteFailuresCSV(t *testing.T) {
+	healthy := setupMockServer()
+	defer healthy.Close()
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer unavailable.Close()
+	broken := setupMockServerWithBody("{not json")
+	defer broken.Close()
+
+	config := NewDefaultConfig()
+	config.RequestDelay = 0
+	results := collectResults([]ServerEntry{
+		{Address: healthy.URL}, {Address: unavailable.URL}, {Address: broken.URL},
+	}, config)
+
+	path := filepath.Join(t.TempDir(), "failures.csv")
+	written, err := writeFailuresCSV(path, results)
+	if err != nil || !written {
+		t.Fatalf("Expected the failures file to be written, got %v, %v", written, err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open failures file: %v", err)
+	}
+	defer file.Close()
+	rows, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to parse failures file: %v", err)
+	}
+
+	if len(rows) != 3 || !reflect.DeepEqual(rows[0], failuresCSVHeader) {
+		t.Fatalf("Expected a header and 2 rows, got %v", rows)
+	}
+	byServer := map[string][]string{}
+	for _, row := range rows[1:] {
+		byServer[row[0]] = row
+	}
+	if row := byServer[unavailable.URL]; row == nil || row[1] != ErrorClassStatus || row[2] != "503" || row[3] != "1" || !strings.Contains(row[4], "503") {
+		t.Errorf("Unexpected row for the unavailable server: %v", row)
+	}
+	if row := byServer[broken.URL]; row == nil || row[1] != ErrorClassDecode || row[2] != "200" {
+		t.Errorf("Unexpected row for the broken server: %v", row)
+	}
+}
+
+// Test that nothing is written when every fetch succeeded, and that the file
+// of an earlier run with failures is removed
+func TestWriteFailuresCSVNoFailures(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "failures.csv")
+	written, err := writeFailuresCSV(path, []ServerResult{{Server: "a"}})
+	if err != nil || written {
+		t.Fatalf("Expected nothing written, got %v, %v", written, err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected no failures file, got %v", err)
+	}
+
+	if _, err := writeFailuresCSV(path, []ServerResult{{Server: "b", Error: "refused"}}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := writeFailuresCSV(path, []ServerResult{{Server: "b"}}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected the stale failures file removed after a clean run, got %v", err)
+	}
+}
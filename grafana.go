@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// grafanaColumn describes a column of a Grafana JSON datasource table
+type grafanaColumn struct {
+	Text string `json:"text"`
+	Type string `json:"type"`
+}
+
+// grafanaTable is a table response of the Grafana JSON datasource: typed
+// columns and rows holding one value per column
+type grafanaTable struct {
+	Type    string          `json:"type"`
+	Columns []grafanaColumn `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+}
+
+// grafanaApplicationColumns are the columns of the per-version table
+var grafanaApplicationColumns = []grafanaColumn{
+	{Text: "Application", Type: "string"},
+	{Text: "Version", Type: "string"},
+	{Text: "Success Rate", Type: "number"},
+	{Text: "Total Requests", Type: "number"},
+	{Text: "Total Successes", Type: "number"},
+	{Text: "Severity", Type: "string"},
+}
+
+// grafanaLivenessColumns are the columns of the liveness table
+var grafanaLivenessColumns = []grafanaColumn{
+	{Text: "App", Type: "string"},
+	{Text: "Up", Type: "number"},
+	{Text: "Down", Type: "number"},
+	{Text: "Availability", Type: "number"},
+}
+
+// grafanaTables shapes the report as the tables a Grafana JSON datasource
+// query returns: one row per application and version, sorted, followed by a
+// liveness table when the report has one
+func grafanaTables(report Report) []grafanaTable {
+	applications := grafanaTable{Type: "table", Columns: grafanaApplicationColumns, Rows: [][]interface{}{}}
+	for _, data := range sortedRecords(report.Applications) {
+		applications.Rows = append(applications.Rows, []interface{}{
+			data.Application, data.Version, successRate(data), data.TotalRequests, data.TotalSuccesses, data.Severity,
+		})
+	}
+	tables := []grafanaTable{applications}
+
+	if len(report.Liveness) > 0 {
+		apps := make([]string, 0, len(report.Liveness))
+		for app := range report.Liveness {
+			apps = append(apps, app)
+		}
+		sort.Strings(apps)
+		liveness := grafanaTable{Type: "table", Columns: grafanaLivenessColumns}
+		for _, app := range apps {
+			l := report.Liveness[app]
+			liveness.Rows = append(liveness.Rows, []interface{}{app, l.Up, l.Down, l.Availability})
+		}
+		tables = append(tables, liveness)
+	}
+	return tables
+}
+
+// renderGrafanaReport encodes the report for the Grafana JSON datasource,
+// indented like the JSON report
+func renderGrafanaReport(report Report, indent string) ([]byte, error) {
+	if indent == "" {
+		return json.Marshal(grafanaTables(report))
+	}
+	return json.MarshalIndent(grafanaTables(report), "", indent)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// Test that the Grafana output decodes as datasource tables whose rows match
+// their typed columns
+func TestRenderGrafanaReport(t *testing.T) {
+	config := NewDefaultConfig()
+	config.OutputFormat = OutputFormatGrafana
+	aggregation := aggregateData([]AggregatedData{
+		{Application: "Memcache2", Version: "1.0.1", TotalRequests: 100, TotalSuccesses: 80},
+		{Application: "Cassandra", Version: "2.0.0", TotalRequests: 100, TotalSuccesses: 100},
+	})
+	annotateSeverity(aggregation, config)
+	report := buildReport(aggregation, nil, config)
+	report.Liveness = map[string]LivenessAvailability{"redis": {Up: 1, Down: 1, Availability: 50}}
+
+	output, err := encodeReport(report, config)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var tables []struct {
+		Type    string `json:"type"`
+		Columns []struct {
+			Text string `json:"text"`
+			Type string `json:"type"`
+		} `json:"columns"`
+		Rows [][]interface{} `json:"rows"`
+	}
+	if err := json.Unmarshal(output, &tables); err != nil {
+		t.Fatalf("Expected a JSON array of tables, got %v", err)
+	}
+	if len(tables) != 2 {
+		t.Fatalf("Expected application and liveness tables, got %d", len(tables))
+	}
+
+	for _, table := range tables {
+		if table.Type != "table" {
+			t.Errorf("Expected type table, got %s", table.Type)
+		}
+		for _, row := range table.Rows {
+			if len(row) != len(table.Columns) {
+				t.Fatalf("Expected %d values per row, got %v", len(table.Columns), row)
+			}
+			for i, column := range table.Columns {
+				switch row[i].(type) {
+				case string:
+					if column.Type != "string" {
+						t.Errorf("Column %s: expected a %s, got %v", column.Text, column.Type, row[i])
+					}
+				case float64:
+					if column.Type != "number" {
+						t.Errorf("Column %s: expected a %s, got %v", column.Text, column.Type, row[i])
+					}
+				default:
+					t.Errorf("Column %s: unexpected value %v", column.Text, row[i])
+				}
+			}
+		}
+	}
+
+	applications := tables[0]
+	if len(applications.Rows) != 2 || applications.Rows[0][0] != "Cassandra" {
+		t.Fatalf("Expected rows sorted by application, got %v", applications.Rows)
+	}
+	if row := applications.Rows[1]; row[2] != 80.0 || row[5] != SeverityCritical {
+		t.Errorf("Expected Memcache2 at 80%% and critical, got %v", row)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+)
+
+// Ranges refused by default: link-local addresses, which include the cloud
+// metadata endpoint 169.254.169.254
+var defaultDenyCIDRs = []string{"169.254.0.0/16", "fe80::/10"}
+
+// Private ranges refused with DENY_PRIVATE_RANGES (RFC 1918 and IPv6 ULA)
+var privateCIDRs = []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7"}
+
+// parseCIDRs parses CIDR ranges, also accepting bare IPs as single-address
+// ranges; invalid entries are ignored
+func parseCIDRs(cidrs []string) []*net.IPNet {
+	var networks []*net.IPNet
+	for _, cidr := range cidrs {
+		if ip := net.ParseIP(cidr); ip != nil {
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		if _, network, err := net.ParseCIDR(cidr); err == nil {
+			networks = append(networks, network)
+		}
+	}
+	return networks
+}
+
+// deniedNetwork returns the denied range containing ip, or nil when ip may be
+// connected to. Allowed ranges take precedence over denied ones.
+func deniedNetwork(ip net.IP, config *Config) *net.IPNet {
+	for _, network := range config.AllowNetworks {
+		if network.Contains(ip) {
+			return nil
+		}
+	}
+	for _, network := range config.DenyNetworks {
+		if network.Contains(ip) {
+			return network
+		}
+	}
+	return nil
+}
+
+// guardDial wraps dial (the default dialer when nil) so connections to denied
+// ranges are refused before they are opened. The host is resolved with r
+// first and the checked addresses are dialed directly, so a second lookup
+// cannot return a different answer. When r is nil only IP literals are
+// checked. When r is a dnsCache and no cached address accepts the connection, the
+// entry is invalidated and the host resolved again at once.
+func guardDial(config *Config, dial dialFunc, r resolver) dialFunc {
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	cache, _ := r.(*dnsCache)
+	if len(config.DenyNetworks) == 0 && cache == nil {
+		return dial
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		if ip := net.ParseIP(host); ip != nil || r == nil {
+			if ip != nil {
+				if err := checkDestination(host, ip, config); err != nil {
+					return nil, err
+				}
+			}
+			return dial(ctx, network, addr)
+		}
+
+		var addrs []net.IPAddr
+		cached := false
+		if cache != nil {
+			addrs, cached, err = cache.lookup(ctx, host)
+		} else {
+			addrs, err = r.LookupIPAddr(ctx, host)
+		}
+		if err != nil {
+			return nil, err
+		}
+		conn, err := dialChecked(ctx, dial, config, network, host, port, addrs)
+		if err != nil && cached && classifyError(err) != ErrorClassDenied {
+			// The cached addresses may predate a failover
+			cache.Invalidate(host)
+			if addrs, _, err = cache.lookup(ctx, host); err != nil {
+				return nil, err
+			}
+			conn, err = dialChecked(ctx, dial, config, network, host, port, addrs)
+		}
+		return conn, err
+	}
+}
+
+// dialChecked checks every address resolved from host against the denied
+// ranges and dials them in turn until one accepts the connection
+func dialChecked(ctx context.Context, dial dialFunc, config *Config, network, host, port string, addrs []net.IPAddr) (net.Conn, error) {
+	for _, ip := range addrs {
+		if err := checkDestination(host, ip.IP, config); err != nil {
+			return nil, err
+		}
+	}
+	lastErr := fmt.Errorf("no addresses found for %s", host)
+	for _, ip := range addrs {
+		conn, err := dial(ctx, network, net.JoinHostPort(ip.IP.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// checkDestination refuses ip, resolved from host, when it is in a denied range
+func checkDestination(host string, ip net.IP, config *Config) error {
+	if network := deniedNetwork(ip, config); network != nil {
+		if host == ip.String() {
+			return &FetchError{Class: ErrorClassDenied, Err: fmt.Errorf("destination %s is in denied range %s", ip, network)}
+		}
+		return &FetchError{Class: ErrorClassDenied, Err: fmt.Errorf("destination %s resolves to %s, which is in denied range %s", host, ip, network)}
+	}
+	return nil
+}
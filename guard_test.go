@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Test that a check of a server in a denied range is refused before connecting
+func TestDestinationGuard(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(mockResponse))
+	}))
+	defer server.Close()
+
+	config := NewDefaultConfig()
+	config.DenyNetworks = append(config.DenyNetworks, parseCIDRs([]string{"127.0.0.0/8", "::1"})...)
+
+	_, _, err := fetchHealthData(context.Background(), newHTTPClient(config), server.URL, config)
+	if err == nil {
+		t.Fatal("Expected the check of a denied address to fail")
+	}
+	if class := classifyError(err); class != ErrorClassDenied {
+		t.Errorf("Expected class %q, got %q", ErrorClassDenied, class)
+	}
+	if !strings.Contains(err.Error(), "in denied range 127.0.0.0/8") {
+		t.Errorf("Expected the error to name the denied range, got %v", err)
+	}
+	if requests != 0 {
+		t.Errorf("Expected no request to reach the server, got %d", requests)
+	}
+
+	if err := checkTCP(context.Background(), "tcp://"+server.Listener.Addr().String(), defaultHTTPTimeout, guardDial(config, nil, net.DefaultResolver)); classifyError(err) != ErrorClassDenied {
+		t.Errorf("Expected the TCP check to be denied, got %v", err)
+	}
+
+	config.AllowNetworks = parseCIDRs([]string{"127.0.0.1"})
+	if _, _, err := fetchHealthData(context.Background(), newHTTPClient(config), server.URL, config); err != nil {
+		t.Fatalf("Expected an allowed address to be checked, got %v", err)
+	}
+	if requests != 1 {
+		t.Errorf("Expected 1 request to reach the server, got %d", requests)
+	}
+}
+
+// Test the default deny list and the optional private ranges
+func TestDeniedNetwork(t *testing.T) {
+	config := NewDefaultConfig()
+	for _, tc := range []struct {
+		ip     string
+		denied bool
+	}{
+		{"169.254.169.254", true},
+		{"fe80::1", true},
+		{"10.0.0.1", false},
+		{"127.0.0.1", false},
+		{"8.8.8.8", false},
+	} {
+		if denied := deniedNetwork(net.ParseIP(tc.ip), config) != nil; denied != tc.denied {
+			t.Errorf("Expected %s denied=%v by default, got %v", tc.ip, tc.denied, denied)
+		}
+	}
+
+	config.DenyNetworks = append(config.DenyNetworks, parseCIDRs(privateCIDRs)...)
+	for _, ip := range []string{"10.1.2.3", "172.20.0.1", "192.168.1.1", "fd00::1"} {
+		if deniedNetwork(net.ParseIP(ip), config) == nil {
+			t.Errorf("Expected private address %s to be denied", ip)
+		}
+	}
+}
+
+// Test that proxy settings from the environment apply unless IGNORE_PROXY or
+// a bastion needs the servers dialed directly
+func TestGuardProxy(t *testing.T) {
+	config := NewDefaultConfig()
+	if newHTTPClient(config).Transport.(*http.Transport).Proxy == nil {
+		t.Error("Expected proxy settings from the environment to apply by default")
+	}
+	config.IgnoreProxy = true
+	if newHTTPClient(config).Transport.(*http.Transport).Proxy != nil {
+		t.Error("Expected servers to be dialed directly with IGNORE_PROXY")
+	}
+	config.IgnoreProxy, config.BastionHost = false, "bastion.example.org"
+	if newHTTPClient(config).Transport.(*http.Transport).Proxy != nil {
+		t.Error("Expected servers to be dialed through the bastion, not a proxy")
+	}
+}
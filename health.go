@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Policies for handling a health response with an empty identifying field
+const (
+	// EmptyPolicyPlaceholder buckets the record under a configurable placeholder
+	EmptyPolicyPlaceholder = "placeholder"
+	// EmptyPolicyDrop excludes the record from aggregation
+	EmptyPolicyDrop = "drop"
+	// EmptyPolicyError treats the record as a failed health check
+	EmptyPolicyError = "error"
+)
+
+// isValidEmptyPolicy reports whether policy is a known empty-field policy
+func isValidEmptyPolicy(policy string) bool {
+	switch policy {
+	case EmptyPolicyPlaceholder, EmptyPolicyDrop, EmptyPolicyError:
+		return true
+	}
+	return false
+}
+
+// validateHealth applies the configured empty-field policies, for the
+// application and then the version, to a decoded health response. It reports
+// whether the record should be dropped from aggregation, or returns an error
+// if the record must be treated as failed.
+func validateHealth(health *HealthResponse, serverURL string, config *Config) (bool, error) {
+	if health.Application == "" {
+		switch config.EmptyAppPolicy {
+		case EmptyPolicyDrop:
+			return true, nil
+		case EmptyPolicyError:
+			return false, &FetchError{
+				Class: ErrorClassInvalidResponse,
+				Err:   fmt.Errorf("server %s reported an empty application name", serverURL),
+			}
+		default:
+			health.Application = config.EmptyAppPlaceholder
+		}
+	}
+	if health.Version == "" {
+		switch config.EmptyVersionPolicy {
+		case EmptyPolicyDrop:
+			return true, nil
+		case EmptyPolicyError:
+			return false, &FetchError{
+				Class: ErrorClassInvalidResponse,
+				Err:   fmt.Errorf("server %s reported an empty version", serverURL),
+			}
+		default:
+			health.Version = config.EmptyVersionPlaceholder
+		}
+	}
+	return false, nil
+}
+
+// invalidCountError reports a count field that is not an integer
+type invalidCountError struct {
+	Value string
+}
+
+func (e *invalidCountError) Error() string {
+	return fmt.Sprintf("invalid count %s", e.Value)
+}
+
+// flexInt64 decodes an integer sent either as a JSON number or as a numeric
+// string, e.g. 5194800029 or "5194800029"
+type flexInt64 int64
+
+func (f *flexInt64) UnmarshalJSON(data []byte) error {
+	raw := string(data)
+	if raw == "null" {
+		return nil
+	}
+	if unquoted, err := strconv.Unquote(raw); err == nil {
+		raw = unquoted
+	}
+	v, err := strconv.ParseInt(strings.TrimSpace(raw), 10, 64)
+	if err != nil {
+		return &invalidCountError{Value: string(data)}
+	}
+	*f = flexInt64(v)
+	return nil
+}
+
+// invalidUptimeError reports an uptime that is neither nanoseconds nor a
+// duration string
+type invalidUptimeError struct {
+	Value string
+}
+
+func (e *invalidUptimeError) Error() string {
+	return fmt.Sprintf("invalid uptime %s", e.Value)
+}
+
+// flexUptime decodes an uptime sent as integer nanoseconds, either as a JSON
+// number or a numeric string, or as a human duration string such as
+// "53d 12h" or "1h30m"
+type flexUptime int64
+
+func (f *flexUptime) UnmarshalJSON(data []byte) error {
+	raw := string(data)
+	if raw == "null" {
+		return nil
+	}
+	if unquoted, err := strconv.Unquote(raw); err == nil {
+		raw = unquoted
+	}
+	raw = strings.TrimSpace(raw)
+	if v, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		*f = flexUptime(v)
+		return nil
+	}
+	d, err := parseUptime(raw)
+	if err != nil {
+		return &invalidUptimeError{Value: string(data)}
+	}
+	*f = flexUptime(d)
+	return nil
+}
+
+// parseUptime parses whitespace separated duration parts, each accepted by
+// time.ParseDuration or a whole number of days such as "53d"
+func parseUptime(value string) (time.Duration, error) {
+	parts := strings.Fields(value)
+	if len(parts) == 0 {
+		return 0, fmt.Errorf("empty uptime")
+	}
+	var total time.Duration
+	for _, part := range parts {
+		if days := strings.TrimSuffix(part, "d"); days != part {
+			n, err := strconv.ParseInt(days, 10, 64)
+			if err != nil || n < 0 {
+				return 0, fmt.Errorf("invalid days %q", part)
+			}
+			total += time.Duration(n) * 24 * time.Hour
+			continue
+		}
+		d, err := time.ParseDuration(part)
+		if err != nil {
+			return 0, err
+		}
+		total += d
+	}
+	return total, nil
+}
+
+// UnmarshalJSON decodes a health response, accepting counts encoded either as
+// JSON numbers or as numeric strings, and uptimes as nanoseconds or duration
+// strings
+func (h *HealthResponse) UnmarshalJSON(data []byte) error {
+	type plain HealthResponse
+	aux := struct {
+		*plain
+		Uptime       flexUptime `json:"uptime"`
+		RequestCount flexInt64  `json:"requestCount"`
+		ErrorCount   flexInt64  `json:"errorCount"`
+		SuccessCount flexInt64  `json:"successCount"`
+	}{plain: (*plain)(h)}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	h.Uptime = int64(aux.Uptime)
+	h.RequestCount = int64(aux.RequestCount)
+	h.ErrorCount = int64(aux.ErrorCount)
+	h.SuccessCount = int64(aux.SuccessCount)
+	return nil
+}
+
+// decodeFailingComponents returns the sorted names of the components under
+// field that are not healthy, e.g. cache in
+// {"components": {"db": {"ok": true}, "cache": {"ok": false}}}. A component
+// is healthy when it is true or an object with "ok": true; anything else,
+// including an unreadable value, counts as failing. A missing field reports
+// no components.
+func decodeFailingComponents(body []byte, field string) ([]string, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, err
+	}
+	raw, ok := fields[field]
+	if !ok || string(raw) == "null" {
+		return nil, nil
+	}
+	var components map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &components); err != nil {
+		return nil, fmt.Errorf("%s is %s, expected an object of components", field, raw)
+	}
+
+	var failing []string
+	for name, value := range components {
+		var healthy bool
+		if err := json.Unmarshal(value, &healthy); err != nil {
+			var check struct {
+				OK bool `json:"ok"`
+			}
+			json.Unmarshal(value, &check)
+			healthy = check.OK
+		}
+		if !healthy {
+			failing = append(failing, name)
+		}
+	}
+	sort.Strings(failing)
+	return failing, nil
+}
+
+// decodeBooleanHealth decides whether a server is up from the boolean field
+// HEALTH_BOOLEAN_FIELD of its response, e.g. {"healthy": true}. The
+// application and version are taken from the response when present. A false
+// or missing field fails the check as unhealthy.
+func decodeBooleanHealth(body []byte, serverURL string, config *Config) (HealthResponse, error) {
+	var health HealthResponse
+	var fields map[string]json.RawMessage
+	if err := json.NewDecoder(bytes.NewReader(body)).Decode(&fields); err != nil {
+		return health, &FetchError{Class: ErrorClassDecode, Err: fmt.Errorf("failed to decode JSON from server %s: %v. Response: %s", serverURL, err, bodySnippet(body, config.BodyLogLimit))}
+	}
+	json.Unmarshal(fields["application"], &health.Application)
+	json.Unmarshal(fields["version"], &health.Version)
+
+	raw, ok := fields[config.HealthBooleanField]
+	if !ok {
+		return health, &FetchError{Class: ErrorClassUnhealthy, Err: fmt.Errorf("server %s did not report %s", serverURL, config.HealthBooleanField)}
+	}
+	var healthy bool
+	if err := json.Unmarshal(raw, &healthy); err != nil {
+		return health, &FetchError{Class: ErrorClassInvalidResponse, Err: fmt.Errorf("server %s reported %s as %s, expected a boolean", serverURL, config.HealthBooleanField, raw)}
+	}
+	if !healthy {
+		return health, &FetchError{Class: ErrorClassUnhealthy, Err: fmt.Errorf("server %s reported %s: false", serverURL, config.HealthBooleanField)}
+	}
+	return health, nil
+}
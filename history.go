@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// historyTimeFormat is the timestamp layout embedded in history filenames.
+// It sorts lexically in chronological order.
+const historyTimeFormat = "20060102T150405.000000000Z"
+
+// historyMu serialises history writes and pruning so overlapping watch cycles
+// never prune a report another cycle is still writing
+var historyMu sync.Mutex
+
+// historyFileName returns the timestamped filename for a report written at t,
+// e.g. report.json becomes report-20240101T120000.000000000Z.json
+func historyFileName(path string, t time.Time) string {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(filepath.Base(path), ext)
+	name := fmt.Sprintf("%s-%s%s", base, t.UTC().Format(historyTimeFormat), ext)
+	return filepath.Join(filepath.Dir(path), name)
+}
+
+// listHistory returns the timestamped reports belonging to path, oldest first.
+// Only files named exactly after path plus a timestamp belong to it, so the
+// history of report-staging.json is not mistaken for that of report.json.
+func listHistory(path string) ([]string, error) {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(filepath.Base(path), ext)
+	matches, err := filepath.Glob(filepath.Join(filepath.Dir(path), base+"-*"+ext))
+	if err != nil {
+		return nil, err
+	}
+
+	var history []string
+	for _, match := range matches {
+		name := strings.TrimSuffix(filepath.Base(match), ext)
+		if _, err := time.Parse(historyTimeFormat, strings.TrimPrefix(name, base+"-")); err == nil {
+			history = append(history, match)
+		}
+	}
+	sort.Strings(history)
+	return history, nil
+}
+
+// parseHistoryTimestamp extracts the timestamp embedded in a history filename
+// of any report, the part after the last '-'; timestamps contain none
+func parseHistoryTimestamp(path string) (time.Time, bool) {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	i := strings.LastIndex(name, "-")
+	if i < 0 {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(historyTimeFormat, name[i+1:])
+	return t, err == nil
+}
+
+// pruneHistory removes all but the newest keep reports belonging to path
+func pruneHistory(path string, keep int) error {
+	history, err := listHistory(path)
+	if err != nil {
+		return err
+	}
+	for len(history) > keep {
+		if err := os.Remove(history[0]); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to prune %s: %v", history[0], err)
+		}
+		history = history[1:]
+	}
+	return nil
+}
+
+// writeFileAtomic writes data to a temporary file and renames it into place so
+// readers never observe a partially written report
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// saveReportWithHistory writes data to a timestamped file next to path, prunes
+// all but the newest keep reports and refreshes path as a copy of the latest
+func saveReportWithHistory(path string, data []byte, keep int, now time.Time) error {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+
+	if err := writeFileAtomic(historyFileName(path, now), data); err != nil {
+		return err
+	}
+	if err := pruneHistory(path, keep); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
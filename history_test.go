@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Test that only the newest KEEP_HISTORY reports survive several cycles
+func TestSaveReportWithHistory(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "report.json")
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// A file sharing the prefix without a timestamp must never be pruned
+	unrelated := filepath.Join(dir, "report-old.json")
+	if err := os.WriteFile(unrelated, []byte("{}"), 0644); err != nil {
+		t.Fatalf("Failed to write unrelated file: %v", err)
+	}
+
+	for i := 0; i < 5; i++ {
+		data := []byte(fmt.Sprintf(`{"cycle": %d}`, i))
+		if err := saveReportWithHistory(path, data, 3, start.Add(time.Duration(i)*time.Minute)); err != nil {
+			t.Fatalf("Cycle %d: expected no error, got %v", i, err)
+		}
+	}
+
+	history, err := listHistory(path)
+	if err != nil {
+		t.Fatalf("Expected no error listing history, got %v", err)
+	}
+	if len(history) != 3 {
+		t.Fatalf("Expected 3 history files, got %d: %v", len(history), history)
+	}
+	if expected := historyFileName(path, start.Add(2*time.Minute)); history[0] != expected {
+		t.Errorf("Expected oldest retained file %s, got %s", expected, history[0])
+	}
+
+	latest, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Expected latest report to exist, got %v", err)
+	}
+	if string(latest) != `{"cycle": 4}` {
+		t.Errorf("Expected latest report to hold the last cycle, got %s", latest)
+	}
+	if _, err := os.Stat(unrelated); err != nil {
+		t.Errorf("Expected unrelated file to survive pruning, got %v", err)
+	}
+}
+
+// Test that overlapping cycles still leave exactly KEEP_HISTORY reports
+func TestSaveReportWithHistoryConcurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.json")
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := saveReportWithHistory(path, []byte("{}"), 4, start.Add(time.Duration(i)*time.Second)); err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	history, err := listHistory(path)
+	if err != nil {
+		t.Fatalf("Expected no error listing history, got %v", err)
+	}
+	if len(history) != 4 {
+		t.Errorf("Expected 4 history files, got %d", len(history))
+	}
+}
+
+// Test that pruning a report's history leaves the history of a report whose
+// name merely starts with it alone
+func TestPruneHistoryOtherReport(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	staging := historyFileName(filepath.Join(dir, "report-staging.json"), start)
+	if err := os.WriteFile(staging, []byte("{}"), 0644); err != nil {
+		t.Fatalf("Failed to write staging history: %v", err)
+	}
+
+	path := filepath.Join(dir, "report.json")
+	for i := 1; i <= 3; i++ {
+		if err := saveReportWithHistory(path, []byte("{}"), 1, start.Add(time.Duration(i)*time.Second)); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	history, err := listHistory(path)
+	if err != nil {
+		t.Fatalf("Expected no error listing history, got %v", err)
+	}
+	if len(history) != 1 || history[0] != historyFileName(path, start.Add(3*time.Second)) {
+		t.Errorf("Expected only the newest report.json history, got %v", history)
+	}
+	if _, err := os.Stat(staging); err != nil {
+		t.Errorf("Expected the history of report-staging.json to be kept, got %v", err)
+	}
+}
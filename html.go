@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"html/template"
+	"sort"
+)
+
+// htmlReportTemplate renders a self-contained HTML page. html/template escapes
+// every value, so strings reported by servers cannot inject markup.
+var htmlReportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8" />
+<title>Health Report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 0.4em 0.8em; text-align: left; }
+th { background: #f0f0f0; }
+td.rate { font-weight: bold; }
+tr.critical td.rate { color: #b00020; }
+tr.warning td.rate { color: #b36b00; }
+tr.ok td.rate { color: #1b7f3b; }
+tr.insufficient_data td.rate { color: #777777; }
+</style>
+</head>
+<body>
+<h1>Health Report</h1>
+<table>
+<thead>
+<tr><th>Application</th><th>Version</th><th>Success Rate</th><th>Total Requests</th><th>Total Successes</th></tr>
+</thead>
+<tbody>
+{{- range .}}
+<tr class="{{.Severity}}"><td>{{.Application}}</td><td>{{.Version}}</td><td class="rate">{{printf "%.2f%%" .SuccessRate}}</td><td>{{.TotalRequests}}</td><td>{{.TotalSuccesses}}</td></tr>
+{{- end}}
+</tbody>
+</table>
+</body>
+</html>
+`))
+
+// htmlRow is a single table row of the HTML report
+type htmlRow struct {
+	AggregatedData
+	SuccessRate float64
+}
+
+// renderHTMLReport renders the aggregation as an HTML table sorted by
+// application and version
+func renderHTMLReport(aggregation map[string]map[string]AggregatedData) ([]byte, error) {
+	var rows []htmlRow
+	for _, versions := range aggregation {
+		for _, data := range versions {
+			rows = append(rows, htmlRow{AggregatedData: data, SuccessRate: successRate(data)})
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Application != rows[j].Application {
+			return rows[i].Application < rows[j].Application
+		}
+		return rows[i].Version < rows[j].Version
+	})
+
+	var buf bytes.Buffer
+	if err := htmlReportTemplate.Execute(&buf, rows); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
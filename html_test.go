@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// Test the HTML report contains sorted, escaped rows and is well-formed
+func TestRenderHTMLReport(t *testing.T) {
+	config := NewDefaultConfig()
+	aggregation := aggregateData([]AggregatedData{
+		{Application: "Memcache2", Version: "1.0.1", TotalRequests: 100, TotalSuccesses: 80},
+		{Application: "Cassandra", Version: "2.0.0", TotalRequests: 100, TotalSuccesses: 100},
+		{Application: "<script>alert(1)</script>", Version: "1.0", TotalRequests: 10, TotalSuccesses: 10},
+	})
+	annotateSeverity(aggregation, config)
+
+	output, err := renderHTMLReport(aggregation)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	html := string(output)
+
+	if strings.Count(html, "<tr class=") != 3 {
+		t.Errorf("Expected 3 data rows, got:\n%s", html)
+	}
+	if !strings.Contains(html, `<tr class="critical"><td>Memcache2</td><td>1.0.1</td><td class="rate">80.00%</td>`) {
+		t.Errorf("Expected a critical Memcache2 row, got:\n%s", html)
+	}
+	if strings.Index(html, "Cassandra") > strings.Index(html, "Memcache2") {
+		t.Errorf("Expected rows sorted by application")
+	}
+	if strings.Contains(html, "<script>") {
+		t.Errorf("Expected server-reported values to be escaped, got:\n%s", html)
+	}
+
+	// The page is written as well-formed markup, so a strict XML parse must succeed
+	decoder := xml.NewDecoder(bytes.NewReader(output))
+	for {
+		if _, err := decoder.Token(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Expected well-formed HTML, got %v", err)
+		}
+	}
+}
+
+// Test that the default report file takes the extension of OUTPUT_FORMAT and
+// that an unsupported format fails before any server is contacted
+func TestOutputFormatDefaults(t *testing.T) {
+	os.Setenv("OUTPUT_FORMAT", "html")
+	defer os.Unsetenv("OUTPUT_FORMAT")
+	if config := LoadConfigFromEnv(); config.OutputFile != "report.html" {
+		t.Errorf("Expected report.html, got %s", config.OutputFile)
+	}
+	os.Setenv("OUTPUT_FORMAT", "markdown")
+	os.Setenv("OUTPUT_FILE", "health.txt")
+	defer os.Unsetenv("OUTPUT_FILE")
+	if config := LoadConfigFromEnv(); config.OutputFile != "health.txt" {
+		t.Errorf("Expected an explicit OUTPUT_FILE to be kept, got %s", config.OutputFile)
+	}
+
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Write([]byte(mockResponse))
+	}))
+	defer server.Close()
+	dir := t.TempDir()
+	serversFile := filepath.Join(dir, "servers.txt")
+	if err := os.WriteFile(serversFile, []byte(server.URL+"\n"), 0644); err != nil {
+		t.Fatalf("Failed to write servers file: %v", err)
+	}
+	config := NewDefaultConfig()
+	config.ServersFile = serversFile
+	config.OutputFile = filepath.Join(dir, "report.pdf")
+	config.OutputFormat = "pdf"
+	if err := runScan(nil, config, io.Discard); err == nil || !strings.Contains(err.Error(), "unsupported output format") {
+		t.Errorf("Expected the format to be refused, got %v", err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 0 {
+		t.Errorf("Expected no server to be contacted, got %d requests", n)
+	}
+}
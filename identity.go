@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Identity pinning modes deciding which application/version a server is
+// aggregated under when its reports change between watch cycles
+const (
+	// PinIdentityOff aggregates every response under what it reports
+	PinIdentityOff = "off"
+	// PinIdentityFirst keeps the first identity a server reports until another
+	// one is reported for PIN_IDENTITY_WINDOW consecutive cycles
+	PinIdentityFirst = "first"
+	// PinIdentityMajority uses the identity reported most often over the last
+	// PIN_IDENTITY_WINDOW cycles
+	PinIdentityMajority = "majority"
+)
+
+// identity is the application and version a server reports
+type identity struct {
+	Application string
+	Version     string
+}
+
+// String renders the identity as application/version
+func (i identity) String() string {
+	return fmt.Sprintf("%s/%s", i.Application, i.Version)
+}
+
+// pinnedHistory is what an identityPinner remembers about a server
+type pinnedHistory struct {
+	pinned identity
+	// recent holds the last reports, oldest first
+	recent []identity
+}
+
+// identityPinner smooths the application/version reported by each server URL
+// across watch cycles, so an instance misreporting its version for a cycle
+// during a rollout does not split its counts into a spurious version
+type identityPinner struct {
+	mode   string
+	window int
+
+	mu      sync.Mutex
+	history map[string]*pinnedHistory
+}
+
+// newIdentityPinner creates a pinner for PIN_IDENTITY over PIN_IDENTITY_WINDOW
+func newIdentityPinner(config *Config) *identityPinner {
+	return &identityPinner{mode: config.PinIdentity, window: config.PinIdentityWindow, history: make(map[string]*pinnedHistory)}
+}
+
+// Pin records the identity of a successful result and rewrites the result to
+// the pinned identity, keeping the reported one in PinnedFrom when they
+// differ. Failed results carry no identity and are left alone.
+func (p *identityPinner) Pin(result *ServerResult) {
+	app, version := &result.Application, &result.Version
+	if result.Health != nil {
+		app, version = &result.Health.Application, &result.Health.Version
+	}
+	if result.Error != "" || (*app == "" && *version == "") {
+		return
+	}
+	reported := identity{Application: *app, Version: *version}
+	pinned := p.observe(result.URL, reported)
+	if pinned != reported {
+		*app, *version = pinned.Application, pinned.Version
+		result.PinnedFrom = reported.String()
+	}
+}
+
+// observe records a server's report and returns the identity it is pinned to
+func (p *identityPinner) observe(url string, reported identity) identity {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	h, ok := p.history[url]
+	if !ok {
+		h = &pinnedHistory{pinned: reported}
+		p.history[url] = h
+	}
+	h.recent = append(h.recent, reported)
+	if len(h.recent) > p.window {
+		h.recent = h.recent[len(h.recent)-p.window:]
+	}
+
+	switch p.mode {
+	case PinIdentityFirst:
+		if len(h.recent) == p.window && h.recent[0] != h.pinned {
+			changed := true
+			for _, id := range h.recent {
+				if id != h.recent[0] {
+					changed = false
+					break
+				}
+			}
+			if changed {
+				h.pinned = h.recent[0]
+			}
+		}
+	case PinIdentityMajority:
+		counts := make(map[identity]int)
+		for _, id := range h.recent {
+			counts[id]++
+		}
+		// Ties keep the identity already pinned, then favour the latest report
+		best := h.pinned
+		for i := len(h.recent) - 1; i >= 0; i-- {
+			if id := h.recent[i]; counts[id] > counts[best] {
+				best = id
+			}
+		}
+		h.pinned = best
+	}
+	return h.pinned
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// Test that a server briefly reporting another version during a rollout stays
+// aggregated under its usual version, while a lasting change is picked up
+func TestPinIdentity(t *testing.T) {
+	versions := []string{"1.0.1", "1.0.1", "1.0.2", "1.0.1", "1.0.2", "1.0.2", "1.0.2"}
+	for _, mode := range []string{PinIdentityFirst, PinIdentityMajority} {
+		var cycle int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			version := versions[atomic.AddInt32(&cycle, 1)-1]
+			w.Write([]byte(`{"application":"Memcache2","version":"` + version + `","requestCount":100,"successCount":100}`))
+		}))
+
+		config := NewDefaultConfig()
+		config.RequestDelay = 0
+		config.PinIdentity = mode
+		config.PinIdentityWindow = 3
+		state := &scanState{identities: newIdentityPinner(config)}
+
+		var got []string
+		for i, reported := range versions {
+			resultChannel := make(chan ServerResult, 1)
+			fetchHealthDataWithDelayAndConcurrency(context.Background(), []ServerEntry{{Address: server.URL}}, resultChannel, config, state)
+			result := <-resultChannel
+			if result.Health == nil {
+				t.Fatalf("%s: expected health data, got %+v", mode, result)
+			}
+			for version := range aggregateData([]AggregatedData{toAggregatedData(*result.Health)})["Memcache2"] {
+				got = append(got, version)
+			}
+			if result.Health.Version != reported && result.PinnedFrom != "Memcache2/"+reported {
+				t.Errorf("%s: cycle %d: expected the reported version in PinnedFrom, got %q", mode, i+1, result.PinnedFrom)
+			}
+		}
+		server.Close()
+
+		// The stray 1.0.2 of the third cycle is smoothed; the lasting one takes
+		// over once it is the majority, or reported three cycles in a row
+		expected := []string{"1.0.1", "1.0.1", "1.0.1", "1.0.1", "1.0.2", "1.0.2", "1.0.2"}
+		if mode == PinIdentityFirst {
+			expected = []string{"1.0.1", "1.0.1", "1.0.1", "1.0.1", "1.0.1", "1.0.1", "1.0.2"}
+		}
+		for i := range expected {
+			if got[i] != expected[i] {
+				t.Errorf("%s: expected versions %v, got %v", mode, expected, got)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// inventoryGroup is a group of an Ansible YAML inventory
+type inventoryGroup struct {
+	Hosts    map[string]map[string]interface{} `yaml:"hosts"`
+	Vars     map[string]interface{}            `yaml:"vars"`
+	Children map[string]inventoryGroup         `yaml:"children"`
+}
+
+// inventoryImplicitGroups are the groups every host belongs to; they are not
+// recorded as group tags
+var inventoryImplicitGroups = map[string]bool{"all": true, "ungrouped": true}
+
+// isInventoryFile reports whether path is a YAML inventory rather than a
+// plain servers list
+func isInventoryFile(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".yml" || ext == ".yaml"
+}
+
+// loadServerEntries reads the servers to check from SERVERS_FILE, either a
+// YAML or CSV inventory or a plain servers list. Malformed CSV rows are
+// skipped with a warning.
+func loadServerEntries(config *Config) ([]ServerEntry, error) {
+	if isCSVInventory(config.ServersFile) {
+		data, err := os.ReadFile(config.ServersFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read inventory: %v", err)
+		}
+		entries, issues, err := parseCSVInventory(data, config.CSVColumns)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse inventory: %v", err)
+		}
+		for _, issue := range issues {
+			fmt.Fprintf(config.Console, "Warning: skipping %s line %d: %s\n", config.ServersFile, issue.Line, issue.Message)
+		}
+		return entries, nil
+	}
+
+	if isInventoryFile(config.ServersFile) {
+		data, err := os.ReadFile(config.ServersFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read inventory: %v", err)
+		}
+		entries, err := parseInventory(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse inventory: %v", err)
+		}
+		return entries, nil
+	}
+
+	lines, err := readServersPath(config.ServersFile, config.ServersRecursive)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read servers list: %v", err)
+	}
+	entries, err := parseServerEntries(lines)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse servers list: %v", err)
+	}
+	return entries, nil
+}
+
+// parseInventory maps an Ansible YAML inventory onto server entries sorted by
+// host. Every group a host is listed under, directly or through children,
+// becomes part of its group tag, e.g. group=db,web. Scalar group and host
+// vars become tags, host vars taking precedence over the vars of nested
+// groups and those over their parents'. ansible_host replaces the address;
+// other ansible_* vars are ignored.
+func parseInventory(data []byte) ([]ServerEntry, error) {
+	var inventory map[string]inventoryGroup
+	if err := yaml.Unmarshal(data, &inventory); err != nil {
+		return nil, err
+	}
+
+	hosts := make(map[string]*inventoryHost)
+	for _, name := range sortedGroupNames(inventory) {
+		walkInventoryGroup(name, inventory[name], nil, nil, hosts)
+	}
+
+	names := make([]string, 0, len(hosts))
+	for name := range hosts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	entries := make([]ServerEntry, 0, len(names))
+	for _, name := range names {
+		entry := hosts[name].entry(name)
+		for key, value := range entry.Tags {
+			if err := checkServerTag(key, value); err != nil {
+				return nil, fmt.Errorf("host %s: %v", name, err)
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// inventoryHost collects what the inventory says about a host across all
+// the groups it appears in
+type inventoryHost struct {
+	groups    map[string]bool
+	groupVars map[string]string
+	hostVars  map[string]string
+}
+
+// entry converts the host to a server entry
+func (h *inventoryHost) entry(name string) ServerEntry {
+	vars := make(map[string]string, len(h.groupVars)+len(h.hostVars))
+	for key, value := range h.groupVars {
+		vars[key] = value
+	}
+	for key, value := range h.hostVars {
+		vars[key] = value
+	}
+
+	entry := ServerEntry{Address: name}
+	if address, ok := vars["ansible_host"]; ok && address != "" {
+		entry.Address = address
+		entry.Name = name
+	}
+	for key, value := range vars {
+		if strings.HasPrefix(key, "ansible_") {
+			continue
+		}
+		if entry.Tags == nil {
+			entry.Tags = make(map[string]string)
+		}
+		entry.Tags[key] = value
+	}
+	if len(h.groups) > 0 {
+		groups := make([]string, 0, len(h.groups))
+		for group := range h.groups {
+			groups = append(groups, group)
+		}
+		sort.Strings(groups)
+		if entry.Tags == nil {
+			entry.Tags = make(map[string]string)
+		}
+		entry.Tags["group"] = strings.Join(groups, ",")
+	}
+	return entry
+}
+
+// walkInventoryGroup records the hosts of group and its children. parents and
+// inherited carry the enclosing groups and their vars.
+func walkInventoryGroup(name string, group inventoryGroup, parents []string, inherited map[string]string, hosts map[string]*inventoryHost) {
+	if !inventoryImplicitGroups[name] {
+		parents = append(append([]string(nil), parents...), name)
+	}
+	vars := make(map[string]string, len(inherited)+len(group.Vars))
+	for key, value := range inherited {
+		vars[key] = value
+	}
+	mergeInventoryVars(vars, group.Vars)
+
+	hostNames := make([]string, 0, len(group.Hosts))
+	for hostName := range group.Hosts {
+		hostNames = append(hostNames, hostName)
+	}
+	sort.Strings(hostNames)
+	for _, hostName := range hostNames {
+		host := hosts[hostName]
+		if host == nil {
+			host = &inventoryHost{
+				groups:    make(map[string]bool),
+				groupVars: make(map[string]string),
+				hostVars:  make(map[string]string),
+			}
+			hosts[hostName] = host
+		}
+		for _, parent := range parents {
+			host.groups[parent] = true
+		}
+		for key, value := range vars {
+			host.groupVars[key] = value
+		}
+		mergeInventoryVars(host.hostVars, group.Hosts[hostName])
+	}
+
+	for _, child := range sortedGroupNames(group.Children) {
+		walkInventoryGroup(child, group.Children[child], parents, vars, hosts)
+	}
+}
+
+// mergeInventoryVars copies the scalar vars into dst; lists and maps cannot be
+// represented as tags and are skipped
+func mergeInventoryVars(dst map[string]string, vars map[string]interface{}) {
+	for key, value := range vars {
+		switch value.(type) {
+		case map[string]interface{}, []interface{}, nil:
+			continue
+		}
+		dst[key] = fmt.Sprint(value)
+	}
+}
+
+// sortedGroupNames returns the names of groups in order
+func sortedGroupNames(groups map[string]inventoryGroup) []string {
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const testInventory = `
+all:
+  hosts:
+    bastion.example.com:
+  vars:
+    dc: us-east
+  children:
+    web:
+      vars:
+        app: Web
+      hosts:
+        web1.example.com:
+        web2.example.com:
+          ansible_host: 10.0.0.2
+          ansible_port: 22
+          dc: us-west
+      children:
+        canary:
+          hosts:
+            web1.example.com:
+              track: canary
+    db:
+      hosts:
+        db1.example.com:
+          app: Memcache2
+          replicas: [db2, db3]
+`
+
+// Test that hosts, groups and vars of a YAML inventory become tagged entries
+func TestParseInventory(t *testing.T) {
+	entries, err := parseInventory([]byte(testInventory))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	expected := []ServerEntry{
+		{Address: "bastion.example.com", Tags: map[string]string{"dc": "us-east"}},
+		{Address: "db1.example.com", Tags: map[string]string{"dc": "us-east", "app": "Memcache2", "group": "db"}},
+		{Address: "web1.example.com", Tags: map[string]string{"dc": "us-east", "app": "Web", "track": "canary", "group": "canary,web"}},
+		{Address: "10.0.0.2", Name: "web2.example.com", Tags: map[string]string{"dc": "us-west", "app": "Web", "group": "web"}},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, entries)
+	}
+
+	if _, err := parseInventory([]byte("all: [")); err == nil {
+		t.Error("Expected an error for malformed YAML")
+	}
+}
+
+// Test that SERVERS_FILE with a YAML extension is loaded as an inventory
+func TestLoadServerEntriesInventory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "inventory.yml")
+	if err := os.WriteFile(path, []byte(testInventory), 0644); err != nil {
+		t.Fatalf("Failed to write inventory: %v", err)
+	}
+	config := NewDefaultConfig()
+	config.ServersFile = path
+
+	entries, err := loadServerEntries(config)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(entries) != 4 {
+		t.Errorf("Expected 4 servers, got %d", len(entries))
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"math/rand"
+	"time"
+)
+
+// intervalJitter spreads the pause between watch cycles by up to percent of
+// the interval either way, so copies of the tool started together drift apart
+// instead of scanning the fleet in lockstep
+type intervalJitter struct {
+	interval time.Duration
+	percent  float64
+	rng      *rand.Rand
+}
+
+// newIntervalJitter creates the jitter for WATCH_INTERVAL and WATCH_JITTER,
+// seeded with WATCH_JITTER_SEED or the current time when it is 0
+func newIntervalJitter(config *Config) *intervalJitter {
+	seed := config.WatchJitterSeed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &intervalJitter{interval: config.WatchInterval, percent: config.WatchJitter, rng: rand.New(rand.NewSource(seed))}
+}
+
+// Next returns the pause before the next cycle, drawn uniformly from the
+// interval plus or minus percent of it
+func (j *intervalJitter) Next() time.Duration {
+	if j.percent <= 0 {
+		return j.interval
+	}
+	spread := float64(j.interval) * j.percent / 100
+	return j.interval + time.Duration((j.rng.Float64()*2-1)*spread)
+}
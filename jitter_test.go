@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// Test that jittered pauses vary but stay within the configured band, and
+// that a seed makes them reproducible
+func TestIntervalJitter(t *testing.T) {
+	config := NewDefaultConfig()
+	config.WatchInterval = 60 * time.Second
+	config.WatchJitter = 10
+	config.WatchJitterSeed = 42
+
+	jitter := newIntervalJitter(config)
+	seen := make(map[time.Duration]bool)
+	var pauses []time.Duration
+	for i := 0; i < 50; i++ {
+		pause := jitter.Next()
+		if pause < 54*time.Second || pause > 66*time.Second {
+			t.Errorf("Expected a pause within 60s +/-10%%, got %v", pause)
+		}
+		seen[pause] = true
+		pauses = append(pauses, pause)
+	}
+	if len(seen) < 2 {
+		t.Errorf("Expected successive pauses to vary, got %v", pauses)
+	}
+
+	again := newIntervalJitter(config)
+	for i, pause := range pauses {
+		if next := again.Next(); next != pause {
+			t.Fatalf("Expected the same seed to give the same pause %d, got %v and %v", i, pause, next)
+		}
+	}
+
+	config.WatchJitter = 0
+	if pause := newIntervalJitter(config).Next(); pause != 60*time.Second {
+		t.Errorf("Expected no jitter to keep the interval, got %v", pause)
+	}
+}
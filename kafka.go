@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Kafka message modes
+const (
+	// KafkaMessagesRecord publishes one message per application/version
+	KafkaMessagesRecord = "record"
+	// KafkaMessagesReport publishes the whole report as a single message
+	KafkaMessagesReport = "report"
+)
+
+// kafkaWriter produces messages to a topic; *kafka.Writer implements it
+type kafkaWriter interface {
+	WriteMessages(ctx context.Context, messages ...kafka.Message) error
+	Close() error
+}
+
+// kafkaRecordMessage is the value of a message in record mode
+type kafkaRecordMessage struct {
+	Meta   ReportMeta     `json:"meta"`
+	Record AggregatedData `json:"record"`
+}
+
+// newKafkaWriter creates a synchronous producer for KAFKA_TOPIC on
+// KAFKA_BROKERS. Messages are partitioned by key, so the records of an
+// application stay in order on one partition.
+func newKafkaWriter(config *Config) (*kafka.Writer, error) {
+	if config.KafkaTopic == "" {
+		return nil, fmt.Errorf("KAFKA_BROKERS requires KAFKA_TOPIC")
+	}
+	return &kafka.Writer{
+		Addr:         kafka.TCP(config.KafkaBrokers...),
+		Topic:        config.KafkaTopic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		BatchTimeout: 10 * time.Millisecond,
+		WriteTimeout: config.HTTPTimeout,
+	}, nil
+}
+
+// kafkaMessages builds the messages for report: one per record keyed by its
+// application, or the whole report keyed by its environment
+func kafkaMessages(report Report, mode string) ([]kafka.Message, error) {
+	if mode == KafkaMessagesReport {
+		value, err := json.Marshal(report)
+		if err != nil {
+			return nil, err
+		}
+		message := kafka.Message{Value: value}
+		if report.Meta.Environment != "" {
+			message.Key = []byte(report.Meta.Environment)
+		}
+		return []kafka.Message{message}, nil
+	}
+
+	var messages []kafka.Message
+	for _, data := range sortedRecords(report.Applications) {
+		value, err := json.Marshal(kafkaRecordMessage{Meta: report.Meta, Record: data})
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, kafka.Message{Key: []byte(data.Application), Value: value})
+	}
+	return messages, nil
+}
+
+// publishKafka produces the messages for report, giving up when ctx is done
+func publishKafka(ctx context.Context, writer kafkaWriter, report Report, config *Config) error {
+	messages, err := kafkaMessages(report, config.KafkaMessages)
+	if err != nil {
+		return err
+	}
+	if len(messages) == 0 {
+		return nil
+	}
+	return writer.WriteMessages(ctx, messages...)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// mockKafkaWriter records the messages produced instead of sending them
+type mockKafkaWriter struct {
+	messages []kafka.Message
+	closed   bool
+}
+
+func (w *mockKafkaWriter) WriteMessages(ctx context.Context, messages ...kafka.Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	w.messages = append(w.messages, messages...)
+	return nil
+}
+
+func (w *mockKafkaWriter) Close() error {
+	w.closed = true
+	return nil
+}
+
+// Test that each record is produced as a message keyed by its application,
+// or the whole report as one message
+func TestPublishKafka(t *testing.T) {
+	config := NewDefaultConfig()
+	config.Environment = "prod"
+	aggregation := aggregateData([]AggregatedData{
+		{Application: "Memcache2", Version: "1.0.1", TotalRequests: 100, TotalSuccesses: 99},
+		{Application: "Memcache2", Version: "1.0.2", TotalRequests: 100, TotalSuccesses: 50},
+		{Application: "Cassandra", Version: "2.0.0", TotalRequests: 10, TotalSuccesses: 10},
+	})
+	annotateSeverity(aggregation, config)
+	report := buildReport(aggregation, nil, config)
+
+	writer := &mockKafkaWriter{}
+	if err := publishKafka(context.Background(), writer, report, config); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(writer.messages) != 3 {
+		t.Fatalf("Expected 3 messages, got %d", len(writer.messages))
+	}
+	expectedKeys := []string{"Cassandra", "Memcache2", "Memcache2"}
+	for i, message := range writer.messages {
+		if string(message.Key) != expectedKeys[i] {
+			t.Errorf("Expected message %d keyed %s, got %s", i, expectedKeys[i], message.Key)
+		}
+	}
+	var record kafkaRecordMessage
+	if err := json.Unmarshal(writer.messages[2].Value, &record); err != nil {
+		t.Fatalf("Failed to decode message: %v", err)
+	}
+	if record.Meta.Environment != "prod" || record.Record.Version != "1.0.2" || record.Record.Severity != SeverityCritical {
+		t.Errorf("Expected the critical 1.0.2 record from prod, got %+v", record)
+	}
+
+	config.KafkaMessages = KafkaMessagesReport
+	writer = &mockKafkaWriter{}
+	if err := publishKafka(context.Background(), writer, report, config); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	var decoded Report
+	if len(writer.messages) != 1 || string(writer.messages[0].Key) != "prod" {
+		t.Fatalf("Expected a single message keyed prod, got %+v", writer.messages)
+	}
+	if err := json.Unmarshal(writer.messages[0].Value, &decoded); err != nil || len(decoded.Applications["Memcache2"]) != 2 {
+		t.Errorf("Expected the whole report as the message, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := publishKafka(ctx, &mockKafkaWriter{}, report, config); err == nil {
+		t.Error("Expected publishing to stop once the run context is done")
+	}
+
+	state := &scanState{kafka: writer}
+	state.Close(config)
+	if !writer.closed {
+		t.Error("Expected the producer to be flushed and closed on exit")
+	}
+}
+
+// Test that Kafka needs a topic
+func TestNewKafkaWriter(t *testing.T) {
+	config := NewDefaultConfig()
+	config.KafkaBrokers = []string{"localhost:9092"}
+	if _, err := newKafkaWriter(config); err == nil {
+		t.Error("Expected KAFKA_BROKERS without KAFKA_TOPIC to be refused")
+	}
+	config.KafkaTopic = "health"
+	writer, err := newKafkaWriter(config)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if writer.Topic != "health" {
+		t.Errorf("Expected topic health, got %s", writer.Topic)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// Latency modes deciding what the latency of a retried check measures
+const (
+	// LatencyModeFinal measures the last attempt only
+	LatencyModeFinal = "final"
+	// LatencyModeCumulative measures every attempt and the backoff between them
+	LatencyModeCumulative = "cumulative"
+)
+
+// SlowEndpoint is a server listed among the slowest health endpoints
+type SlowEndpoint struct {
+	Server    string  `json:"server"`
+	URL       string  `json:"url"`
+	LatencyMs float64 `json:"latencyMs"`
+	// ErrorClass is set when the slow request failed, e.g. with a timeout
+	ErrorClass string `json:"errorClass,omitempty"`
+}
+
+// durationMs converts d to fractional milliseconds
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// slowestEndpoints returns up to n servers with the highest latency, slowest
+// first. Ties are broken by server so the list is stable.
+func slowestEndpoints(results []ServerResult, n int) []SlowEndpoint {
+	if n <= 0 {
+		return nil
+	}
+	var endpoints []SlowEndpoint
+	for _, result := range results {
+		if result.LatencyMs > 0 {
+			endpoints = append(endpoints, SlowEndpoint{Server: result.Server, URL: result.URL, LatencyMs: result.LatencyMs, ErrorClass: result.ErrorClass})
+		}
+	}
+	sort.Slice(endpoints, func(i, j int) bool {
+		if endpoints[i].LatencyMs != endpoints[j].LatencyMs {
+			return endpoints[i].LatencyMs > endpoints[j].LatencyMs
+		}
+		return endpoints[i].Server < endpoints[j].Server
+	})
+	if len(endpoints) > n {
+		endpoints = endpoints[:n]
+	}
+	return endpoints
+}
+
+// printSlowest prints the slowest endpoints for performance triage
+func printSlowest(w io.Writer, endpoints []SlowEndpoint) {
+	if len(endpoints) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "slowest (%d):\n", len(endpoints))
+	for _, e := range endpoints {
+		failed := ""
+		if e.ErrorClass != "" {
+			failed = fmt.Sprintf(" [%s]", e.ErrorClass)
+		}
+		fmt.Fprintf(w, "  Server: %s, Latency: %.1fms%s\n", e.Server, e.LatencyMs, failed)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test that the slowest endpoints are ordered by latency and capped at n
+func TestSlowestEndpoints(t *testing.T) {
+	results := []ServerResult{
+		{Server: "a", LatencyMs: 12},
+		{Server: "b", LatencyMs: 250, ErrorClass: ErrorClassTimeout},
+		{Server: "c", LatencyMs: 80},
+		{Server: "d"}, // never measured
+		{Server: "e", LatencyMs: 80},
+		{Server: "f", LatencyMs: 3},
+	}
+
+	slowest := slowestEndpoints(results, 3)
+	var servers []string
+	for _, e := range slowest {
+		servers = append(servers, e.Server)
+	}
+	if strings.Join(servers, ",") != "b,c,e" {
+		t.Errorf("Expected b,c,e, got %v", servers)
+	}
+	if got := slowestEndpoints(results, 10); len(got) != 5 {
+		t.Errorf("Expected the 5 measured servers, got %d", len(got))
+	}
+	if got := slowestEndpoints(results, 0); got != nil {
+		t.Errorf("Expected nothing when disabled, got %v", got)
+	}
+
+	var buf bytes.Buffer
+	printSlowest(&buf, slowest)
+	if !strings.Contains(buf.String(), "slowest (3):\n  Server: b, Latency: 250.0ms [timeout]\n") {
+		t.Errorf("Unexpected summary:\n%s", buf.String())
+	}
+}
+
+// Test that fetched results carry the latency of the request
+func TestFetchLatency(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		w.Write([]byte(mockResponse))
+	}))
+	defer server.Close()
+
+	config := NewDefaultConfig()
+	config.RequestDelay = 0
+	results := collectResults([]ServerEntry{{Address: server.URL}}, config)
+	if len(results) != 1 || results[0].LatencyMs < 50 {
+		t.Errorf("Expected a latency of at least 50ms, got %+v", results)
+	}
+}
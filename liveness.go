@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// LivenessAvailability summarises the liveness-only checks of an application
+// (tcp:// servers, HEALTH_METHOD=HEAD and HEALTH_BOOLEAN_FIELD) as up/down
+// counts, since they carry no request counts
+type LivenessAvailability struct {
+	Up   int `json:"up"`
+	Down int `json:"down"`
+	// Availability is the percentage of servers that were up
+	Availability float64 `json:"availability"`
+	// Versions breaks the counts down by the version servers reported, for
+	// HEALTH_BOOLEAN_FIELD checks
+	Versions map[string]LivenessAvailability `json:"versions,omitempty"`
+}
+
+// add counts a server that was up or down
+func (a *LivenessAvailability) add(up, down int) {
+	a.Up += up
+	a.Down += down
+	a.Availability = float64(a.Up) / float64(a.Up+a.Down) * 100
+}
+
+// merge adds the counts of other, including its versions
+func (a *LivenessAvailability) merge(other LivenessAvailability) {
+	a.add(other.Up, other.Down)
+	for version, counts := range other.Versions {
+		if a.Versions == nil {
+			a.Versions = make(map[string]LivenessAvailability)
+		}
+		v := a.Versions[version]
+		v.add(counts.Up, counts.Down)
+		a.Versions[version] = v
+	}
+}
+
+// aggregateLiveness groups the liveness-only results by the application they
+// reported, else their app tag, falling back to the empty app placeholder
+func aggregateLiveness(results []ServerResult, config *Config) map[string]LivenessAvailability {
+	var aggregation map[string]LivenessAvailability
+	for _, result := range results {
+		if !result.LivenessOnly {
+			continue
+		}
+		if aggregation == nil {
+			aggregation = make(map[string]LivenessAvailability)
+		}
+		app := result.Application
+		if app == "" {
+			app = result.Tags["app"]
+		}
+		if app == "" {
+			app = config.EmptyAppPlaceholder
+		}
+		counts := LivenessAvailability{Up: 1}
+		if result.Error != "" {
+			counts = LivenessAvailability{Down: 1}
+		}
+		if result.Version != "" {
+			counts.Versions = map[string]LivenessAvailability{result.Version: counts}
+		}
+		availability := aggregation[app]
+		availability.merge(counts)
+		aggregation[app] = availability
+	}
+	return aggregation
+}
+
+// printLivenessSummary prints the liveness-only availability per application
+func printLivenessSummary(w io.Writer, aggregation map[string]LivenessAvailability) {
+	if len(aggregation) == 0 {
+		return
+	}
+	apps := make([]string, 0, len(aggregation))
+	for app := range aggregation {
+		apps = append(apps, app)
+	}
+	sort.Strings(apps)
+	fmt.Fprintf(w, "liveness (%d):\n", len(apps))
+	for _, app := range apps {
+		a := aggregation[app]
+		fmt.Fprintf(w, "  Application: %s, Up: %d/%d, Availability: %.2f%%\n", app, a.Up, a.Up+a.Down, a.Availability)
+		versions := make([]string, 0, len(a.Versions))
+		for version := range a.Versions {
+			versions = append(versions, version)
+		}
+		sort.Strings(versions)
+		for _, version := range versions {
+			v := a.Versions[version]
+			fmt.Fprintf(w, "    Version: %s, Up: %d/%d, Availability: %.2f%%\n", version, v.Up, v.Up+v.Down, v.Availability)
+		}
+	}
+}
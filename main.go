@@ -2,13 +2,21 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 )
 
@@ -19,6 +27,11 @@ type HealthResponse struct {
 	RequestCount int64  `json:"requestCount"`
 	ErrorCount   int64  `json:"errorCount"`
 	SuccessCount int64  `json:"successCount"`
+	// Status is the optional self-reported state, e.g. ok, degraded or down
+	Status string `json:"status,omitempty"`
+	// FailingComponents lists the sub-checks of HEALTH_COMPONENTS_FIELD that
+	// did not report ok
+	FailingComponents []string `json:"failingComponents,omitempty"`
 }
 
 type AggregatedData struct {
@@ -26,72 +39,406 @@ type AggregatedData struct {
 	Version        string
 	TotalRequests  int64
 	TotalSuccesses int64
+	Severity       string
+	// StatusCounts counts instances by their self-reported status
+	StatusCounts map[string]int `json:",omitempty"`
+	// VolumeShare is the percentage of the application's requests served by
+	// this version, set when VOLUME_SHARES is enabled
+	VolumeShare float64 `json:",omitempty"`
+	// InstancePercentiles holds percentiles of the per-instance success
+	// rates keyed like p10, set when SUCCESS_PERCENTILES is configured
+	InstancePercentiles map[string]float64 `json:",omitempty"`
+	// UnhealthyComponents counts instances by each component they reported
+	// failing, set when HEALTH_COMPONENTS_FIELD is configured
+	UnhealthyComponents map[string]int `json:",omitempty"`
 }
 
-// Function to fetch health data from a server with configurable timeout
-func fetchHealthData(serverURL string, timeout time.Duration) (HealthResponse, error) {
+// ServerResult is the outcome of checking a single server, included in the
+// report's raw section when INCLUDE_RAW is enabled
+type ServerResult struct {
+	Server   string            `json:"server"`
+	URL      string            `json:"url"`
+	Protocol string            `json:"protocol,omitempty"`
+	Tags     map[string]string `json:"tags,omitempty"`
+	Health   *HealthResponse   `json:"health,omitempty"`
+	Error    string            `json:"error,omitempty"`
+	// ErrorClass classifies Error, e.g. network, http_status or decode
+	ErrorClass string `json:"errorClass,omitempty"`
+	// StatusCode is the HTTP status of the last attempt, 0 if none was received
+	StatusCode int `json:"statusCode,omitempty"`
+	// Attempts is the number of requests made, including retries
+	Attempts int `json:"attempts,omitempty"`
+	// Dropped marks a successful result excluded from aggregation by policy
+	Dropped bool `json:"dropped,omitempty"`
+	// Retries is the number of attempts beyond the first
+	Retries int `json:"retries,omitempty"`
+	// CircuitState is the server's circuit after this check when
+	// CIRCUIT_THRESHOLD is set: closed, or open
+	CircuitState string `json:"circuitState,omitempty"`
+	// CircuitProbe marks a check made while the circuit was half-open
+	CircuitProbe bool `json:"circuitProbe,omitempty"`
+	// LivenessOnly marks a check that only tells whether the server is up,
+	// without counts: tcp:// servers, HEALTH_METHOD=HEAD and
+	// HEALTH_BOOLEAN_FIELD
+	LivenessOnly bool `json:"livenessOnly,omitempty"`
+	// Application and Version are reported alongside a HEALTH_BOOLEAN_FIELD
+	Application string `json:"application,omitempty"`
+	Version     string `json:"version,omitempty"`
+	// LatencyMs is the duration of the last attempt in milliseconds
+	LatencyMs float64 `json:"latencyMs,omitempty"`
+	// Revalidated marks counts reused from an earlier cycle after the server
+	// answered a conditional request with 304 Not Modified
+	Revalidated bool `json:"revalidated,omitempty"`
+	// PinnedFrom is the application/version the server reported when
+	// PIN_IDENTITY aggregated it under another one
+	PinnedFrom string `json:"pinnedFrom,omitempty"`
+	// RawBody is the response body of the last attempt when INCLUDE_RAW_BODY
+	// is enabled, as a string, or base64 when it is not valid UTF-8
+	RawBody string `json:"rawBody,omitempty"`
+	// RawBodyEncoding is base64 when RawBody is base64 encoded
+	RawBodyEncoding string `json:"rawBodyEncoding,omitempty"`
+	// RawBodyTruncated marks a body cut at MAX_BODY_BYTES
+	RawBodyTruncated bool `json:"rawBodyTruncated,omitempty"`
+}
+
+// fetchMeta describes how a health check response was served
+type fetchMeta struct {
+	Protocol    string
+	StatusCode  int
+	Attempts    int
+	Revalidated bool
+	// Redirected marks a 3xx counted as success by RedirectPolicy; the server
+	// is up but sent no counts
+	Redirected bool
+	// Latency is the duration of the last attempt
+	Latency time.Duration
+	// Body is the response body, capped at MaxBodyBytes, when IncludeRawBody
+	// is enabled
+	Body []byte
+	// BodyTruncated marks a Body cut at MaxBodyBytes
+	BodyTruncated bool
+	// debugBody is the decoded body when DebugBodyDir is set, saved if the
+	// response then fails validation
+	debugBody []byte
+}
+
+// keepBody stores body in meta when INCLUDE_RAW_BODY is enabled. Bodies are
+// read at most one byte past MaxBodyBytes, which marks the copy truncated.
+func (m *fetchMeta) keepBody(body []byte, config *Config) {
+	if !config.IncludeRawBody {
+		return
+	}
+	if len(body) > config.MaxBodyBytes {
+		body, m.BodyTruncated = body[:config.MaxBodyBytes], true
+	}
+	m.Body = append([]byte{}, body...)
+}
+
+// Function to fetch health data from a server using the shared client
+func fetchHealthData(ctx context.Context, client *http.Client, serverURL string, config *Config) (HealthResponse, fetchMeta, error) {
 	var health HealthResponse
-	client := &http.Client{Timeout: timeout}
+	var meta fetchMeta
+
+	var cancel context.CancelFunc
+	if client.Timeout == 0 && config.HTTPTimeout > 0 {
+		// Servers with a timeout tag use a client without its own timeout
+		ctx, cancel = context.WithTimeout(ctx, config.HTTPTimeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+	// Every attempt builds its request afresh, so a retried POST sends the
+	// whole body again; the strings.Reader also lets the client rewind it
+	// itself when following a redirect
+	var reqBody io.Reader
+	if config.HealthMethod == http.MethodPost {
+		reqBody = strings.NewReader(config.HealthBody)
+	}
+	var handshake handshakeTrace
+	req, err := http.NewRequestWithContext(withHandshakeTrace(ctx, &handshake), config.HealthMethod, serverURL, reqBody)
+	if err != nil {
+		return health, meta, &FetchError{Class: ErrorClassNetwork, Err: fmt.Errorf("invalid request for server %s: %v", serverURL, err)}
+	}
+	if reqBody != nil {
+		req.Header.Set("Content-Type", config.HealthContentType)
+	}
+	if config.HostHeader != "" {
+		req.Host = config.HostHeader
+	}
 
-	resp, err := client.Get(serverURL)
+	resp, err := client.Do(req)
 	if err != nil {
-		return health, fmt.Errorf("failed to reach server %s: %v", serverURL, err)
+		return health, meta, &FetchError{Class: handshake.classify(err), Err: fmt.Errorf("failed to reach server %s: %v", serverURL, err)}
 	}
 	defer resp.Body.Close()
+	meta.Protocol = resp.Proto
+	meta.StatusCode = resp.StatusCode
+	meta.Revalidated = resp.Header.Get(revalidatedHeader) != ""
+
+	// Headers have arrived; cut off servers that dribble the body slowly
+	// instead of letting them hold the request for the whole HTTP timeout
+	var bodyTimedOut int32
+	if config.BodyTimeout > 0 {
+		timer := time.AfterFunc(config.BodyTimeout, func() {
+			atomic.StoreInt32(&bodyTimedOut, 1)
+			cancel()
+		})
+		defer timer.Stop()
+	}
+
+	if config.ForceHTTP2 && resp.ProtoMajor != 2 {
+		return health, meta, &FetchError{Class: ErrorClassProtocol, Err: fmt.Errorf("server %s did not negotiate HTTP/2, got %s", serverURL, resp.Proto)}
+	}
+
+	if resp.StatusCode >= 300 && resp.StatusCode < 400 && config.RedirectPolicy == RedirectPolicySuccess {
+		meta.Redirected = true
+		return health, meta, nil
+	}
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return health, fmt.Errorf("server %s returned status %d: %s", serverURL, resp.StatusCode, string(body))
+		// Only a snippet of an error body is used, so it is read no further
+		// than the cap
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, int64(config.MaxBodyBytes)+1))
+		meta.keepBody(body, config)
+		return health, meta, &FetchError{Class: ErrorClassStatus, Err: fmt.Errorf("server %s returned status %d: %s", serverURL, resp.StatusCode, bodySnippet(body, config.BodyLogLimit))}
 	}
 
-	if err := json.NewDecoder(resp.Body).Decode(&health); err != nil {
-		body, _ := io.ReadAll(resp.Body)
-		return health, fmt.Errorf("failed to decode JSON from server %s: %v. Response: %s", serverURL, err, string(body))
+	// A HEAD response carries no body, its status is all there is to check
+	if config.HealthMethod == http.MethodHead {
+		return health, meta, nil
 	}
 
-	return health, nil
+	// The whole body is buffered, up to MAX_BODY_BYTES, so an invalid one can
+	// be saved to DEBUG_BODY_DIR and a stream decoded to its last value; a
+	// larger body fails the check rather than being buffered without bound
+	body, err := io.ReadAll(io.LimitReader(resp.Body, int64(config.MaxBodyBytes)+1))
+	if err != nil {
+		if atomic.LoadInt32(&bodyTimedOut) == 1 {
+			return health, meta, &FetchError{Class: ErrorClassBodyTimeout, Err: fmt.Errorf("server %s did not send the response body within %v", serverURL, config.BodyTimeout)}
+		}
+		return health, meta, &FetchError{Class: classifyNetworkError(err), Err: fmt.Errorf("failed to read response from server %s: %v", serverURL, err)}
+	}
+	meta.keepBody(body, config)
+	if len(body) > config.MaxBodyBytes {
+		return health, meta, &FetchError{Class: ErrorClassInvalidResponse, Err: fmt.Errorf("server %s sent more than %d bytes", serverURL, config.MaxBodyBytes)}
+	}
+	if config.DebugBodyDir != "" {
+		meta.debugBody = body
+	}
+	if config.HealthStreaming {
+		last, err := lastJSONValue(body)
+		if err != nil {
+			return health, meta, &FetchError{Class: ErrorClassDecode, Err: fmt.Errorf("failed to decode JSON stream from server %s: %v. Response: %s", serverURL, err, bodySnippet(body, config.BodyLogLimit))}
+		}
+		body = last
+	}
+	if config.HealthBooleanField != "" {
+		health, err := decodeBooleanHealth(body, serverURL, config)
+		return health, meta, err
+	}
+	if len(config.PrometheusMetrics) > 0 && isPrometheusText(resp.Header.Get("Content-Type")) {
+		health, err := decodePrometheusHealth(body, serverURL, config)
+		return health, meta, err
+	}
+	if err := json.NewDecoder(bytes.NewReader(body)).Decode(&health); err != nil {
+		class := ErrorClassDecode
+		var countErr *invalidCountError
+		var uptimeErr *invalidUptimeError
+		if errors.As(err, &countErr) {
+			class = ErrorClassInvalidCount
+		} else if errors.As(err, &uptimeErr) {
+			class = ErrorClassInvalidUptime
+		}
+		if config.DebugBodyDir != "" {
+			logDebugBody(config, serverURL, body)
+		}
+		return health, meta, &FetchError{Class: class, Err: fmt.Errorf("failed to decode JSON from server %s: %v. Response: %s", serverURL, err, bodySnippet(body, config.BodyLogLimit))}
+	}
+	if config.HealthComponentsField != "" {
+		if health.FailingComponents, err = decodeFailingComponents(body, config.HealthComponentsField); err != nil {
+			return health, meta, &FetchError{Class: ErrorClassInvalidResponse, Err: fmt.Errorf("server %s: %v", serverURL, err)}
+		}
+	}
+
+	return health, meta, nil
+}
+
+// sleepContext waits for d, or less once ctx is done so a canceled run does
+// not sit out the REQUEST_DELAY of every remaining server
+func sleepContext(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
 }
 
 func fetchHealthDataWithDelayAndConcurrency(
-	servers []string,
-	dataChannel chan<- AggregatedData,
+	ctx context.Context,
+	servers []ServerEntry,
+	resultChannel chan<- ServerResult,
 	config *Config,
+	state *scanState,
 ) {
-	var wg sync.WaitGroup
-	sem := make(chan struct{}, config.MaxConcurrency)
-
-	for _, server := range servers {
-		wg.Add(1)
-		go func(server string) {
-			defer wg.Done()
+	client := newHTTPClient(config)
+	var breaker *circuitBreaker
+	var identities *identityPinner
+	var telemetry *otelRecorder
+	var dial dialFunc
+	var lookup resolver = net.DefaultResolver
+	if state != nil {
+		if state.bastion != nil {
+			dial = state.bastion.DialContext
+			client = newTunneledHTTPClient(config, dial, state.bastion)
+			lookup = state.bastion
+		} else if state.dns != nil {
+			client = newCachedDNSHTTPClient(config, state.dns)
+			lookup = state.dns
+		}
+		breaker = state.breaker
+		identities = state.identities
+		telemetry = state.otel
+	}
+	clients := newServerNameClients(client, func(transport http.RoundTripper) http.RoundTripper {
+		if state != nil && state.responses != nil {
+			transport = state.responses.wrap(transport)
+		}
+		if state != nil && state.token != nil {
+			transport = state.token.wrap(transport)
+		}
+		return transport
+	})
+	tcpDial := guardDial(config, dial, lookup)
+	budget := newRetryBudget(config.MaxTotalRetries)
+	ceiling := newRequestCeiling(config.MaxTotalRequests)
+	budget.out, ceiling.out = config.Console, config.Console
 
-			if !strings.HasPrefix(server, "http://") && !strings.HasPrefix(server, "https://") {
-				server = "https://" + server
+	check := func(entry ServerEntry) ServerResult {
+		config := configFor(entry, config)
+		if isTCPAddress(entry.Address) {
+			if !ceiling.take() {
+				return ceiling.skippedResult(entry, entry.Address)
+			}
+			sleepContext(ctx, config.RequestDelay)
+			start := time.Now()
+			result := checkTCPServer(ctx, entry, config, tcpDial)
+			if telemetry != nil {
+				telemetry.RecordFetch(result, start, time.Now())
 			}
+			return result
+		}
+
+		// TLS presents the Host header as server name, so the certificate
+		// is verified against the name the server is reached under
+		serverClient := clients.get(config.HostHeader)
+		if _, ok := entry.Tags[timeoutTag]; ok {
+			// The client's timeout would cap a longer override, so the
+			// server's requests are bounded by their context instead
+			c := *serverClient
+			c.Timeout = 0
+			serverClient = &c
+		}
+
+		server := entry.Address
+		if !strings.HasPrefix(server, "http://") && !strings.HasPrefix(server, "https://") {
+			server = "https://" + server
+		}
+
+		serverURL := server + healthPathFor(entry, config)
 
-			serverURL := server + "/healthz"
+		circuitState := CircuitClosed
+		if breaker != nil {
+			var allowed bool
+			if circuitState, allowed = breaker.allow(entry.name()); !allowed {
+				return breaker.skippedResult(entry, serverURL)
+			}
+		}
 
-			sem <- struct{}{}
-			defer func() { <-sem }()
-			time.Sleep(config.RequestDelay)
+		sleepContext(ctx, config.RequestDelay)
 
-			health, err := fetchHealthData(serverURL, config.HTTPTimeout)
-			if err != nil {
-				fmt.Printf("Error fetching data from %s: %v\n", serverURL, err)
-				return
+		result := ServerResult{Server: entry.name(), URL: serverURL, Tags: entry.Tags}
+		start := time.Now()
+		health, meta, err := fetchHealthDataWithRetry(ctx, serverClient, serverURL, config, budget, ceiling)
+		if classifyError(err) == ErrorClassSkippedBudget {
+			return ceiling.skippedResult(entry, serverURL)
+		}
+		result.Protocol = meta.Protocol
+		result.StatusCode = meta.StatusCode
+		result.Attempts = meta.Attempts
+		if meta.Attempts > 1 {
+			result.Retries = meta.Attempts - 1
+		}
+		result.Revalidated = meta.Revalidated
+		if meta.Body != nil {
+			result.RawBody, result.RawBodyEncoding = encodeRawBody(meta.Body)
+			result.RawBodyTruncated = meta.BodyTruncated
+		}
+		result.LatencyMs = durationMs(meta.Latency)
+		result.LivenessOnly = isLivenessOnly(config) || meta.Redirected
+		if config.HealthBooleanField != "" {
+			result.Application, result.Version = health.Application, health.Version
+		}
+		if err == nil && !result.LivenessOnly {
+			if result.Dropped, err = validateHealth(&health, serverURL, config); err != nil && meta.debugBody != nil {
+				logDebugBody(config, serverURL, meta.debugBody)
 			}
+		}
+		if err != nil {
+			fmt.Fprintf(config.Console, "Error fetching data from %s: %v\n", serverURL, err)
+			result.Error = err.Error()
+			result.ErrorClass = classifyError(err)
+		} else if !result.LivenessOnly {
+			result.Health = &health
+		}
+		if breaker != nil {
+			result.CircuitProbe = circuitState == CircuitHalfOpen
+			result.CircuitState = breaker.record(entry.name(), err == nil)
+		}
+		if identities != nil {
+			identities.Pin(&result)
+		}
+		if telemetry != nil {
+			telemetry.RecordFetch(result, start, time.Now())
+		}
+
+		return result
+	}
+
+	// Each port of a host is checked as a server of its own
+	servers = expandPorts(servers)
 
-			dataChannel <- AggregatedData{
-				Application:    health.Application,
-				Version:        health.Version,
-				TotalRequests:  health.RequestCount,
-				TotalSuccesses: health.SuccessCount,
+	// A fixed pool of MaxConcurrency workers bounds the goroutines to the
+	// concurrency however long the servers list is
+	workers := config.MaxConcurrency
+	if workers > len(servers) {
+		workers = len(servers)
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	// Workers take the next server whose class has a free CLASS_CONCURRENCY
+	// slot, so a class at its limit does not park the workers
+	queue := newClassQueue(servers, config.ClassConcurrency)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				entry, release, ok := queue.next()
+				if !ok {
+					return
+				}
+				result := check(entry)
+				release()
+				resultChannel <- result
 			}
-		}(server)
+		}()
 	}
 
 	wg.Wait()
-	close(dataChannel)
+	close(resultChannel)
 }
 
 func readServersList(filename string) ([]string, error) {
@@ -109,67 +456,486 @@ func readServersList(filename string) ([]string, error) {
 	return servers, scanner.Err()
 }
 
+// toAggregatedData converts a single health response into an aggregation record
+func toAggregatedData(health HealthResponse) AggregatedData {
+	data := AggregatedData{
+		Application:    health.Application,
+		Version:        health.Version,
+		TotalRequests:  health.RequestCount,
+		TotalSuccesses: health.SuccessCount,
+	}
+	if health.Status != "" {
+		data.StatusCounts = map[string]int{health.Status: 1}
+	}
+	for _, component := range health.FailingComponents {
+		if data.UnhealthyComponents == nil {
+			data.UnhealthyComponents = make(map[string]int)
+		}
+		data.UnhealthyComponents[component]++
+	}
+	return data
+}
+
 func aggregateData(data []AggregatedData) map[string]map[string]AggregatedData {
 	aggregation := make(map[string]map[string]AggregatedData)
 	for _, d := range data {
-		if _, exists := aggregation[d.Application]; !exists {
-			aggregation[d.Application] = make(map[string]AggregatedData)
-		}
-		agg := aggregation[d.Application][d.Version]
-		agg.Application = d.Application
-		agg.Version = d.Version
-		agg.TotalRequests += d.TotalRequests
-		agg.TotalSuccesses += d.TotalSuccesses
-		aggregation[d.Application][d.Version] = agg
+		foldAggregatedData(aggregation, d)
 	}
 	return aggregation
 }
 
+// foldAggregatedData adds the counts of d to its application and version in
+// aggregation
+func foldAggregatedData(aggregation map[string]map[string]AggregatedData, d AggregatedData) {
+	if _, exists := aggregation[d.Application]; !exists {
+		aggregation[d.Application] = make(map[string]AggregatedData)
+	}
+	agg := aggregation[d.Application][d.Version]
+	agg.Application = d.Application
+	agg.Version = d.Version
+	agg.TotalRequests += d.TotalRequests
+	agg.TotalSuccesses += d.TotalSuccesses
+	for status, count := range d.StatusCounts {
+		if agg.StatusCounts == nil {
+			agg.StatusCounts = make(map[string]int)
+		}
+		agg.StatusCounts[status] += count
+	}
+	for component, count := range d.UnhealthyComponents {
+		if agg.UnhealthyComponents == nil {
+			agg.UnhealthyComponents = make(map[string]int)
+		}
+		agg.UnhealthyComponents[component] += count
+	}
+	aggregation[d.Application][d.Version] = agg
+}
+
 func main() {
 	// Load configuration
 	config := LoadConfigFromEnv()
 
-	// Log current configuration
-	fmt.Printf("Running with configuration:\n")
-	fmt.Printf("- HTTP Timeout: %v\n", config.HTTPTimeout)
-	fmt.Printf("- Request Delay: %v\n", config.RequestDelay)
-	fmt.Printf("- Max Concurrency: %d\n\n", config.MaxConcurrency)
-
-	servers, err := readServersList("servers.txt")
+	cmd, args, err := findCommand(os.Args[1:])
 	if err != nil {
-		fmt.Println("Error reading servers list:", err)
+		fmt.Fprintln(config.Console, "Error:", err)
+		printUsage(os.Stdout)
+		os.Exit(exitCodeError)
+	}
+	if cmd == nil {
+		printUsage(os.Stdout)
 		return
 	}
 
-	dataChannel := make(chan AggregatedData, len(servers))
+	if err := cmd.run(args, config, os.Stdout); err != nil {
+		var exitErr *exitError
+		switch {
+		case errors.Is(err, flag.ErrHelp):
+			return
+		case errors.As(err, &exitErr):
+			fmt.Fprintln(config.Console, exitErr.reason)
+			os.Exit(exitErr.code)
+		default:
+			fmt.Fprintln(config.Console, "Error:", err)
+			os.Exit(exitCodeError)
+		}
+	}
+}
 
-	go fetchHealthDataWithDelayAndConcurrency(servers, dataChannel, config)
+// runScan implements the scan command, the default when no command is named.
+// Its flags override the corresponding environment variables.
+func runScan(args []string, config *Config, _ io.Writer) error {
+	if err := parseScanFlags(args, config); err != nil {
+		return err
+	}
+	if err := checkOutputFormat(config.OutputFormat); err != nil {
+		return err
+	}
+	routeConsole(config)
+	if err := checkDashboardOutputs(config); err != nil {
+		return err
+	}
 
-	var collectedData []AggregatedData
-	for data := range dataChannel {
-		collectedData = append(collectedData, data)
+	// Log current configuration
+	fmt.Fprintf(config.Console, "Running with configuration:\n")
+	if config.Environment != "" {
+		fmt.Fprintf(config.Console, "- Environment: %s\n", config.Environment)
+	}
+	if config.Region != "" {
+		fmt.Fprintf(config.Console, "- Region: %s\n", config.Region)
+	}
+	fmt.Fprintf(config.Console, "- Servers: %s\n", config.ServersFile)
+	fmt.Fprintf(config.Console, "- HTTP Timeout: %v\n", config.HTTPTimeout)
+	if config.BodyTimeout > 0 {
+		fmt.Fprintf(config.Console, "- Body Timeout: %v\n", config.BodyTimeout)
+	}
+	if config.ConnectTimeout > 0 {
+		fmt.Fprintf(config.Console, "- Connect Timeout: %v\n", config.ConnectTimeout)
+	}
+	fmt.Fprintf(config.Console, "- Request Delay: %v\n", config.RequestDelay)
+	fmt.Fprintf(config.Console, "- Max Concurrency: %d\n", config.MaxConcurrency)
+	if len(config.ClassConcurrency) > 0 {
+		fmt.Fprintf(config.Console, "- Class Concurrency: %v\n", config.ClassConcurrency)
+	}
+	fmt.Fprintf(config.Console, "- Shuffle: %v\n", config.Shuffle)
+	fmt.Fprintf(config.Console, "- Max Retries: %d (total budget: %d)\n", config.MaxRetries, config.MaxTotalRetries)
+	if config.AuthTokenCommand != "" {
+		fmt.Fprintf(config.Console, "- Auth Token: from command (timeout: %v, TTL: %v)\n", config.AuthTokenTimeout, config.AuthTokenTTL)
+	}
+	if config.MaxTotalRequests > 0 {
+		fmt.Fprintf(config.Console, "- Max Total Requests: %d\n", config.MaxTotalRequests)
+	}
+	fmt.Fprintf(config.Console, "- Keep History: %d\n", config.KeepHistory)
+	fmt.Fprintf(config.Console, "- Force HTTP/2: %v\n", config.ForceHTTP2)
+	fmt.Fprintf(config.Console, "- Include Raw Results: %v\n", config.IncludeRaw)
+	fmt.Fprintf(config.Console, "- Empty Application Policy: %s\n", config.EmptyAppPolicy)
+	fmt.Fprintf(config.Console, "- Empty Version Policy: %s\n", config.EmptyVersionPolicy)
+	fmt.Fprintf(config.Console, "- Output: %s (%s)\n", config.OutputFile, config.OutputFormat)
+	if config.TargetApp != "" {
+		fmt.Fprintf(config.Console, "- Target Application: %s (strict: %v)\n", config.TargetApp, config.TargetAppStrict)
+	}
+	if config.WatchInterval > 0 {
+		fmt.Fprintf(config.Console, "- Watch Interval: %v\n", config.WatchInterval)
+		if config.WatchJitter > 0 {
+			fmt.Fprintf(config.Console, "- Watch Jitter: +/-%g%%\n", config.WatchJitter)
+		}
+	}
+	if config.RunTimeout > 0 {
+		fmt.Fprintf(config.Console, "- Run Timeout: %v (watchdog after %gx)\n", config.RunTimeout, config.WatchdogFactor)
+	}
+	if config.MetricsAddr != "" {
+		fmt.Fprintf(config.Console, "- Metrics Address: %s (labels: %s, pprof: %v)\n",
+			config.MetricsAddr, strings.Join(config.MetricsLabels, ","), config.EnablePprof)
+	}
+	if config.StatsdAddr != "" {
+		fmt.Fprintf(config.Console, "- StatsD Address: %s\n", config.StatsdAddr)
 	}
+	if config.PushgatewayURL != "" {
+		fmt.Fprintf(config.Console, "- Pushgateway: %s (job %s)\n", config.PushgatewayURL, config.PushgatewayJob)
+	}
+	if config.SLOTarget > 0 {
+		fmt.Fprintf(config.Console, "- SLO Target: %.3f%% (burn rate factor %.1f over %v and %v)\n",
+			config.SLOTarget, config.BurnRateFactor, config.BurnShortWindow, config.BurnLongWindow)
+	}
+	fmt.Fprintf(config.Console, "- Exit Policy: %s\n", config.ExitPolicy)
+	if config.BastionHost != "" {
+		fmt.Fprintf(config.Console, "- Bastion: %s@%s\n", config.BastionUser, config.BastionHost)
+	}
+	if config.WebhookURL != "" {
+		fmt.Fprintf(config.Console, "- Webhook: enabled (timeout %v, flush timeout %v)\n", config.WebhookTimeout, config.WebhookFlushTimeout)
+	}
+	if config.HealthMethod == http.MethodPost {
+		fmt.Fprintf(config.Console, "- Health Method: POST (%d byte %s body)\n", len(config.HealthBody), config.HealthContentType)
+	}
+	if config.HealthMethod == http.MethodHead {
+		fmt.Fprintf(config.Console, "- Health Method: HEAD (liveness only, no counts)\n")
+	} else if config.HealthBooleanField != "" {
+		fmt.Fprintf(config.Console, "- Health Field: %s (liveness only, no counts)\n", config.HealthBooleanField)
+	}
+	if isLivenessOnly(config) {
+		if settings := countDependentSettings(config); len(settings) > 0 {
+			fmt.Fprintf(config.Console, "Warning: liveness-only health checks return no counts, so %s will have no data to work with\n", strings.Join(settings, ", "))
+		}
+	}
+	if config.MinRequests > 0 {
+		fmt.Fprintf(config.Console, "- Minimum Requests: %d\n", config.MinRequests)
+	}
+	fmt.Fprintf(config.Console, "- Severity Thresholds: critical < %.2f%%, warning < %.2f%%\n\n",
+		config.CriticalThreshold, config.WarningThreshold)
 
-	aggregation := aggregateData(collectedData)
+	// The run context is canceled on SIGINT/SIGTERM so in-flight work such as
+	// webhook notifications stops promptly
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	fmt.Println("Health Report:")
-	for app, versions := range aggregation {
-		for version, data := range versions {
-			successRate := float64(data.TotalSuccesses) / float64(data.TotalRequests) * 100
-			fmt.Printf("Application: %s, Version: %s, Success Rate: %.2f%%\n",
-				app, version, successRate)
+	// The dashboard swaps the console writer, so it starts before the scan
+	// state's goroutines can print
+	var dash *dashboard
+	if usesDashboard(config) {
+		var ok bool
+		if dash, ok = startDashboard(config, stop); ok {
+			defer dash.Close()
+		} else {
+			fmt.Fprintln(config.Console, "Warning: TUI needs a terminal, using plain output")
 		}
 	}
 
-	outputFile := "report.json"
-	jsonData, err := json.MarshalIndent(aggregation, "", "  ")
+	state, err := newScanState(ctx, config)
 	if err != nil {
-		fmt.Println("Error encoding JSON:", err)
-		return
+		return err
 	}
-	if err := os.WriteFile(outputFile, jsonData, 0644); err != nil {
-		fmt.Println("Error writing to file:", err)
-		return
+	if state.metrics != nil {
+		startMetricsServer(state.metrics, state.self, config)
+	}
+
+	cycle := func(ctx context.Context) (*cycleOutcome, error) {
+		return runCycle(ctx, config, state)
+	}
+	watchdog := newCycleWatchdog(config)
+
+	if config.WatchInterval <= 0 {
+		outcome, err := watchdog.Run(ctx, cycle)
+		if err == nil && state.self != nil {
+			state.self.CycleCompleted()
+		}
+		watchdog.Wait()
+		state.Close(config)
+		if err != nil {
+			return err
+		}
+		if code, reason := decideExitCode(outcome, config); code != exitCodeOK {
+			return &exitError{code: code, reason: fmt.Sprintf("Exit policy %s failed: %s", config.ExitPolicy, reason)}
+		}
+		if config.GlobalRateGate > 0 {
+			rate, requests := globalSuccessRate(outcome.Report.Applications)
+			fmt.Fprintf(config.Console, "Global success rate: %.2f%% over %d requests (gate: %.2f%%)\n", rate, requests, config.GlobalRateGate)
+			if code, reason := decideGlobalRateGate(outcome, config); code != exitCodeOK {
+				return &exitError{code: code, reason: fmt.Sprintf("Global rate gate failed: %s", reason)}
+			}
+		}
+		if regressed := len(outcome.Report.BaselineRegressions); config.FailOnRegression && regressed > 0 {
+			return &exitError{code: exitCodePolicyFailed, reason: fmt.Sprintf("%d application versions regressed from the baseline %s", regressed, config.BaselineFile)}
+		}
+		return nil
+	}
+
+	jitter := newIntervalJitter(config)
+	for {
+		outcome, err := watchdog.Run(ctx, cycle)
+		if err != nil {
+			fmt.Fprintln(config.Console, "Error:", err)
+		} else if state.self != nil {
+			state.self.CycleCompleted()
+		}
+		if dash != nil {
+			dash.Update(outcome, err)
+		}
+		select {
+		case <-ctx.Done():
+			watchdog.Wait()
+			state.Close(config)
+			return nil
+		case <-time.After(jitter.Next()):
+		}
+	}
+}
+
+// cycleOutcome is what a completed scan cycle produced
+type cycleOutcome struct {
+	Report  Report
+	Results []ServerResult
+}
+
+// publishReport writes the report and pushes the StatsD and Pushgateway
+// gauges concurrently so a slow push does not delay the write or the other way
+// around. Every push has completed when it returns. The report is
+// authoritative: only a failed write fails the cycle, a failed push is logged.
+func publishReport(ctx context.Context, config *Config, state *scanState, report Report) error {
+	var wg sync.WaitGroup
+	var writeErr, pushErr, gatewayErr, kafkaErr, otelErr error
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		writeErr = state.writer.Write(ctx, report)
+	}()
+
+	if config.StatsdAddr != "" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pushErr = sendStatsd(config.StatsdAddr, statsdLines(report.Applications, config.Environment))
+		}()
+	}
+
+	if config.PushgatewayURL != "" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			gatewayErr = pushMetrics(ctx, config, report)
+		}()
+	}
+
+	if state.otel != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			otelErr = state.otel.Flush(ctx)
+		}()
+	}
+
+	if state.kafka != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			kafkaErr = publishKafka(ctx, state.kafka, report, config)
+		}()
+	}
+
+	wg.Wait()
+	if otelErr != nil {
+		fmt.Fprintf(config.Console, "Error exporting to OpenTelemetry collector %s: %v\n", config.OTLPEndpoint, otelErr)
+	}
+	if kafkaErr != nil {
+		fmt.Fprintf(config.Console, "Error publishing to Kafka topic %s: %v\n", config.KafkaTopic, kafkaErr)
+	}
+	if pushErr != nil {
+		fmt.Fprintf(config.Console, "Error sending StatsD metrics to %s: %v\n", config.StatsdAddr, pushErr)
+	}
+	if gatewayErr != nil {
+		fmt.Fprintf(config.Console, "Error pushing metrics to %s: %v\n", config.PushgatewayURL, gatewayErr)
+	}
+	if writeErr != nil {
+		return fmt.Errorf("failed to write report: %v", writeErr)
+	}
+	return nil
+}
+
+// runCycle performs a single scan: it checks every server, aggregates the
+// results and writes the report. State carried between watch cycles lives in
+// state.
+func runCycle(ctx context.Context, config *Config, state *scanState) (*cycleOutcome, error) {
+	var entries []ServerEntry
+	var err error
+	if state.servers != nil {
+		entries, err = state.servers.Load(config)
+	} else {
+		entries, err = loadServerEntries(config)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if config.NormalizeHosts {
+		entries = normalizeServerEntries(entries, config.NormalizeStripPort)
+	}
+	// The files of a directory may overlap, so a server listed in several of
+	// them is checked once. A single list is taken as written.
+	if isServersDir(config.ServersFile) {
+		entries = dedupeServers(entries)
+	}
+
+	servers := selectServers(entries, config)
+	if skipped := len(entries) - len(servers); skipped > 0 {
+		fmt.Fprintf(config.Console, "Skipping %d servers not tagged app=%s\n", skipped, config.TargetApp)
+	}
+	if config.Shuffle {
+		seed := config.ShuffleSeed
+		if seed == 0 {
+			seed = time.Now().UnixNano()
+		}
+		servers = shuffleServers(servers, seed)
+	}
+
+	if state.token != nil {
+		if err := state.token.Refresh(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	resultChannel := make(chan ServerResult, len(servers))
+
+	go fetchHealthDataWithDelayAndConcurrency(ctx, servers, resultChannel, config, state)
+
+	var onResult func(ServerResult)
+	if state.stream != nil {
+		onResult = func(result ServerResult) {
+			if err := state.stream.Write(result); err != nil {
+				fmt.Fprintf(config.Console, "Error streaming result for %s: %v\n", result.Server, err)
+			}
+		}
+	}
+	results, collectedData, aggregation := consumeResults(resultChannel, config.ResultConsumers, onResult)
+	if canonicalizeApplications(results, config) {
+		collectedData = collectedData[:0]
+		for _, result := range results {
+			if result.Health != nil && !result.Dropped {
+				collectedData = append(collectedData, toAggregatedData(*result.Health))
+			}
+		}
+		aggregation = aggregateData(collectedData)
+	}
+
+	for _, warning := range detectDataAnomalies(collectedData, config) {
+		fmt.Fprintf(config.Console, "Data warning: %s\n", warning)
+	}
+	var uptimeRegressions []UptimeRegression
+	if state.uptimes != nil {
+		uptimeRegressions = state.uptimes.Observe(results, time.Now())
+		for _, regression := range uptimeRegressions {
+			fmt.Fprintf(config.Console, "Data warning: %s\n", regression)
+		}
+	}
+	var requestDeltas []RequestDelta
+	if state.deltas != nil {
+		requestDeltas = state.deltas.Observe(results, time.Now())
+		for _, delta := range requestDeltas {
+			fmt.Fprintf(config.Console, "Since last cycle: %s\n", delta)
+		}
+	}
+
+	annotateSeverity(aggregation, config)
+	if config.VolumeShares {
+		annotateVolumeShares(aggregation)
+	}
+	if len(config.SuccessPercentiles) > 0 {
+		annotateInstancePercentiles(aggregation, collectedData, config.SuccessPercentiles)
+	}
+
+	fmt.Fprintln(config.Console, "Health Report:")
+	printSeveritySummary(config.Console, aggregation)
+	printLivenessSummary(config.Console, aggregateLiveness(results, config))
+	printSlowest(config.Console, slowestEndpoints(results, config.SlowestN))
+
+	if state.metrics != nil {
+		state.metrics.Update(aggregation, results)
+	}
+
+	if state.burnRate != nil {
+		now := time.Now()
+		state.burnRate.RecordResults(results, now)
+		for _, alert := range state.burnRate.Evaluate(now) {
+			fmt.Fprintf(config.Console, "Burn-rate alert: Application: %s, Version: %s, burning error budget at %.1fx over %v and %.1fx over %v\n",
+				alert.Application, alert.Version, alert.ShortBurnRate, config.BurnShortWindow, alert.LongBurnRate, config.BurnLongWindow)
+		}
+	}
+
+	alerts := breachingRecords(aggregation, config)
+	if state.notifier != nil {
+		state.notifier.Notify(alerts)
+	}
+
+	report := buildReport(aggregation, results, config)
+	report.UptimeRegressions = uptimeRegressions
+	report.RequestDeltas = requestDeltas
+	if status, fraction := overallStatus(report.Applications, config); status != "" {
+		fmt.Fprintf(config.Console, "Overall status: %s (%.0f%% of application versions failing)\n", status, fraction*100)
+	}
+	if state.sloTargets != nil {
+		report.SLO = computeSLOCompliance(aggregation, state.sloTargets, config)
+	}
+	if state.baseline != nil {
+		report.BaselineRegressions = findRegressions(state.baseline.Applications, report.Applications, config.RegressionTolerance)
+		for _, regression := range report.BaselineRegressions {
+			fmt.Fprintf(config.Console, "Regression from baseline: %s\n", regression)
+		}
+	}
+	if err := publishReport(ctx, config, state, report); err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(config.Console, "Report saved to %s\n", config.OutputFile)
+
+	if config.AlertsFile != "" {
+		if err := writeAlertsFile(config.AlertsFile, alerts); err != nil {
+			fmt.Fprintf(config.Console, "Error writing alerts to %s: %v\n", config.AlertsFile, err)
+		} else {
+			fmt.Fprintf(config.Console, "Alerts saved to %s\n", config.AlertsFile)
+		}
+	}
+
+	if config.FailuresFile != "" {
+		if written, err := writeFailuresCSV(config.FailuresFile, results); err != nil {
+			fmt.Fprintf(config.Console, "Error writing failures to %s: %v\n", config.FailuresFile, err)
+		} else if written {
+			fmt.Fprintf(config.Console, "Failures saved to %s\n", config.FailuresFile)
+		}
 	}
-	fmt.Printf("Report saved to %s\n", outputFile)
+	return &cycleOutcome{Report: report, Results: results}, nil
 }
@@ -1,9 +1,22 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"testing"
 	"time"
 )
@@ -89,19 +102,36 @@ func TestLoadConfigFromEnv(t *testing.T) {
 
 // Mock server to simulate /healthz endpoint
 func setupMockServer() *httptest.Server {
+	return setupMockServerWithBody(mockResponse)
+}
+
+// Mock server to simulate a /healthz endpoint returning a custom body
+func setupMockServerWithBody(body string) *httptest.Server {
 	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
-		w.Write([]byte(mockResponse))
+		w.Write([]byte(body))
 	}))
 }
 
+// collectResults runs the concurrent fetch against servers and gathers the results
+func collectResults(servers []ServerEntry, config *Config) []ServerResult {
+	resultChannel := make(chan ServerResult, len(servers))
+	go fetchHealthDataWithDelayAndConcurrency(context.Background(), servers, resultChannel, config, nil)
+
+	var results []ServerResult
+	for result := range resultChannel {
+		results = append(results, result)
+	}
+	return results
+}
+
 // Test fetching health data with a mock server
 func TestFetchHealthData(t *testing.T) {
 	server := setupMockServer()
 	defer server.Close()
 
 	config := NewDefaultConfig()
-	data, err := fetchHealthData(server.URL, config.HTTPTimeout)
+	data, _, err := fetchHealthData(context.Background(), newHTTPClient(config), server.URL, config)
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
 	}
@@ -144,24 +174,27 @@ func TestAggregateData(t *testing.T) {
 
 // Test rate limiting and concurrency handling
 func TestFetchHealthDataWithDelayAndConcurrency(t *testing.T) {
-	servers := []string{}
+	servers := []ServerEntry{}
 	mockServer := setupMockServer()
 	defer mockServer.Close()
 
 	// Use the full mock server URL
 	for i := 0; i < 3; i++ {
-		servers = append(servers, mockServer.URL)
+		servers = append(servers, ServerEntry{Address: mockServer.URL})
 	}
 
 	config := NewDefaultConfig()
 	config.MaxConcurrency = 2 // Set concurrency to 2 for testing
 
-	dataChannel := make(chan AggregatedData, len(servers))
-	go fetchHealthDataWithDelayAndConcurrency(servers, dataChannel, config)
+	resultChannel := make(chan ServerResult, len(servers))
+	go fetchHealthDataWithDelayAndConcurrency(context.Background(), servers, resultChannel, config, nil)
 
 	var result []AggregatedData
-	for data := range dataChannel {
-		result = append(result, data)
+	for r := range resultChannel {
+		if r.Health == nil {
+			t.Fatalf("Expected health data from %s, got error %s", r.URL, r.Error)
+		}
+		result = append(result, toAggregatedData(*r.Health))
 	}
 
 	if len(result) != len(servers) {
@@ -176,3 +209,679 @@ func TestFetchHealthDataWithDelayAndConcurrency(t *testing.T) {
 		}
 	}
 }
+
+// Test that a long servers list is checked by a bounded pool of workers
+// rather than a goroutine per server
+func TestFetchWorkerPool(t *testing.T) {
+	const serverCount = 2000
+	const concurrency = 10
+
+	var inFlight int32
+	release := make(chan struct{})
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&inFlight, 1)
+		<-release
+		w.Write([]byte(mockResponse))
+	}))
+	defer mockServer.Close()
+
+	servers := make([]ServerEntry, serverCount)
+	for i := range servers {
+		servers[i] = ServerEntry{Address: mockServer.URL}
+	}
+	config := NewDefaultConfig()
+	config.MaxConcurrency = concurrency
+	config.RequestDelay = 0
+
+	baseline := runtime.NumGoroutine()
+	resultChannel := make(chan ServerResult, serverCount)
+	go fetchHealthDataWithDelayAndConcurrency(context.Background(), servers, resultChannel, config, nil)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&inFlight) < concurrency && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	// Each in-flight check also holds client and server connection
+	// goroutines, but nothing proportional to the list length
+	if grown := runtime.NumGoroutine() - baseline; grown > 10*concurrency {
+		t.Errorf("Expected goroutines bounded by the concurrency, grew by %d for %d servers", grown, serverCount)
+	}
+	close(release)
+
+	var count int
+	for r := range resultChannel {
+		if r.Health == nil {
+			t.Fatalf("Expected health data from %s, got error %s", r.URL, r.Error)
+		}
+		count++
+	}
+	if count != serverCount {
+		t.Errorf("Expected %d results, got %d", serverCount, count)
+	}
+}
+
+// Test that the negotiated protocol is recorded and FORCE_HTTP2 is enforced
+func TestFetchHealthDataHTTP2(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(mockResponse))
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	config := NewDefaultConfig()
+	config.ForceHTTP2 = true
+	client := newHTTPClient(config)
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+	client.Transport.(*http.Transport).TLSClientConfig = &tls.Config{RootCAs: pool}
+
+	_, meta, err := fetchHealthData(context.Background(), client, server.URL, config)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if meta.Protocol != "HTTP/2.0" {
+		t.Errorf("Expected protocol HTTP/2.0, got %s", meta.Protocol)
+	}
+
+	// A plain HTTP/1.1 server must be rejected when HTTP/2 is forced
+	plain := setupMockServer()
+	defer plain.Close()
+	if _, meta, err := fetchHealthData(context.Background(), newHTTPClient(config), plain.URL, config); err == nil {
+		t.Errorf("Expected error for %s response with FORCE_HTTP2, got none", meta.Protocol)
+	}
+}
+
+// Test that raw results are only included in the report when enabled
+func TestBuildReportRaw(t *testing.T) {
+	results := []ServerResult{
+		{Server: "server-0002", Protocol: "HTTP/2.0"},
+		{Server: "server-0001", Protocol: "HTTP/1.1", Error: "timeout"},
+	}
+	config := NewDefaultConfig()
+
+	if report := buildReport(nil, results, config); report.Raw != nil {
+		t.Errorf("Expected no raw results by default, got %v", report.Raw)
+	}
+
+	config.IncludeRaw = true
+	report := buildReport(nil, results, config)
+	if len(report.Raw) != 2 {
+		t.Fatalf("Expected 2 raw results, got %d", len(report.Raw))
+	}
+	if report.Raw[0].Server != "server-0001" || report.Raw[1].Protocol != "HTTP/2.0" {
+		t.Errorf("Expected raw results sorted by server with protocols, got %v", report.Raw)
+	}
+}
+
+// Test each policy for a health response with an empty application name
+func TestEmptyApplicationPolicy(t *testing.T) {
+	server := setupMockServerWithBody(`{"application": "", "version": "1.0.1", "requestCount": 10, "successCount": 9}`)
+	defer server.Close()
+
+	config := NewDefaultConfig()
+	config.RequestDelay = 0
+
+	// Default policy buckets the record under the placeholder
+	servers := []ServerEntry{{Address: server.URL}}
+	results := collectResults(servers, config)
+	if len(results) != 1 || results[0].Health == nil {
+		t.Fatalf("Expected one successful result, got %v", results)
+	}
+	if results[0].Health.Application != "unknown" || results[0].Dropped {
+		t.Errorf("Expected application 'unknown', got %q (dropped %v)", results[0].Health.Application, results[0].Dropped)
+	}
+
+	config.EmptyAppPolicy = EmptyPolicyDrop
+	results = collectResults(servers, config)
+	if len(results) != 1 || !results[0].Dropped || results[0].Error != "" {
+		t.Errorf("Expected a dropped result without error, got %v", results)
+	}
+
+	config.EmptyAppPolicy = EmptyPolicyError
+	results = collectResults(servers, config)
+	if len(results) != 1 || results[0].Health != nil || results[0].Error == "" {
+		t.Errorf("Expected a failed result, got %v", results)
+	}
+}
+
+// Test each policy for a health response with an empty version, and that
+// bucketed records still aggregate with the rest
+func TestEmptyVersionPolicy(t *testing.T) {
+	versioned := setupMockServerWithBody(`{"application": "Memcache2", "version": "1.0.1", "requestCount": 100, "successCount": 100}`)
+	defer versioned.Close()
+	unversioned := setupMockServerWithBody(`{"application": "Memcache2", "requestCount": 10, "successCount": 9}`)
+	defer unversioned.Close()
+	unversioned2 := setupMockServerWithBody(`{"application": "Memcache2", "version": "", "requestCount": 30, "successCount": 30}`)
+	defer unversioned2.Close()
+
+	config := NewDefaultConfig()
+	config.RequestDelay = 0
+	servers := []ServerEntry{{Address: versioned.URL}, {Address: unversioned.URL}, {Address: unversioned2.URL}}
+
+	// Default policy buckets both under the unknown version
+	results := collectResults(servers, config)
+	var data []AggregatedData
+	for _, result := range results {
+		if result.Health != nil && !result.Dropped {
+			data = append(data, toAggregatedData(*result.Health))
+		}
+	}
+	aggregation := aggregateData(data)
+	if unknown := aggregation["Memcache2"]["unknown"]; unknown.TotalRequests != 40 || unknown.TotalSuccesses != 39 {
+		t.Errorf("Expected 39/40 under the unknown version, got %+v", unknown)
+	}
+	if known := aggregation["Memcache2"]["1.0.1"]; known.TotalRequests != 100 {
+		t.Errorf("Expected 1.0.1 to be kept apart, got %+v", known)
+	}
+	if _, ok := aggregation["Memcache2"][""]; ok {
+		t.Error("Expected no empty version key")
+	}
+
+	config.EmptyVersionPlaceholder = "untagged"
+	for _, result := range collectResults(servers[1:2], config) {
+		if result.Health == nil || result.Health.Version != "untagged" {
+			t.Errorf("Expected the configured placeholder, got %+v", result.Health)
+		}
+	}
+
+	config.EmptyVersionPolicy = EmptyPolicyDrop
+	results = collectResults(servers[1:2], config)
+	if len(results) != 1 || !results[0].Dropped || results[0].Error != "" {
+		t.Errorf("Expected a dropped result without error, got %v", results)
+	}
+
+	config.EmptyVersionPolicy = EmptyPolicyError
+	results = collectResults(servers[1:2], config)
+	if len(results) != 1 || results[0].Health != nil || results[0].ErrorClass != ErrorClassInvalidResponse {
+		t.Errorf("Expected a failed result, got %v", results)
+	}
+}
+
+// Test decoding counts sent as JSON strings and rejecting non-numeric ones
+func TestFetchHealthDataStringCounts(t *testing.T) {
+	server := setupMockServerWithBody(`{
+    "application": "Memcache2",
+    "version": "1.0.1",
+    "uptime": "4637719417",
+    "requestCount": "5194800029",
+    "errorCount": 1042813251,
+    "successCount": "4151986778"
+}`)
+	defer server.Close()
+
+	config := NewDefaultConfig()
+	data, _, err := fetchHealthData(context.Background(), newHTTPClient(config), server.URL, config)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if data.RequestCount != 5194800029 || data.SuccessCount != 4151986778 || data.ErrorCount != 1042813251 {
+		t.Errorf("Expected counts 5194800029/4151986778/1042813251, got %d/%d/%d",
+			data.RequestCount, data.SuccessCount, data.ErrorCount)
+	}
+	if data.Uptime != 4637719417 || data.Application != "Memcache2" {
+		t.Errorf("Expected uptime and application to decode, got %d and %s", data.Uptime, data.Application)
+	}
+
+	invalid := setupMockServerWithBody(`{"application": "Memcache2", "requestCount": "lots"}`)
+	defer invalid.Close()
+	_, _, err = fetchHealthData(context.Background(), newHTTPClient(config), invalid.URL, config)
+	if err == nil {
+		t.Fatalf("Expected an error for a non-numeric count")
+	}
+	if class := classifyError(err); class != ErrorClassInvalidCount {
+		t.Errorf("Expected error class %s, got %s", ErrorClassInvalidCount, class)
+	}
+}
+
+// Test decoding uptimes sent as nanoseconds or as duration strings
+func TestFetchHealthDataUptime(t *testing.T) {
+	tests := []struct {
+		uptime   string
+		expected int64
+	}{
+		{`4637719417`, 4637719417},
+		{`"4637719417"`, 4637719417},
+		{`"53d 12h"`, int64(53*24*time.Hour + 12*time.Hour)},
+		{`"1h30m"`, int64(90 * time.Minute)},
+	}
+	config := NewDefaultConfig()
+	for _, tt := range tests {
+		server := setupMockServerWithBody(`{"application": "Memcache2", "version": "1.0.1", "uptime": ` + tt.uptime + `}`)
+		data, _, err := fetchHealthData(context.Background(), newHTTPClient(config), server.URL, config)
+		server.Close()
+		if err != nil {
+			t.Errorf("Expected uptime %s to decode, got %v", tt.uptime, err)
+			continue
+		}
+		if data.Uptime != tt.expected {
+			t.Errorf("Expected uptime %s to be %d ns, got %d", tt.uptime, tt.expected, data.Uptime)
+		}
+	}
+
+	invalid := setupMockServerWithBody(`{"application": "Memcache2", "uptime": "forever"}`)
+	defer invalid.Close()
+	_, _, err := fetchHealthData(context.Background(), newHTTPClient(config), invalid.URL, config)
+	if class := classifyError(err); class != ErrorClassInvalidUptime {
+		t.Errorf("Expected error class %s, got %s (%v)", ErrorClassInvalidUptime, class, err)
+	}
+}
+
+// Test that CONNECT_TIMEOUT distinguishes unreachable hosts from slow ones
+func TestConnectTimeout(t *testing.T) {
+	// A slow but alive server answers well after the connect timeout
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte(mockResponse))
+	}))
+	defer slow.Close()
+
+	config := NewDefaultConfig()
+	config.ConnectTimeout = 50 * time.Millisecond
+	config.HTTPTimeout = 2 * time.Second
+	client := newHTTPClient(config)
+
+	if _, _, err := fetchHealthData(context.Background(), client, slow.URL, config); err != nil {
+		t.Errorf("Expected a slow server to succeed within the HTTP timeout, got %v", err)
+	}
+
+	// A listener whose accept queue is full drops further SYNs, so the
+	// connection hangs until CONNECT_TIMEOUT gives up on it
+	start := time.Now()
+	_, _, err := fetchHealthData(context.Background(), client, "http://"+fullBacklogAddr(t)+"/healthz", config)
+	elapsed := time.Since(start)
+	if class := classifyError(err); class != ErrorClassConnect {
+		t.Errorf("Expected error class %s for an unreachable host, got %s (%v)", ErrorClassConnect, class, err)
+	}
+	if err == nil || !strings.Contains(err.Error(), "i/o timeout") {
+		t.Errorf("Expected a connect timeout, got %v", err)
+	}
+	if elapsed < config.ConnectTimeout || elapsed > time.Second {
+		t.Errorf("Expected the connection to give up after the connect timeout, well within the HTTP timeout, took %v", elapsed)
+	}
+
+	// A server slower than the overall timeout is classified as a timeout
+	config.HTTPTimeout = 50 * time.Millisecond
+	_, _, err = fetchHealthData(context.Background(), newHTTPClient(config), slow.URL, config)
+	if class := classifyError(err); class != ErrorClassTimeout {
+		t.Errorf("Expected error class %s for a slow server, got %s (%v)", ErrorClassTimeout, class, err)
+	}
+}
+
+// fullBacklogAddr returns the address of a listener that never accepts and
+// whose accept queue is already full, so connecting to it hangs
+func fullBacklogAddr(t *testing.T) string {
+	t.Helper()
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatalf("Failed to create socket: %v", err)
+	}
+	t.Cleanup(func() { syscall.Close(fd) })
+	if err := syscall.Bind(fd, &syscall.SockaddrInet4{Addr: [4]byte{127, 0, 0, 1}}); err != nil {
+		t.Fatalf("Failed to bind socket: %v", err)
+	}
+	if err := syscall.Listen(fd, 0); err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	sa, err := syscall.Getsockname(fd)
+	if err != nil {
+		t.Fatalf("Failed to get socket address: %v", err)
+	}
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(sa.(*syscall.SockaddrInet4).Port))
+	// Fill the queue until a connection attempt hangs
+	for i := 0; i < 16; i++ {
+		conn, err := net.DialTimeout("tcp", addr, 100*time.Millisecond)
+		if err != nil {
+			return addr
+		}
+		t.Cleanup(func() { conn.Close() })
+	}
+	t.Fatalf("Failed to fill the accept queue of %s", addr)
+	return ""
+}
+
+// Test the per-version breakdown of self-reported statuses
+func TestAggregateStatusCounts(t *testing.T) {
+	var data []AggregatedData
+	for _, status := range []string{"ok", "ok", "degraded", "down", ""} {
+		data = append(data, toAggregatedData(HealthResponse{
+			Application:  "Memcache2",
+			Version:      "1.0.1",
+			RequestCount: 100,
+			SuccessCount: 100,
+			Status:       status,
+		}))
+	}
+
+	agg := aggregateData(data)["Memcache2"]["1.0.1"]
+	expected := map[string]int{"ok": 2, "degraded": 1, "down": 1}
+	if len(agg.StatusCounts) != len(expected) {
+		t.Errorf("Expected status counts %v, got %v", expected, agg.StatusCounts)
+	}
+	for status, count := range expected {
+		if agg.StatusCounts[status] != count {
+			t.Errorf("Expected %d instances %s, got %d", count, status, agg.StatusCounts[status])
+		}
+	}
+
+	// A degraded instance still answered successfully over HTTP
+	if agg.TotalRequests != 500 || successRate(agg) != 100 {
+		t.Errorf("Expected status not to affect counts, got %d requests at %.2f%%", agg.TotalRequests, successRate(agg))
+	}
+	if got := formatStatusCounts(agg.StatusCounts); got != ", Statuses: degraded=1, down=1, ok=2" {
+		t.Errorf("Unexpected status summary %q", got)
+	}
+}
+
+// Test that ENVIRONMENT is stamped into the report meta and metrics
+func TestReportEnvironment(t *testing.T) {
+	config := NewDefaultConfig()
+	config.Environment = "staging"
+	config.ReportEnvelope = true
+	aggregation := aggregateData([]AggregatedData{{Application: "Memcache2", Version: "1.0.1", TotalRequests: 10, TotalSuccesses: 10}})
+
+	report := buildReport(aggregation, nil, config)
+	data, err := encodeReport(report, config)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !strings.Contains(string(data), `"meta": {
+    "environment": "staging"
+  }`) {
+		t.Errorf("Expected the environment in the report meta, got:\n%s", data)
+	}
+
+	registry := newMetricsRegistry(config)
+	registry.Update(aggregation, []ServerResult{{Server: "server-0001"}})
+	var buf bytes.Buffer
+	registry.Render(&buf)
+	if !strings.Contains(buf.String(), `healthcheck_success_rate{application="Memcache2",version="1.0.1",environment="staging"} 100`) ||
+		!strings.Contains(buf.String(), `healthcheck_up{server="server-0001",environment="staging"} 0`) {
+		t.Errorf("Expected the environment label on all metrics, got:\n%s", buf.String())
+	}
+}
+
+// Test that a server dribbling its body is cut off by BODY_TIMEOUT
+func TestBodyTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(mockResponse[:20]))
+		w.(http.Flusher).Flush()
+		select {
+		case <-time.After(2 * time.Second):
+		case <-r.Context().Done():
+			return
+		}
+		w.Write([]byte(mockResponse[20:]))
+	}))
+	defer server.Close()
+
+	config := NewDefaultConfig()
+	config.HTTPTimeout = 5 * time.Second
+	config.BodyTimeout = 100 * time.Millisecond
+
+	start := time.Now()
+	_, _, err := fetchHealthData(context.Background(), newHTTPClient(config), server.URL, config)
+	if class := classifyError(err); class != ErrorClassBodyTimeout {
+		t.Errorf("Expected error class %s, got %s (%v)", ErrorClassBodyTimeout, class, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the body to be cut off after ~100ms, took %v", elapsed)
+	}
+}
+
+// Test that application granularity collapses versions into one record
+func TestReportApplicationGranularity(t *testing.T) {
+	config := NewDefaultConfig()
+	config.OutputGranularity = GranularityApplication
+	aggregation := aggregateData([]AggregatedData{
+		{Application: "Web", Version: "1.0", TotalRequests: 900, TotalSuccesses: 900, StatusCounts: map[string]int{"ok": 2}},
+		{Application: "Web", Version: "1.1", TotalRequests: 100, TotalSuccesses: 0, StatusCounts: map[string]int{"down": 1}},
+		{Application: "Cache", Version: "2.0", TotalRequests: 10, TotalSuccesses: 10},
+	})
+	annotateSeverity(aggregation, config)
+
+	report := buildReport(aggregation, nil, config)
+	if report.Meta.Granularity != GranularityApplication {
+		t.Errorf("Expected the granularity in the report meta, got %q", report.Meta.Granularity)
+	}
+	if len(report.Applications["Web"]) != 1 {
+		t.Fatalf("Expected a single Web record, got %v", report.Applications["Web"])
+	}
+	web := report.Applications["Web"][versionAll]
+	if web.TotalRequests != 1000 || web.TotalSuccesses != 900 || web.Version != versionAll {
+		t.Errorf("Expected summed counts for Web, got %+v", web)
+	}
+	// 90% weighted by volume, not the 50% average of the version rates
+	if successRate(web) != 90 || web.Severity != SeverityWarning {
+		t.Errorf("Expected a weighted 90%% warning, got %.2f%% %s", successRate(web), web.Severity)
+	}
+	if web.StatusCounts["ok"] != 2 || web.StatusCounts["down"] != 1 {
+		t.Errorf("Expected summed status counts, got %v", web.StatusCounts)
+	}
+
+	// The aggregation itself keeps its versions
+	if len(aggregation["Web"]) != 2 {
+		t.Errorf("Expected the aggregation untouched, got %v", aggregation["Web"])
+	}
+}
+
+// Test that HEAD health checks send HEAD requests and record liveness only
+func TestHealthMethodHead(t *testing.T) {
+	var methods []string
+	var mu sync.Mutex
+	handler := func(status int) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			methods = append(methods, r.Method)
+			mu.Unlock()
+			w.WriteHeader(status)
+		}
+	}
+	up := httptest.NewServer(handler(http.StatusOK))
+	defer up.Close()
+	down := httptest.NewServer(handler(http.StatusServiceUnavailable))
+	defer down.Close()
+
+	config := NewDefaultConfig()
+	config.RequestDelay = 0
+	config.HealthMethod = http.MethodHead
+	results := collectResults([]ServerEntry{
+		{Address: up.URL, Tags: map[string]string{"app": "Web"}},
+		{Address: down.URL, Tags: map[string]string{"app": "Web"}},
+	}, config)
+
+	if strings.Join(methods, ",") != "HEAD,HEAD" {
+		t.Errorf("Expected only HEAD requests, got %v", methods)
+	}
+	for _, result := range results {
+		if !result.LivenessOnly || result.Health != nil {
+			t.Errorf("Expected a liveness-only result without health data, got %+v", result)
+		}
+	}
+	if web := aggregateLiveness(results, config)["Web"]; web.Up != 1 || web.Down != 1 {
+		t.Errorf("Expected Web 1 up and 1 down, got %+v", web)
+	}
+
+	config.SLOTarget = 99.9
+	if settings := countDependentSettings(config); strings.Join(settings, ",") != "SLO_TARGET" {
+		t.Errorf("Expected SLO_TARGET to be flagged as needing counts, got %v", settings)
+	}
+}
+
+// Test that POST health checks send the configured body and content type,
+// including on retries
+func TestHealthMethodPost(t *testing.T) {
+	const expectedBody = `{"check": "deep"}`
+	var requests, valid int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempt := atomic.AddInt32(&requests, 1)
+		body, _ := io.ReadAll(r.Body)
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" || string(body) != expectedBody {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		atomic.AddInt32(&valid, 1)
+		if attempt == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(mockResponse))
+	}))
+	defer server.Close()
+
+	config := NewDefaultConfig()
+	config.HealthMethod = http.MethodPost
+	config.HealthBody = expectedBody
+	config.MaxRetries = 1
+	config.RetryBackoff = time.Millisecond
+
+	health, meta, err := fetchHealthDataWithRetry(context.Background(), newHTTPClient(config), server.URL, config, newRetryBudget(0), nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if meta.Attempts != 2 || valid != 2 {
+		t.Errorf("Expected the body on both attempts, got %d valid of %d attempts", valid, meta.Attempts)
+	}
+	if health.Application != "Memcache2" {
+		t.Errorf("Expected the POST response to be decoded, got %+v", health)
+	}
+}
+
+// Test that a boolean-only payload decides up/down and is aggregated as
+// availability per application and version instead of a success rate
+func TestHealthBooleanField(t *testing.T) {
+	handler := func(body string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(body))
+		}))
+	}
+	healthy := handler(`{"application": "Memcache2", "version": "1.0.1", "healthy": true}`)
+	defer healthy.Close()
+	unhealthy := handler(`{"application": "Memcache2", "version": "1.0.2", "healthy": false}`)
+	defer unhealthy.Close()
+	missing := handler(`{"application": "Memcache2"}`)
+	defer missing.Close()
+
+	config := NewDefaultConfig()
+	config.RequestDelay = 0
+	config.HealthBooleanField = "healthy"
+	results := collectResults([]ServerEntry{{Address: healthy.URL}, {Address: unhealthy.URL}, {Address: missing.URL}}, config)
+
+	for _, result := range results {
+		if !result.LivenessOnly || result.Health != nil {
+			t.Errorf("Expected a liveness-only result without counts, got %+v", result)
+		}
+		if result.URL == unhealthy.URL+config.HealthPath && result.ErrorClass != ErrorClassUnhealthy {
+			t.Errorf("Expected healthy: false to be classed %s, got %s", ErrorClassUnhealthy, result.ErrorClass)
+		}
+	}
+
+	memcache := aggregateLiveness(results, config)["Memcache2"]
+	if memcache.Up != 1 || memcache.Down != 2 {
+		t.Errorf("Expected Memcache2 1 up and 2 down, got %+v", memcache)
+	}
+	if v := memcache.Versions["1.0.1"]; v.Up != 1 || v.Down != 0 || v.Availability != 100 {
+		t.Errorf("Expected 1.0.1 fully available, got %+v", v)
+	}
+	if v := memcache.Versions["1.0.2"]; v.Up != 0 || v.Down != 1 {
+		t.Errorf("Expected 1.0.2 down, got %+v", v)
+	}
+
+	_, collected, _ := consumeResults(resultsChannel(results), 1, nil)
+	if len(collected) != 0 {
+		t.Errorf("Expected no count-based data, got %+v", collected)
+	}
+}
+
+// resultsChannel returns a closed channel holding results
+func resultsChannel(results []ServerResult) chan ServerResult {
+	ch := make(chan ServerResult, len(results))
+	for _, result := range results {
+		ch <- result
+	}
+	close(ch)
+	return ch
+}
+
+// Test each REDIRECT_POLICY against a server redirecting to its health data
+func TestRedirectPolicy(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/cached", http.StatusFound)
+	})
+	mux.HandleFunc("/cached", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(mockResponse))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	check := func(policy string) ServerResult {
+		config := NewDefaultConfig()
+		config.RedirectPolicy = policy
+		resultChannel := make(chan ServerResult, 1)
+		fetchHealthDataWithDelayAndConcurrency(context.Background(), []ServerEntry{{Address: server.URL, Tags: map[string]string{"app": "Memcache2"}}}, resultChannel, config, nil)
+		return <-resultChannel
+	}
+
+	if result := check(RedirectPolicyFollow); result.Health == nil || result.Health.Application != "Memcache2" || result.StatusCode != http.StatusOK {
+		t.Errorf("Expected the redirect to be followed to the health data, got %+v", result)
+	}
+
+	result := check(RedirectPolicySuccess)
+	if result.Error != "" || result.Health != nil || !result.LivenessOnly || result.StatusCode != http.StatusFound {
+		t.Errorf("Expected the 302 to count as an up server without counts, got %+v", result)
+	}
+	if memcache := aggregateLiveness([]ServerResult{result}, NewDefaultConfig())["Memcache2"]; memcache.Up != 1 {
+		t.Errorf("Expected Memcache2 to be up, got %+v", memcache)
+	}
+
+	if result := check(RedirectPolicyFailure); result.ErrorClass != ErrorClassStatus || result.StatusCode != http.StatusFound || result.Attempts != 1 {
+		t.Errorf("Expected the 302 to fail the check, got %+v", result)
+	}
+}
+
+// Test that HEALTH_COMPONENTS_FIELD counts the instances failing each component
+func TestHealthComponentsField(t *testing.T) {
+	bodies := []string{
+		`{"application":"Memcache2","version":"1.0.1","requestCount":100,"successCount":100,"components":{"db":{"ok":true},"cache":{"ok":false}}}`,
+		`{"application":"Memcache2","version":"1.0.1","requestCount":100,"successCount":100,"components":{"db":{"ok":false},"cache":false,"queue":true}}`,
+		`{"application":"Memcache2","version":"1.0.1","requestCount":100,"successCount":100,"components":{"db":{"ok":true}}}`,
+		`{"application":"Memcache2","version":"1.0.1","requestCount":100,"successCount":100}`,
+	}
+	config := NewDefaultConfig()
+	config.HealthComponentsField = "components"
+
+	var data []AggregatedData
+	for _, body := range bodies {
+		body := body
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(body))
+		}))
+		health, _, err := fetchHealthData(context.Background(), newHTTPClient(config), server.URL, config)
+		server.Close()
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		data = append(data, toAggregatedData(health))
+	}
+
+	agg := aggregateData(data)["Memcache2"]["1.0.1"]
+	expected := map[string]int{"cache": 2, "db": 1}
+	if !reflect.DeepEqual(agg.UnhealthyComponents, expected) {
+		t.Errorf("Expected unhealthy components %v, got %v", expected, agg.UnhealthyComponents)
+	}
+	if got := formatUnhealthyComponents(agg.UnhealthyComponents); got != ", Unhealthy Components: cache=2, db=1" {
+		t.Errorf("Unexpected component summary %q", got)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"application":"Memcache2","version":"1.0.1","requestCount":1,"successCount":1,"components":"ok"}`))
+	}))
+	defer server.Close()
+	_, _, err := fetchHealthData(context.Background(), newHTTPClient(config), server.URL, config)
+	if fetchErr, ok := err.(*FetchError); !ok || fetchErr.Class != ErrorClassInvalidResponse {
+		t.Errorf("Expected a non-object components field to be an invalid response, got %v", err)
+	}
+}
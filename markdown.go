@@ -0,0 +1,34 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// markdownEscaper keeps server-reported values inside their table cell: pipes
+// would end the cell and line breaks the row
+var markdownEscaper = strings.NewReplacer("|", `\|`, "\r\n", " ", "\n", " ", "\r", " ")
+
+// renderMarkdownReport renders the report as a Markdown table with one row per
+// application and version, sorted by application and version, followed by a
+// summary line, for pasting into wikis and pull requests
+func renderMarkdownReport(report Report) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("| Application | Version | Success Rate | Total Requests | Total Successes | Severity |\n")
+	buf.WriteString("| --- | --- | ---: | ---: | ---: | --- |\n")
+	records := sortedRecords(report.Applications)
+	for _, data := range records {
+		fmt.Fprintf(&buf, "| %s | %s | %.2f%% | %d | %d | %s |\n",
+			markdownEscaper.Replace(data.Application), markdownEscaper.Replace(data.Version),
+			successRate(data), data.TotalRequests, data.TotalSuccesses, data.Severity)
+	}
+
+	rate, requests := globalSuccessRate(report.Applications)
+	summary := fmt.Sprintf("\n**%d application versions**, %d requests, %.2f%% overall success rate", len(records), requests, rate)
+	if report.Status != "" {
+		summary += fmt.Sprintf(", status **%s**", report.Status)
+	}
+	buf.WriteString(summary + "\n")
+	return buf.Bytes()
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// Test the Markdown report has its header, one sorted row per record with
+// pipes escaped, and a summary line
+func TestRenderMarkdownReport(t *testing.T) {
+	config := NewDefaultConfig()
+	config.OutputFormat = OutputFormatMarkdown
+	aggregation := aggregateData([]AggregatedData{
+		{Application: "Memcache2", Version: "1.0.1", TotalRequests: 100, TotalSuccesses: 80},
+		{Application: "Cassandra", Version: "2.0.0", TotalRequests: 100, TotalSuccesses: 100},
+		{Application: "a|b", Version: "1.0\n", TotalRequests: 50, TotalSuccesses: 50},
+	})
+	annotateSeverity(aggregation, config)
+
+	output, err := encodeReport(buildReport(aggregation, nil, config), config)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	lines := strings.Split(strings.TrimRight(string(output), "\n"), "\n")
+
+	if lines[0] != "| Application | Version | Success Rate | Total Requests | Total Successes | Severity |" {
+		t.Errorf("Unexpected header %q", lines[0])
+	}
+	if lines[1] != "| --- | --- | ---: | ---: | ---: | --- |" {
+		t.Errorf("Unexpected delimiter row %q", lines[1])
+	}
+	var rows []string
+	for _, line := range lines[2:] {
+		if strings.HasPrefix(line, "| ") {
+			rows = append(rows, line)
+		}
+	}
+	if len(rows) != 3 {
+		t.Fatalf("Expected 3 rows, got %d:\n%s", len(rows), output)
+	}
+	expected := []string{
+		`| Cassandra | 2.0.0 | 100.00% | 100 | 100 | ok |`,
+		`| Memcache2 | 1.0.1 | 80.00% | 100 | 80 | critical |`,
+		`| a\|b | 1.0  | 100.00% | 50 | 50 | ok |`,
+	}
+	for i, row := range rows {
+		if row != expected[i] {
+			t.Errorf("Row %d: expected %q, got %q", i, expected[i], row)
+		}
+	}
+	if summary := lines[len(lines)-1]; summary != "**3 application versions**, 250 requests, 92.00% overall success rate, status **critical**" {
+		t.Errorf("Unexpected summary %q", summary)
+	}
+}
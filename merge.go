@@ -0,0 +1,266 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// mergeReports combines reports into one. Counts of the same application and
+// version are summed and severities recomputed; liveness is summed per app.
+// With byRegion the records are also kept per meta.region, or per region of
+// inputs that are themselves merged by region. With dedupe the records are
+// instead rebuilt from the raw results, counting every server once. Reports
+// must share a schema version and granularity, and be bare application maps
+// or of the current schema, which the merged report is written in.
+func mergeReports(names []string, reports []Report, byRegion, dedupe bool, config *Config) (Report, error) {
+	if err := checkSchemaVersions(names, reports); err != nil {
+		return Report{}, err
+	}
+	// Sections of another schema would be dropped or relabeled on the way
+	// through, e.g. the tcp section of version 1, so they are not merged
+	for i, report := range reports {
+		if report.SchemaVersion != 0 && report.SchemaVersion != reportSchemaVersion {
+			return Report{}, fmt.Errorf("report %s has schemaVersion %d but merge writes schemaVersion %d; refusing to merge reports of another schema",
+				names[i], report.SchemaVersion, reportSchemaVersion)
+		}
+	}
+	if err := checkGranularities(names, reports); err != nil {
+		return Report{}, err
+	}
+
+	merged := Report{
+		SchemaVersion: reportSchemaVersion,
+		Applications:  make(map[string]map[string]AggregatedData),
+	}
+	for i, report := range reports {
+		if dedupe {
+			if len(report.Raw) == 0 {
+				return Report{}, fmt.Errorf("report %s has no raw section; enable INCLUDE_RAW on the shards to merge with -dedupe", names[i])
+			}
+			continue
+		}
+		for _, data := range sortedRecords(report.Applications) {
+			foldAggregatedData(merged.Applications, data)
+		}
+		if byRegion {
+			if err := foldRegions(&merged, names[i], report); err != nil {
+				return Report{}, err
+			}
+		}
+		for app, liveness := range report.Liveness {
+			if merged.Liveness == nil {
+				merged.Liveness = make(map[string]LivenessAvailability)
+			}
+			total := merged.Liveness[app]
+			total.merge(liveness)
+			merged.Liveness[app] = total
+		}
+	}
+	if dedupe {
+		merged.Raw = dedupeResults(reports)
+		for _, result := range merged.Raw {
+			if result.Health != nil && !result.Dropped {
+				foldAggregatedData(merged.Applications, toAggregatedData(*result.Health))
+			}
+		}
+		if len(reports) > 0 && reports[0].Meta.Granularity == GranularityApplication {
+			merged.Applications = collapseVersions(merged.Applications, config)
+		}
+		merged.Liveness = aggregateLiveness(merged.Raw, config)
+	}
+	if len(reports) > 0 {
+		merged.Meta = reports[0].Meta
+		for _, report := range reports[1:] {
+			if report.Meta.Environment != merged.Meta.Environment {
+				merged.Meta.Environment = ""
+			}
+			if report.Meta.Region != merged.Meta.Region {
+				merged.Meta.Region = ""
+			}
+		}
+	}
+	annotateSeverity(merged.Applications, config)
+	if config.VolumeShares {
+		annotateVolumeShares(merged.Applications)
+	}
+	for _, applications := range merged.Regions {
+		annotateSeverity(applications, config)
+		if config.VolumeShares {
+			annotateVolumeShares(applications)
+		}
+	}
+	return merged, nil
+}
+
+// dedupeResults returns the raw results of reports with one result per
+// server URL, for shards whose server lists overlap. A successful result is
+// preferred over a failure, then the one with the most requests, as the
+// counters only grow and it is the most recent; ties keep the earliest report.
+func dedupeResults(reports []Report) []ServerResult {
+	var order []string
+	kept := make(map[string]ServerResult)
+	for _, report := range reports {
+		for _, result := range report.Raw {
+			current, ok := kept[result.URL]
+			if !ok {
+				order = append(order, result.URL)
+			}
+			if !ok || supersedes(result, current) {
+				kept[result.URL] = result
+			}
+		}
+	}
+	results := make([]ServerResult, 0, len(order))
+	for _, url := range order {
+		results = append(results, kept[url])
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Server < results[j].Server })
+	return results
+}
+
+// supersedes reports whether result should replace current, another result of
+// the same server
+func supersedes(result, current ServerResult) bool {
+	ok, currentOK := result.Error == "", current.Error == ""
+	if ok != currentOK {
+		return ok
+	}
+	if result.Health == nil || current.Health == nil {
+		return false
+	}
+	return result.Health.RequestCount > current.Health.RequestCount
+}
+
+// foldRegions adds the records of report to the region breakdown of merged
+func foldRegions(merged *Report, name string, report Report) error {
+	regions := report.Regions
+	if len(regions) == 0 {
+		if report.Meta.Region == "" {
+			return fmt.Errorf("report %s has no meta.region; refusing to merge by region", name)
+		}
+		regions = map[string]map[string]map[string]AggregatedData{report.Meta.Region: report.Applications}
+	}
+	if merged.Regions == nil {
+		merged.Regions = make(map[string]map[string]map[string]AggregatedData)
+	}
+	for region, applications := range regions {
+		if merged.Regions[region] == nil {
+			merged.Regions[region] = make(map[string]map[string]AggregatedData)
+		}
+		for _, data := range sortedRecords(applications) {
+			foldAggregatedData(merged.Regions[region], data)
+		}
+	}
+	return nil
+}
+
+// mergeOptions are the parsed arguments of the merge command
+type mergeOptions struct {
+	Output   string
+	ByRegion bool
+	Dedupe   bool
+	// Parallel bounds the reports decoded at once
+	Parallel int
+	Inputs   []string
+}
+
+// parseMergeFlags parses the merge command's arguments
+func parseMergeFlags(args []string) (mergeOptions, error) {
+	var opts mergeOptions
+	flags := flag.NewFlagSet("merge", flag.ContinueOnError)
+	flags.StringVar(&opts.Output, "output", "-", "file to write the merged report to, - for stdout")
+	flags.BoolVar(&opts.ByRegion, "by-region", false, "also break the merged records down by each report's meta.region")
+	flags.BoolVar(&opts.Dedupe, "dedupe", false, "count every server once across overlapping shards, using their raw results")
+	flags.IntVar(&opts.Parallel, "parallel", runtime.NumCPU(), "reports to decode at once")
+	if err := flags.Parse(args); err != nil {
+		return opts, err
+	}
+	if opts.Parallel < 1 {
+		return opts, fmt.Errorf("-parallel must be at least 1, got %d", opts.Parallel)
+	}
+	if opts.Dedupe && opts.ByRegion {
+		return opts, fmt.Errorf("-dedupe and -by-region cannot be combined")
+	}
+	opts.Inputs = flags.Args()
+	if len(opts.Inputs) < 2 {
+		return opts, fmt.Errorf("merge needs at least two reports, got %d", len(opts.Inputs))
+	}
+	return opts, nil
+}
+
+// loadReports decodes the reports at paths with up to parallel workers. The
+// reports keep the order of paths whatever order they are decoded in, so the
+// merge is the same as a serial one; on failure the error of the first
+// failing path is returned.
+func loadReports(paths []string, parallel int, load func(string) (Report, error)) ([]Report, error) {
+	reports := make([]Report, len(paths))
+	errs := make([]error, len(paths))
+	if parallel > len(paths) {
+		parallel = len(paths)
+	}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < parallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				reports[i], errs[i] = load(paths[i])
+			}
+		}()
+	}
+	for i := range paths {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return reports, nil
+}
+
+// runMerge implements the merge command, which combines reports written by
+// separate scans, e.g. one per region, into a single JSON report
+func runMerge(args []string, config *Config, out io.Writer) error {
+	opts, err := parseMergeFlags(args)
+	if err != nil {
+		return err
+	}
+
+	reports, err := loadReports(opts.Inputs, opts.Parallel, loadReport)
+	if err != nil {
+		return err
+	}
+	merged, err := mergeReports(opts.Inputs, reports, opts.ByRegion, opts.Dedupe, config)
+	if err != nil {
+		return err
+	}
+
+	jsonConfig := *config
+	jsonConfig.OutputFormat = OutputFormatJSON
+	if reports[0].SchemaVersion > 0 || opts.ByRegion || opts.Dedupe {
+		// Keep the envelope of the inputs, and the sections only it holds
+		jsonConfig.ReportEnvelope = true
+	}
+	data, err := encodeReport(merged, &jsonConfig)
+	if err != nil {
+		return err
+	}
+	if opts.Output == "-" {
+		_, err = fmt.Fprintln(out, string(data))
+		return err
+	}
+	if err := writeFileAtomic(opts.Output, data); err != nil {
+		return fmt.Errorf("failed to write merged report: %v", err)
+	}
+	fmt.Fprintf(out, "Merged %d reports into %s\n", len(reports), opts.Output)
+	return nil
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// writeTestReport writes report as JSON into dir and returns its path
+func writeTestReport(t *testing.T, dir, name string, report Report) string {
+	t.Helper()
+	data, err := json.Marshal(report)
+	if err != nil {
+		t.Fatalf("Failed to encode report: %v", err)
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("Failed to write report: %v", err)
+	}
+	return path
+}
+
+// Test that merged reports sum counts and recompute severities
+func TestRunMerge(t *testing.T) {
+	dir := t.TempDir()
+	eu := writeTestReport(t, dir, "eu.json", Report{SchemaVersion: reportSchemaVersion, Applications: map[string]map[string]AggregatedData{
+		"Memcache2": {"1.0.1": {Application: "Memcache2", Version: "1.0.1", TotalRequests: 100, TotalSuccesses: 100}},
+	}, Liveness: map[string]LivenessAvailability{"redis": {Up: 1, Availability: 100}}})
+	us := writeTestReport(t, dir, "us.json", Report{SchemaVersion: reportSchemaVersion, Applications: map[string]map[string]AggregatedData{
+		"Memcache2": {"1.0.1": {Application: "Memcache2", Version: "1.0.1", TotalRequests: 100, TotalSuccesses: 80}},
+		"Cassandra": {"2.0.0": {Application: "Cassandra", Version: "2.0.0", TotalRequests: 10, TotalSuccesses: 10}},
+	}, Liveness: map[string]LivenessAvailability{"redis": {Down: 1}}})
+	output := filepath.Join(dir, "merged.json")
+
+	var buf bytes.Buffer
+	if err := runMerge([]string{"-output", output, eu, us}, NewDefaultConfig(), &buf); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	merged, err := loadReport(output)
+	if err != nil {
+		t.Fatalf("Failed to load merged report: %v", err)
+	}
+
+	memcache := merged.Applications["Memcache2"]["1.0.1"]
+	if memcache.TotalRequests != 200 || memcache.TotalSuccesses != 180 || memcache.Severity != SeverityWarning {
+		t.Errorf("Expected 180/200 as a warning, got %+v", memcache)
+	}
+	if _, ok := merged.Applications["Cassandra"]["2.0.0"]; !ok {
+		t.Error("Expected Cassandra in the merged report")
+	}
+	if redis := merged.Liveness["redis"]; redis.Up != 1 || redis.Down != 1 || redis.Availability != 50 {
+		t.Errorf("Expected redis at 50%% availability, got %+v", redis)
+	}
+
+	old := writeTestReport(t, dir, "old.json", Report{})
+	if err := runMerge([]string{old, us}, NewDefaultConfig(), &buf); err == nil {
+		t.Error("Expected reports with different schema versions to be refused")
+	}
+
+	// Reports of an older schema are refused even when they agree, as the
+	// merged report would stamp them with the current one
+	v1 := writeTestReport(t, dir, "v1.json", Report{SchemaVersion: 1, Applications: map[string]map[string]AggregatedData{
+		"Memcache2": {"1.0.1": {Application: "Memcache2", Version: "1.0.1", TotalRequests: 100, TotalSuccesses: 100}},
+	}})
+	for _, inputs := range [][]string{{v1, v1}, {v1, v1, v1}} {
+		err := runMerge(append([]string{"-output", output}, inputs...), NewDefaultConfig(), &buf)
+		if err == nil || !strings.Contains(err.Error(), "schemaVersion 1") {
+			t.Errorf("Expected the version 1 inputs %v to be refused, got %v", inputs, err)
+		}
+	}
+}
+
+// Test that merging by region keeps a per-region breakdown next to the
+// combined, request-weighted numbers
+func TestMergeByRegion(t *testing.T) {
+	dir := t.TempDir()
+	eu := writeTestReport(t, dir, "eu.json", Report{SchemaVersion: reportSchemaVersion, Meta: ReportMeta{Region: "eu-west-1"}, Applications: map[string]map[string]AggregatedData{
+		"Memcache2": {"1.0.1": {Application: "Memcache2", Version: "1.0.1", TotalRequests: 900, TotalSuccesses: 900}},
+	}})
+	us := writeTestReport(t, dir, "us.json", Report{SchemaVersion: reportSchemaVersion, Meta: ReportMeta{Region: "us-east-1"}, Applications: map[string]map[string]AggregatedData{
+		"Memcache2": {"1.0.1": {Application: "Memcache2", Version: "1.0.1", TotalRequests: 100, TotalSuccesses: 50}},
+	}})
+	output := filepath.Join(dir, "merged.json")
+
+	var buf bytes.Buffer
+	if err := runMerge([]string{"-by-region", "-output", output, eu, us}, NewDefaultConfig(), &buf); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	merged, err := loadReport(output)
+	if err != nil {
+		t.Fatalf("Failed to load merged report: %v", err)
+	}
+
+	if combined := merged.Applications["Memcache2"]["1.0.1"]; combined.TotalRequests != 1000 || combined.TotalSuccesses != 950 || combined.Severity != SeverityWarning {
+		t.Errorf("Expected 950/1000 combined as a warning, got %+v", combined)
+	}
+	if euData := merged.Regions["eu-west-1"]["Memcache2"]["1.0.1"]; euData.TotalRequests != 900 || euData.Severity != SeverityOK {
+		t.Errorf("Expected 900/900 in eu-west-1, got %+v", euData)
+	}
+	if usData := merged.Regions["us-east-1"]["Memcache2"]["1.0.1"]; usData.TotalRequests != 100 || usData.TotalSuccesses != 50 || usData.Severity != SeverityCritical {
+		t.Errorf("Expected 50/100 in us-east-1 as critical, got %+v", usData)
+	}
+	if merged.Meta.Region != "" {
+		t.Errorf("Expected the merged region to be cleared, got %q", merged.Meta.Region)
+	}
+
+	// A merged report can itself be merged again, keeping its regions
+	ap := writeTestReport(t, dir, "ap.json", Report{SchemaVersion: reportSchemaVersion, Meta: ReportMeta{Region: "ap-south-1"}, Applications: map[string]map[string]AggregatedData{
+		"Memcache2": {"1.0.1": {Application: "Memcache2", Version: "1.0.1", TotalRequests: 10, TotalSuccesses: 10}},
+	}})
+	if err := runMerge([]string{"-by-region", "-output", output, output, ap}, NewDefaultConfig(), &buf); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if merged, err = loadReport(output); err != nil {
+		t.Fatalf("Failed to load merged report: %v", err)
+	}
+	if len(merged.Regions) != 3 || merged.Regions["us-east-1"]["Memcache2"]["1.0.1"].TotalRequests != 100 {
+		t.Errorf("Expected three regions after merging again, got %+v", merged.Regions)
+	}
+
+	untagged := writeTestReport(t, dir, "untagged.json", Report{SchemaVersion: reportSchemaVersion})
+	if err := runMerge([]string{"-by-region", eu, untagged}, NewDefaultConfig(), &buf); err == nil {
+		t.Error("Expected a report without a region to be refused")
+	}
+}
+
+// Test that merging overlapping shards with -dedupe counts a server reported
+// by both shards once, keeping its most recent counts
+func TestMergeDedupe(t *testing.T) {
+	result := func(server string, requests, successes int64) ServerResult {
+		return ServerResult{Server: server, URL: "http://" + server + "/status", Health: &HealthResponse{
+			Application: "Memcache2", Version: "1.0.1", RequestCount: requests, SuccessCount: successes,
+		}}
+	}
+	shardReport := func(raw ...ServerResult) Report {
+		report := Report{SchemaVersion: reportSchemaVersion, Applications: make(map[string]map[string]AggregatedData), Raw: raw}
+		for _, r := range raw {
+			foldAggregatedData(report.Applications, toAggregatedData(*r.Health))
+		}
+		return report
+	}
+	dir := t.TempDir()
+	first := writeTestReport(t, dir, "first.json", shardReport(result("a", 100, 100), result("b", 100, 90)))
+	second := writeTestReport(t, dir, "second.json", shardReport(result("b", 110, 99), result("c", 50, 50)))
+	down := ServerResult{Server: "d", URL: "http://d/status", Error: "connection refused"}
+	third := writeTestReport(t, dir, "third.json", Report{SchemaVersion: reportSchemaVersion, Raw: []ServerResult{down, result("c", 40, 40)}})
+	output := filepath.Join(dir, "merged.json")
+
+	var buf bytes.Buffer
+	if err := runMerge([]string{"-dedupe", "-output", output, first, second, third}, NewDefaultConfig(), &buf); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	merged, err := loadReport(output)
+	if err != nil {
+		t.Fatalf("Failed to load merged report: %v", err)
+	}
+	if data := merged.Applications["Memcache2"]["1.0.1"]; data.TotalRequests != 260 || data.TotalSuccesses != 249 {
+		t.Errorf("Expected 249/260 with b and c counted once, got %+v", data)
+	}
+	if len(merged.Raw) != 4 {
+		t.Errorf("Expected one raw result per server, got %+v", merged.Raw)
+	}
+
+	// Without -dedupe the overlap is counted twice
+	if err := runMerge([]string{"-output", output, first, second}, NewDefaultConfig(), &buf); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if merged, err = loadReport(output); err != nil {
+		t.Fatalf("Failed to load merged report: %v", err)
+	}
+	if data := merged.Applications["Memcache2"]["1.0.1"]; data.TotalRequests != 360 {
+		t.Errorf("Expected 360 requests summed without -dedupe, got %+v", data)
+	}
+
+	noRaw := writeTestReport(t, dir, "noraw.json", Report{SchemaVersion: reportSchemaVersion})
+	if err := runMerge([]string{"-dedupe", first, noRaw}, NewDefaultConfig(), &buf); err == nil {
+		t.Error("Expected a report without raw results to be refused")
+	}
+	if err := runMerge([]string{"-dedupe", "-by-region", first, second}, NewDefaultConfig(), &buf); err == nil {
+		t.Error("Expected -dedupe with -by-region to be refused")
+	}
+}
+
+// Test that merging many reports in parallel sums them correctly and writes
+// the same output as a serial merge
+func TestMergeParallel(t *testing.T) {
+	dir := t.TempDir()
+	var inputs []string
+	for i := 0; i < 200; i++ {
+		version := fmt.Sprintf("1.0.%d", i%3)
+		inputs = append(inputs, writeTestReport(t, dir, fmt.Sprintf("shard-%03d.json", i), Report{SchemaVersion: reportSchemaVersion, Applications: map[string]map[string]AggregatedData{
+			"Memcache2": {version: {Application: "Memcache2", Version: version, TotalRequests: int64(100 + i), TotalSuccesses: int64(90 + i)}},
+		}, Liveness: map[string]LivenessAvailability{"redis": {Up: 1}}}))
+	}
+
+	merge := func(parallel string) []byte {
+		output := filepath.Join(dir, "merged-"+parallel+".json")
+		var buf bytes.Buffer
+		if err := runMerge(append([]string{"-parallel", parallel, "-output", output}, inputs...), NewDefaultConfig(), &buf); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		data, err := os.ReadFile(output)
+		if err != nil {
+			t.Fatalf("Failed to read merged report: %v", err)
+		}
+		return data
+	}
+	parallel := merge("8")
+	if serial := merge("1"); !bytes.Equal(parallel, serial) {
+		t.Errorf("Expected the parallel merge to match the serial one")
+	}
+
+	var merged Report
+	if err := json.Unmarshal(parallel, &merged); err != nil {
+		t.Fatalf("Failed to decode merged report: %v", err)
+	}
+	var requests, successes int64
+	for _, data := range merged.Applications["Memcache2"] {
+		requests += data.TotalRequests
+		successes += data.TotalSuccesses
+	}
+	// 200 shards of 100+i requests and 90+i successes
+	if requests != 200*100+199*200/2 || successes != 200*90+199*200/2 {
+		t.Errorf("Expected every shard summed once, got %d/%d", successes, requests)
+	}
+	if merged.Liveness["redis"].Up != 200 {
+		t.Errorf("Expected 200 live redis checks, got %+v", merged.Liveness["redis"])
+	}
+}
+
+// Test that reports are decoded by at most the given number of workers and
+// kept in input order
+func TestLoadReportsBounded(t *testing.T) {
+	var inFlight, peak int32
+	// Loads wait until two are in flight at once, so the workers are seen to
+	// overlap however they are scheduled; a loader that never overlaps gives
+	// up after a while and is caught by the lower bound
+	var overlapOnce sync.Once
+	overlapped := make(chan struct{})
+	load := func(path string) (Report, error) {
+		n := atomic.AddInt32(&inFlight, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		if n >= 2 {
+			overlapOnce.Do(func() { close(overlapped) })
+		}
+		select {
+		case <-overlapped:
+		case <-time.After(5 * time.Second):
+		}
+		atomic.AddInt32(&inFlight, -1)
+		return Report{Meta: ReportMeta{Region: path}}, nil
+	}
+
+	var paths []string
+	for i := 0; i < 50; i++ {
+		paths = append(paths, fmt.Sprintf("shard-%d", i))
+	}
+	reports, err := loadReports(paths, 3, load)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if peak > 3 || peak < 2 {
+		t.Errorf("Expected up to 3 reports decoded at once, got %d", peak)
+	}
+	for i, report := range reports {
+		if report.Meta.Region != paths[i] {
+			t.Fatalf("Expected report %d to be %s, got %s", i, paths[i], report.Meta.Region)
+		}
+	}
+
+	failing := func(path string) (Report, error) {
+		if path == "shard-7" || path == "shard-30" {
+			return Report{}, fmt.Errorf("cannot read %s", path)
+		}
+		return Report{}, nil
+	}
+	if _, err := loadReports(paths, 3, failing); err == nil || err.Error() != "cannot read shard-7" {
+		t.Errorf("Expected the first failing report's error, got %v", err)
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/pprof"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// metricsRegistry holds the results of the latest scan cycle and renders them
+// in the Prometheus text exposition format
+type metricsRegistry struct {
+	mu          sync.RWMutex
+	environment string
+	// tagLabels pairs every allowed server tag with its unique label name
+	tagLabels   [][2]string
+	aggregation map[string]map[string]AggregatedData
+	results     []ServerResult
+}
+
+// newMetricsRegistry creates a registry exposing only the allowed server tags
+// as labels, guarding against high-cardinality label explosion
+func newMetricsRegistry(config *Config) *metricsRegistry {
+	return &metricsRegistry{environment: config.Environment, tagLabels: tagLabelNames(config.MetricsLabels, config.Console)}
+}
+
+// tagLabelNames pairs each server tag with the label name it is exposed as.
+// Tags whose sanitized names collide, e.g. dc-1 and dc.1, or take the server
+// or environment label, get a numeric suffix so no label is silently merged
+// into another; the renaming is logged.
+func tagLabelNames(tags []string, out io.Writer) [][2]string {
+	taken := map[string]bool{"server": true, "environment": true}
+	seen := make(map[string]bool)
+	var pairs [][2]string
+	for _, tag := range tags {
+		if tag == "server" || tag == "environment" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		label := sanitizeLabelName(tag)
+		if taken[label] {
+			base := label
+			for n := 2; taken[label]; n++ {
+				label = fmt.Sprintf("%s_%d", base, n)
+			}
+			fmt.Fprintf(out, "Warning: metric label for tag %q collides with another label, exposing it as %s\n", tag, label)
+		}
+		taken[label] = true
+		pairs = append(pairs, [2]string{tag, label})
+	}
+	return pairs
+}
+
+// Update replaces the exposed data with the results of a completed cycle
+func (m *metricsRegistry) Update(aggregation map[string]map[string]AggregatedData, results []ServerResult) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.aggregation = aggregation
+	m.results = results
+}
+
+// ServeHTTP implements the /metrics endpoint
+func (m *metricsRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	m.Render(w)
+}
+
+// Render writes all metrics in the Prometheus text format
+func (m *metricsRegistry) Render(w io.Writer) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	records := sortedRecords(m.aggregation)
+	gauges := []struct {
+		name, help string
+		value      func(AggregatedData) float64
+	}{
+		{"healthcheck_success_rate", "Success rate in percent per application and version.", successRate},
+		{"healthcheck_total_requests", "Total requests reported per application and version.", func(d AggregatedData) float64 { return float64(d.TotalRequests) }},
+		{"healthcheck_total_successes", "Total successes reported per application and version.", func(d AggregatedData) float64 { return float64(d.TotalSuccesses) }},
+	}
+	for _, gauge := range gauges {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", gauge.name, gauge.help, gauge.name)
+		for _, data := range records {
+			labels := m.withEnvironment([][2]string{
+				{"application", data.Application},
+				{"version", data.Version},
+			})
+			fmt.Fprintf(w, "%s{%s} %s\n", gauge.name, formatLabels(labels), strconv.FormatFloat(gauge.value(data), 'f', -1, 64))
+		}
+	}
+
+	results := append([]ServerResult(nil), m.results...)
+	sort.Slice(results, func(i, j int) bool { return results[i].Server < results[j].Server })
+	fmt.Fprintf(w, "# HELP healthcheck_up Whether the last health check of a server succeeded.\n# TYPE healthcheck_up gauge\n")
+	for _, result := range results {
+		up := 0
+		if result.Health != nil {
+			up = 1
+		}
+		fmt.Fprintf(w, "healthcheck_up{%s} %d\n", formatLabels(m.serverLabels(result)), up)
+	}
+}
+
+// serverLabels returns the labels of a per-server metric: the server itself
+// plus any allowed tags it carries
+func (m *metricsRegistry) serverLabels(result ServerResult) [][2]string {
+	labels := m.withEnvironment([][2]string{{"server", result.Server}})
+	for _, pair := range m.tagLabels {
+		if value, ok := result.Tags[pair[0]]; ok {
+			labels = append(labels, [2]string{pair[1], value})
+		}
+	}
+	return labels
+}
+
+// withEnvironment appends the environment label when ENVIRONMENT is set
+func (m *metricsRegistry) withEnvironment(labels [][2]string) [][2]string {
+	if m.environment == "" {
+		return labels
+	}
+	return append(labels, [2]string{"environment", m.environment})
+}
+
+// sortedRecords flattens an aggregation into records sorted by application
+// and version
+func sortedRecords(aggregation map[string]map[string]AggregatedData) []AggregatedData {
+	var records []AggregatedData
+	for _, versions := range aggregation {
+		for _, data := range versions {
+			records = append(records, data)
+		}
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Application != records[j].Application {
+			return records[i].Application < records[j].Application
+		}
+		return records[i].Version < records[j].Version
+	})
+	return records
+}
+
+// formatLabels renders label pairs as name="value",... with escaped values
+func formatLabels(labels [][2]string) string {
+	escaper := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	parts := make([]string, len(labels))
+	for i, label := range labels {
+		parts[i] = fmt.Sprintf(`%s="%s"`, label[0], escaper.Replace(label[1]))
+	}
+	return strings.Join(parts, ",")
+}
+
+// sanitizeLabelName replaces characters that are invalid in a Prometheus
+// label name with underscores
+func sanitizeLabelName(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		if r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (i > 0 && r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('_')
+		}
+	}
+	return b.String()
+}
+
+// newMetricsMux routes the metrics endpoint, the /healthz and /readyz
+// endpoints of self when set and, when ENABLE_PPROF is set, the pprof
+// profiling endpoints
+func newMetricsMux(registry *metricsRegistry, self *selfCheck, config *Config) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", registry)
+	if self != nil {
+		mux.HandleFunc("/healthz", self.ServeLive)
+		mux.HandleFunc("/readyz", self.ServeReady)
+	}
+	if config.EnablePprof {
+		mux.HandleFunc("/debug/pprof/", pprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	}
+	return mux
+}
+
+// startMetricsServer serves the registry and self check on METRICS_ADDR in
+// the background
+func startMetricsServer(registry *metricsRegistry, self *selfCheck, config *Config) {
+	mux := newMetricsMux(registry, self, config)
+	go func() {
+		if err := http.ListenAndServe(config.MetricsAddr, mux); err != nil {
+			fmt.Fprintf(config.Console, "Error serving metrics on %s: %v\n", config.MetricsAddr, err)
+		}
+	}()
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Test that server tags reach the raw results and only allowed tags become labels
+func TestServerTagsPropagation(t *testing.T) {
+	server := setupMockServer()
+	defer server.Close()
+
+	entry, _, err := parseServerLine(server.URL + " dc=us-east team=cache env=prod")
+	if err != nil {
+		t.Fatalf("Failed to parse server line: %v", err)
+	}
+
+	config := NewDefaultConfig()
+	config.RequestDelay = 0
+	config.IncludeRaw = true
+	config.MetricsLabels = []string{"dc", "team"}
+
+	results := collectResults([]ServerEntry{entry}, config)
+	report := buildReport(nil, results, config)
+	if len(report.Raw) != 1 {
+		t.Fatalf("Expected 1 raw result, got %d", len(report.Raw))
+	}
+	tags := report.Raw[0].Tags
+	if tags["dc"] != "us-east" || tags["team"] != "cache" || tags["env"] != "prod" {
+		t.Errorf("Expected all tags in the raw output, got %v", tags)
+	}
+
+	registry := newMetricsRegistry(config)
+	aggregation := aggregateData([]AggregatedData{toAggregatedData(*results[0].Health)})
+	registry.Update(aggregation, results)
+
+	var buf bytes.Buffer
+	registry.Render(&buf)
+	metrics := buf.String()
+
+	expected := `healthcheck_up{server="` + server.URL + `",dc="us-east",team="cache"} 1`
+	if !strings.Contains(metrics, expected) {
+		t.Errorf("Expected %q in metrics, got:\n%s", expected, metrics)
+	}
+	if strings.Contains(metrics, "env=") {
+		t.Errorf("Expected tags outside the allowed set to be excluded, got:\n%s", metrics)
+	}
+	if !strings.Contains(metrics, `healthcheck_total_requests{application="Memcache2",version="1.0.1"} 5194800029`) {
+		t.Errorf("Expected per-version gauges, got:\n%s", metrics)
+	}
+}
+
+// Test that the pprof endpoints are only served when enabled
+func TestMetricsMuxPprof(t *testing.T) {
+	config := NewDefaultConfig()
+	registry := newMetricsRegistry(config)
+
+	get := func(mux *http.ServeMux, path string) int {
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		return recorder.Code
+	}
+
+	if code := get(newMetricsMux(registry, nil, config), "/debug/pprof/"); code != http.StatusNotFound {
+		t.Errorf("Expected pprof to be disabled by default, got status %d", code)
+	}
+
+	config.EnablePprof = true
+	mux := newMetricsMux(registry, nil, config)
+	if code := get(mux, "/debug/pprof/"); code != http.StatusOK {
+		t.Errorf("Expected the pprof index when enabled, got status %d", code)
+	}
+	if code := get(mux, "/debug/pprof/goroutine?debug=1"); code != http.StatusOK {
+		t.Errorf("Expected the goroutine profile when enabled, got status %d", code)
+	}
+	if code := get(mux, "/metrics"); code != http.StatusOK {
+		t.Errorf("Expected metrics alongside pprof, got status %d", code)
+	}
+}
+
+// Test that tags whose sanitized label names collide are exposed under
+// distinct labels instead of being merged
+func TestMetricsLabelCollisions(t *testing.T) {
+	config := NewDefaultConfig()
+	config.MetricsLabels = []string{"dc-1", "dc.1", "dc_1", "server", "dc-1"}
+	registry := newMetricsRegistry(config)
+	registry.Update(nil, []ServerResult{{Server: "server-0001", Tags: map[string]string{"dc-1": "a", "dc.1": "b", "dc_1": "c", "server": "x"}}})
+
+	var buf bytes.Buffer
+	registry.Render(&buf)
+	expected := `healthcheck_up{server="server-0001",dc_1="a",dc_1_2="b",dc_1_3="c"} 0`
+	if !strings.Contains(buf.String(), expected) {
+		t.Errorf("Expected %q in metrics, got:\n%s", expected, buf.String())
+	}
+}
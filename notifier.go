@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// notifierQueueSize bounds the number of notifications waiting to be sent
+const notifierQueueSize = 16
+
+// AlertRecord is a breaching application/version included in a notification
+type AlertRecord struct {
+	Application string  `json:"application"`
+	Version     string  `json:"version"`
+	SuccessRate float64 `json:"successRate"`
+	// EvaluatedRate is the rate compared with Threshold: SuccessRate with the
+	// failure rate scaled by SEVERITY_VOLUME_CURVE, or SuccessRate without it
+	EvaluatedRate float64 `json:"evaluatedRate"`
+	// Threshold is the success rate threshold EvaluatedRate fell below
+	Threshold float64 `json:"threshold"`
+	Severity  string  `json:"severity"`
+}
+
+// webhookPayload is the JSON body posted to the webhook. The text field makes
+// it directly usable with Slack incoming webhooks.
+type webhookPayload struct {
+	Text   string        `json:"text"`
+	Alerts []AlertRecord `json:"alerts"`
+}
+
+// webhookNotifier posts alerts to a webhook from a single background
+// goroutine. Sends are bounded by their own timeout and by the run context,
+// so a hanging endpoint can neither block a scan nor shutdown.
+type webhookNotifier struct {
+	ctx     context.Context
+	url     string
+	client  *http.Client
+	timeout time.Duration
+	queue   chan webhookPayload
+	done    chan struct{}
+	once    sync.Once
+	out     io.Writer
+}
+
+// newWebhookNotifier starts a notifier posting to WEBHOOK_URL
+func newWebhookNotifier(ctx context.Context, config *Config) *webhookNotifier {
+	n := &webhookNotifier{
+		ctx:     ctx,
+		url:     config.WebhookURL,
+		client:  &http.Client{},
+		timeout: config.WebhookTimeout,
+		queue:   make(chan webhookPayload, notifierQueueSize),
+		done:    make(chan struct{}),
+		out:     config.Console,
+	}
+	go n.run()
+	return n
+}
+
+func (n *webhookNotifier) run() {
+	defer close(n.done)
+	for payload := range n.queue {
+		if err := n.send(payload); err != nil {
+			fmt.Fprintf(n.out, "Error sending webhook notification: %v\n", err)
+		}
+	}
+}
+
+func (n *webhookNotifier) send(payload webhookPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(n.ctx, n.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Notify queues alerts for sending without blocking. Alerts are dropped with a
+// warning if the queue is full.
+func (n *webhookNotifier) Notify(alerts []AlertRecord) {
+	if len(alerts) == 0 {
+		return
+	}
+	payload := webhookPayload{
+		Text:   fmt.Sprintf("Health check: %d application versions below their success rate threshold", len(alerts)),
+		Alerts: alerts,
+	}
+	select {
+	case n.queue <- payload:
+	default:
+		fmt.Fprintln(n.out, "Warning: webhook notification queue full, dropping alerts")
+	}
+}
+
+// Close stops accepting notifications and waits up to deadline for queued
+// ones to be sent. It reports false if the deadline passed first.
+func (n *webhookNotifier) Close(deadline time.Duration) bool {
+	n.once.Do(func() { close(n.queue) })
+	select {
+	case <-n.done:
+		return true
+	case <-time.After(deadline):
+		fmt.Fprintln(n.out, "Warning: timed out flushing webhook notifications")
+		return false
+	}
+}
+
+// breachingRecords returns the critical and warning records of the
+// aggregation, sorted by application and version
+func breachingRecords(aggregation map[string]map[string]AggregatedData, config *Config) []AlertRecord {
+	var alerts []AlertRecord
+	for _, data := range sortedRecords(aggregation) {
+		if !isAlertable(data.Severity) {
+			continue
+		}
+		alerts = append(alerts, AlertRecord{
+			Application:   data.Application,
+			Version:       data.Version,
+			SuccessRate:   successRate(data),
+			EvaluatedRate: severityRate(data, config),
+			Threshold:     breachedThreshold(data.Severity, config),
+			Severity:      data.Severity,
+		})
+	}
+	return alerts
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// Test that notifications are posted and flushed on close
+func TestWebhookNotifier(t *testing.T) {
+	received := make(chan webhookPayload, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload webhookPayload
+		json.NewDecoder(r.Body).Decode(&payload)
+		received <- payload
+	}))
+	defer server.Close()
+
+	config := NewDefaultConfig()
+	config.WebhookURL = server.URL
+	notifier := newWebhookNotifier(context.Background(), config)
+
+	notifier.Notify([]AlertRecord{{Application: "Memcache2", Version: "1.0.1", SuccessRate: 80, Severity: SeverityCritical}})
+	if !notifier.Close(time.Second) {
+		t.Fatalf("Expected the notifier to flush before the deadline")
+	}
+
+	select {
+	case payload := <-received:
+		if len(payload.Alerts) != 1 || payload.Alerts[0].Application != "Memcache2" || payload.Text == "" {
+			t.Errorf("Unexpected payload %+v", payload)
+		}
+	default:
+		t.Errorf("Expected the queued notification to be sent before Close returned")
+	}
+}
+
+// Test that a hanging webhook neither blocks notifying nor shutdown
+func TestWebhookNotifierSlowServer(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	config := NewDefaultConfig()
+	config.WebhookURL = server.URL
+	config.WebhookTimeout = 50 * time.Millisecond
+	notifier := newWebhookNotifier(context.Background(), config)
+
+	start := time.Now()
+	alerts := []AlertRecord{{Application: "Memcache2", Version: "1.0.1", Severity: SeverityWarning}}
+	notifier.Notify(alerts)
+	notifier.Notify(alerts)
+	if elapsed := time.Since(start); elapsed > 20*time.Millisecond {
+		t.Errorf("Expected Notify not to block, took %v", elapsed)
+	}
+
+	// Both sends time out after 50ms each, well within the flush deadline
+	if !notifier.Close(time.Second) {
+		t.Errorf("Expected the sends to time out and the notifier to close")
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected shutdown to be bounded by the webhook timeout, took %v", elapsed)
+	}
+
+	// A canceled run context cuts sends short as well
+	ctx, cancel := context.WithCancel(context.Background())
+	config.WebhookTimeout = time.Minute
+	notifier = newWebhookNotifier(ctx, config)
+	notifier.Notify(alerts)
+	cancel()
+	if !notifier.Close(time.Second) {
+		t.Errorf("Expected a canceled run context to abort the send")
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// otelScope names the instrumentation scope of the exported telemetry
+const otelScope = "cloud-ops-interview-edeediong"
+
+// Names of the span recorded for every health check and of the fetch metrics
+const (
+	otelFetchSpan     = "healthcheck.fetch"
+	otelFetchCount    = "healthcheck.fetch.count"
+	otelFetchDuration = "healthcheck.fetch.duration"
+)
+
+// otelDurationBounds are the explicit bucket bounds, in milliseconds, of the
+// fetch duration histogram
+var otelDurationBounds = []float64{5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+// otelRecorder records a span and metric observations for every fetch with
+// the OpenTelemetry SDK. Spans are batched and metrics read periodically;
+// both are flushed after each cycle and on shutdown.
+type otelRecorder struct {
+	tracerProvider *sdktrace.TracerProvider
+	meterProvider  *sdkmetric.MeterProvider
+	tracer         trace.Tracer
+	fetches        metric.Int64Counter
+	durations      metric.Float64Histogram
+}
+
+// newOtelRecorder creates a recorder describing this tool as res, handing
+// finished spans to spans and the metrics to reader
+func newOtelRecorder(res *resource.Resource, spans sdktrace.SpanProcessor, reader sdkmetric.Reader) (*otelRecorder, error) {
+	r := &otelRecorder{
+		tracerProvider: sdktrace.NewTracerProvider(sdktrace.WithResource(res), sdktrace.WithSpanProcessor(spans)),
+		meterProvider: sdkmetric.NewMeterProvider(
+			sdkmetric.WithResource(res),
+			sdkmetric.WithReader(reader),
+			sdkmetric.WithView(sdkmetric.NewView(
+				sdkmetric.Instrument{Name: otelFetchDuration},
+				sdkmetric.Stream{Aggregation: sdkmetric.AggregationExplicitBucketHistogram{Boundaries: otelDurationBounds}},
+			)),
+		),
+	}
+	r.tracer = r.tracerProvider.Tracer(otelScope)
+	meter := r.meterProvider.Meter(otelScope)
+	var err error
+	if r.fetches, err = meter.Int64Counter(otelFetchCount, metric.WithUnit("{fetch}")); err != nil {
+		return nil, err
+	}
+	if r.durations, err = meter.Float64Histogram(otelFetchDuration, metric.WithUnit("ms")); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// newOTLPRecorder creates a recorder exporting over OTLP/HTTP to
+// OTEL_EXPORTER_OTLP_ENDPOINT/v1/traces and /v1/metrics
+func newOTLPRecorder(ctx context.Context, config *Config) (*otelRecorder, error) {
+	endpoint, err := url.Parse(config.OTLPEndpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid OTLP endpoint %s", config.OTLPEndpoint)
+	}
+	path := strings.TrimSuffix(endpoint.Path, "/")
+	traceOptions := []otlptracehttp.Option{
+		otlptracehttp.WithEndpoint(endpoint.Host),
+		otlptracehttp.WithURLPath(path + "/v1/traces"),
+		otlptracehttp.WithTimeout(config.HTTPTimeout),
+	}
+	metricOptions := []otlpmetrichttp.Option{
+		otlpmetrichttp.WithEndpoint(endpoint.Host),
+		otlpmetrichttp.WithURLPath(path + "/v1/metrics"),
+		otlpmetrichttp.WithTimeout(config.HTTPTimeout),
+	}
+	if endpoint.Scheme == "http" {
+		traceOptions = append(traceOptions, otlptracehttp.WithInsecure())
+		metricOptions = append(metricOptions, otlpmetrichttp.WithInsecure())
+	}
+	spans, err := otlptracehttp.New(ctx, traceOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP trace exporter: %v", err)
+	}
+	metrics, err := otlpmetrichttp.New(ctx, metricOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP metric exporter: %v", err)
+	}
+	return newOtelRecorder(otelResource(config), sdktrace.NewBatchSpanProcessor(spans), sdkmetric.NewPeriodicReader(metrics))
+}
+
+// otelResource returns the resource describing this tool, made of
+// OTEL_SERVICE_NAME, ENVIRONMENT and OTEL_RESOURCE_ATTRIBUTES
+func otelResource(config *Config) *resource.Resource {
+	attributes := []attribute.KeyValue{attribute.String("service.name", config.OTelServiceName)}
+	if config.Environment != "" {
+		attributes = append(attributes, attribute.String("deployment.environment", config.Environment))
+	}
+	for key, value := range config.OTelResourceAttributes {
+		attributes = append(attributes, attribute.String(key, value))
+	}
+	return resource.NewSchemaless(attributes...)
+}
+
+// RecordFetch records the fetch of result that ran from start to end
+func (r *otelRecorder) RecordFetch(result ServerResult, start, end time.Time) {
+	host := result.URL
+	if u, err := url.Parse(result.URL); err == nil && u.Host != "" {
+		host = u.Hostname()
+	}
+	outcome := "success"
+	if result.Error != "" {
+		outcome = "failure"
+	}
+
+	attributes := []attribute.KeyValue{
+		attribute.String("server.address", host),
+		attribute.String("url.full", result.URL),
+		attribute.Float64("healthcheck.latency_ms", result.LatencyMs),
+		attribute.Int("healthcheck.attempts", result.Attempts),
+	}
+	if result.StatusCode != 0 {
+		attributes = append(attributes, attribute.Int("http.response.status_code", result.StatusCode))
+	}
+	if result.ErrorClass != "" {
+		attributes = append(attributes, attribute.String("error.type", result.ErrorClass))
+	}
+	ctx := context.Background()
+	_, span := r.tracer.Start(ctx, otelFetchSpan,
+		trace.WithSpanKind(trace.SpanKindClient), trace.WithTimestamp(start), trace.WithAttributes(attributes...))
+	if result.Error != "" {
+		span.SetStatus(codes.Error, result.Error)
+	} else {
+		span.SetStatus(codes.Ok, "")
+	}
+	span.End(trace.WithTimestamp(end))
+
+	measured := metric.WithAttributes(attribute.String("server.address", host), attribute.String("healthcheck.outcome", outcome))
+	r.fetches.Add(ctx, 1, measured)
+	r.durations.Record(ctx, durationMs(end.Sub(start)), measured)
+}
+
+// Flush exports the spans recorded since the last flush and the cumulative
+// metrics
+func (r *otelRecorder) Flush(ctx context.Context) error {
+	if err := r.tracerProvider.ForceFlush(ctx); err != nil {
+		return fmt.Errorf("failed to export spans: %v", err)
+	}
+	if err := r.meterProvider.ForceFlush(ctx); err != nil {
+		return fmt.Errorf("failed to export metrics: %v", err)
+	}
+	return nil
+}
+
+// Shutdown flushes what is still pending and stops the tracer and meter
+// providers
+func (r *otelRecorder) Shutdown(ctx context.Context) error {
+	traceErr := r.tracerProvider.Shutdown(ctx)
+	metricErr := r.meterProvider.Shutdown(ctx)
+	if traceErr != nil {
+		return fmt.Errorf("failed to shut down tracer provider: %v", traceErr)
+	}
+	if metricErr != nil {
+		return fmt.Errorf("failed to shut down meter provider: %v", metricErr)
+	}
+	return nil
+}
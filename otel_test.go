@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// attributeValue returns the value of key among attributes
+func attributeValue(attributes []attribute.KeyValue, key string) attribute.Value {
+	for _, a := range attributes {
+		if string(a.Key) == key {
+			return a.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+// Test that every fetch produces a span and fetch metrics, and that closing
+// the scan state shuts the providers down
+func TestOtelExport(t *testing.T) {
+	healthy := setupMockServer()
+	defer healthy.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	config := NewDefaultConfig()
+	config.RequestDelay = 0
+	spans := tracetest.NewSpanRecorder()
+	reader := sdkmetric.NewManualReader()
+	recorder, err := newOtelRecorder(otelResource(config), spans, reader)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	state := &scanState{otel: recorder}
+
+	resultChannel := make(chan ServerResult, 3)
+	fetchHealthDataWithDelayAndConcurrency(context.Background(), []ServerEntry{{Address: healthy.URL}, {Address: healthy.URL}, {Address: failing.URL}}, resultChannel, config, state)
+
+	var metrics metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &metrics); err != nil {
+		t.Fatalf("Expected the metrics to be collected, got %v", err)
+	}
+	state.Close(config)
+	if err := reader.Collect(context.Background(), &metricdata.ResourceMetrics{}); err == nil {
+		t.Errorf("Expected the meter provider to be shut down with the scan state")
+	}
+
+	ended := spans.Ended()
+	if len(ended) != 3 {
+		t.Fatalf("Expected a span per fetch, got %d", len(ended))
+	}
+	var failed int
+	for _, span := range ended {
+		if span.Name() != otelFetchSpan || span.SpanKind() != trace.SpanKindClient || !span.SpanContext().IsValid() || span.EndTime().Before(span.StartTime()) {
+			t.Errorf("Unexpected span %+v", span)
+		}
+		attributes := span.Attributes()
+		if attributeValue(attributes, "server.address").AsString() != "127.0.0.1" {
+			t.Errorf("Expected the host attribute, got %v", attributes)
+		}
+		if attributeValue(attributes, "healthcheck.latency_ms").Type() != attribute.FLOAT64 {
+			t.Errorf("Expected the latency attribute, got %v", attributes)
+		}
+		if span.Status().Code == codes.Error {
+			failed++
+			if attributeValue(attributes, "http.response.status_code").AsInt64() != http.StatusServiceUnavailable || attributeValue(attributes, "error.type").AsString() != ErrorClassStatus {
+				t.Errorf("Expected the status and error class of the failed fetch, got %v", attributes)
+			}
+		}
+		if service, _ := span.Resource().Set().Value("service.name"); service.AsString() != defaultOTelServiceName {
+			t.Errorf("Expected the configured resource, got %v", span.Resource())
+		}
+	}
+	if failed != 1 {
+		t.Errorf("Expected 1 failed span, got %d", failed)
+	}
+
+	if len(metrics.ScopeMetrics) != 1 {
+		t.Fatalf("Expected the fetch metrics, got %+v", metrics)
+	}
+	counts := make(map[string]int64)
+	for _, m := range metrics.ScopeMetrics[0].Metrics {
+		switch data := m.Data.(type) {
+		case metricdata.Sum[int64]:
+			for _, point := range data.DataPoints {
+				outcome, _ := point.Attributes.Value("healthcheck.outcome")
+				counts[outcome.AsString()] += point.Value
+			}
+		case metricdata.Histogram[float64]:
+			for _, point := range data.DataPoints {
+				var buckets uint64
+				for _, count := range point.BucketCounts {
+					buckets += count
+				}
+				if len(point.Bounds) != len(otelDurationBounds) || buckets != point.Count || point.Sum <= 0 {
+					t.Errorf("Expected the durations histogram to cover every fetch, got %+v", point)
+				}
+			}
+		}
+	}
+	if counts["success"] != 2 || counts["failure"] != 1 {
+		t.Errorf("Expected 2 successful and 1 failed fetch, got %v", counts)
+	}
+}
+
+// resourceValue returns the value of key among OTLP resource attributes
+func resourceValue(attributes []*commonpb.KeyValue, key string) string {
+	for _, a := range attributes {
+		if a.Key == key {
+			return a.Value.GetStringValue()
+		}
+	}
+	return ""
+}
+
+// Test that the OTLP recorder posts traces and metrics with the resource to
+// the collector's endpoint
+func TestOTLPExporter(t *testing.T) {
+	var mu sync.Mutex
+	bodies := make(map[string][]byte)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies[r.URL.Path] = body
+		mu.Unlock()
+	}))
+	defer collector.Close()
+
+	config := NewDefaultConfig()
+	config.OTLPEndpoint = collector.URL + "/otlp/"
+	config.Environment = "staging"
+	config.OTelResourceAttributes = map[string]string{"team": "ops"}
+	recorder, err := newOTLPRecorder(context.Background(), config)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	start := time.Now()
+	recorder.RecordFetch(ServerResult{URL: "https://web-1:8443/healthz", StatusCode: 200, LatencyMs: 12.5, Attempts: 1}, start, start.Add(12500000))
+	if err := recorder.Flush(context.Background()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := recorder.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var traces coltracepb.ExportTraceServiceRequest
+	if err := proto.Unmarshal(bodies["/otlp/v1/traces"], &traces); err != nil || len(traces.ResourceSpans) != 1 {
+		t.Fatalf("Expected traces on /otlp/v1/traces, got %v, %v", traces.ResourceSpans, err)
+	}
+	var metrics colmetricpb.ExportMetricsServiceRequest
+	if err := proto.Unmarshal(bodies["/otlp/v1/metrics"], &metrics); err != nil || len(metrics.ResourceMetrics) != 1 {
+		t.Fatalf("Expected metrics on /otlp/v1/metrics, got %v, %v", metrics.ResourceMetrics, err)
+	}
+
+	for name, attributes := range map[string][]*commonpb.KeyValue{
+		"traces":  traces.ResourceSpans[0].Resource.Attributes,
+		"metrics": metrics.ResourceMetrics[0].Resource.Attributes,
+	} {
+		if resourceValue(attributes, "service.name") != "healthcheck" || resourceValue(attributes, "deployment.environment") != "staging" || resourceValue(attributes, "team") != "ops" {
+			t.Errorf("Expected the configured resource on the %s, got %v", name, attributes)
+		}
+	}
+	if span := traces.ResourceSpans[0].ScopeSpans[0].Spans[0]; span.Name != otelFetchSpan {
+		t.Errorf("Expected the fetch span, got %v", span)
+	}
+	names := make(map[string]bool)
+	for _, m := range metrics.ResourceMetrics[0].ScopeMetrics[0].Metrics {
+		names[m.Name] = true
+	}
+	if !names[otelFetchCount] || !names[otelFetchDuration] {
+		t.Errorf("Expected the fetch count and duration metrics, got %v", names)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// detectDataAnomalies inspects the per-instance data before it is summed and
+// describes (app, version) pairs that look suspicious: contributed by more
+// instances than MaxInstancesPerVersion, or whose per-instance request counts
+// differ by more than OutlierFactor. Either check is disabled when zero.
+func detectDataAnomalies(data []AggregatedData, config *Config) []string {
+	type key struct{ application, version string }
+	contributions := make(map[key][]int64)
+	for _, d := range data {
+		k := key{d.Application, d.Version}
+		contributions[k] = append(contributions[k], d.TotalRequests)
+	}
+
+	keys := make([]key, 0, len(contributions))
+	for k := range contributions {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].application != keys[j].application {
+			return keys[i].application < keys[j].application
+		}
+		return keys[i].version < keys[j].version
+	})
+
+	var warnings []string
+	for _, k := range keys {
+		counts := contributions[k]
+		if config.MaxInstancesPerVersion > 0 && len(counts) > config.MaxInstancesPerVersion {
+			warnings = append(warnings, fmt.Sprintf("Application: %s, Version: %s reported by %d instances, expected at most %d",
+				k.application, k.version, len(counts), config.MaxInstancesPerVersion))
+		}
+		if config.OutlierFactor > 0 && len(counts) > 1 {
+			lowest, highest := counts[0], counts[0]
+			for _, c := range counts[1:] {
+				if c < lowest {
+					lowest = c
+				}
+				if c > highest {
+					highest = c
+				}
+			}
+			if highest > 0 && (lowest <= 0 || float64(highest)/float64(lowest) > config.OutlierFactor) {
+				warnings = append(warnings, fmt.Sprintf("Application: %s, Version: %s per-instance request counts range from %d to %d, more than %gx apart",
+					k.application, k.version, lowest, highest, config.OutlierFactor))
+			}
+		}
+	}
+	return warnings
+}
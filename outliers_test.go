@@ -0,0 +1,35 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// Test that conflicting contributions to an app/version are flagged
+func TestDetectDataAnomalies(t *testing.T) {
+	data := []AggregatedData{
+		{Application: "Cache", Version: "1.0", TotalRequests: 1000},
+		{Application: "Cache", Version: "1.0", TotalRequests: 1200},
+		{Application: "Cache", Version: "1.0", TotalRequests: 900000},
+		{Application: "Web", Version: "2.0", TotalRequests: 500},
+		{Application: "Web", Version: "2.0", TotalRequests: 600},
+	}
+
+	config := NewDefaultConfig()
+	if warnings := detectDataAnomalies(data, config); len(warnings) != 0 {
+		t.Errorf("Expected no warnings with the checks disabled, got %v", warnings)
+	}
+
+	config.OutlierFactor = 10
+	warnings := detectDataAnomalies(data, config)
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "Application: Cache, Version: 1.0") || !strings.Contains(warnings[0], "1000 to 900000") {
+		t.Errorf("Expected an outlier warning for Cache 1.0, got %v", warnings)
+	}
+
+	config.OutlierFactor = 0
+	config.MaxInstancesPerVersion = 2
+	warnings = detectDataAnomalies(data, config)
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "reported by 3 instances, expected at most 2") {
+		t.Errorf("Expected an instance count warning for Cache 1.0, got %v", warnings)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// percentileKey names percentile p in InstancePercentiles, e.g. p10
+func percentileKey(p float64) string {
+	return "p" + strconv.FormatFloat(p, 'f', -1, 64)
+}
+
+// nearestRank returns percentile p of sorted, which must be non-empty and in
+// ascending order, by the nearest-rank method: the smallest value with at
+// least p percent of the values at or below it
+func nearestRank(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	if rank > len(sorted) {
+		rank = len(sorted)
+	}
+	return sorted[rank-1]
+}
+
+// annotateInstancePercentiles sets the configured percentiles of the
+// per-instance success rates on every record of the aggregation. Instances
+// that served no requests have no rate and are left out.
+func annotateInstancePercentiles(aggregation map[string]map[string]AggregatedData, instances []AggregatedData, percentiles []float64) {
+	rates := make(map[string]map[string][]float64)
+	for _, instance := range instances {
+		if instance.TotalRequests == 0 {
+			continue
+		}
+		if rates[instance.Application] == nil {
+			rates[instance.Application] = make(map[string][]float64)
+		}
+		rates[instance.Application][instance.Version] = append(rates[instance.Application][instance.Version], successRate(instance))
+	}
+
+	for app, versions := range rates {
+		for version, versionRates := range versions {
+			data, ok := aggregation[app][version]
+			if !ok {
+				continue
+			}
+			sort.Float64s(versionRates)
+			data.InstancePercentiles = make(map[string]float64, len(percentiles))
+			for _, p := range percentiles {
+				data.InstancePercentiles[percentileKey(p)] = nearestRank(versionRates, p)
+			}
+			aggregation[app][version] = data
+		}
+	}
+}
+
+// formatInstancePercentiles renders the per-instance percentiles for the
+// console summary, highest first, e.g. ", p50: 99.00%, p10: 80.00%"
+func formatInstancePercentiles(percentiles map[string]float64) string {
+	if len(percentiles) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(percentiles))
+	for key := range percentiles {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, _ := strconv.ParseFloat(strings.TrimPrefix(keys[i], "p"), 64)
+		b, _ := strconv.ParseFloat(strings.TrimPrefix(keys[j], "p"), 64)
+		return a > b
+	})
+	for i, key := range keys {
+		keys[i] = fmt.Sprintf("%s: %.2f%%", key, percentiles[key])
+	}
+	return ", " + strings.Join(keys, ", ")
+}
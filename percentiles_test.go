@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// Test that per-instance percentiles expose a few bad instances hidden by a
+// healthy majority in the summed rate
+func TestInstancePercentiles(t *testing.T) {
+	var instances []AggregatedData
+	for _, successes := range []int64{100, 100, 99, 98, 97, 96, 95, 60, 40, 100} {
+		instances = append(instances, AggregatedData{Application: "Memcache2", Version: "1.0.1", TotalRequests: 100, TotalSuccesses: successes})
+	}
+	instances = append(instances,
+		AggregatedData{Application: "Memcache2", Version: "1.0.1"},
+		AggregatedData{Application: "Cassandra", Version: "2.0.0", TotalRequests: 10, TotalSuccesses: 5},
+	)
+	aggregation := aggregateData(instances)
+	annotateSeverity(aggregation, NewDefaultConfig())
+
+	annotateInstancePercentiles(aggregation, instances, []float64{50, 10})
+
+	memcache := aggregation["Memcache2"]["1.0.1"]
+	if rate := successRate(memcache); rate != 88.5 {
+		t.Errorf("Expected a summed rate of 88.5%%, got %.2f%%", rate)
+	}
+	expected := map[string]float64{"p50": 97, "p10": 40}
+	for key, value := range expected {
+		if memcache.InstancePercentiles[key] != value {
+			t.Errorf("Expected %s of %.0f%%, got %v", key, value, memcache.InstancePercentiles)
+		}
+	}
+	if cassandra := aggregation["Cassandra"]["2.0.0"].InstancePercentiles; cassandra["p50"] != 50 || cassandra["p10"] != 50 {
+		t.Errorf("Expected a single instance to be every percentile, got %v", cassandra)
+	}
+
+	var buf bytes.Buffer
+	printSeveritySummary(&buf, aggregation)
+	if !strings.Contains(buf.String(), "Success Rate: 88.50%, p50: 97.00%, p10: 40.00%") {
+		t.Errorf("Expected the percentiles in the summary, got %s", buf.String())
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"math"
+	"mime"
+	"strconv"
+	"strings"
+)
+
+// Health response fields PROMETHEUS_METRICS can map a metric to
+const (
+	PrometheusFieldRequestCount = "requestCount"
+	PrometheusFieldErrorCount   = "errorCount"
+	PrometheusFieldSuccessCount = "successCount"
+	// PrometheusFieldUptime is read in seconds, the Prometheus convention
+	PrometheusFieldUptime = "uptime"
+)
+
+// isPrometheusField reports whether field is a health response field that can
+// be read from a Prometheus metric
+func isPrometheusField(field string) bool {
+	switch field {
+	case PrometheusFieldRequestCount, PrometheusFieldErrorCount, PrometheusFieldSuccessCount, PrometheusFieldUptime:
+		return true
+	}
+	return false
+}
+
+// isPrometheusText reports whether contentType is the Prometheus text
+// exposition format, text/plain with or without a version parameter
+func isPrometheusText(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && mediaType == "text/plain"
+}
+
+// prometheusSample is a line of the exposition format
+type prometheusSample struct {
+	Name   string
+	Labels map[string]string
+	Value  float64
+}
+
+// parsePrometheusText parses the samples of a Prometheus text exposition,
+// skipping comments, HELP and TYPE lines
+func parsePrometheusText(body []byte) ([]prometheusSample, error) {
+	var samples []prometheusSample
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		sample, err := parsePrometheusSample(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		samples = append(samples, sample)
+	}
+	return samples, scanner.Err()
+}
+
+// parsePrometheusSample parses name{label="value",...} value [timestamp]
+func parsePrometheusSample(text string) (prometheusSample, error) {
+	sample := prometheusSample{}
+	end := strings.IndexAny(text, "{ \t")
+	if end <= 0 {
+		return sample, fmt.Errorf("invalid sample %q", text)
+	}
+	sample.Name, text = text[:end], text[end:]
+
+	if strings.HasPrefix(text, "{") {
+		labels, rest, err := parsePrometheusLabels(text[1:])
+		if err != nil {
+			return sample, fmt.Errorf("metric %s: %v", sample.Name, err)
+		}
+		sample.Labels, text = labels, rest
+	}
+
+	fields := strings.Fields(text)
+	if len(fields) == 0 || len(fields) > 2 {
+		return sample, fmt.Errorf("metric %s: expected a value and an optional timestamp, got %q", sample.Name, text)
+	}
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return sample, fmt.Errorf("metric %s: invalid value %q", sample.Name, fields[0])
+	}
+	sample.Value = value
+	return sample, nil
+}
+
+// parsePrometheusLabels parses the labels following a sample's opening brace
+// and returns the text after the closing one
+func parsePrometheusLabels(text string) (map[string]string, string, error) {
+	labels := make(map[string]string)
+	for {
+		text = strings.TrimLeft(text, " \t,")
+		if strings.HasPrefix(text, "}") {
+			return labels, text[1:], nil
+		}
+		eq := strings.Index(text, "=")
+		if eq <= 0 || len(text) < eq+2 || text[eq+1] != '"' {
+			return nil, "", fmt.Errorf("invalid labels near %q", text)
+		}
+		name := strings.TrimSpace(text[:eq])
+		text = text[eq+2:]
+
+		var value strings.Builder
+		closed := false
+		for i := 0; i < len(text); i++ {
+			c := text[i]
+			if c == '\\' && i+1 < len(text) {
+				i++
+				switch text[i] {
+				case 'n':
+					value.WriteByte('\n')
+				default:
+					value.WriteByte(text[i])
+				}
+				continue
+			}
+			if c == '"' {
+				text, closed = text[i+1:], true
+				break
+			}
+			value.WriteByte(c)
+		}
+		if !closed {
+			return nil, "", fmt.Errorf("unterminated value of label %s", name)
+		}
+		labels[name] = value.String()
+	}
+}
+
+// decodePrometheusHealth builds a health response from a Prometheus text
+// body. Each field of PROMETHEUS_METRICS is the sum of every sample of its
+// metric, so a counter split by labels such as status code is totalled. The
+// application and version are taken from the first sample labelled with
+// them. Without a mapped successCount it is derived as requests minus errors.
+func decodePrometheusHealth(body []byte, serverURL string, config *Config) (HealthResponse, error) {
+	var health HealthResponse
+	samples, err := parsePrometheusText(body)
+	if err != nil {
+		return health, &FetchError{Class: ErrorClassDecode, Err: fmt.Errorf("failed to decode Prometheus metrics from server %s: %v", serverURL, err)}
+	}
+
+	totals := make(map[string]float64)
+	found := make(map[string]bool)
+	for _, sample := range samples {
+		totals[sample.Name] += sample.Value
+		found[sample.Name] = true
+		if health.Application == "" && sample.Labels["application"] != "" {
+			health.Application, health.Version = sample.Labels["application"], sample.Labels["version"]
+		}
+	}
+
+	for field, metric := range config.PrometheusMetrics {
+		if !found[metric] {
+			return health, &FetchError{Class: ErrorClassInvalidResponse, Err: fmt.Errorf("server %s did not expose metric %s for %s", serverURL, metric, field)}
+		}
+		value := totals[metric]
+		if math.IsNaN(value) || math.IsInf(value, 0) || value < 0 {
+			return health, &FetchError{Class: ErrorClassInvalidCount, Err: fmt.Errorf("server %s reported %s as %v", serverURL, metric, value)}
+		}
+		switch field {
+		case PrometheusFieldRequestCount:
+			health.RequestCount = int64(math.Round(value))
+		case PrometheusFieldErrorCount:
+			health.ErrorCount = int64(math.Round(value))
+		case PrometheusFieldSuccessCount:
+			health.SuccessCount = int64(math.Round(value))
+		case PrometheusFieldUptime:
+			health.Uptime = int64(value * 1e9)
+		}
+	}
+	if _, ok := config.PrometheusMetrics[PrometheusFieldSuccessCount]; !ok {
+		if _, ok := config.PrometheusMetrics[PrometheusFieldErrorCount]; ok {
+			health.SuccessCount = health.RequestCount - health.ErrorCount
+		}
+	}
+	return health, nil
+}
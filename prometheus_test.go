@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+const prometheusBody = `# HELP http_requests_total Requests served.
+# TYPE http_requests_total counter
+http_requests_total{code="200",path="/api"} 1200
+http_requests_total{code="500",path="/api"} 30
+http_requests_total{code="200",path="/login, \"legacy\""} 70 1712000000000
+# TYPE http_errors_total counter
+http_errors_total{code="500"} 30
+app_info{application="Memcache2",version="1.0.1"} 1
+process_uptime_seconds 3600.5
+`
+
+// Test that counts are extracted from a Prometheus text body, summing the
+// samples of each mapped metric
+func TestDecodePrometheusHealth(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.Write([]byte(prometheusBody))
+	}))
+	defer server.Close()
+
+	config := NewDefaultConfig()
+	config.PrometheusMetrics = map[string]string{
+		PrometheusFieldRequestCount: "http_requests_total",
+		PrometheusFieldErrorCount:   "http_errors_total",
+		PrometheusFieldUptime:       "process_uptime_seconds",
+	}
+	health, _, err := fetchHealthData(context.Background(), newHTTPClient(config), server.URL, config)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	expected := HealthResponse{
+		Application:  "Memcache2",
+		Version:      "1.0.1",
+		Uptime:       3600500000000,
+		RequestCount: 1300,
+		ErrorCount:   30,
+		SuccessCount: 1270,
+	}
+	if !reflect.DeepEqual(health, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, health)
+	}
+
+	config.PrometheusMetrics[PrometheusFieldSuccessCount] = "http_successes_total"
+	if _, _, err := fetchHealthData(context.Background(), newHTTPClient(config), server.URL, config); classifyError(err) != ErrorClassInvalidResponse {
+		t.Errorf("Expected a missing metric to be an invalid response, got %v", err)
+	}
+
+	if _, err := decodePrometheusHealth([]byte("http_requests_total{code=\"200} 5\n"), server.URL, config); classifyError(err) != ErrorClassDecode {
+		t.Errorf("Expected malformed labels to be a decode error, got %v", err)
+	}
+}
+
+// Test that only text/plain bodies are read as Prometheus metrics
+func TestIsPrometheusText(t *testing.T) {
+	for contentType, expected := range map[string]bool{
+		"text/plain; version=0.0.4": true,
+		"text/plain":                true,
+		"application/json":          false,
+		"":                          false,
+	} {
+		if got := isPrometheusText(contentType); got != expected {
+			t.Errorf("%q: expected %v, got %v", contentType, expected, got)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// pushMetrics replaces the gauges of PUSHGATEWAY_JOB on the Pushgateway with
+// those of report, in the same text format as the /metrics endpoint. It waits
+// for the gateway to acknowledge the push, for at most HTTP_TIMEOUT.
+func pushMetrics(ctx context.Context, config *Config, report Report) error {
+	registry := newMetricsRegistry(config)
+	registry.Update(report.Applications, nil)
+	var body bytes.Buffer
+	registry.Render(&body)
+
+	endpoint := config.PushgatewayURL + "/metrics/job/" + url.PathEscape(config.PushgatewayJob)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, endpoint, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+
+	client := &http.Client{Timeout: config.HTTPTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("pushgateway returned status %d", resp.StatusCode)
+	}
+	return nil
+}
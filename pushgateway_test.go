@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Test that publishReport only returns once the mock Pushgateway has received
+// the push
+func TestPushgatewayPushAwaited(t *testing.T) {
+	var mu sync.Mutex
+	var method, path, body string
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A slow gateway must still be waited for
+		time.Sleep(100 * time.Millisecond)
+		data, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		method, path, body = r.Method, r.URL.Path, string(data)
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer gateway.Close()
+
+	config := NewDefaultConfig()
+	config.PushgatewayURL = gateway.URL
+	report := Report{Applications: aggregateData([]AggregatedData{
+		{Application: "Memcache2", Version: "1.0.1", TotalRequests: 10, TotalSuccesses: 9},
+	})}
+
+	if err := publishReport(context.Background(), config, &scanState{writer: &fakeReportWriter{}}, report); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if method != http.MethodPut || path != "/metrics/job/healthcheck" {
+		t.Errorf("Expected a PUT to /metrics/job/healthcheck, got %s %s", method, path)
+	}
+	if !strings.Contains(body, `healthcheck_success_rate{application="Memcache2",version="1.0.1"} 90`) {
+		t.Errorf("Expected the gauges in the push, got:\n%s", body)
+	}
+}
+
+// Test that a rejected push is reported
+func TestPushMetricsError(t *testing.T) {
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer gateway.Close()
+
+	config := NewDefaultConfig()
+	config.PushgatewayURL = gateway.URL
+	if err := pushMetrics(context.Background(), config, Report{}); err == nil || !strings.Contains(err.Error(), "400") {
+		t.Errorf("Expected the status to be reported, got %v", err)
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Supported report output formats
+const (
+	OutputFormatJSON = "json"
+	OutputFormatHTML = "html"
+	// OutputFormatMarkdown renders a Markdown table for wikis and pull requests
+	OutputFormatMarkdown = "markdown"
+	// OutputFormatGrafana shapes the report for Grafana's JSON datasource
+	OutputFormatGrafana = "grafana-json"
+)
+
+// outputExtensions maps every supported output format to the extension of
+// its default report file
+var outputExtensions = map[string]string{
+	OutputFormatJSON:     ".json",
+	OutputFormatHTML:     ".html",
+	OutputFormatMarkdown: ".md",
+	OutputFormatGrafana:  ".json",
+}
+
+// checkOutputFormat returns an error when format is not a supported output
+// format, so a typo fails the run before any server is contacted
+func checkOutputFormat(format string) error {
+	if _, ok := outputExtensions[format]; !ok {
+		return fmt.Errorf("unsupported output format %q", format)
+	}
+	return nil
+}
+
+// defaultOutputFileFor returns the default report file of format, e.g.
+// report.html for html
+func defaultOutputFileFor(format string) string {
+	ext, ok := outputExtensions[format]
+	if !ok {
+		return defaultOutputFile
+	}
+	return strings.TrimSuffix(defaultOutputFile, filepath.Ext(defaultOutputFile)) + ext
+}
+
+// Supported report granularities
+const (
+	GranularityVersion     = "version"
+	GranularityApplication = "application"
+)
+
+// versionAll keys the single record of an application collapsed at
+// application granularity
+const versionAll = "*"
+
+// reportSchemaVersion is bumped whenever the shape of the report changes so
+// downstream consumers can pin to it. Version 2 renamed tcp to liveness and
+// added circuits, slo, slowest, status and the latency, retries and circuit
+// state of raw results.
+const reportSchemaVersion = 2
+
+// ReportMeta describes the run that produced a report
+type ReportMeta struct {
+	// Environment distinguishes reports shipped from different environments
+	Environment string `json:"environment,omitempty"`
+	// Region is the region the report was scanned from
+	Region string `json:"region,omitempty"`
+	// Granularity is set to application when versions were collapsed
+	Granularity string `json:"granularity,omitempty"`
+}
+
+// Report is the document written to report.json
+type Report struct {
+	// SchemaVersion identifies the report shape; reports written before it was
+	// introduced decode as 0
+	SchemaVersion int        `json:"schemaVersion"`
+	Meta          ReportMeta `json:"meta"`
+	// Applications holds the aggregated records keyed by application and version
+	Applications map[string]map[string]AggregatedData `json:"applications"`
+	// Regions holds the records of a merged report broken down by region when
+	// merged with -by-region; Applications then holds the combined numbers
+	Regions map[string]map[string]map[string]AggregatedData `json:"regions,omitempty"`
+	// Liveness holds the up/down availability of liveness-only checks keyed
+	// by their app tag
+	Liveness map[string]LivenessAvailability `json:"liveness,omitempty"`
+	// SLO holds the compliance of every record with its SLO_FILE target
+	SLO []SLOCompliance `json:"slo,omitempty"`
+	// Circuits summarises retries and circuit states when MAX_RETRIES or
+	// CIRCUIT_THRESHOLD is set
+	Circuits *CircuitSummary `json:"circuits,omitempty"`
+	// UptimeRegressions lists the servers whose uptime went backwards since
+	// the previous watch cycle
+	UptimeRegressions []UptimeRegression `json:"uptimeRegressions,omitempty"`
+	// RequestDeltas lists the requests served per application version since
+	// the previous watch cycle when REQUEST_DELTAS is enabled
+	RequestDeltas []RequestDelta `json:"requestDeltas,omitempty"`
+	// BaselineRegressions lists the records whose success rate dropped below
+	// that of BASELINE_FILE by more than REGRESSION_TOLERANCE
+	BaselineRegressions []BaselineRegression `json:"baselineRegressions,omitempty"`
+	// Slowest lists the slowest endpoints when REPORT_SLOWEST is enabled
+	Slowest []SlowEndpoint `json:"slowest,omitempty"`
+	// Raw holds the per-server results when INCLUDE_RAW is enabled
+	Raw []ServerResult `json:"raw,omitempty"`
+	// Status is the overall verdict of the report: healthy, degraded or
+	// critical, omitted when no record has enough data
+	Status string `json:"status,omitempty"`
+}
+
+// flatReport is a report whose single application's versions are hoisted to
+// the top level, written with FLATTEN_SINGLE_APP
+type flatReport struct {
+	Report
+	// Applications shadows the nested records so they are left out, or holds
+	// them when a nested report is decoded as a flatReport
+	Applications map[string]map[string]AggregatedData `json:"applications,omitempty"`
+	Application  string                               `json:"application,omitempty"`
+	Versions     map[string]AggregatedData            `json:"versions,omitempty"`
+}
+
+// flattenReport returns the flat shape of report when it holds a single
+// application, or report itself otherwise
+func flattenReport(report Report) interface{} {
+	if len(report.Applications) != 1 {
+		return report
+	}
+	flat := flatReport{Report: report}
+	for app, versions := range report.Applications {
+		flat.Application, flat.Versions = app, versions
+	}
+	return flat
+}
+
+// nested returns the report in the nested shape whichever shape it was
+// decoded from
+func (f flatReport) nested() Report {
+	report := f.Report
+	report.Applications = f.Applications
+	if f.Versions != nil {
+		report.Applications = map[string]map[string]AggregatedData{f.Application: f.Versions}
+	}
+	return report
+}
+
+// buildReport assembles the report for a run from the aggregation and the
+// individual server results
+func buildReport(aggregation map[string]map[string]AggregatedData, results []ServerResult, config *Config) Report {
+	report := Report{
+		SchemaVersion: reportSchemaVersion,
+		Meta:          ReportMeta{Environment: config.Environment, Region: config.Region},
+		Applications:  aggregation,
+		Liveness:      aggregateLiveness(results, config),
+	}
+	if config.OutputGranularity == GranularityApplication {
+		report.Meta.Granularity = GranularityApplication
+		report.Applications = collapseVersions(aggregation, config)
+	}
+	if config.MaxRetries > 0 || config.CircuitThreshold > 0 {
+		summary := summarizeCircuits(results)
+		report.Circuits = &summary
+	}
+	if config.ReportSlowest {
+		report.Slowest = slowestEndpoints(results, config.SlowestN)
+	}
+	if config.IncludeRaw {
+		report.Raw = append([]ServerResult(nil), results...)
+		sort.Slice(report.Raw, func(i, j int) bool {
+			return report.Raw[i].Server < report.Raw[j].Server
+		})
+	}
+	report.Status, _ = overallStatus(report.Applications, config)
+	return report
+}
+
+// collapseVersions folds every version of an application into a single
+// record keyed by versionAll. Counts are summed, so its success rate is the
+// request-weighted rate of the versions.
+func collapseVersions(aggregation map[string]map[string]AggregatedData, config *Config) map[string]map[string]AggregatedData {
+	collapsed := make(map[string]map[string]AggregatedData)
+	for _, data := range sortedRecords(aggregation) {
+		data.Version = versionAll
+		foldAggregatedData(collapsed, data)
+	}
+	annotateSeverity(collapsed, config)
+	return collapsed
+}
+
+// checkGranularities reports an error when the reports, identified by names,
+// do not all share the granularity of the first one, since version and
+// application records cannot be compared with each other
+func checkGranularities(names []string, reports []Report) error {
+	for i := 1; i < len(reports); i++ {
+		if reports[i].Meta.Granularity != reports[0].Meta.Granularity {
+			return fmt.Errorf("report %s has granularity %q but %s has granularity %q; refusing to combine reports of different granularities",
+				names[i], reports[i].Meta.Granularity, names[0], reports[0].Meta.Granularity)
+		}
+	}
+	return nil
+}
+
+// checkSchemaVersions reports an error when the reports, identified by names,
+// do not all share the schema version of the first one
+func checkSchemaVersions(names []string, reports []Report) error {
+	for i := 1; i < len(reports); i++ {
+		if reports[i].SchemaVersion != reports[0].SchemaVersion {
+			return fmt.Errorf("report %s has schemaVersion %d but %s has schemaVersion %d; refusing to combine reports of different schemas",
+				names[i], reports[i].SchemaVersion, names[0], reports[0].SchemaVersion)
+		}
+	}
+	return nil
+}
+
+// wantsEnvelope reports whether the JSON report is written as the envelope
+// rather than the bare application and version map. Raw results and the flat
+// shape only exist within the envelope, so they imply it.
+func wantsEnvelope(config *Config) bool {
+	return config.ReportEnvelope || config.IncludeRaw || config.FlattenSingleApp
+}
+
+// encodeReport serialises the report in the configured output format
+func encodeReport(report Report, config *Config) ([]byte, error) {
+	switch config.OutputFormat {
+	case OutputFormatJSON:
+		var document interface{} = report.Applications
+		if config.FlattenSingleApp {
+			document = flattenReport(report)
+		} else if wantsEnvelope(config) {
+			document = report
+		}
+		if config.JSONIndent == "" {
+			return json.Marshal(document)
+		}
+		return json.MarshalIndent(document, "", config.JSONIndent)
+	case OutputFormatHTML:
+		return renderHTMLReport(report.Applications)
+	case OutputFormatGrafana:
+		return renderGrafanaReport(report, config.JSONIndent)
+	case OutputFormatMarkdown:
+		return renderMarkdownReport(report), nil
+	default:
+		return nil, fmt.Errorf("unsupported output format %q", config.OutputFormat)
+	}
+}
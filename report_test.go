@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// goldenReport builds a report exercising every section with fixed data
+func goldenReport(config *Config) Report {
+	aggregation := aggregateData([]AggregatedData{
+		{Application: "Memcache2", Version: "1.0.1", TotalRequests: 5194800029, TotalSuccesses: 4151986778, StatusCounts: map[string]int{"ok": 1, "degraded": 1}},
+		{Application: "Cassandra", Version: "2.0.0", TotalRequests: 1000, TotalSuccesses: 1000},
+	})
+	annotateSeverity(aggregation, config)
+	results := []ServerResult{
+		{Server: "server-0002", URL: "https://server-0002/healthz", Error: "server https://server-0002/healthz returned status 503: ", ErrorClass: ErrorClassStatus, StatusCode: 503, Attempts: 1},
+		{Server: "server-0001", URL: "https://server-0001/healthz", Protocol: "HTTP/2.0", Tags: map[string]string{"dc": "us-east", "app": "Memcache2"},
+			Health: &HealthResponse{Application: "Memcache2", Version: "1.0.1", Uptime: 4637719417, RequestCount: 5194800029, ErrorCount: 1042813251, SuccessCount: 4151986778}, StatusCode: 200, Attempts: 1},
+	}
+	return buildReport(aggregation, results, config)
+}
+
+// Test that the JSON report is byte-stable against the golden file
+func TestReportGolden(t *testing.T) {
+	config := NewDefaultConfig()
+	config.Environment = "prod"
+	config.IncludeRaw = true
+
+	golden, err := os.ReadFile(filepath.Join("testdata", "report.golden.json"))
+	if err != nil {
+		t.Fatalf("Failed to read golden file: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		data, err := encodeReport(goldenReport(config), config)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if !bytes.Equal(data, bytes.TrimRight(golden, "\n")) {
+			t.Fatalf("Report differs from testdata/report.golden.json:\n%s", data)
+		}
+	}
+
+	// Other indents only change the whitespace
+	for _, indent := range []string{"\t", "    ", ""} {
+		config.JSONIndent = indent
+		data, err := encodeReport(goldenReport(config), config)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		var expected bytes.Buffer
+		if indent == "" {
+			err = json.Compact(&expected, golden)
+		} else {
+			err = json.Indent(&expected, bytes.TrimRight(golden, "\n"), "", indent)
+		}
+		if err != nil {
+			t.Fatalf("Failed to reformat golden file: %v", err)
+		}
+		if !bytes.Equal(data, expected.Bytes()) {
+			t.Errorf("Expected indent %q to only change whitespace, got:\n%s", indent, data)
+		}
+	}
+}
+
+// Test parsing of the JSON_INDENT values
+func TestParseJSONIndent(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected string
+		ok       bool
+	}{
+		{"4", "    ", true},
+		{"0", "", true},
+		{"tab", "\t", true},
+		{`\t`, "\t", true},
+		{"  ", "  ", true},
+		{"x", "", false},
+		{"-1", "", false},
+	}
+	for _, tt := range tests {
+		if got, ok := parseJSONIndent(tt.value); got != tt.expected || ok != tt.ok {
+			t.Errorf("parseJSONIndent(%q) = %q, %v, expected %q, %v", tt.value, got, ok, tt.expected, tt.ok)
+		}
+	}
+}
+
+// Test that FLATTEN_SINGLE_APP writes a single application's versions at the
+// top level, keeps several applications nested, and reads back either shape
+func TestFlattenSingleApp(t *testing.T) {
+	config := NewDefaultConfig()
+	config.FlattenSingleApp = true
+	aggregation := aggregateData([]AggregatedData{
+		{Application: "Memcache2", Version: "1.0.1", TotalRequests: 100, TotalSuccesses: 99},
+		{Application: "Memcache2", Version: "1.0.2", TotalRequests: 100, TotalSuccesses: 80},
+	})
+	annotateSeverity(aggregation, config)
+
+	data, err := encodeReport(buildReport(aggregation, nil, config), config)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	var shape map[string]json.RawMessage
+	if err := json.Unmarshal(data, &shape); err != nil {
+		t.Fatalf("Failed to decode report: %v", err)
+	}
+	if _, nested := shape["applications"]; nested {
+		t.Errorf("Expected no applications map in the flat report, got %s", data)
+	}
+	if string(shape["application"]) != `"Memcache2"` {
+		t.Errorf("Expected the application at the top level, got %s", shape["application"])
+	}
+	var versions map[string]AggregatedData
+	if err := json.Unmarshal(shape["versions"], &versions); err != nil || len(versions) != 2 || versions["1.0.2"].Severity != SeverityCritical {
+		t.Errorf("Expected both versions with their metrics, got %s", shape["versions"])
+	}
+
+	path := filepath.Join(t.TempDir(), "report.json")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("Failed to write report: %v", err)
+	}
+	loaded, err := loadReport(path)
+	if err != nil {
+		t.Fatalf("Failed to load report: %v", err)
+	}
+	if loaded.Applications["Memcache2"]["1.0.1"].TotalSuccesses != 99 || loaded.SchemaVersion != reportSchemaVersion {
+		t.Errorf("Expected the flat report to load nested, got %+v", loaded)
+	}
+
+	// Several applications keep the nested schema
+	aggregation = aggregateData([]AggregatedData{
+		{Application: "Memcache2", Version: "1.0.1", TotalRequests: 100, TotalSuccesses: 99},
+		{Application: "Cassandra", Version: "2.0.0", TotalRequests: 100, TotalSuccesses: 100},
+	})
+	if data, err = encodeReport(buildReport(aggregation, nil, config), config); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	shape = nil
+	json.Unmarshal(data, &shape)
+	if _, nested := shape["applications"]; !nested || shape["versions"] != nil {
+		t.Errorf("Expected several applications to stay nested, got %s", data)
+	}
+}
+
+// Test that the JSON report is the bare application and version map by
+// default, and the envelope only when asked for
+func TestReportEnvelope(t *testing.T) {
+	config := NewDefaultConfig()
+	config.Environment = "staging"
+	aggregation := aggregateData([]AggregatedData{{Application: "Memcache2", Version: "1.0.1", TotalRequests: 100, TotalSuccesses: 99}})
+
+	data, err := encodeReport(buildReport(aggregation, nil, config), config)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	var bare map[string]map[string]AggregatedData
+	if err := json.Unmarshal(data, &bare); err != nil || len(bare) != 1 || bare["Memcache2"]["1.0.1"].TotalSuccesses != 99 {
+		t.Fatalf("Expected the bare application map, got %s", data)
+	}
+	path := filepath.Join(t.TempDir(), "report.json")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("Failed to write report: %v", err)
+	}
+	loaded, err := loadReport(path)
+	if err != nil || loaded.Applications["Memcache2"]["1.0.1"].TotalRequests != 100 || loaded.SchemaVersion != 0 {
+		t.Errorf("Expected the bare map to load as a version 0 report, got %+v (%v)", loaded, err)
+	}
+
+	for _, configure := range []func(*Config){
+		func(c *Config) { c.ReportEnvelope = true },
+		func(c *Config) { c.IncludeRaw = true },
+	} {
+		config := NewDefaultConfig()
+		configure(config)
+		data, err := encodeReport(buildReport(aggregation, nil, config), config)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		var shape map[string]json.RawMessage
+		json.Unmarshal(data, &shape)
+		if _, ok := shape["schemaVersion"]; !ok || shape["applications"] == nil {
+			t.Errorf("Expected the envelope, got %s", data)
+		}
+	}
+}
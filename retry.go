@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// retryBudget caps the retries shared by all servers in a cycle so a wide
+// outage does not multiply the load on the fleet
+type retryBudget struct {
+	limit     int64
+	used      int64
+	exhausted int32
+	out       io.Writer
+}
+
+// newRetryBudget creates a budget of limit retries (0 means unlimited)
+func newRetryBudget(limit int) *retryBudget {
+	return &retryBudget{limit: int64(limit), out: os.Stdout}
+}
+
+// take reserves a retry, reporting false once the budget is exhausted. The
+// first refusal is logged.
+func (b *retryBudget) take() bool {
+	if b.limit <= 0 {
+		return true
+	}
+	if atomic.AddInt64(&b.used, 1) <= b.limit {
+		return true
+	}
+	if atomic.CompareAndSwapInt32(&b.exhausted, 0, 1) {
+		fmt.Fprintf(b.out, "Retry budget of %d exhausted, remaining failures will not be retried\n", b.limit)
+	}
+	return false
+}
+
+// requestCeiling caps the requests made to the fleet in a cycle, first
+// attempts and retries alike, for endpoints billed per request
+type requestCeiling struct {
+	limit   int64
+	used    int64
+	reached int32
+	out     io.Writer
+}
+
+// newRequestCeiling creates a ceiling of limit requests (0 means unlimited)
+func newRequestCeiling(limit int) *requestCeiling {
+	return &requestCeiling{limit: int64(limit), out: os.Stdout}
+}
+
+// take reserves a request, reporting false once the ceiling is reached. A nil
+// ceiling is unlimited. The first refusal is logged.
+func (c *requestCeiling) take() bool {
+	if c == nil || c.limit <= 0 {
+		return true
+	}
+	if atomic.AddInt64(&c.used, 1) <= c.limit {
+		return true
+	}
+	if atomic.CompareAndSwapInt32(&c.reached, 0, 1) {
+		fmt.Fprintf(c.out, "Request ceiling of %d reached, remaining servers will be skipped\n", c.limit)
+	}
+	return false
+}
+
+// skippedResult is the result of a server not checked because the ceiling was
+// reached before its first request
+func (c *requestCeiling) skippedResult(entry ServerEntry, serverURL string) ServerResult {
+	return ServerResult{
+		Server:     entry.name(),
+		URL:        serverURL,
+		Tags:       entry.Tags,
+		Error:      fmt.Sprintf("request ceiling of %d reached, skipping server %s", c.limit, serverURL),
+		ErrorClass: ErrorClassSkippedBudget,
+	}
+}
+
+// isRetryable reports whether a failed health check may be retried. Only
+// conditions where repeating the request is safe and likely to help qualify:
+// connection failures, timeouts, server errors and rate limiting, or the
+// statuses of RetryStatusCodes when set, plus bodies that failed to decode
+// when RetryDecode is set and TLS handshake failures when RetryTLSHandshake is.
+func isRetryable(err error, meta fetchMeta, config *Config) bool {
+	switch classifyError(err) {
+	case ErrorClassNetwork, ErrorClassConnect, ErrorClassTimeout, ErrorClassReset:
+		return true
+	case ErrorClassTLSHandshake:
+		return config.RetryTLSHandshake
+	case ErrorClassDecode:
+		return config.RetryDecode
+	case ErrorClassStatus:
+		if config.RetryStatusCodes != nil {
+			return config.RetryStatusCodes[meta.StatusCode]
+		}
+		return meta.StatusCode >= 500 || meta.StatusCode == http.StatusTooManyRequests
+	}
+	return false
+}
+
+// parseRetryStatusCodes parses the statuses of RETRY_STATUS_CODES. Only error
+// statuses, 400 to 599, can be retried; other entries are ignored, and nil is
+// returned when none is valid so the default set applies.
+func parseRetryStatusCodes(codes []string) map[int]bool {
+	var statuses map[int]bool
+	for _, code := range codes {
+		status, err := strconv.Atoi(code)
+		if err != nil || status < 400 || status > 599 {
+			continue
+		}
+		if statuses == nil {
+			statuses = make(map[int]bool)
+		}
+		statuses[status] = true
+	}
+	return statuses
+}
+
+// fetchHealthDataWithRetry fetches health data, retrying retryable failures up
+// to MaxRetries times with exponential backoff while the shared budget allows.
+// The latency is that of the final attempt, or with LATENCY_MODE=cumulative
+// the time from the first attempt to the last, backoff included. With
+// RetryOnReset, the first connection reset of a GET or HEAD check is retried
+// straight away without counting against MaxRetries or the budget. Every
+// attempt takes a request from ceiling; once it is reached no further attempt
+// is made, and a check refused its first attempt fails as skipped-budget.
+func fetchHealthDataWithRetry(ctx context.Context, client *http.Client, serverURL string, config *Config, budget *retryBudget, ceiling *requestCeiling) (HealthResponse, fetchMeta, error) {
+	backoff := config.RetryBackoff
+	first := time.Now()
+	retries := 0
+	resetRetried := false
+	var health HealthResponse
+	var meta fetchMeta
+	var err error
+	for attempt := 1; ; attempt++ {
+		if !ceiling.take() {
+			if attempt == 1 {
+				err = &FetchError{Class: ErrorClassSkippedBudget, Err: fmt.Errorf("request ceiling reached before checking %s", serverURL)}
+			}
+			return health, meta, err
+		}
+		start := time.Now()
+		if config.LatencyMode == LatencyModeCumulative {
+			start = first
+		}
+		health, meta, err = fetchHealthData(ctx, client, serverURL, config)
+		meta.Latency = time.Since(start)
+		meta.Attempts = attempt
+		if err == nil {
+			return health, meta, nil
+		}
+		if config.RetryOnReset && config.HealthMethod != http.MethodPost && !resetRetried && classifyError(err) == ErrorClassReset && ctx.Err() == nil {
+			// Resets are mostly a peer dropping a connection mid-request and
+			// a fresh connection almost always succeeds, so skip the backoff
+			resetRetried = true
+			continue
+		}
+		if retries >= config.MaxRetries || !isRetryable(err, meta, config) || !budget.take() {
+			return health, meta, err
+		}
+		retries++
+		select {
+		case <-ctx.Done():
+			return health, meta, err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
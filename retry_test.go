@@ -0,0 +1,366 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Test that a failing server is retried and then succeeds
+func TestFetchHealthDataWithRetry(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(mockResponse))
+	}))
+	defer server.Close()
+
+	config := NewDefaultConfig()
+	config.MaxRetries = 3
+	config.RetryBackoff = time.Millisecond
+
+	_, meta, err := fetchHealthDataWithRetry(context.Background(), newHTTPClient(config), server.URL, config, newRetryBudget(0), nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if meta.Attempts != 3 {
+		t.Errorf("Expected 3 attempts, got %d", meta.Attempts)
+	}
+
+	// Client errors are not retried
+	notFound := httptest.NewServer(http.NotFoundHandler())
+	defer notFound.Close()
+	if _, meta, _ := fetchHealthDataWithRetry(context.Background(), newHTTPClient(config), notFound.URL, config, newRetryBudget(0), nil); meta.Attempts != 1 {
+		t.Errorf("Expected a 404 not to be retried, got %d attempts", meta.Attempts)
+	}
+}
+
+// Test that retries stop once the global budget is exhausted
+func TestRetryBudget(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	var servers []ServerEntry
+	for i := 0; i < 10; i++ {
+		servers = append(servers, ServerEntry{Address: server.URL})
+	}
+
+	config := NewDefaultConfig()
+	config.RequestDelay = 0
+	config.MaxRetries = 3
+	config.MaxTotalRetries = 5
+	config.RetryBackoff = time.Millisecond
+
+	results := collectResults(servers, config)
+
+	// Every server is tried once, plus exactly the 5 budgeted retries
+	if requests != 15 {
+		t.Errorf("Expected 15 requests, got %d", requests)
+	}
+	var attempts int
+	for _, result := range results {
+		attempts += result.Attempts
+	}
+	if attempts != 15 {
+		t.Errorf("Expected 15 recorded attempts, got %d", attempts)
+	}
+}
+
+// Test that a truncated body is only retried when RetryDecode is set
+func TestFetchHealthDataWithRetryDecode(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.Write([]byte(mockResponse[:len(mockResponse)/2]))
+			return
+		}
+		w.Write([]byte(mockResponse))
+	}))
+	defer server.Close()
+
+	config := NewDefaultConfig()
+	config.MaxRetries = 2
+	config.RetryBackoff = time.Millisecond
+
+	_, meta, err := fetchHealthDataWithRetry(context.Background(), newHTTPClient(config), server.URL, config, newRetryBudget(0), nil)
+	if classifyError(err) != ErrorClassDecode || meta.Attempts != 1 {
+		t.Errorf("Expected a decode error without retries, got %v after %d attempts", err, meta.Attempts)
+	}
+
+	atomic.StoreInt32(&requests, 0)
+	config.RetryDecode = true
+	health, meta, err := fetchHealthDataWithRetry(context.Background(), newHTTPClient(config), server.URL, config, newRetryBudget(0), nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if meta.Attempts != 2 {
+		t.Errorf("Expected 2 attempts, got %d", meta.Attempts)
+	}
+	if health.Application == "" {
+		t.Errorf("Expected the retried response to decode, got %+v", health)
+	}
+}
+
+// Test that a check failing once reports the final attempt's latency, or the
+// total including the backoff in cumulative mode
+func TestLatencyMode(t *testing.T) {
+	const attemptDelay = 20 * time.Millisecond
+	const backoff = 100 * time.Millisecond
+
+	for _, mode := range []string{LatencyModeFinal, LatencyModeCumulative} {
+		var requests int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(attemptDelay)
+			if atomic.AddInt32(&requests, 1) == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte(mockResponse))
+		}))
+
+		config := NewDefaultConfig()
+		config.MaxRetries = 1
+		config.RetryBackoff = backoff
+		config.LatencyMode = mode
+
+		_, meta, err := fetchHealthDataWithRetry(context.Background(), newHTTPClient(config), server.URL, config, newRetryBudget(0), nil)
+		server.Close()
+		if err != nil || meta.Attempts != 2 {
+			t.Fatalf("Mode %s: expected success on the second attempt, got %d attempts, %v", mode, meta.Attempts, err)
+		}
+
+		switch mode {
+		case LatencyModeFinal:
+			if meta.Latency < attemptDelay || meta.Latency >= backoff {
+				t.Errorf("Mode %s: expected the latency of one attempt, got %v", mode, meta.Latency)
+			}
+		case LatencyModeCumulative:
+			if meta.Latency < 2*attemptDelay+backoff {
+				t.Errorf("Mode %s: expected both attempts and the backoff, got %v", mode, meta.Latency)
+			}
+		}
+	}
+}
+
+// Test that with RETRY_ON_RESET a connection reset is retried once straight
+// away, even without MAX_RETRIES, unless the check is a POST
+func TestRetryOnReset(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				t.Errorf("Failed to hijack the connection: %v", err)
+				return
+			}
+			// Closing with a zero linger sends a RST instead of a FIN
+			conn.(*net.TCPConn).SetLinger(0)
+			conn.Close()
+			return
+		}
+		w.Write([]byte(mockResponse))
+	}))
+	defer server.Close()
+
+	config := NewDefaultConfig()
+	config.RetryBackoff = time.Hour
+	config.RetryOnReset = true
+
+	_, meta, err := fetchHealthDataWithRetry(context.Background(), newHTTPClient(config), server.URL, config, newRetryBudget(0), nil)
+	if err != nil {
+		t.Fatalf("Expected the reset to be retried, got %v", err)
+	}
+	if meta.Attempts != 2 {
+		t.Errorf("Expected 2 attempts, got %d", meta.Attempts)
+	}
+
+	atomic.StoreInt32(&requests, 0)
+	config.HealthMethod = http.MethodPost
+	if _, meta, _ = fetchHealthDataWithRetry(context.Background(), newHTTPClient(config), server.URL, config, newRetryBudget(0), nil); meta.Attempts != 1 {
+		t.Errorf("Expected a POST not to be retried after a reset, got %d attempts", meta.Attempts)
+	}
+
+	atomic.StoreInt32(&requests, 0)
+	config.HealthMethod = http.MethodGet
+	config.RetryOnReset = NewDefaultConfig().RetryOnReset
+	_, meta, err = fetchHealthDataWithRetry(context.Background(), newHTTPClient(config), server.URL, config, newRetryBudget(0), nil)
+	if class := classifyError(err); class != ErrorClassReset {
+		t.Errorf("Expected class %q, got %q (%v)", ErrorClassReset, class, err)
+	}
+	if meta.Attempts != 1 {
+		t.Errorf("Expected 1 attempt without RETRY_ON_RESET, got %d", meta.Attempts)
+	}
+}
+
+// Test that RETRY_STATUS_CODES replaces the default retryable statuses
+func TestRetryStatusCodes(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.WriteHeader(http.StatusRequestTimeout)
+			return
+		}
+		w.Write([]byte(mockResponse))
+	}))
+	defer server.Close()
+
+	config := NewDefaultConfig()
+	config.MaxRetries = 2
+	config.RetryBackoff = time.Millisecond
+
+	if _, meta, err := fetchHealthDataWithRetry(context.Background(), newHTTPClient(config), server.URL, config, newRetryBudget(0), nil); err == nil || meta.Attempts != 1 {
+		t.Errorf("Expected a 408 not to be retried by default, got %d attempts, %v", meta.Attempts, err)
+	}
+
+	atomic.StoreInt32(&requests, 0)
+	config.RetryStatusCodes = parseRetryStatusCodes([]string{"408", "502", "503", "504"})
+	_, meta, err := fetchHealthDataWithRetry(context.Background(), newHTTPClient(config), server.URL, config, newRetryBudget(0), nil)
+	if err != nil || meta.Attempts != 2 {
+		t.Errorf("Expected a configured 408 to be retried, got %d attempts, %v", meta.Attempts, err)
+	}
+
+	// A 500 is no longer retried once the set excludes it
+	internal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer internal.Close()
+	if _, meta, _ := fetchHealthDataWithRetry(context.Background(), newHTTPClient(config), internal.URL, config, newRetryBudget(0), nil); meta.Attempts != 1 {
+		t.Errorf("Expected a 500 outside the set not to be retried, got %d attempts", meta.Attempts)
+	}
+
+	if codes := parseRetryStatusCodes([]string{"200", "abc", "600", "503"}); len(codes) != 1 || !codes[503] {
+		t.Errorf("Expected only 503 to be kept, got %v", codes)
+	}
+	if codes := parseRetryStatusCodes([]string{"302", "oops"}); codes != nil {
+		t.Errorf("Expected no valid codes to keep the default, got %v", codes)
+	}
+}
+
+// Test that MAX_TOTAL_REQUESTS stops further requests, retries included, and
+// marks the servers left over as skipped
+func TestRequestCeiling(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	var servers []ServerEntry
+	for i := 0; i < 10; i++ {
+		servers = append(servers, ServerEntry{Address: server.URL})
+	}
+
+	config := NewDefaultConfig()
+	config.RequestDelay = 0
+	config.MaxRetries = 2
+	config.MaxTotalRequests = 7
+	config.RetryBackoff = time.Millisecond
+
+	results := collectResults(servers, config)
+
+	if requests != 7 {
+		t.Errorf("Expected the ceiling of 7 requests, got %d", requests)
+	}
+	var attempts, skipped int
+	for _, result := range results {
+		attempts += result.Attempts
+		if result.ErrorClass == ErrorClassSkippedBudget {
+			skipped++
+			if result.Attempts != 0 {
+				t.Errorf("Expected a skipped server to record no attempts, got %+v", result)
+			}
+		}
+	}
+	if attempts != 7 {
+		t.Errorf("Expected 7 recorded attempts, got %d", attempts)
+	}
+	// Each checked server uses up to 3 attempts, so at least 3 servers and at
+	// most 7 were reached
+	if skipped < 3 || skipped > 7 {
+		t.Errorf("Expected between 3 and 7 skipped servers, got %d", skipped)
+	}
+
+	var ceiling *requestCeiling
+	if !ceiling.take() {
+		t.Error("Expected a nil ceiling to be unlimited")
+	}
+}
+
+// dropFirstListener closes the first connections it accepts straight away,
+// like a load balancer dropping TLS handshakes
+type dropFirstListener struct {
+	net.Listener
+	drops int32
+}
+
+func (l *dropFirstListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil || atomic.AddInt32(&l.drops, -1) < 0 {
+			return conn, err
+		}
+		conn.Close()
+	}
+}
+
+// Test that a transient TLS handshake failure is retried, unlike a
+// certificate that failed validation
+func TestRetryTLSHandshake(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(mockResponse))
+	}))
+	listener := &dropFirstListener{Listener: server.Listener, drops: 1}
+	server.Listener = listener
+	server.StartTLS()
+	defer server.Close()
+
+	config := NewDefaultConfig()
+	config.MaxRetries = 3
+	config.RetryBackoff = time.Millisecond
+	trusting := func() *http.Client {
+		client := newHTTPClient(config)
+		client.Transport.(*http.Transport).TLSClientConfig = server.Client().Transport.(*http.Transport).TLSClientConfig
+		return client
+	}
+
+	_, meta, err := fetchHealthDataWithRetry(context.Background(), trusting(), server.URL, config, newRetryBudget(0), nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if meta.Attempts != 2 {
+		t.Errorf("Expected 2 attempts, got %d", meta.Attempts)
+	}
+
+	// Not retried when disabled
+	config.RetryTLSHandshake = false
+	atomic.StoreInt32(&listener.drops, 1)
+	_, meta, err = fetchHealthDataWithRetry(context.Background(), trusting(), server.URL, config, newRetryBudget(0), nil)
+	if class := classifyError(err); class != ErrorClassTLSHandshake {
+		t.Errorf("Expected class %q, got %q (%v)", ErrorClassTLSHandshake, class, err)
+	}
+	if meta.Attempts != 1 {
+		t.Errorf("Expected 1 attempt, got %d", meta.Attempts)
+	}
+
+	// A certificate the client does not trust is never retried
+	config.RetryTLSHandshake = true
+	_, meta, err = fetchHealthDataWithRetry(context.Background(), newHTTPClient(config), server.URL, config, newRetryBudget(0), nil)
+	if class := classifyError(err); class != ErrorClassCertificate {
+		t.Errorf("Expected class %q, got %q (%v)", ErrorClassCertificate, class, err)
+	}
+	if meta.Attempts != 1 {
+		t.Errorf("Expected 1 attempt, got %d", meta.Attempts)
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// s3Target is a parsed s3://bucket/key output location
+type s3Target struct {
+	Bucket string
+	Key    string
+}
+
+// parseS3Target parses an s3://bucket/key output target. It reports false when
+// target is not an S3 URL.
+func parseS3Target(target string) (s3Target, bool, error) {
+	if !strings.HasPrefix(target, "s3://") {
+		return s3Target{}, false, nil
+	}
+	bucket, key, found := strings.Cut(strings.TrimPrefix(target, "s3://"), "/")
+	if !found || bucket == "" || key == "" {
+		return s3Target{}, true, fmt.Errorf("invalid S3 target %q, expected s3://bucket/key", target)
+	}
+	return s3Target{Bucket: bucket, Key: key}, true, nil
+}
+
+// s3Uploader writes objects to S3 or an S3-compatible endpoint with a single
+// SigV4-signed PUT request
+type s3Uploader struct {
+	client       *http.Client
+	endpoint     string
+	region       string
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	retries      int
+	backoff      time.Duration
+	now          func() time.Time
+}
+
+// newS3UploaderFromEnv creates an uploader using the standard AWS credential
+// environment variables
+func newS3UploaderFromEnv(config *Config) *s3Uploader {
+	endpoint := config.S3Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", config.S3Region)
+	}
+	return &s3Uploader{
+		client:       &http.Client{Timeout: config.HTTPTimeout},
+		endpoint:     strings.TrimSuffix(endpoint, "/"),
+		region:       config.S3Region,
+		accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		retries:      config.MaxRetries,
+		backoff:      config.RetryBackoff,
+		now:          time.Now,
+	}
+}
+
+// Put uploads data to the target, retrying failed attempts up to the
+// configured number of retries
+func (u *s3Uploader) Put(ctx context.Context, target s3Target, data []byte) error {
+	var err error
+	for attempt := 0; attempt <= u.retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(u.backoff):
+			}
+		}
+		if err = u.put(ctx, target, data); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+func (u *s3Uploader) put(ctx context.Context, target s3Target, data []byte) error {
+	objectURL, err := url.Parse(u.endpoint + "/" + target.Bucket + "/" + target.Key)
+	if err != nil {
+		return fmt.Errorf("invalid S3 endpoint %s: %v", u.endpoint, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, objectURL.String(), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	u.sign(req, data)
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to upload report to s3://%s/%s: %v", target.Bucket, target.Key, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("upload to s3://%s/%s returned status %d: %s", target.Bucket, target.Key, resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// sign adds AWS Signature Version 4 headers to req
+func (u *s3Uploader) sign(req *http.Request, payload []byte) {
+	now := u.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	payloadHash := sha256Hex(payload)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if u.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", u.sessionToken)
+	}
+
+	headers := map[string]string{
+		"host":                 req.URL.Host,
+		"x-amz-content-sha256": payloadHash,
+		"x-amz-date":           amzDate,
+	}
+	names := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	if u.sessionToken != "" {
+		headers["x-amz-security-token"] = u.sessionToken
+		names = append(names, "x-amz-security-token")
+	}
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := day + "/" + u.region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+u.secretKey), day)
+	key = hmacSHA256(key, u.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		u.accessKey, scope, signedHeaders, signature))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Test parsing of S3 output targets
+func TestParseS3Target(t *testing.T) {
+	target, ok, err := parseS3Target("s3://reports/fleet/report.json")
+	if err != nil || !ok {
+		t.Fatalf("Expected a valid S3 target, got ok=%v err=%v", ok, err)
+	}
+	if target.Bucket != "reports" || target.Key != "fleet/report.json" {
+		t.Errorf("Expected bucket 'reports' and key 'fleet/report.json', got %+v", target)
+	}
+
+	if _, ok, _ := parseS3Target("report.json"); ok {
+		t.Errorf("Expected a local path not to be treated as S3")
+	}
+	if _, _, err := parseS3Target("s3://reports"); err == nil {
+		t.Errorf("Expected an error for a target without a key")
+	}
+}
+
+// Test uploading a report to a mock S3 endpoint, retrying a failed attempt
+func TestS3UploaderPut(t *testing.T) {
+	var attempts int32
+	var gotPath, gotBody, gotAuth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if r.Method != http.MethodPut {
+			t.Errorf("Expected PUT, got %s", r.Method)
+		}
+		body, _ := io.ReadAll(r.Body)
+		gotPath, gotBody, gotAuth = r.URL.Path, string(body), r.Header.Get("Authorization")
+	}))
+	defer server.Close()
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	config := NewDefaultConfig()
+	config.S3Endpoint = server.URL
+	config.MaxRetries = 1
+	config.RetryBackoff = time.Millisecond
+
+	uploader := newS3UploaderFromEnv(config)
+	if err := uploader.Put(context.Background(), s3Target{Bucket: "reports", Key: "report.json"}, []byte(`{"applications":{}}`)); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if attempts != 2 {
+		t.Errorf("Expected 2 attempts, got %d", attempts)
+	}
+	if gotPath != "/reports/report.json" {
+		t.Errorf("Expected path /reports/report.json, got %s", gotPath)
+	}
+	if gotBody != `{"applications":{}}` {
+		t.Errorf("Expected report body, got %s", gotBody)
+	}
+	if !strings.HasPrefix(gotAuth, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/") {
+		t.Errorf("Expected SigV4 authorization header, got %s", gotAuth)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import "sync"
+
+// classTag is the server tag naming a host's class, e.g. class=edge
+const classTag = "class"
+
+// queuedServer is a server waiting in a classQueue along with its position
+// in the servers list
+type queuedServer struct {
+	seq   int
+	entry ServerEntry
+}
+
+// classQueue hands the servers to the workers, capping the concurrent checks
+// per host class. Each class with a configured limit is queued apart and the
+// earliest listed server whose class has a free slot goes next, so a class at
+// its limit waits without holding up workers the other classes could use.
+// Classes without a configured limit are not held back by it.
+type classQueue struct {
+	limits map[string]int
+
+	mu      sync.Mutex
+	ready   *sync.Cond
+	open    []queuedServer
+	queues  map[string][]queuedServer
+	running map[string]int
+}
+
+// newClassQueue queues servers for CLASS_CONCURRENCY
+func newClassQueue(servers []ServerEntry, limits map[string]int) *classQueue {
+	q := &classQueue{limits: limits, queues: make(map[string][]queuedServer), running: make(map[string]int)}
+	q.ready = sync.NewCond(&q.mu)
+	for i, entry := range servers {
+		queued := queuedServer{seq: i, entry: entry}
+		if class := entry.Tags[classTag]; q.limited(class) {
+			q.queues[class] = append(q.queues[class], queued)
+		} else {
+			q.open = append(q.open, queued)
+		}
+	}
+	return q
+}
+
+func (q *classQueue) limited(class string) bool {
+	_, ok := q.limits[class]
+	return ok
+}
+
+// next blocks until a server may be checked and returns it with the function
+// releasing its class slot. It reports false once every server was handed
+// out.
+func (q *classQueue) next() (ServerEntry, func(), bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for {
+		// The earliest listed of the open queue and the classes with a free
+		// slot; there are few classes, so they are simply scanned
+		pick, class, limited := -1, "", false
+		if len(q.open) > 0 {
+			pick = q.open[0].seq
+		}
+		for c, queue := range q.queues {
+			if len(queue) > 0 && q.running[c] < q.limits[c] && (pick < 0 || queue[0].seq < pick) {
+				pick, class, limited = queue[0].seq, c, true
+			}
+		}
+		switch {
+		case limited:
+			entry := q.queues[class][0].entry
+			q.queues[class] = q.queues[class][1:]
+			q.running[class]++
+			return entry, func() { q.release(class) }, true
+		case pick >= 0:
+			entry := q.open[0].entry
+			q.open = q.open[1:]
+			return entry, func() {}, true
+		case q.empty():
+			return ServerEntry{}, nil, false
+		}
+		q.ready.Wait()
+	}
+}
+
+// release frees a slot of class and wakes the workers waiting for one
+func (q *classQueue) release(class string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.running[class]--
+	q.ready.Broadcast()
+}
+
+// empty reports whether every server was handed out
+func (q *classQueue) empty() bool {
+	if len(q.open) > 0 {
+		return false
+	}
+	for _, queue := range q.queues {
+		if len(queue) > 0 {
+			return false
+		}
+	}
+	return true
+}
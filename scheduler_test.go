@@ -0,0 +1,113 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// concurrencyServer serves the mock health response slowly and records the
+// highest number of requests it handled at once
+type concurrencyServer struct {
+	*httptest.Server
+	mu      sync.Mutex
+	current int
+	peak    int
+}
+
+func newConcurrencyServer() *concurrencyServer {
+	s := &concurrencyServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.current++
+		if s.current > s.peak {
+			s.peak = s.current
+		}
+		s.mu.Unlock()
+
+		time.Sleep(50 * time.Millisecond)
+
+		s.mu.Lock()
+		s.current--
+		s.mu.Unlock()
+		w.Write([]byte(mockResponse))
+	}))
+	return s
+}
+
+// Test that each class is held to its own concurrency limit within the
+// global one
+func TestClassConcurrency(t *testing.T) {
+	edge := newConcurrencyServer()
+	defer edge.Close()
+	db := newConcurrencyServer()
+	defer db.Close()
+
+	var servers []ServerEntry
+	for i := 0; i < 6; i++ {
+		servers = append(servers,
+			ServerEntry{Address: edge.URL, Tags: map[string]string{"class": "edge"}},
+			ServerEntry{Address: db.URL, Tags: map[string]string{"class": "db"}},
+		)
+	}
+
+	config := NewDefaultConfig()
+	config.MaxConcurrency = 10
+	config.RequestDelay = 0
+	config.ClassConcurrency = map[string]int{"edge": 3, "db": 1}
+
+	results := collectResults(servers, config)
+	if len(results) != len(servers) {
+		t.Fatalf("Expected %d results, got %d", len(servers), len(results))
+	}
+	for _, result := range results {
+		if result.Error != "" {
+			t.Errorf("Expected no error, got %s", result.Error)
+		}
+	}
+	if db.peak != 1 {
+		t.Errorf("Expected db to be checked one at a time, peaked at %d", db.peak)
+	}
+	if edge.peak < 2 || edge.peak > 3 {
+		t.Errorf("Expected edge to peak between 2 and 3 concurrent checks, got %d", edge.peak)
+	}
+}
+
+// Test that a class at its limit does not hold up the servers of other
+// classes listed after it
+func TestClassConcurrencyNoHeadOfLineBlocking(t *testing.T) {
+	db := newConcurrencyServer()
+	defer db.Close()
+	edge := setupMockServer()
+	defer edge.Close()
+
+	var servers []ServerEntry
+	for i := 0; i < 6; i++ {
+		servers = append(servers, ServerEntry{Address: db.URL, Tags: map[string]string{"class": "db"}})
+	}
+	for i := 0; i < 6; i++ {
+		servers = append(servers, ServerEntry{Address: edge.URL, Tags: map[string]string{"class": "edge"}})
+	}
+
+	config := NewDefaultConfig()
+	config.MaxConcurrency = 4
+	config.RequestDelay = 0
+	config.ClassConcurrency = map[string]int{"db": 1}
+
+	var order []string
+	for _, result := range collectResults(servers, config) {
+		order = append(order, result.Tags["class"])
+	}
+	dbDone := 0
+	for _, class := range order {
+		if class == "db" {
+			dbDone++
+			continue
+		}
+		if dbDone > 1 {
+			t.Fatalf("Expected edge servers checked while db waits for its slot, got order %v", order)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// selfCheck tracks the tool's own health for the /healthz and /readyz
+// endpoints: it is live while the process serves requests and ready while
+// scan cycles keep completing
+type selfCheck struct {
+	maxAge time.Duration
+	now    func() time.Time
+
+	mu        sync.Mutex
+	lastCycle time.Time
+}
+
+// newSelfCheck creates a self check allowing READY_MAX_AGE between completed
+// cycles, by default three watch intervals plus RUN_TIMEOUT. Without a watch
+// interval a completed scan stays ready.
+func newSelfCheck(config *Config) *selfCheck {
+	maxAge := config.ReadyMaxAge
+	if maxAge <= 0 && config.WatchInterval > 0 {
+		maxAge = 3*config.WatchInterval + config.RunTimeout
+	}
+	return &selfCheck{maxAge: maxAge, now: time.Now}
+}
+
+// CycleCompleted records that a scan cycle completed
+func (c *selfCheck) CycleCompleted() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastCycle = c.now()
+}
+
+// ready reports whether a cycle completed recently enough, with the reason
+// when it did not
+func (c *selfCheck) ready() (bool, string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lastCycle.IsZero() {
+		return false, "no scan cycle completed yet"
+	}
+	if age := c.now().Sub(c.lastCycle); c.maxAge > 0 && age > c.maxAge {
+		return false, fmt.Sprintf("last scan cycle completed %v ago, over %v", age.Round(time.Second), c.maxAge)
+	}
+	return true, "ok"
+}
+
+// ServeLive implements /healthz: the process is alive if it answers
+func (c *selfCheck) ServeLive(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintln(w, "ok")
+}
+
+// ServeReady implements /readyz, failing with 503 while cycles stall
+func (c *selfCheck) ServeReady(w http.ResponseWriter, r *http.Request) {
+	ready, reason := c.ready()
+	if !ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	fmt.Fprintln(w, reason)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test that /readyz flips to not ready when cycles stall while /healthz stays live
+func TestSelfCheckEndpoints(t *testing.T) {
+	config := NewDefaultConfig()
+	config.MetricsAddr = ":0"
+	config.WatchInterval = time.Minute
+	config.RunTimeout = 30 * time.Second
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	self := newSelfCheck(config)
+	self.now = func() time.Time { return now }
+	mux := newMetricsMux(newMetricsRegistry(config), self, config)
+
+	get := func(path string) (int, string) {
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		return recorder.Code, recorder.Body.String()
+	}
+
+	if code, _ := get("/healthz"); code != http.StatusOK {
+		t.Errorf("Expected /healthz to be live, got status %d", code)
+	}
+	if code, body := get("/readyz"); code != http.StatusServiceUnavailable || !strings.Contains(body, "no scan cycle") {
+		t.Errorf("Expected /readyz to be unready before the first cycle, got %d: %s", code, body)
+	}
+
+	self.CycleCompleted()
+	now = now.Add(3 * time.Minute)
+	if code, body := get("/readyz"); code != http.StatusOK {
+		t.Errorf("Expected /readyz to be ready within 3m30s of a cycle, got %d: %s", code, body)
+	}
+
+	now = now.Add(time.Minute)
+	if code, body := get("/readyz"); code != http.StatusServiceUnavailable || !strings.Contains(body, "4m0s ago") {
+		t.Errorf("Expected /readyz to be unready once cycles stall, got %d: %s", code, body)
+	}
+	if code, _ := get("/healthz"); code != http.StatusOK {
+		t.Errorf("Expected /healthz to stay live while cycles stall, got status %d", code)
+	}
+
+	self.CycleCompleted()
+	if code, _ := get("/readyz"); code != http.StatusOK {
+		t.Errorf("Expected /readyz to recover after a completed cycle, got status %d", code)
+	}
+}
@@ -0,0 +1,438 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"math/rand"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// readServersPath reads the servers list from path. When path is a directory,
+// all *.txt files within it are read in name order and concatenated;
+// subdirectories are only descended into when recursive is set.
+func readServersPath(path string, recursive bool) ([]string, error) {
+	files, err := readServersFiles(path, recursive)
+	if err != nil {
+		return nil, err
+	}
+	var lines []string
+	for _, file := range files {
+		lines = append(lines, file.Lines...)
+	}
+	return lines, nil
+}
+
+// serversFile is a servers list file and its lines
+type serversFile struct {
+	Path  string
+	Lines []string
+}
+
+// readServersFiles reads the servers list files at path like
+// readServersPath, keeping the lines of each file apart so they can be
+// reported by file and line number
+func readServersFiles(path string, recursive bool) ([]serversFile, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		lines, err := readServersList(path)
+		if err != nil {
+			return nil, err
+		}
+		return []serversFile{{Path: path, Lines: lines}}, nil
+	}
+
+	var files []string
+	err = filepath.WalkDir(path, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if file != path && !recursive {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if filepath.Ext(file) == ".txt" {
+			files = append(files, file)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	var lists []serversFile
+	for _, file := range files {
+		lines, err := readServersList(file)
+		if err != nil {
+			return nil, err
+		}
+		lists = append(lists, serversFile{Path: file, Lines: lines})
+	}
+	return lists, nil
+}
+
+// normalizeHost lowercases the scheme and host of address and strips a
+// trailing dot from the host, and its port when stripPort is set. Any path is
+// kept as is.
+func normalizeHost(address string, stripPort bool) string {
+	scheme, rest := "", address
+	if i := strings.Index(address, "://"); i >= 0 {
+		scheme, rest = strings.ToLower(address[:i+3]), address[i+3:]
+	}
+	hostport, path := rest, ""
+	if i := strings.Index(rest, "/"); i >= 0 {
+		hostport, path = rest[:i], rest[i:]
+	}
+
+	host, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		host, port = strings.Trim(hostport, "[]"), ""
+	}
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+
+	switch {
+	case port != "" && !stripPort:
+		hostport = net.JoinHostPort(host, port)
+	case strings.Contains(host, ":"):
+		hostport = "[" + host + "]"
+	default:
+		hostport = host
+	}
+	return scheme + hostport + path
+}
+
+// normalizeServerEntries sets the normalized name of every entry so that
+// spellings of the same host are deduplicated and reported together
+func normalizeServerEntries(entries []ServerEntry, stripPort bool) []ServerEntry {
+	normalized := make([]ServerEntry, len(entries))
+	for i, entry := range entries {
+		entry.Name = normalizeHost(entry.Address, stripPort)
+		normalized[i] = entry
+	}
+	return normalized
+}
+
+// isServersDir reports whether the servers list at path is a directory of
+// list files
+func isServersDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// dedupeServers drops repeated addresses, keeping the first occurrence
+func dedupeServers(entries []ServerEntry) []ServerEntry {
+	seen := make(map[string]bool, len(entries))
+	var unique []ServerEntry
+	for _, entry := range entries {
+		if seen[entry.name()] {
+			continue
+		}
+		seen[entry.name()] = true
+		unique = append(unique, entry)
+	}
+	return unique
+}
+
+// ServerEntry is a parsed line of the servers list: an address optionally
+// followed by whitespace separated key=value tags and a trailing comment, e.g.
+//
+//	server-0001.example.org app=Memcache2 dc=us-east # decommission soon
+type ServerEntry struct {
+	Address string
+	Tags    map[string]string
+	// Name is the normalized address used for dedupe and reporting when
+	// NORMALIZE_HOSTS is enabled, or the inventory host name of an entry
+	// whose ansible_host differs; Address is still what gets requested
+	Name string
+}
+
+// name returns the identity of the entry: its normalized name if set, else
+// its address
+func (e ServerEntry) name() string {
+	if e.Name != "" {
+		return e.Name
+	}
+	return e.Address
+}
+
+// lineError is an error in a line of the servers list, located at Column,
+// the 1-based position of the offending field
+type lineError struct {
+	Column int
+	Err    error
+}
+
+func (e *lineError) Error() string {
+	return e.Err.Error()
+}
+
+// splitServerFields splits a line into whitespace separated fields, returning
+// the 1-based column each field starts at alongside. A field starting with
+// '#' begins a comment that runs to the end of the line, so a '#' within a
+// field (such as a URL fragment) is kept. Double quotes group a value
+// containing whitespace or '#', e.g. note="rack #4", and are removed.
+func splitServerFields(line string) ([]string, []int, error) {
+	var fields []string
+	var columns []int
+	var field strings.Builder
+	inField, inQuote := false, false
+	column, quoteColumn := 0, 0
+
+	for _, r := range line {
+		column++
+		if !inField && r != ' ' && r != '\t' && !(r == '#' && !inQuote) {
+			columns = append(columns, column)
+		}
+		switch {
+		case r == '"':
+			if !inQuote {
+				quoteColumn = column
+			}
+			inQuote = !inQuote
+			inField = true
+		case inQuote:
+			field.WriteRune(r)
+		case r == ' ' || r == '\t':
+			if inField {
+				fields = append(fields, field.String())
+				field.Reset()
+				inField = false
+			}
+		case r == '#' && !inField:
+			return fields, columns, nil
+		default:
+			field.WriteRune(r)
+			inField = true
+		}
+	}
+
+	if inQuote {
+		return nil, nil, &lineError{Column: quoteColumn, Err: fmt.Errorf("unterminated quote")}
+	}
+	if inField {
+		fields = append(fields, field.String())
+	}
+	return fields, columns, nil
+}
+
+// timeoutTag is the server tag overriding HTTP_TIMEOUT for that server, as a
+// Go duration such as timeout=5s
+const timeoutTag = "timeout"
+
+// parseTimeoutTag parses the value of a timeout tag, which must be a positive
+// duration
+func parseTimeoutTag(value string) (time.Duration, error) {
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout <= 0 {
+		return 0, fmt.Errorf("invalid %s %q, expected a positive duration such as 5s", timeoutTag, value)
+	}
+	return timeout, nil
+}
+
+// hostTag is the server tag setting the Host header sent to that server,
+// e.g. host=app.example.com on a server listed by IP
+const hostTag = "host"
+
+// portsTag is the server tag listing the ports a host runs instances on,
+// e.g. ports=8080,8081, each checked as a server of its own
+const portsTag = "ports"
+
+// parsePortsTag parses the value of a ports tag, a comma separated list of
+// ports from 1 to 65535
+func parsePortsTag(value string) ([]string, error) {
+	ports := splitList(value)
+	if len(ports) == 0 {
+		return nil, fmt.Errorf("invalid %s %q, expected ports such as 8080,8081", portsTag, value)
+	}
+	for _, port := range ports {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return nil, fmt.Errorf("invalid port %q in %s %q", port, portsTag, value)
+		}
+	}
+	return ports, nil
+}
+
+// checkServerTag returns an error when value is invalid for the tag key
+func checkServerTag(key, value string) error {
+	var err error
+	switch key {
+	case timeoutTag:
+		_, err = parseTimeoutTag(value)
+	case portsTag:
+		_, err = parsePortsTag(value)
+	}
+	return err
+}
+
+// withPort returns address with its port replaced by port, keeping any
+// scheme and path
+func withPort(address, port string) string {
+	if strings.Contains(address, "://") {
+		if u, err := url.Parse(address); err == nil && u.Host != "" {
+			u.Host = net.JoinHostPort(u.Hostname(), port)
+			return u.String()
+		}
+	}
+	host, rest := address, ""
+	if i := strings.Index(host, "/"); i >= 0 {
+		host, rest = host[:i], host[i:]
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return net.JoinHostPort(strings.Trim(host, "[]"), port) + rest
+}
+
+// expandPorts returns entries with every entry carrying a ports tag replaced
+// by one entry per port, so each instance is checked, and counted, like a
+// server listed on its own line. Entries with an invalid ports tag are kept
+// as they are.
+func expandPorts(entries []ServerEntry) []ServerEntry {
+	expanded := make([]ServerEntry, 0, len(entries))
+	for _, entry := range entries {
+		value, tagged := entry.Tags[portsTag]
+		ports, err := parsePortsTag(value)
+		if !tagged || err != nil {
+			expanded = append(expanded, entry)
+			continue
+		}
+		tags := make(map[string]string, len(entry.Tags)-1)
+		for key, value := range entry.Tags {
+			if key != portsTag {
+				tags[key] = value
+			}
+		}
+		for _, port := range ports {
+			instance := ServerEntry{Address: withPort(entry.Address, port), Tags: tags}
+			if entry.Name != "" {
+				instance.Name = withPort(entry.Name, port)
+			}
+			expanded = append(expanded, instance)
+		}
+	}
+	return expanded
+}
+
+// configFor returns the configuration used to check entry: config itself, or
+// a copy with HTTPTimeout replaced by the entry's timeout tag and HostHeader
+// by its host tag
+func configFor(entry ServerEntry, config *Config) *Config {
+	serverConfig := *config
+	overridden := false
+	if value, ok := entry.Tags[timeoutTag]; ok {
+		if timeout, err := parseTimeoutTag(value); err == nil {
+			serverConfig.HTTPTimeout = timeout
+			overridden = true
+		}
+	}
+	if host := entry.Tags[hostTag]; host != "" {
+		serverConfig.HostHeader = host
+		overridden = true
+	}
+	if !overridden {
+		return config
+	}
+	return &serverConfig
+}
+
+// parseServerLine parses a single line of the servers list. It reports false
+// for blank lines and full-line comments.
+func parseServerLine(line string) (ServerEntry, bool, error) {
+	fields, columns, err := splitServerFields(line)
+	if err != nil {
+		return ServerEntry{}, false, err
+	}
+	if len(fields) == 0 {
+		return ServerEntry{}, false, nil
+	}
+
+	entry := ServerEntry{Address: fields[0]}
+	for i, field := range fields[1:] {
+		key, value, found := strings.Cut(field, "=")
+		if !found || key == "" {
+			return ServerEntry{}, false, &lineError{Column: columns[i+1], Err: fmt.Errorf("invalid tag %q, expected key=value", field)}
+		}
+		if err := checkServerTag(key, value); err != nil {
+			return ServerEntry{}, false, &lineError{Column: columns[i+1], Err: err}
+		}
+		if entry.Tags == nil {
+			entry.Tags = make(map[string]string)
+		}
+		entry.Tags[key] = value
+	}
+	return entry, true, nil
+}
+
+// parseServerEntries parses the lines of a servers list, skipping blank lines
+// and comments
+func parseServerEntries(lines []string) ([]ServerEntry, error) {
+	var entries []ServerEntry
+	for i, line := range lines {
+		entry, ok, err := parseServerLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+1, err)
+		}
+		if ok {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// selectServers returns the entries that should be contacted. When TargetApp
+// is set only servers tagged with that app are kept; untagged servers are kept
+// unless TargetAppStrict is enabled.
+func selectServers(entries []ServerEntry, config *Config) []ServerEntry {
+	if config.TargetApp == "" {
+		return entries
+	}
+
+	var selected []ServerEntry
+	for _, entry := range entries {
+		app, tagged := entry.Tags["app"]
+		if (tagged && app == config.TargetApp) || (!tagged && !config.TargetAppStrict) {
+			selected = append(selected, entry)
+		}
+	}
+	return selected
+}
+
+// healthPathFor returns the health path queried on entry: its own path tag,
+// else the path mapped to its app tag, else the global HealthPath
+func healthPathFor(entry ServerEntry, config *Config) string {
+	path := config.HealthPath
+	if mapped, ok := config.HealthPaths[entry.Tags["app"]]; ok {
+		path = mapped
+	}
+	if tagged, ok := entry.Tags["path"]; ok && tagged != "" {
+		path = tagged
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return path
+}
+
+// shuffleServers returns a copy of entries in a random order derived from
+// seed, so partial scans sample the fleet evenly instead of favouring the top
+// of the file
+func shuffleServers(entries []ServerEntry, seed int64) []ServerEntry {
+	shuffled := append([]ServerEntry(nil), entries...)
+	rng := rand.New(rand.NewSource(seed))
+	rng.Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+	return shuffled
+}
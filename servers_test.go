@@ -0,0 +1,501 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Test parsing server lines with tags, blank lines and comments
+func TestParseServerEntries(t *testing.T) {
+	lines := []string{
+		"# inventory",
+		"server-0001.example.org app=Memcache2 dc=us-east",
+		"",
+		"server-0002.example.org",
+	}
+
+	entries, err := parseServerEntries(lines)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 entries, got %d", len(entries))
+	}
+	if entries[0].Address != "server-0001.example.org" || entries[0].Tags["app"] != "Memcache2" || entries[0].Tags["dc"] != "us-east" {
+		t.Errorf("Expected tagged entry, got %+v", entries[0])
+	}
+	if entries[1].Address != "server-0002.example.org" || len(entries[1].Tags) != 0 {
+		t.Errorf("Expected untagged entry, got %+v", entries[1])
+	}
+
+	if _, err := parseServerEntries([]string{"server-0001.example.org notatag"}); err == nil {
+		t.Errorf("Expected an error for a malformed tag")
+	}
+}
+
+// Test that TARGET_APP only contacts matching servers
+func TestSelectServersTargetApp(t *testing.T) {
+	var hits [3]int32
+	var servers []ServerEntry
+	tags := []string{"app=Memcache2", "app=Cassandra", ""}
+	for i := range hits {
+		i := i
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&hits[i], 1)
+			w.Write([]byte(mockResponse))
+		}))
+		defer server.Close()
+
+		entry, _, err := parseServerLine(fmt.Sprintf("%s %s", server.URL, tags[i]))
+		if err != nil {
+			t.Fatalf("Failed to parse server line: %v", err)
+		}
+		servers = append(servers, entry)
+	}
+
+	config := NewDefaultConfig()
+	config.RequestDelay = 0
+	config.TargetApp = "Memcache2"
+
+	collectResults(selectServers(servers, config), config)
+	if hits != [3]int32{1, 0, 1} {
+		t.Errorf("Expected only the matching and untagged servers to be contacted, got %v", hits)
+	}
+
+	config.TargetAppStrict = true
+	collectResults(selectServers(servers, config), config)
+	if hits != [3]int32{2, 0, 1} {
+		t.Errorf("Expected only the matching server to be contacted in strict mode, got %v", hits)
+	}
+}
+
+// Test that shuffling is deterministic for a given seed and keeps every server
+func TestShuffleServers(t *testing.T) {
+	var entries []ServerEntry
+	for i := 0; i < 20; i++ {
+		entries = append(entries, ServerEntry{Address: fmt.Sprintf("server-%04d", i)})
+	}
+
+	first := shuffleServers(entries, 42)
+	second := shuffleServers(entries, 42)
+	other := shuffleServers(entries, 7)
+
+	seen := make(map[string]bool)
+	sameOrder, sameAsOther, sameAsInput := true, true, true
+	for i := range entries {
+		seen[first[i].Address] = true
+		sameOrder = sameOrder && first[i].Address == second[i].Address
+		sameAsOther = sameAsOther && first[i].Address == other[i].Address
+		sameAsInput = sameAsInput && first[i].Address == entries[i].Address
+	}
+
+	if !sameOrder {
+		t.Errorf("Expected the same seed to produce the same order")
+	}
+	if sameAsOther || sameAsInput {
+		t.Errorf("Expected a different order for a different seed and from the input")
+	}
+	if len(seen) != len(entries) {
+		t.Errorf("Expected all %d servers after shuffling, got %d", len(entries), len(seen))
+	}
+	if entries[0].Address != "server-0000" {
+		t.Errorf("Expected the input to be left untouched")
+	}
+}
+
+// Test reading the servers list from a directory of list files
+func TestReadServersPathDirectory(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"b-web.txt":        "server-0003.example.org\nserver-0001.example.org\n",
+		"a-cache.txt":      "server-0001.example.org\nserver-0002.example.org\n",
+		"notes.md":         "server-9999.example.org\n",
+		"nested/extra.txt": "server-0004.example.org\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	addresses := func(recursive bool) []string {
+		lines, err := readServersPath(dir, recursive)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		entries, err := parseServerEntries(lines)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		var result []string
+		for _, entry := range dedupeServers(entries) {
+			result = append(result, entry.Address)
+		}
+		return result
+	}
+
+	expected := []string{"server-0001.example.org", "server-0002.example.org", "server-0003.example.org"}
+	if got := addresses(false); fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+
+	expected = append(expected, "server-0004.example.org")
+	if got := addresses(true); fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Errorf("Expected %v with recursion, got %v", expected, got)
+	}
+}
+
+// Test trailing comments, quoted values and URL fragments in server lines
+func TestParseServerLineComments(t *testing.T) {
+	tests := []struct {
+		line    string
+		address string
+		tags    map[string]string
+	}{
+		{"server-0001.example.org # decommission soon", "server-0001.example.org", nil},
+		{"server-0001.example.org app=Memcache2 #note", "server-0001.example.org", map[string]string{"app": "Memcache2"}},
+		{"https://server-0001.example.org/status#frag", "https://server-0001.example.org/status#frag", nil},
+		{`server-0001.example.org note="rack #4" # moved`, "server-0001.example.org", map[string]string{"note": "rack #4"}},
+	}
+
+	for _, tt := range tests {
+		entry, ok, err := parseServerLine(tt.line)
+		if err != nil || !ok {
+			t.Errorf("%q: expected an entry, got ok=%v err=%v", tt.line, ok, err)
+			continue
+		}
+		if entry.Address != tt.address {
+			t.Errorf("%q: expected address %s, got %s", tt.line, tt.address, entry.Address)
+		}
+		if fmt.Sprint(entry.Tags) != fmt.Sprint(tt.tags) && len(entry.Tags)+len(tt.tags) > 0 {
+			t.Errorf("%q: expected tags %v, got %v", tt.line, tt.tags, entry.Tags)
+		}
+	}
+
+	for _, line := range []string{"# full line comment", "   # indented comment", ""} {
+		if _, ok, err := parseServerLine(line); ok || err != nil {
+			t.Errorf("%q: expected the line to be skipped, got ok=%v err=%v", line, ok, err)
+		}
+	}
+
+	if _, _, err := parseServerLine(`server-0001.example.org note="unterminated`); err == nil {
+		t.Errorf("Expected an error for an unterminated quote")
+	}
+}
+
+// Test that each server is queried at the health path of its application
+func TestHealthPathPerApplication(t *testing.T) {
+	var mu sync.Mutex
+	paths := map[string]string{}
+	handler := func(app string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			paths[app] = r.URL.Path
+			mu.Unlock()
+			w.Write([]byte(mockResponse))
+		}
+	}
+	search := httptest.NewServer(handler("Search"))
+	defer search.Close()
+	web := httptest.NewServer(handler("Web"))
+	defer web.Close()
+	other := httptest.NewServer(handler("Other"))
+	defer other.Close()
+	pinned := httptest.NewServer(handler("Pinned"))
+	defer pinned.Close()
+
+	config := NewDefaultConfig()
+	config.RequestDelay = 0
+	config.HealthPaths = map[string]string{"Search": "/status", "Web": "health"}
+	collectResults([]ServerEntry{
+		{Address: search.URL, Tags: map[string]string{"app": "Search"}},
+		{Address: web.URL, Tags: map[string]string{"app": "Web"}},
+		{Address: other.URL, Tags: map[string]string{"app": "Other"}},
+		{Address: pinned.URL, Tags: map[string]string{"app": "Search", "path": "/ready"}},
+	}, config)
+
+	expected := map[string]string{"Search": "/status", "Web": "/health", "Other": "/healthz", "Pinned": "/ready"}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("Expected paths %v, got %v", expected, paths)
+	}
+}
+
+// Test hostname normalization of case, trailing dots and ports
+func TestNormalizeHost(t *testing.T) {
+	tests := []struct {
+		address   string
+		stripPort bool
+		expected  string
+	}{
+		{"Server-0001.Example.ORG", false, "server-0001.example.org"},
+		{"server-0001.example.org.", false, "server-0001.example.org"},
+		{"server-0001.example.org.:8443", false, "server-0001.example.org:8443"},
+		{"server-0001.example.org:8443", true, "server-0001.example.org"},
+		{"HTTPS://Server-0001.example.org.:8443/Path", true, "https://server-0001.example.org/Path"},
+		{"[::1]:8080", true, "[::1]"},
+		{"[::1]:8080", false, "[::1]:8080"},
+	}
+	for _, tt := range tests {
+		if got := normalizeHost(tt.address, tt.stripPort); got != tt.expected {
+			t.Errorf("normalizeHost(%q, %v) = %q, expected %q", tt.address, tt.stripPort, got, tt.expected)
+		}
+	}
+}
+
+// Test that normalized entries are deduplicated while keeping the original
+// address for the request
+func TestNormalizeServerEntriesDedupe(t *testing.T) {
+	entries := []ServerEntry{
+		{Address: "Server-0001.example.org:8443"},
+		{Address: "server-0001.example.org."},
+		{Address: "server-0002.example.org"},
+	}
+	if unique := dedupeServers(normalizeServerEntries(entries, false)); len(unique) != 3 {
+		t.Errorf("Expected ports to keep servers apart, got %v", unique)
+	}
+
+	unique := dedupeServers(normalizeServerEntries(entries, true))
+	if len(unique) != 2 {
+		t.Fatalf("Expected 2 servers, got %v", unique)
+	}
+	if unique[0].Address != "Server-0001.example.org:8443" || unique[0].name() != "server-0001.example.org" {
+		t.Errorf("Expected the original address kept for the request, got %+v", unique[0])
+	}
+}
+
+// Test that a timeout tag overrides HTTP_TIMEOUT for its server only
+func TestServerTimeoutTag(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(300 * time.Millisecond)
+		w.Write([]byte(mockResponse))
+	}))
+	defer server.Close()
+
+	lines := []string{server.URL + " role=global", server.URL + " role=patient timeout=2s"}
+	servers, err := parseServerEntries(lines)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	config := NewDefaultConfig()
+	config.HTTPTimeout = 100 * time.Millisecond
+
+	resultChannel := make(chan ServerResult, len(servers))
+	go fetchHealthDataWithDelayAndConcurrency(context.Background(), servers, resultChannel, config, nil)
+	results := make(map[string]ServerResult)
+	for r := range resultChannel {
+		results[r.Tags["role"]] = r
+	}
+
+	if r := results["global"]; r.ErrorClass != ErrorClassTimeout {
+		t.Errorf("Expected the server without a tag to time out, got %q (%s)", r.ErrorClass, r.Error)
+	}
+	if r := results["patient"]; r.Health == nil {
+		t.Errorf("Expected the server with timeout=2s to answer, got %s", r.Error)
+	}
+
+	for _, value := range []string{"5", "soon", "-1s", "0s"} {
+		if _, _, err := parseServerLine("server-0001.example.org timeout=" + value); err == nil {
+			t.Errorf("Expected timeout=%s to be rejected", value)
+		}
+	}
+}
+
+// Test that the host tag, else HOST_HEADER, sets the Host header while the
+// connection still goes to the listed address
+func TestHostHeader(t *testing.T) {
+	var mu sync.Mutex
+	hosts := make(map[string]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hosts[r.URL.Query().Get("role")] = r.Host
+		mu.Unlock()
+		w.Write([]byte(mockResponse))
+	}))
+	defer server.Close()
+	address := strings.TrimPrefix(server.URL, "http://")
+
+	config := NewDefaultConfig()
+	config.RequestDelay = 0
+	config.HostHeader = "default.example.com"
+	servers := []ServerEntry{
+		{Address: server.URL, Tags: map[string]string{"path": "/healthz?role=tagged", "host": "app.example.com"}},
+		{Address: server.URL, Tags: map[string]string{"path": "/healthz?role=global"}},
+	}
+	resultChannel := make(chan ServerResult, len(servers))
+	fetchHealthDataWithDelayAndConcurrency(context.Background(), servers, resultChannel, config, nil)
+	for result := range resultChannel {
+		if result.Error != "" {
+			t.Errorf("Expected %s to be checked, got %s", result.URL, result.Error)
+		}
+	}
+
+	if hosts["tagged"] != "app.example.com" || hosts["global"] != "default.example.com" {
+		t.Errorf("Expected the tagged and global Host headers, got %v", hosts)
+	}
+
+	config.HostHeader = ""
+	resultChannel = make(chan ServerResult, 1)
+	fetchHealthDataWithDelayAndConcurrency(context.Background(), servers[1:], resultChannel, config, nil)
+	<-resultChannel
+	if hosts["global"] != address {
+		t.Errorf("Expected the address as Host by default, got %s", hosts["global"])
+	}
+
+	// Over HTTPS the host is also the TLS server name, sent as SNI and
+	// verified against the certificate, issued for example.com
+	var serverName string
+	tlsServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		serverName = r.TLS.ServerName
+		mu.Unlock()
+		w.Write([]byte(mockResponse))
+	}))
+	tlsServer.StartTLS()
+	defer tlsServer.Close()
+	pool := x509.NewCertPool()
+	pool.AddCert(tlsServer.Certificate())
+	base := newHTTPClient(config)
+	base.Transport.(*http.Transport).TLSClientConfig = &tls.Config{RootCAs: pool}
+	clients := newServerNameClients(base, nil)
+
+	config.HostHeader = "example.com:443"
+	if _, _, err := fetchHealthData(context.Background(), clients.get(config.HostHeader), tlsServer.URL, config); err != nil {
+		t.Fatalf("Expected the certificate to verify against the host, got %v", err)
+	}
+	if serverName != "example.com" {
+		t.Errorf("Expected example.com as TLS server name, got %q", serverName)
+	}
+	config.HostHeader = "app.internal"
+	if _, _, err := fetchHealthData(context.Background(), clients.get(config.HostHeader), tlsServer.URL, config); err == nil || !strings.Contains(err.Error(), "app.internal") {
+		t.Errorf("Expected the certificate to be refused for app.internal, got %v", err)
+	}
+	if clients.get("") != clients.get("") || clients.get("example.com") == clients.get("") {
+		t.Errorf("Expected a client per server name, reused across checks")
+	}
+}
+
+// Test that a server with a timeout tag keeps what the other servers' client
+// adds: the bearer token of AUTH_TOKEN_COMMAND and the host as Host header and
+// TLS server name
+func TestServerTimeoutTagKeepsClient(t *testing.T) {
+	var mu sync.Mutex
+	var authorization, host string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		authorization, host = r.Header.Get("Authorization"), r.Host
+		mu.Unlock()
+		w.Write([]byte(mockResponse))
+	}))
+	defer server.Close()
+	tlsServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(mockResponse))
+	}))
+	defer tlsServer.Close()
+
+	config := NewDefaultConfig()
+	config.RequestDelay = 0
+	config.AuthTokenCommand = "echo s3cr3t-token"
+	state := &scanState{token: newCommandToken(config)}
+	if err := state.token.Refresh(context.Background()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	servers := []ServerEntry{
+		{Address: server.URL, Tags: map[string]string{"timeout": "2s", "host": "app.example.com"}},
+		{Address: tlsServer.URL, Tags: map[string]string{"timeout": "2s", "host": "app.internal"}},
+	}
+	resultChannel := make(chan ServerResult, len(servers))
+	fetchHealthDataWithDelayAndConcurrency(context.Background(), servers, resultChannel, config, state)
+	results := make(map[string]ServerResult)
+	for result := range resultChannel {
+		results[result.URL] = result
+	}
+
+	if result := results[server.URL+config.HealthPath]; result.Error != "" {
+		t.Errorf("Expected the server to be checked, got %s", result.Error)
+	}
+	if authorization != "Bearer s3cr3t-token" || host != "app.example.com" {
+		t.Errorf("Expected the token and Host header with a timeout tag, got %q and %q", authorization, host)
+	}
+	// The test certificate is not trusted, but the name is verified first
+	if result := results[tlsServer.URL+config.HealthPath]; !strings.Contains(result.Error, "app.internal") {
+		t.Errorf("Expected the certificate to be verified against the host tag, got %s", result.Error)
+	}
+}
+
+// Test that every port of a ports tag is checked and the instances summed
+func TestServerPortsTag(t *testing.T) {
+	var mu sync.Mutex
+	contacted := make(map[string]int)
+	var ports []string
+	for i := 0; i < 3; i++ {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			contacted[r.Host]++
+			mu.Unlock()
+			w.Write([]byte(mockResponse))
+		}))
+		defer server.Close()
+		_, port, _ := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+		ports = append(ports, port)
+	}
+
+	servers, err := parseServerEntries([]string{"http://127.0.0.1 app=Web ports=" + strings.Join(ports, ",")})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	config := NewDefaultConfig()
+	config.RequestDelay = 0
+	resultChannel := make(chan ServerResult, len(ports))
+	fetchHealthDataWithDelayAndConcurrency(context.Background(), servers, resultChannel, config, nil)
+
+	var data []AggregatedData
+	var health HealthResponse
+	for result := range resultChannel {
+		if result.Health == nil {
+			t.Fatalf("Expected %s to be checked, got %s", result.URL, result.Error)
+		}
+		if _, tagged := result.Tags[portsTag]; tagged || result.Tags["app"] != "Web" {
+			t.Errorf("Expected the other tags without ports, got %v", result.Tags)
+		}
+		health = *result.Health
+		data = append(data, toAggregatedData(health))
+	}
+	for _, port := range ports {
+		if contacted["127.0.0.1:"+port] != 1 {
+			t.Errorf("Expected port %s to be contacted once, got %v", port, contacted)
+		}
+	}
+	agg := aggregateData(data)[health.Application][health.Version]
+	if agg.TotalRequests != 3*health.RequestCount {
+		t.Errorf("Expected the three instances summed to %d requests, got %d", 3*health.RequestCount, agg.TotalRequests)
+	}
+
+	if got := withPort("https://[::1]:9000/base", "8080"); got != "https://[::1]:8080/base" {
+		t.Errorf("Expected the port replaced, got %s", got)
+	}
+	if got := withPort("server-0001.example.org:9000", "8080"); got != "server-0001.example.org:8080" {
+		t.Errorf("Expected the port replaced, got %s", got)
+	}
+	for _, value := range []string{"", "8080,http", "0", "65536"} {
+		if _, _, err := parseServerLine("server-0001.example.org ports=" + value); err == nil {
+			t.Errorf("Expected ports=%s to be rejected", value)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"time"
+)
+
+// serverListCache keeps the parsed servers list between watch cycles. A file
+// is only parsed again once its modification time or size changes; a
+// directory, whose own modification time does not change when a file in it
+// is edited, is read again every SERVERS_RELOAD_INTERVAL.
+type serverListCache struct {
+	load func(config *Config) ([]ServerEntry, error)
+	now  func() time.Time
+
+	loaded   bool
+	modTime  time.Time
+	size     int64
+	loadedAt time.Time
+	entries  []ServerEntry
+}
+
+// newServerListCache creates an empty cache loading with loadServerEntries
+func newServerListCache() *serverListCache {
+	return &serverListCache{load: loadServerEntries, now: time.Now}
+}
+
+// Load returns the servers of SERVERS_FILE, parsing it only when it changed.
+// Reloads after the first load are logged, those of a directory when its
+// servers changed.
+func (c *serverListCache) Load(config *Config) ([]ServerEntry, error) {
+	info, err := os.Stat(config.ServersFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read servers list: %v", err)
+	}
+	if c.loaded {
+		if info.IsDir() {
+			if c.now().Sub(c.loadedAt) < config.ServersReloadInterval {
+				return append([]ServerEntry(nil), c.entries...), nil
+			}
+		} else if info.ModTime().Equal(c.modTime) && info.Size() == c.size {
+			return append([]ServerEntry(nil), c.entries...), nil
+		}
+	}
+
+	entries, err := c.load(config)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case !c.loaded:
+	case !info.IsDir():
+		fmt.Fprintf(config.Console, "Servers list %s changed, reloaded %d servers\n", config.ServersFile, len(entries))
+	case !reflect.DeepEqual(entries, c.entries):
+		// A directory is read on every interval, so only a change is logged
+		fmt.Fprintf(config.Console, "Servers directory %s changed, reloaded %d servers\n", config.ServersFile, len(entries))
+	}
+	c.loaded = true
+	c.modTime, c.size, c.loadedAt = info.ModTime(), info.Size(), c.now()
+	c.entries = entries
+	return append([]ServerEntry(nil), entries...), nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test that a servers file is parsed again only after it is modified
+func TestServerListCacheFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "servers.txt")
+	if err := os.WriteFile(path, []byte("server-0001.example.org\n"), 0644); err != nil {
+		t.Fatalf("Failed to write servers list: %v", err)
+	}
+	config := NewDefaultConfig()
+	config.ServersFile = path
+
+	loads := 0
+	cache := newServerListCache()
+	cache.load = func(config *Config) ([]ServerEntry, error) {
+		loads++
+		return loadServerEntries(config)
+	}
+
+	for i := 0; i < 3; i++ {
+		if entries, err := cache.Load(config); err != nil || len(entries) != 1 {
+			t.Fatalf("Expected 1 server, got %d, %v", len(entries), err)
+		}
+	}
+	if loads != 1 {
+		t.Errorf("Expected a single parse while the file is unchanged, got %d", loads)
+	}
+
+	if err := os.WriteFile(path, []byte("server-0001.example.org\nserver-0002.example.org\n"), 0644); err != nil {
+		t.Fatalf("Failed to write servers list: %v", err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatalf("Failed to touch servers list: %v", err)
+	}
+	entries, err := cache.Load(config)
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("Expected the modified list of 2 servers, got %d, %v", len(entries), err)
+	}
+	if loads != 2 {
+		t.Errorf("Expected a parse after the modification, got %d", loads)
+	}
+}
+
+// Test that a servers directory is read again once the reload interval passes
+func TestServerListCacheDirectory(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "eu.txt"), []byte("server-0001.example.org\n"), 0644); err != nil {
+		t.Fatalf("Failed to write servers list: %v", err)
+	}
+	config := NewDefaultConfig()
+	config.ServersFile = dir
+	config.ServersReloadInterval = time.Minute
+
+	now := time.Now()
+	loads := 0
+	cache := newServerListCache()
+	cache.now = func() time.Time { return now }
+	cache.load = func(config *Config) ([]ServerEntry, error) {
+		loads++
+		return loadServerEntries(config)
+	}
+
+	cache.Load(config)
+	now = now.Add(30 * time.Second)
+	cache.Load(config)
+	if loads != 1 {
+		t.Errorf("Expected no read within the reload interval, got %d", loads)
+	}
+	now = now.Add(time.Minute)
+	cache.Load(config)
+	if loads != 2 {
+		t.Errorf("Expected a read once the reload interval passed, got %d", loads)
+	}
+
+	// A read that finds new servers is logged
+	var console bytes.Buffer
+	config.Console = &console
+	now = now.Add(time.Minute)
+	cache.Load(config)
+	if console.Len() != 0 {
+		t.Errorf("Expected an unchanged directory not to be logged, got %q", console.String())
+	}
+	if err := os.WriteFile(filepath.Join(dir, "us.txt"), []byte("server-0002.example.org\n"), 0644); err != nil {
+		t.Fatalf("Failed to write servers list: %v", err)
+	}
+	now = now.Add(time.Minute)
+	if entries, _ := cache.Load(config); len(entries) != 2 {
+		t.Errorf("Expected the new file to be read, got %d servers", len(entries))
+	}
+	if !strings.Contains(console.String(), "changed, reloaded 2 servers") {
+		t.Errorf("Expected the reload to be logged, got %q", console.String())
+	}
+}
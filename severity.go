@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Severity levels assigned to each application/version
+const (
+	SeverityCritical = "critical"
+	SeverityWarning  = "warning"
+	SeverityOK       = "ok"
+	// SeverityInsufficientData marks records with fewer than MIN_REQUESTS
+	// requests; they are reported but never alerted on
+	SeverityInsufficientData = "insufficient_data"
+)
+
+// severityOrder lists severities from most to least urgent for the console summary
+var severityOrder = []string{SeverityCritical, SeverityWarning, SeverityOK, SeverityInsufficientData}
+
+// successRate returns the success rate of d as a percentage, or 0 when no
+// requests were recorded
+func successRate(d AggregatedData) float64 {
+	if d.TotalRequests == 0 {
+		return 0
+	}
+	return float64(d.TotalSuccesses) / float64(d.TotalRequests) * 100
+}
+
+// classifySeverity maps a success rate onto a severity band. A rate equal to a
+// threshold belongs to the healthier band.
+func classifySeverity(rate float64, config *Config) string {
+	switch {
+	case rate < config.CriticalThreshold:
+		return SeverityCritical
+	case rate < config.WarningThreshold:
+		return SeverityWarning
+	default:
+		return SeverityOK
+	}
+}
+
+// Curves scaling the failure rate by request volume before classification
+const (
+	VolumeCurveNone   = "none"
+	VolumeCurveLinear = "linear"
+	VolumeCurveSqrt   = "sqrt"
+	VolumeCurveLog    = "log"
+)
+
+// volumeWeight returns the factor the failure rate of a record with requests
+// requests is scaled by: 1 at VolumeReference, growing with volume along
+// VolumeCurve and bounded to [1/VolumeMaxWeight, VolumeMaxWeight]
+func volumeWeight(requests int64, config *Config) float64 {
+	if config.VolumeCurve == VolumeCurveNone || config.VolumeCurve == "" || config.VolumeReference <= 0 {
+		return 1
+	}
+	ratio := float64(requests) / float64(config.VolumeReference)
+	var weight float64
+	switch config.VolumeCurve {
+	case VolumeCurveLinear:
+		weight = ratio
+	case VolumeCurveSqrt:
+		weight = math.Sqrt(ratio)
+	case VolumeCurveLog:
+		weight = 1 + math.Log10(ratio)
+	default:
+		return 1
+	}
+	maxWeight := config.VolumeMaxWeight
+	if maxWeight < 1 {
+		maxWeight = 1
+	}
+	return math.Max(1/maxWeight, math.Min(weight, maxWeight))
+}
+
+// severityRate returns the rate d is classified on: its success rate with
+// the failure rate scaled by volumeWeight
+func severityRate(d AggregatedData, config *Config) float64 {
+	failure := (100 - successRate(d)) * volumeWeight(d.TotalRequests, config)
+	return 100 - math.Min(failure, 100)
+}
+
+// isAlertable reports whether a severity takes part in threshold and alert
+// evaluation
+func isAlertable(severity string) bool {
+	return severity == SeverityCritical || severity == SeverityWarning
+}
+
+// breachedThreshold returns the threshold a record of severity fell below
+func breachedThreshold(severity string, config *Config) float64 {
+	if severity == SeverityCritical {
+		return config.CriticalThreshold
+	}
+	return config.WarningThreshold
+}
+
+// annotateSeverity sets the Severity of every record in the aggregation.
+// Records without requests, or with fewer than MinRequests, are marked as
+// insufficient data instead of being classified. With a VolumeCurve, failure
+// rates are scaled by request volume first, so the same dip pages louder on a
+// busy version.
+func annotateSeverity(aggregation map[string]map[string]AggregatedData, config *Config) {
+	for app, versions := range aggregation {
+		for version, data := range versions {
+			if data.TotalRequests <= 0 || data.TotalRequests < config.MinRequests {
+				data.Severity = SeverityInsufficientData
+			} else {
+				data.Severity = classifySeverity(severityRate(data, config), config)
+			}
+			aggregation[app][version] = data
+		}
+	}
+}
+
+// groupBySeverity returns the records of the aggregation keyed by severity,
+// each group sorted by application and version
+func groupBySeverity(aggregation map[string]map[string]AggregatedData) map[string][]AggregatedData {
+	groups := make(map[string][]AggregatedData)
+	for _, versions := range aggregation {
+		for _, data := range versions {
+			groups[data.Severity] = append(groups[data.Severity], data)
+		}
+	}
+	for _, group := range groups {
+		sort.Slice(group, func(i, j int) bool {
+			if group[i].Application != group[j].Application {
+				return group[i].Application < group[j].Application
+			}
+			return group[i].Version < group[j].Version
+		})
+	}
+	return groups
+}
+
+// printSeveritySummary writes the console report grouped by severity
+func printSeveritySummary(w io.Writer, aggregation map[string]map[string]AggregatedData) {
+	groups := groupBySeverity(aggregation)
+	for _, severity := range severityOrder {
+		group := groups[severity]
+		if len(group) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "%s (%d):\n", severity, len(group))
+		for _, data := range group {
+			fmt.Fprintf(w, "  Application: %s, Version: %s, Success Rate: %.2f%%%s%s%s\n",
+				data.Application, data.Version, successRate(data), formatInstancePercentiles(data.InstancePercentiles), formatStatusCounts(data.StatusCounts), formatUnhealthyComponents(data.UnhealthyComponents))
+		}
+	}
+}
+
+// formatStatusCounts renders the self-reported status breakdown for the
+// console summary, e.g. ", Statuses: degraded=1, ok=3"
+func formatStatusCounts(counts map[string]int) string {
+	if len(counts) == 0 {
+		return ""
+	}
+	statuses := make([]string, 0, len(counts))
+	for status := range counts {
+		statuses = append(statuses, status)
+	}
+	sort.Strings(statuses)
+	for i, status := range statuses {
+		statuses[i] = fmt.Sprintf("%s=%d", status, counts[status])
+	}
+	return ", Statuses: " + strings.Join(statuses, ", ")
+}
+
+// formatUnhealthyComponents renders the failing components for the console
+// summary, e.g. ", Unhealthy Components: cache=2, db=1"
+func formatUnhealthyComponents(counts map[string]int) string {
+	if len(counts) == 0 {
+		return ""
+	}
+	components := make([]string, 0, len(counts))
+	for component := range counts {
+		components = append(components, component)
+	}
+	sort.Strings(components)
+	for i, component := range components {
+		components[i] = fmt.Sprintf("%s=%d", component, counts[component])
+	}
+	return ", Unhealthy Components: " + strings.Join(components, ", ")
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+)
+
+// Test severity classification including the threshold boundaries
+func TestClassifySeverity(t *testing.T) {
+	config := NewDefaultConfig()
+	config.CriticalThreshold = 90
+	config.WarningThreshold = 99
+
+	tests := []struct {
+		rate     float64
+		expected string
+	}{
+		{0, SeverityCritical},
+		{89.99, SeverityCritical},
+		{90, SeverityWarning},
+		{95, SeverityWarning},
+		{98.99, SeverityWarning},
+		{99, SeverityOK},
+		{100, SeverityOK},
+	}
+
+	for _, tt := range tests {
+		if got := classifySeverity(tt.rate, config); got != tt.expected {
+			t.Errorf("Rate %.2f: expected severity %s, got %s", tt.rate, tt.expected, got)
+		}
+	}
+}
+
+// Test that records are annotated and the summary groups them by severity
+func TestAnnotateSeverity(t *testing.T) {
+	config := NewDefaultConfig()
+	config.CriticalThreshold = 90
+	config.WarningThreshold = 99
+
+	aggregation := aggregateData([]AggregatedData{
+		{Application: "Memcache2", Version: "1.0.1", TotalRequests: 100, TotalSuccesses: 80},
+		{Application: "Memcache2", Version: "1.0.2", TotalRequests: 100, TotalSuccesses: 95},
+		{Application: "Cassandra", Version: "2.0.0", TotalRequests: 100, TotalSuccesses: 100},
+	})
+	annotateSeverity(aggregation, config)
+
+	expected := map[string]string{
+		"1.0.1": SeverityCritical,
+		"1.0.2": SeverityWarning,
+	}
+	for version, severity := range expected {
+		if got := aggregation["Memcache2"][version].Severity; got != severity {
+			t.Errorf("Version %s: expected severity %s, got %s", version, severity, got)
+		}
+	}
+	if got := aggregation["Cassandra"]["2.0.0"].Severity; got != SeverityOK {
+		t.Errorf("Expected severity %s, got %s", SeverityOK, got)
+	}
+
+	// A record without requests has no rate to classify
+	idle := aggregateData([]AggregatedData{{Application: "Memcache2", Version: "1.0.3"}})
+	annotateSeverity(idle, config)
+	if got := idle["Memcache2"]["1.0.3"].Severity; got != SeverityInsufficientData {
+		t.Errorf("Expected a record without requests to be %s, got %s", SeverityInsufficientData, got)
+	}
+
+	var buf bytes.Buffer
+	printSeveritySummary(&buf, aggregation)
+	output := buf.String()
+	critical := strings.Index(output, "critical (1):")
+	warning := strings.Index(output, "warning (1):")
+	ok := strings.Index(output, "ok (1):")
+	if critical < 0 || warning < 0 || ok < 0 {
+		t.Fatalf("Expected all severity groups in summary, got:\n%s", output)
+	}
+	if !(critical < warning && warning < ok) {
+		t.Errorf("Expected groups ordered critical, warning, ok, got:\n%s", output)
+	}
+}
+
+// Test that a low-volume version is reported as insufficient data and kept
+// out of alerting while aggregation still sums its counts
+func TestMinRequests(t *testing.T) {
+	config := NewDefaultConfig()
+	config.MinRequests = 50
+	config.ExitPolicy = ExitPolicyThreshold
+
+	aggregation := aggregateData([]AggregatedData{
+		{Application: "Memcache2", Version: "1.0.1", TotalRequests: 100, TotalSuccesses: 80},
+		{Application: "Memcache2", Version: "1.0.2", TotalRequests: 3, TotalSuccesses: 1},
+		{Application: "Memcache2", Version: "1.0.2", TotalRequests: 4, TotalSuccesses: 1},
+	})
+	annotateSeverity(aggregation, config)
+
+	lowVolume := aggregation["Memcache2"]["1.0.2"]
+	if lowVolume.Severity != SeverityInsufficientData {
+		t.Errorf("Expected severity %s, got %s", SeverityInsufficientData, lowVolume.Severity)
+	}
+	if lowVolume.TotalRequests != 7 || lowVolume.TotalSuccesses != 2 {
+		t.Errorf("Expected summed counts 7/2, got %d/%d", lowVolume.TotalRequests, lowVolume.TotalSuccesses)
+	}
+
+	alerts := breachingRecords(aggregation, config)
+	if len(alerts) != 1 || alerts[0].Version != "1.0.1" {
+		t.Errorf("Expected only 1.0.1 to alert, got %+v", alerts)
+	}
+
+	report := buildReport(aggregation, nil, config)
+	if _, ok := report.Applications["Memcache2"]["1.0.2"]; !ok {
+		t.Error("Expected the low-volume version in the report")
+	}
+
+	delete(aggregation["Memcache2"], "1.0.1")
+	outcome := &cycleOutcome{Report: buildReport(aggregation, nil, config)}
+	if code, reason := decideExitCode(outcome, config); code != exitCodeOK {
+		t.Errorf("Expected insufficient data to pass the threshold policy, got %d: %s", code, reason)
+	}
+
+	var buf bytes.Buffer
+	printSeveritySummary(&buf, aggregation)
+	if !strings.Contains(buf.String(), "insufficient_data (1):") {
+		t.Errorf("Expected insufficient data group in summary, got:\n%s", buf.String())
+	}
+}
+
+// Test that equal rate drops are classified by volume with a volume curve
+func TestVolumeWeightedSeverity(t *testing.T) {
+	config := NewDefaultConfig()
+	config.VolumeCurve = VolumeCurveLog
+	config.VolumeReference = 10000
+	aggregation := aggregateData([]AggregatedData{
+		{Application: "Quiet", Version: "1.0.0", TotalRequests: 100, TotalSuccesses: 89},
+		{Application: "Steady", Version: "1.0.0", TotalRequests: 10000, TotalSuccesses: 8900},
+		{Application: "Busy", Version: "1.0.0", TotalRequests: 1000000, TotalSuccesses: 990000},
+		{Application: "Reference", Version: "1.0.0", TotalRequests: 10000, TotalSuccesses: 9900},
+	})
+	annotateSeverity(aggregation, config)
+
+	expected := map[string]string{
+		// 11% failures softened to 2.75% by the 1/4 floor
+		"Quiet": SeverityWarning,
+		// 11% failures at the reference volume stay at 11%
+		"Steady": SeverityCritical,
+		// 1% failures escalated threefold to 3%
+		"Busy": SeverityWarning,
+		// 1% failures at the reference volume stay at 1%
+		"Reference": SeverityOK,
+	}
+	for app, severity := range expected {
+		if got := aggregation[app]["1.0.0"].Severity; got != severity {
+			t.Errorf("Expected %s to be %s, got %s", app, severity, got)
+		}
+	}
+
+	// Alerts report the scaled rate the severity was decided on
+	for _, alert := range breachingRecords(aggregation, config) {
+		if alert.Application == "Busy" && (alert.SuccessRate != 99 || math.Abs(alert.EvaluatedRate-97) > 1e-9 || alert.Threshold != config.WarningThreshold) {
+			t.Errorf("Expected Busy to alert at 97%% (99%% unscaled) against %.0f%%, got %+v", config.WarningThreshold, alert)
+		}
+	}
+
+	config.VolumeCurve = VolumeCurveNone
+	annotateSeverity(aggregation, config)
+	if quiet, steady := aggregation["Quiet"]["1.0.0"].Severity, aggregation["Steady"]["1.0.0"].Severity; quiet != steady {
+		t.Errorf("Expected equal rates to share a severity without a curve, got %s and %s", quiet, steady)
+	}
+	if weight := volumeWeight(1, &Config{VolumeCurve: VolumeCurveLinear, VolumeReference: 100, VolumeMaxWeight: 4}); weight != 0.25 {
+		t.Errorf("Expected the weight to be floored at 0.25, got %v", weight)
+	}
+}
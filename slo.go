@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// sloTargets maps an application, or an application/version pair, to its
+// target success rate in percent, e.g. {"Memcache2": 99.5, "Memcache2/1.0.1": 99}
+type sloTargets map[string]float64
+
+// loadSLOTargets reads the SLO_FILE mapping
+func loadSLOTargets(path string) (sloTargets, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read SLO file: %v", err)
+	}
+	var targets sloTargets
+	if err := json.Unmarshal(data, &targets); err != nil {
+		return nil, fmt.Errorf("failed to decode SLO file %s: %v", path, err)
+	}
+	for key, target := range targets {
+		if target <= 0 || target > 100 {
+			return nil, fmt.Errorf("SLO file %s: target %v for %s is not a percentage", path, target, key)
+		}
+	}
+	return targets, nil
+}
+
+// SLOCompliance compares an application/version against its SLO target
+type SLOCompliance struct {
+	Application string  `json:"application"`
+	Version     string  `json:"version"`
+	Target      float64 `json:"target"`
+	SuccessRate float64 `json:"successRate"`
+	Met         bool    `json:"met"`
+	// Margin is the success rate minus the target; negative when missed
+	Margin float64 `json:"margin"`
+	// Source tells where the target came from: app/version, app or default
+	Source string `json:"source"`
+}
+
+// target returns the target for an application/version, preferring an exact
+// app/version entry over an app entry over fallback
+func (t sloTargets) target(application, version string, fallback float64) (float64, string) {
+	if target, ok := t[application+"/"+version]; ok {
+		return target, "app/version"
+	}
+	if target, ok := t[application]; ok {
+		return target, "app"
+	}
+	return fallback, "default"
+}
+
+// computeSLOCompliance evaluates every record of the aggregation against its
+// target. Unlisted services fall back to SLO_TARGET, or WARNING_THRESHOLD
+// when that is unset.
+func computeSLOCompliance(aggregation map[string]map[string]AggregatedData, targets sloTargets, config *Config) []SLOCompliance {
+	fallback := config.WarningThreshold
+	if config.SLOTarget > 0 {
+		fallback = config.SLOTarget
+	}
+	var compliance []SLOCompliance
+	for _, data := range sortedRecords(aggregation) {
+		target, source := targets.target(data.Application, data.Version, fallback)
+		rate := successRate(data)
+		compliance = append(compliance, SLOCompliance{
+			Application: data.Application,
+			Version:     data.Version,
+			Target:      target,
+			SuccessRate: rate,
+			Met:         rate >= target,
+			Margin:      rate - target,
+			Source:      source,
+		})
+	}
+	return compliance
+}
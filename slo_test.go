@@ -0,0 +1,62 @@
+package main
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Test compliance computed against per-service targets from an SLO file
+func TestSLOCompliance(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "slo.json")
+	if err := os.WriteFile(path, []byte(`{"Web": 99.5, "Web/2.0": 90, "Cache": 95}`), 0644); err != nil {
+		t.Fatalf("Failed to write SLO file: %v", err)
+	}
+	targets, err := loadSLOTargets(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	aggregation := aggregateData([]AggregatedData{
+		{Application: "Web", Version: "1.0", TotalRequests: 1000, TotalSuccesses: 996},
+		{Application: "Web", Version: "2.0", TotalRequests: 100, TotalSuccesses: 92},
+		{Application: "Cache", Version: "3.1", TotalRequests: 100, TotalSuccesses: 94},
+		{Application: "Search", Version: "1.0", TotalRequests: 100, TotalSuccesses: 98},
+	})
+	config := NewDefaultConfig()
+	compliance := computeSLOCompliance(aggregation, targets, config)
+
+	expected := []SLOCompliance{
+		{Application: "Cache", Version: "3.1", Target: 95, SuccessRate: 94, Met: false, Margin: -1, Source: "app"},
+		{Application: "Search", Version: "1.0", Target: 99, SuccessRate: 98, Met: false, Margin: -1, Source: "default"},
+		{Application: "Web", Version: "1.0", Target: 99.5, SuccessRate: 99.6, Met: true, Margin: 0.1, Source: "app"},
+		{Application: "Web", Version: "2.0", Target: 90, SuccessRate: 92, Met: true, Margin: 2, Source: "app/version"},
+	}
+	if len(compliance) != len(expected) {
+		t.Fatalf("Expected %d entries, got %v", len(expected), compliance)
+	}
+	for i, want := range expected {
+		got := compliance[i]
+		if got.Application != want.Application || got.Version != want.Version || got.Target != want.Target ||
+			got.Met != want.Met || got.Source != want.Source ||
+			math.Abs(got.SuccessRate-want.SuccessRate) > 1e-9 || math.Abs(got.Margin-want.Margin) > 1e-9 {
+			t.Errorf("Expected %+v, got %+v", want, got)
+		}
+	}
+
+	// SLO_TARGET is the fallback for unlisted services when set
+	config.SLOTarget = 97
+	for _, c := range computeSLOCompliance(aggregation, targets, config) {
+		if c.Application == "Search" && (c.Target != 97 || !c.Met) {
+			t.Errorf("Expected Search to meet the 97%% fallback, got %+v", c)
+		}
+	}
+
+	if err := os.WriteFile(path, []byte(`{"Web": 150}`), 0644); err != nil {
+		t.Fatalf("Failed to write SLO file: %v", err)
+	}
+	if _, err := loadSLOTargets(path); err == nil {
+		t.Errorf("Expected an error for a target above 100%%")
+	}
+}
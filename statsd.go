@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// statsdMaxPacketSize keeps batched packets below a typical network MTU
+const statsdMaxPacketSize = 1432
+
+// statsdLines renders the aggregation as StatsD gauges using DogStatsD tags,
+// e.g. healthcheck.success_rate:79.93|g|#application:Memcache2,version:1.0.1
+func statsdLines(aggregation map[string]map[string]AggregatedData, environment string) []string {
+	var lines []string
+	for _, data := range sortedRecords(aggregation) {
+		tags := fmt.Sprintf("application:%s,version:%s", statsdTag(data.Application), statsdTag(data.Version))
+		if environment != "" {
+			tags += ",environment:" + statsdTag(environment)
+		}
+		gauges := []struct {
+			name  string
+			value float64
+		}{
+			{"success_rate", successRate(data)},
+			{"total_requests", float64(data.TotalRequests)},
+			{"total_successes", float64(data.TotalSuccesses)},
+		}
+		for _, gauge := range gauges {
+			lines = append(lines, fmt.Sprintf("healthcheck.%s:%s|g|#%s",
+				gauge.name, strconv.FormatFloat(gauge.value, 'f', -1, 64), tags))
+		}
+	}
+	return lines
+}
+
+// statsdTag strips the characters that delimit StatsD tags from a value
+func statsdTag(value string) string {
+	return strings.NewReplacer(",", "_", "|", "_", "#", "_", "\n", "_").Replace(value)
+}
+
+// sendStatsd sends lines to addr over UDP, batching as many lines per packet
+// as fit
+func sendStatsd(addr string, lines []string) error {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var packet strings.Builder
+	flush := func() error {
+		if packet.Len() == 0 {
+			return nil
+		}
+		_, err := conn.Write([]byte(packet.String()))
+		packet.Reset()
+		return err
+	}
+
+	for _, line := range lines {
+		if packet.Len() > 0 && packet.Len()+1+len(line) > statsdMaxPacketSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(line)
+	}
+	return flush()
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test that the expected gauges are sent to a StatsD listener
+func TestSendStatsd(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	aggregation := aggregateData([]AggregatedData{
+		{Application: "Memcache2", Version: "1.0.1", TotalRequests: 200, TotalSuccesses: 150},
+	})
+	lines := statsdLines(aggregation, "prod")
+	if err := sendStatsd(listener.LocalAddr().String(), lines); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	buf := make([]byte, statsdMaxPacketSize)
+	listener.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := listener.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("Expected a StatsD packet, got %v", err)
+	}
+
+	expected := []string{
+		"healthcheck.success_rate:75|g|#application:Memcache2,version:1.0.1,environment:prod",
+		"healthcheck.total_requests:200|g|#application:Memcache2,version:1.0.1,environment:prod",
+		"healthcheck.total_successes:150|g|#application:Memcache2,version:1.0.1,environment:prod",
+	}
+	if got := strings.Split(string(buf[:n]), "\n"); strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected lines:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+// Test that an unresolvable StatsD address is reported rather than fatal
+func TestSendStatsdError(t *testing.T) {
+	if err := sendStatsd("invalid-host-name.invalid:8125", []string{"x:1|g"}); err == nil {
+		t.Errorf("Expected an error for an unresolvable address")
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+// Overall statuses of a report, derived from the severities of its records
+const (
+	StatusHealthy  = "healthy"
+	StatusDegraded = "degraded"
+	StatusCritical = "critical"
+)
+
+// overallStatus returns the one-glance verdict of a report along with the
+// fraction of its records that are failing, i.e. critical or warning. The
+// report is critical when more than STATUS_CRITICAL_FRACTION of the records
+// are critical, else degraded when more than STATUS_DEGRADED_FRACTION are
+// failing, else healthy. With the default fractions of 0 the worst severity
+// decides. Records with insufficient data are left out; a report without
+// any other record has no status.
+func overallStatus(aggregation map[string]map[string]AggregatedData, config *Config) (string, float64) {
+	var evaluated, critical, failing int
+	for _, versions := range aggregation {
+		for _, data := range versions {
+			switch data.Severity {
+			case SeverityInsufficientData:
+				continue
+			case SeverityCritical:
+				critical++
+				failing++
+			case SeverityWarning:
+				failing++
+			}
+			evaluated++
+		}
+	}
+	if evaluated == 0 {
+		return "", 0
+	}
+
+	fraction := float64(failing) / float64(evaluated)
+	switch {
+	case critical > 0 && float64(critical)/float64(evaluated) > config.StatusCriticalFraction:
+		return StatusCritical, fraction
+	case failing > 0 && fraction > config.StatusDegradedFraction:
+		return StatusDegraded, fraction
+	default:
+		return StatusHealthy, fraction
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+)
+
+// Test the overall status derived from crafted record severities
+func TestOverallStatus(t *testing.T) {
+	records := func(severities ...string) map[string]map[string]AggregatedData {
+		aggregation := map[string]map[string]AggregatedData{"Memcache2": {}}
+		for i, severity := range severities {
+			version := string(rune('a' + i))
+			aggregation["Memcache2"][version] = AggregatedData{Application: "Memcache2", Version: version, Severity: severity}
+		}
+		return aggregation
+	}
+
+	tests := []struct {
+		name             string
+		severities       []string
+		critical         float64
+		degraded         float64
+		expected         string
+		expectedFraction float64
+	}{
+		{"all ok", []string{SeverityOK, SeverityOK}, 0, 0, StatusHealthy, 0},
+		{"worst is warning", []string{SeverityOK, SeverityWarning}, 0, 0, StatusDegraded, 0.5},
+		{"worst is critical", []string{SeverityOK, SeverityOK, SeverityOK, SeverityCritical}, 0, 0, StatusCritical, 0.25},
+		{"critical below the critical fraction", []string{SeverityOK, SeverityOK, SeverityOK, SeverityCritical}, 0.3, 0, StatusDegraded, 0.25},
+		{"failing below both fractions", []string{SeverityOK, SeverityOK, SeverityOK, SeverityCritical}, 0.3, 0.3, StatusHealthy, 0.25},
+		{"insufficient data left out", []string{SeverityOK, SeverityInsufficientData, SeverityInsufficientData}, 0, 0, StatusHealthy, 0},
+		{"only insufficient data", []string{SeverityInsufficientData}, 0, 0, "", 0},
+	}
+	for _, tt := range tests {
+		config := NewDefaultConfig()
+		config.StatusCriticalFraction = tt.critical
+		config.StatusDegradedFraction = tt.degraded
+		status, fraction := overallStatus(records(tt.severities...), config)
+		if status != tt.expected || fraction != tt.expectedFraction {
+			t.Errorf("%s: expected %q with %.2f failing, got %q with %.2f", tt.name, tt.expected, tt.expectedFraction, status, fraction)
+		}
+	}
+
+	config := NewDefaultConfig()
+	if report := buildReport(records(SeverityOK, SeverityWarning), nil, config); report.Status != StatusDegraded {
+		t.Errorf("Expected the report to carry its status, got %q", report.Status)
+	}
+}
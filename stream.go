@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// resultStream writes each server result as an NDJSON line as soon as it is
+// fetched. Writes are serialized so lines from concurrent consumers never
+// interleave.
+type resultStream struct {
+	mu  sync.Mutex
+	out io.Writer
+	// file is set when the stream owns a file sink
+	file *os.File
+}
+
+// newResultStream opens the STREAM_OUTPUT sink: "-" for stdout, otherwise a
+// file that lines are appended to
+func newResultStream(target string) (*resultStream, error) {
+	if target == "-" {
+		return &resultStream{out: os.Stdout}, nil
+	}
+	file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open stream output %s: %v", target, err)
+	}
+	return &resultStream{out: file, file: file}, nil
+}
+
+// Write streams a single result
+func (s *resultStream) Write(result ServerResult) error {
+	line, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.out.Write(line)
+	return err
+}
+
+// Close closes the file sink, if any
+func (s *resultStream) Close() error {
+	if s.file != nil {
+		return s.file.Close()
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Test that every fetched server is streamed as one NDJSON line
+func TestStreamOutput(t *testing.T) {
+	server := setupMockServer()
+	defer server.Close()
+	broken := setupMockServerWithBody("{not json")
+	defer broken.Close()
+
+	dir := t.TempDir()
+	// Distinct query strings keep the servers apart when deduplicating
+	var lines []string
+	for i := 0; i < 5; i++ {
+		lines = append(lines, server.URL+"/?"+string(rune('a'+i)), broken.URL+"/?"+string(rune('a'+i)))
+	}
+	serversFile := filepath.Join(dir, "servers.txt")
+	if err := os.WriteFile(serversFile, []byte(strings.Join(lines, "\n")), 0644); err != nil {
+		t.Fatalf("Failed to write servers file: %v", err)
+	}
+
+	config := NewDefaultConfig()
+	config.ServersFile = serversFile
+	config.FailuresFile = ""
+	config.RequestDelay = 0
+	config.ResultConsumers = 4
+	config.StreamOutput = filepath.Join(dir, "results.ndjson")
+	stream, err := newResultStream(config.StreamOutput)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	state := &scanState{writer: &fakeReportWriter{}, stream: stream}
+
+	outcome, err := runCycle(context.Background(), config, state)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	state.Close(config)
+
+	file, err := os.Open(config.StreamOutput)
+	if err != nil {
+		t.Fatalf("Failed to open stream output: %v", err)
+	}
+	defer file.Close()
+	streamed := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var result ServerResult
+		if err := json.Unmarshal(scanner.Bytes(), &result); err != nil {
+			t.Fatalf("Expected each line to be a JSON result, got %q: %v", scanner.Text(), err)
+		}
+		streamed++
+	}
+	if streamed != len(outcome.Results) || streamed != 10 {
+		t.Errorf("Expected 10 streamed lines, one per fetched server, got %d for %d results", streamed, len(outcome.Results))
+	}
+}
+
+// Test that the stream's file is closed again when the scan state fails to be
+// created after it was opened
+func TestScanStateReleasedOnError(t *testing.T) {
+	openFiles := func() int {
+		entries, err := os.ReadDir("/proc/self/fd")
+		if err != nil {
+			t.Skip("open files cannot be listed on this platform")
+		}
+		return len(entries)
+	}
+
+	dir := t.TempDir()
+	config := NewDefaultConfig()
+	config.OutputFile = filepath.Join(dir, "report.json")
+	config.StreamOutput = filepath.Join(dir, "results.ndjson")
+	config.OTLPEndpoint = "://invalid"
+	before := openFiles()
+	if _, err := newScanState(context.Background(), config); err == nil || !strings.Contains(err.Error(), "invalid OTLP endpoint") {
+		t.Fatalf("Expected the OTLP endpoint to be refused, got %v", err)
+	}
+	if after := openFiles(); after != before {
+		t.Errorf("Expected the stream file to be closed, %d files open before and %d after", before, after)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// tcpScheme prefixes servers checked by connecting to a TCP port instead of
+// querying an HTTP health endpoint
+const tcpScheme = "tcp://"
+
+// ProtocolTCP is recorded as the protocol of TCP-only checks
+const ProtocolTCP = "tcp"
+
+// isTCPAddress reports whether address is a tcp://host:port entry
+func isTCPAddress(address string) bool {
+	return strings.HasPrefix(strings.ToLower(address), tcpScheme)
+}
+
+// checkTCP connects to address (a tcp://host:port entry) and closes the
+// connection straight away, dialing through dial when set. The dial stops
+// after timeout or once ctx is done.
+func checkTCP(ctx context.Context, address string, timeout time.Duration, dial dialFunc) error {
+	hostport := address[len(tcpScheme):]
+	if _, _, err := net.SplitHostPort(hostport); err != nil {
+		return &FetchError{Class: ErrorClassNetwork, Err: fmt.Errorf("invalid TCP address %q: %v", address, err)}
+	}
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	conn, err := dial(ctx, "tcp", hostport)
+	if err != nil {
+		return &FetchError{Class: classifyNetworkError(err), Err: err}
+	}
+	return conn.Close()
+}
+
+// checkTCPServer runs a TCP-only check for entry within HTTPTimeout
+func checkTCPServer(ctx context.Context, entry ServerEntry, config *Config, dial dialFunc) ServerResult {
+	result := ServerResult{Server: entry.name(), URL: entry.Address, Protocol: ProtocolTCP, Tags: entry.Tags, Attempts: 1, LivenessOnly: true}
+	start := time.Now()
+	err := checkTCP(ctx, entry.Address, config.HTTPTimeout, dial)
+	result.LatencyMs = durationMs(time.Since(start))
+	if err != nil {
+		fmt.Fprintf(config.Console, "Error connecting to %s: %v\n", entry.Address, err)
+		result.Error = err.Error()
+		result.ErrorClass = classifyError(err)
+	}
+	return result
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+// Test TCP-only checks against an open and a closed port
+func TestTCPChecks(t *testing.T) {
+	open, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer open.Close()
+	go func() {
+		for {
+			conn, err := open.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	closedAddr := closed.Addr().String()
+	closed.Close()
+
+	config := NewDefaultConfig()
+	config.RequestDelay = 0
+	results := collectResults([]ServerEntry{
+		{Address: "tcp://" + open.Addr().String(), Tags: map[string]string{"app": "Redis"}},
+		{Address: "tcp://" + closedAddr, Tags: map[string]string{"app": "Redis"}},
+	}, config)
+
+	for _, result := range results {
+		if result.Protocol != ProtocolTCP || !result.LivenessOnly || result.Health != nil {
+			t.Errorf("Expected a TCP result without health data, got %+v", result)
+		}
+		up := result.Server == "tcp://"+open.Addr().String()
+		if up && result.Error != "" {
+			t.Errorf("Expected the open port to be up, got %v", result.Error)
+		}
+		if !up && result.ErrorClass != ErrorClassConnect {
+			t.Errorf("Expected the closed port to fail to connect, got %q (%v)", result.ErrorClass, result.Error)
+		}
+	}
+
+	aggregation := aggregateLiveness(results, config)
+	if redis := aggregation["Redis"]; redis.Up != 1 || redis.Down != 1 || redis.Availability != 50 {
+		t.Errorf("Expected Redis 1 up and 1 down at 50%%, got %+v", redis)
+	}
+}
+
+// Test that canceling the run stops in-flight TCP checks and the request
+// delay before the next ones
+func TestTCPChecksCanceled(t *testing.T) {
+	hanging := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := checkTCP(ctx, "tcp://127.0.0.1:9", time.Minute, hanging); err == nil {
+		t.Error("Expected the canceled check to fail")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the check to stop with the run, took %v", elapsed)
+	}
+
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	address := "tcp://" + closed.Addr().String()
+	closed.Close()
+	config := NewDefaultConfig()
+	config.RequestDelay = time.Minute
+	config.MaxConcurrency = 1
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	resultChannel := make(chan ServerResult, 2)
+	start = time.Now()
+	fetchHealthDataWithDelayAndConcurrency(canceled, []ServerEntry{{Address: address}, {Address: address}}, resultChannel, config, nil)
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected REQUEST_DELAY to be cut short by the canceled run, took %v", elapsed)
+	}
+}
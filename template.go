@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Layouts of the time placeholders of output filename templates
+const (
+	templateTimestampFormat = "20060102T150405Z"
+	templateDateFormat      = "2006-01-02"
+)
+
+// outputTemplateData is the run metadata placeholders are resolved from
+type outputTemplateData struct {
+	Environment string
+	Shard       string
+	Hostname    string
+	Time        time.Time
+	Cycle       int64
+}
+
+// isOutputTemplate reports whether path contains placeholders
+func isOutputTemplate(path string) bool {
+	return strings.ContainsAny(path, "{}")
+}
+
+// expandOutputTemplate replaces the placeholders of tmpl, e.g.
+// report-{env}-{timestamp}-{shard}.json. Supported placeholders are {env},
+// {shard}, {hostname}, {timestamp} (UTC, 20060102T150405Z), {date} (UTC,
+// 2006-01-02), {cycle} (1 for the first watch cycle) and {env:NAME} for any
+// environment variable. A placeholder resolving to an empty value is an
+// error, and path separators in values are replaced so they cannot escape
+// the templated directory.
+func expandOutputTemplate(tmpl string, data outputTemplateData) (string, error) {
+	var out strings.Builder
+	rest := tmpl
+	for {
+		open := strings.IndexAny(rest, "{}")
+		if open < 0 {
+			out.WriteString(rest)
+			return out.String(), nil
+		}
+		if rest[open] == '}' {
+			return "", fmt.Errorf("unmatched } in output template %q", tmpl)
+		}
+		out.WriteString(rest[:open])
+		rest = rest[open+1:]
+
+		end := strings.IndexAny(rest, "{}")
+		if end < 0 || rest[end] != '}' {
+			return "", fmt.Errorf("unterminated placeholder in output template %q", tmpl)
+		}
+		value, err := resolvePlaceholder(rest[:end], data)
+		if err != nil {
+			return "", fmt.Errorf("output template %q: %v", tmpl, err)
+		}
+		out.WriteString(strings.NewReplacer("/", "_", "\\", "_").Replace(value))
+		rest = rest[end+1:]
+	}
+}
+
+// resolvePlaceholder returns the value of a single placeholder
+func resolvePlaceholder(name string, data outputTemplateData) (string, error) {
+	var value, source string
+	switch {
+	case name == "env":
+		value, source = data.Environment, "ENVIRONMENT"
+	case name == "shard":
+		value, source = data.Shard, "SHARD"
+	case name == "hostname":
+		value, source = data.Hostname, "the hostname"
+	case name == "timestamp":
+		return data.Time.UTC().Format(templateTimestampFormat), nil
+	case name == "date":
+		return data.Time.UTC().Format(templateDateFormat), nil
+	case name == "cycle":
+		return fmt.Sprint(data.Cycle), nil
+	case strings.HasPrefix(name, "env:") && len(name) > len("env:"):
+		source = name[len("env:"):]
+		value = os.Getenv(source)
+	default:
+		return "", fmt.Errorf("unknown placeholder {%s}", name)
+	}
+	if value == "" {
+		return "", fmt.Errorf("{%s} needs %s to be set", name, source)
+	}
+	return value, nil
+}
+
+// newOutputTemplateData gathers the run metadata for cycle at now
+func newOutputTemplateData(config *Config, now time.Time, cycle int64) outputTemplateData {
+	hostname, _ := os.Hostname()
+	return outputTemplateData{
+		Environment: config.Environment,
+		Shard:       config.Shard,
+		Hostname:    hostname,
+		Time:        now,
+		Cycle:       cycle,
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Test that placeholders expand to the expected filename
+func TestExpandOutputTemplate(t *testing.T) {
+	t.Setenv("REGION", "eu/west")
+	data := outputTemplateData{
+		Environment: "prod",
+		Shard:       "3",
+		Hostname:    "scanner-1",
+		Time:        time.Date(2024, 3, 5, 14, 7, 9, 0, time.UTC),
+		Cycle:       2,
+	}
+
+	tests := []struct {
+		template string
+		expected string
+	}{
+		{"report-{env}-{timestamp}-{shard}.json", "report-prod-20240305T140709Z-3.json"},
+		{"reports/{date}/{hostname}-{cycle}.json", "reports/2024-03-05/scanner-1-2.json"},
+		{"report-{env:REGION}.json", "report-eu_west.json"},
+		{"report.json", "report.json"},
+	}
+	for _, tt := range tests {
+		got, err := expandOutputTemplate(tt.template, data)
+		if err != nil {
+			t.Errorf("Template %s: expected no error, got %v", tt.template, err)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("Template %s: expected %s, got %s", tt.template, tt.expected, got)
+		}
+	}
+
+	for _, invalid := range []string{"report-{region}.json", "report-{env.json", "report-}.json", "report-{env:UNSET_VARIABLE}.json"} {
+		if _, err := expandOutputTemplate(invalid, data); err == nil {
+			t.Errorf("Template %s: expected an error", invalid)
+		}
+	}
+	if _, err := expandOutputTemplate("report-{shard}.json", outputTemplateData{}); err == nil {
+		t.Error("Expected an error for {shard} without SHARD")
+	}
+}
+
+// Test that a templated output is validated up front and written to a new
+// directory per cycle
+func TestTemplatedReportWriter(t *testing.T) {
+	dir := t.TempDir()
+	config := NewDefaultConfig()
+	config.Environment = "staging"
+	config.OutputFile = filepath.Join(dir, "{env}", "report-{cycle}.json")
+
+	writer, err := newReportWriter(config)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := writer.Write(context.Background(), Report{}); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	for _, name := range []string{"report-1.json", "report-2.json"} {
+		if _, err := os.Stat(filepath.Join(dir, "staging", name)); err != nil {
+			t.Errorf("Expected %s to be written, got %v", name, err)
+		}
+	}
+
+	config.OutputFile = filepath.Join(dir, "report-{unknown}.json")
+	if _, err := newReportWriter(config); err == nil {
+		t.Error("Expected an invalid template to be rejected before the scan")
+	}
+}
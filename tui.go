@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// Columns the dashboard can be sorted by, each bound to a key
+const (
+	DashboardSortApplication = "application"
+	DashboardSortRate        = "rate"
+	DashboardSortRequests    = "requests"
+	DashboardSortSeverity    = "severity"
+)
+
+// dashboardSortKeys maps the keys pressed in the dashboard to the column they
+// sort by
+var dashboardSortKeys = map[byte]string{
+	'a': DashboardSortApplication,
+	'r': DashboardSortRate,
+	'n': DashboardSortRequests,
+	's': DashboardSortSeverity,
+}
+
+// severityColors are the ANSI colours of each severity in the dashboard
+var severityColors = map[string]string{
+	SeverityCritical: "\x1b[31m",
+	SeverityWarning:  "\x1b[33m",
+	SeverityOK:       "\x1b[32m",
+}
+
+// dashboardRow is an application/version line of the dashboard
+type dashboardRow struct {
+	Application string
+	Version     string
+	SuccessRate float64
+	Requests    int64
+	Severity    string
+}
+
+// dashboardModel is what the dashboard shows, updated after every watch cycle
+// and kept sorted by the selected column
+type dashboardModel struct {
+	Rows    []dashboardRow
+	SortBy  string
+	Reverse bool
+	// Cycles counts the completed cycles, successful or not
+	Cycles    int
+	UpdatedAt time.Time
+	// LastError is the error of the latest cycle, empty when it succeeded
+	LastError string
+}
+
+// newDashboardModel creates an empty model sorted by severity, most urgent first
+func newDashboardModel() *dashboardModel {
+	return &dashboardModel{SortBy: DashboardSortSeverity}
+}
+
+// Update replaces the rows with the aggregation of a completed cycle
+func (m *dashboardModel) Update(aggregation map[string]map[string]AggregatedData, now time.Time) {
+	m.Rows = m.Rows[:0]
+	for app, versions := range aggregation {
+		for version, data := range versions {
+			m.Rows = append(m.Rows, dashboardRow{
+				Application: app,
+				Version:     version,
+				SuccessRate: successRate(data),
+				Requests:    data.TotalRequests,
+				Severity:    data.Severity,
+			})
+		}
+	}
+	m.Cycles++
+	m.UpdatedAt = now
+	m.LastError = ""
+	m.sort()
+}
+
+// Fail records a cycle that produced no report, keeping the previous rows
+func (m *dashboardModel) Fail(err error, now time.Time) {
+	m.Cycles++
+	m.UpdatedAt = now
+	m.LastError = err.Error()
+}
+
+// Sort orders the rows by column; selecting the current column again reverses
+// the order
+func (m *dashboardModel) Sort(column string) {
+	if column == m.SortBy {
+		m.Reverse = !m.Reverse
+	} else {
+		m.SortBy, m.Reverse = column, false
+	}
+	m.sort()
+}
+
+// sort orders the rows by SortBy. Rates and severities put the worst first,
+// request counts the busiest first; ties fall back to application and version
+// so the table does not jump between refreshes.
+func (m *dashboardModel) sort() {
+	rank := make(map[string]int, len(severityOrder))
+	for i, severity := range severityOrder {
+		rank[severity] = i
+	}
+	sort.SliceStable(m.Rows, func(i, j int) bool {
+		a, b := m.Rows[i], m.Rows[j]
+		if m.Reverse {
+			a, b = b, a
+		}
+		switch m.SortBy {
+		case DashboardSortRate:
+			if a.SuccessRate != b.SuccessRate {
+				return a.SuccessRate < b.SuccessRate
+			}
+		case DashboardSortRequests:
+			if a.Requests != b.Requests {
+				return a.Requests > b.Requests
+			}
+		case DashboardSortSeverity:
+			if rank[a.Severity] != rank[b.Severity] {
+				return rank[a.Severity] < rank[b.Severity]
+			}
+		}
+		if a.Application != b.Application {
+			return a.Application < b.Application
+		}
+		return a.Version < b.Version
+	})
+}
+
+// Render draws the model as a full screen for a terminal in raw mode, where
+// every line must end in \r\n
+func (m *dashboardModel) Render(w io.Writer) {
+	var b strings.Builder
+	b.WriteString("\x1b[H\x1b[2J")
+	order := ""
+	if m.Reverse {
+		order = ", reversed"
+	}
+	fmt.Fprintf(&b, "Health Dashboard - cycle %d at %s (sorted by %s%s)\r\n", m.Cycles, m.UpdatedAt.Format("15:04:05"), m.SortBy, order)
+	if m.LastError != "" {
+		fmt.Fprintf(&b, "%sLast cycle failed: %s\x1b[0m\r\n", severityColors[SeverityCritical], m.LastError)
+	}
+	fmt.Fprintf(&b, "\r\n%-24s %-16s %12s %16s  %s\r\n", "APPLICATION", "VERSION", "SUCCESS", "REQUESTS", "SEVERITY")
+	for _, row := range m.Rows {
+		fmt.Fprintf(&b, "%s%-24s %-16s %11.2f%% %16d  %s\x1b[0m\r\n",
+			severityColors[row.Severity], row.Application, row.Version, row.SuccessRate, row.Requests, row.Severity)
+	}
+	b.WriteString("\r\nSort: [a]pplication [r]ate [n]requests [s]everity (again to reverse)  [q]uit\r\n")
+	io.WriteString(w, b.String())
+}
+
+// dashboard shows the model full screen on the terminal, redrawing it after
+// every cycle and on key presses. While it runs the regular console output is
+// discarded, as it would scroll the table away.
+type dashboard struct {
+	mu    sync.Mutex
+	model *dashboardModel
+	tty   *os.File
+	state *term.State
+	// config and console are the configuration whose Console the dashboard
+	// replaced and the writer it restores on Close
+	config  *Config
+	console io.Writer
+}
+
+// usesDashboard reports whether a scan shows the dashboard, which draws on
+// stdout
+func usesDashboard(config *Config) bool {
+	return config.TUI && config.WatchInterval > 0
+}
+
+// checkDashboardOutputs rejects the dashboard together with a report or result
+// stream written to stdout
+func checkDashboardOutputs(config *Config) error {
+	if !usesDashboard(config) {
+		return nil
+	}
+	if config.OutputFile == "-" || config.StreamOutput == "-" {
+		return fmt.Errorf("TUI cannot be combined with OUTPUT_FILE=- or STREAM_OUTPUT=-, the dashboard owns stdout")
+	}
+	return nil
+}
+
+// startDashboard takes over the terminal for TUI and discards config.Console
+// until Close. It must run before any goroutine prints to the console. It
+// returns false when stdin or stdout is not a terminal, leaving the plain
+// output in place. Pressing q or Ctrl-C calls quit.
+func startDashboard(config *Config, quit context.CancelFunc) (*dashboard, bool) {
+	if !term.IsTerminal(int(os.Stdout.Fd())) || !term.IsTerminal(int(os.Stdin.Fd())) {
+		return nil, false
+	}
+	state, err := term.MakeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		return nil, false
+	}
+
+	d := &dashboard{model: newDashboardModel(), tty: os.Stdout, state: state, config: config, console: config.Console}
+	config.Console = io.Discard
+	// Switch to the alternate screen and hide the cursor
+	io.WriteString(d.tty, "\x1b[?1049h\x1b[?25l")
+	d.draw()
+
+	go func() {
+		buf := make([]byte, 1)
+		for {
+			if _, err := os.Stdin.Read(buf); err != nil {
+				return
+			}
+			if buf[0] == 'q' || buf[0] == 3 {
+				quit()
+				return
+			}
+			if column, ok := dashboardSortKeys[buf[0]]; ok {
+				d.mu.Lock()
+				d.model.Sort(column)
+				d.mu.Unlock()
+				d.draw()
+			}
+		}
+	}()
+	return d, true
+}
+
+// Update shows the outcome of a cycle
+func (d *dashboard) Update(outcome *cycleOutcome, err error) {
+	d.mu.Lock()
+	if err != nil {
+		d.model.Fail(err, time.Now())
+	} else {
+		d.model.Update(outcome.Report.Applications, time.Now())
+	}
+	d.mu.Unlock()
+	d.draw()
+}
+
+func (d *dashboard) draw() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.model.Render(d.tty)
+}
+
+// Close restores the terminal and the console output. The goroutines printing
+// to the console must have stopped by then.
+func (d *dashboard) Close() {
+	io.WriteString(d.tty, "\x1b[?25h\x1b[?1049l")
+	term.Restore(int(os.Stdin.Fd()), d.state)
+	d.config.Console = d.console
+}
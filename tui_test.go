@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test that the dashboard model is rebuilt from each cycle's aggregation and
+// keeps the selected sort order across refreshes
+func TestDashboardModel(t *testing.T) {
+	model := newDashboardModel()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	model.Update(map[string]map[string]AggregatedData{
+		"Memcache2": {
+			"1.0.1": {TotalRequests: 1000, TotalSuccesses: 999, Severity: SeverityOK},
+			"1.0.2": {TotalRequests: 100, TotalSuccesses: 80, Severity: SeverityCritical},
+		},
+		"Webapp": {
+			"2.0.0": {TotalRequests: 5000, TotalSuccesses: 4900, Severity: SeverityWarning},
+		},
+	}, now)
+
+	order := func() string {
+		var rows []string
+		for _, row := range model.Rows {
+			rows = append(rows, row.Application+"/"+row.Version)
+		}
+		return strings.Join(rows, " ")
+	}
+	if got := order(); got != "Memcache2/1.0.2 Webapp/2.0.0 Memcache2/1.0.1" {
+		t.Errorf("Expected the most severe first, got %s", got)
+	}
+	if model.Rows[0].SuccessRate != 80 || model.Cycles != 1 || !model.UpdatedAt.Equal(now) {
+		t.Errorf("Unexpected model %+v", model)
+	}
+
+	model.Sort(DashboardSortRequests)
+	if got := order(); got != "Webapp/2.0.0 Memcache2/1.0.1 Memcache2/1.0.2" {
+		t.Errorf("Expected the busiest first, got %s", got)
+	}
+	model.Sort(DashboardSortRequests)
+	if got := order(); got != "Memcache2/1.0.2 Memcache2/1.0.1 Webapp/2.0.0" || !model.Reverse {
+		t.Errorf("Expected sorting again to reverse the order, got %s", got)
+	}
+	model.Sort(DashboardSortRate)
+	if got := order(); got != "Memcache2/1.0.2 Webapp/2.0.0 Memcache2/1.0.1" || model.Reverse {
+		t.Errorf("Expected the lowest rate first, got %s", got)
+	}
+
+	// A failed cycle keeps the rows and shows the error until the next update
+	model.Fail(fmt.Errorf("servers file missing"), now.Add(time.Minute))
+	if len(model.Rows) != 3 || model.LastError != "servers file missing" || model.Cycles != 2 {
+		t.Errorf("Expected the failure recorded over the previous rows, got %+v", model)
+	}
+	model.Update(map[string]map[string]AggregatedData{
+		"Webapp":    {"2.0.0": {TotalRequests: 10, TotalSuccesses: 10, Severity: SeverityOK}},
+		"Memcache2": {"1.0.2": {TotalRequests: 10, TotalSuccesses: 5, Severity: SeverityCritical}},
+	}, now.Add(2*time.Minute))
+	if got := order(); got != "Memcache2/1.0.2 Webapp/2.0.0" || model.LastError != "" {
+		t.Errorf("Expected the new rows sorted by rate, got %s (error %q)", got, model.LastError)
+	}
+
+	var out bytes.Buffer
+	model.Render(&out)
+	if !strings.Contains(out.String(), "50.00%") || !strings.Contains(out.String(), "sorted by rate") {
+		t.Errorf("Expected the rows in the rendered view, got %q", out.String())
+	}
+}
+
+// Test that the dashboard is refused together with outputs written to stdout,
+// before any server is contacted, and that it does not fall back to stdout
+func TestDashboardRejectsStdoutOutputs(t *testing.T) {
+	for _, output := range []struct{ file, stream string }{{"-", ""}, {"", "-"}} {
+		config := NewDefaultConfig()
+		config.ServersFile = filepath.Join(t.TempDir(), "missing.txt")
+		config.TUI = true
+		config.WatchInterval = time.Second
+		if output.file != "" {
+			config.OutputFile = output.file
+		}
+		config.StreamOutput = output.stream
+		err := runScan(nil, config, io.Discard)
+		if err == nil || !strings.Contains(err.Error(), "TUI cannot be combined") {
+			t.Errorf("OUTPUT_FILE=%q STREAM_OUTPUT=%q: expected TUI to be refused, got %v", output.file, output.stream, err)
+		}
+	}
+
+	// A single scan does not show the dashboard, so stdout stays usable
+	config := NewDefaultConfig()
+	config.TUI = true
+	config.OutputFile = "-"
+	if err := checkDashboardOutputs(config); err != nil {
+		t.Errorf("Expected a single scan to ignore TUI, got %v", err)
+	}
+
+	readOnly := t.TempDir()
+	if err := os.Chmod(readOnly, 0555); err != nil {
+		t.Fatalf("Failed to make the directory read-only: %v", err)
+	}
+	defer os.Chmod(readOnly, 0755)
+	if os.Geteuid() == 0 {
+		t.Skip("root can write to read-only directories")
+	}
+	config = NewDefaultConfig()
+	config.TUI = true
+	config.WatchInterval = time.Second
+	config.OutputFile = filepath.Join(readOnly, "report.json")
+	config.OutputFallbackStdout = true
+	if _, err := newReportWriter(config); err == nil || !strings.Contains(err.Error(), "is not writable") {
+		t.Errorf("Expected the stdout fallback to be refused with TUI, got %v", err)
+	}
+	if config.Console != os.Stdout {
+		t.Errorf("Expected the console to stay on stdout")
+	}
+}
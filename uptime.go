@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// UptimeRegression is an instance whose uptime went backwards between watch
+// cycles by more than could be explained by a restart since the last cycle,
+// hinting at clock skew or a load balancer answering from another instance
+type UptimeRegression struct {
+	Server string `json:"server"`
+	URL    string `json:"url"`
+	// PreviousUptime and CurrentUptime are the reported uptimes in nanoseconds
+	PreviousUptime int64 `json:"previousUptime"`
+	CurrentUptime  int64 `json:"currentUptime"`
+}
+
+// String describes the regression for the console
+func (r UptimeRegression) String() string {
+	return fmt.Sprintf("%s uptime went back from %v to %v", r.URL,
+		time.Duration(r.PreviousUptime), time.Duration(r.CurrentUptime))
+}
+
+// uptimeSample is the uptime a server reported in a cycle
+type uptimeSample struct {
+	Uptime time.Duration
+	At     time.Time
+}
+
+// uptimeTracker remembers the last uptime reported by each server URL across
+// watch cycles
+type uptimeTracker struct {
+	tolerance time.Duration
+	last      map[string]uptimeSample
+}
+
+// newUptimeTracker creates a tracker allowing decreases up to UPTIME_TOLERANCE
+func newUptimeTracker(config *Config) *uptimeTracker {
+	return &uptimeTracker{tolerance: config.UptimeTolerance, last: make(map[string]uptimeSample)}
+}
+
+// Observe records the uptimes of a cycle's results and returns the
+// regressions, sorted by URL. A decrease is only a regression when the new
+// uptime is also longer than the time since the previous cycle, since an
+// instance restarted in between would report less.
+func (u *uptimeTracker) Observe(results []ServerResult, now time.Time) []UptimeRegression {
+	var regressions []UptimeRegression
+	for _, result := range results {
+		if result.Health == nil {
+			continue
+		}
+		current := time.Duration(result.Health.Uptime)
+		if previous, ok := u.last[result.URL]; ok {
+			elapsed := now.Sub(previous.At)
+			if current < previous.Uptime-u.tolerance && current > elapsed+u.tolerance {
+				regressions = append(regressions, UptimeRegression{
+					Server:         result.Server,
+					URL:            result.URL,
+					PreviousUptime: int64(previous.Uptime),
+					CurrentUptime:  int64(current),
+				})
+			}
+		}
+		u.last[result.URL] = uptimeSample{Uptime: current, At: now}
+	}
+	sort.Slice(regressions, func(i, j int) bool {
+		return regressions[i].URL < regressions[j].URL
+	})
+	return regressions
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// Test that an uptime going backwards between two cycles is flagged unless a
+// restart explains it
+func TestUptimeRegression(t *testing.T) {
+	config := NewDefaultConfig()
+	config.UptimeTolerance = 5 * time.Second
+	tracker := newUptimeTracker(config)
+
+	cycle := func(uptimes map[string]time.Duration) []ServerResult {
+		var results []ServerResult
+		for url, uptime := range uptimes {
+			results = append(results, ServerResult{Server: url, URL: url, Health: &HealthResponse{Uptime: int64(uptime)}})
+		}
+		return results
+	}
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	first := tracker.Observe(cycle(map[string]time.Duration{
+		"https://skewed/healthz":    10 * time.Hour,
+		"https://restarted/healthz": 10 * time.Hour,
+		"https://healthy/healthz":   10 * time.Hour,
+		"https://jitter/healthz":    10 * time.Hour,
+	}), start)
+	if len(first) != 0 {
+		t.Fatalf("Expected no regressions on the first cycle, got %+v", first)
+	}
+
+	second := tracker.Observe(cycle(map[string]time.Duration{
+		"https://skewed/healthz":    5 * time.Hour,
+		"https://restarted/healthz": 30 * time.Second,
+		"https://healthy/healthz":   10*time.Hour + time.Minute,
+		"https://jitter/healthz":    10*time.Hour - 2*time.Second,
+	}), start.Add(time.Minute))
+	if len(second) != 1 {
+		t.Fatalf("Expected a single regression, got %+v", second)
+	}
+	regression := second[0]
+	if regression.URL != "https://skewed/healthz" ||
+		regression.PreviousUptime != int64(10*time.Hour) || regression.CurrentUptime != int64(5*time.Hour) {
+		t.Errorf("Unexpected regression %+v", regression)
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// ValidationIssue is a problem found in a line of the servers list
+type ValidationIssue struct {
+	// File is the list file the line is in, set when SERVERS_FILE is a
+	// directory
+	File string `json:"file,omitempty"`
+	Line int    `json:"line"`
+	// Column is the 1-based position of the offending field, 0 when unknown
+	Column  int    `json:"column"`
+	Message string `json:"message"`
+	// Raw is the line as written in the servers list
+	Raw string `json:"raw"`
+}
+
+// validateServerLines checks every line of a servers list the way a scan
+// would parse it, without contacting any server. It returns the number of
+// valid entries and the issues found.
+func validateServerLines(lines []string) (int, []ValidationIssue) {
+	valid := 0
+	var issues []ValidationIssue
+	for i, line := range lines {
+		entry, ok, err := parseServerLine(line)
+		if err != nil {
+			issue := ValidationIssue{Line: i + 1, Message: err.Error(), Raw: line}
+			var lineErr *lineError
+			if errors.As(err, &lineErr) {
+				issue.Column = lineErr.Column
+			}
+			issues = append(issues, issue)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if err := validateServerAddress(entry.Address); err != nil {
+			column := strings.Index(line, entry.Address) + 1
+			issues = append(issues, ValidationIssue{Line: i + 1, Column: column, Message: err.Error(), Raw: line})
+			continue
+		}
+		valid++
+	}
+	return valid, issues
+}
+
+// validateServerAddress reports whether address can be checked: a
+// tcp://host:port entry, or a host or http(s) URL with a host
+func validateServerAddress(address string) error {
+	if isTCPAddress(address) {
+		if _, _, err := net.SplitHostPort(address[len(tcpScheme):]); err != nil {
+			return fmt.Errorf("invalid TCP address %q: %v", address, err)
+		}
+		return nil
+	}
+	if !strings.HasPrefix(address, "http://") && !strings.HasPrefix(address, "https://") {
+		address = "https://" + address
+	}
+	u, err := url.Parse(address)
+	if err != nil {
+		return fmt.Errorf("invalid address: %v", err)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("invalid address %q: missing host", address)
+	}
+	return nil
+}
+
+// validateOptions are the parsed arguments of the validate command
+type validateOptions struct {
+	// ErrorsJSON prints the issues as a JSON array instead of text
+	ErrorsJSON bool
+}
+
+// parseValidateFlags applies the validate command's flags to config
+func parseValidateFlags(args []string, config *Config) (validateOptions, error) {
+	var opts validateOptions
+	flags := flag.NewFlagSet("validate", flag.ContinueOnError)
+	flags.StringVar(&config.ServersFile, "servers", config.ServersFile, "servers list file or directory (SERVERS_FILE)")
+	flags.BoolVar(&opts.ErrorsJSON, "errors-json", false, "print the issues as a JSON array of line, column, message and raw")
+	if err := flags.Parse(args); err != nil {
+		return opts, err
+	}
+	if flags.NArg() > 0 {
+		return opts, fmt.Errorf("validate takes no arguments, got %q", flags.Args())
+	}
+	return opts, nil
+}
+
+// runValidate implements the validate command, which checks the servers list
+// and fails when any line would be rejected by a scan
+func runValidate(args []string, config *Config, out io.Writer) error {
+	opts, err := parseValidateFlags(args, config)
+	if err != nil {
+		return err
+	}
+
+	if isInventoryFile(config.ServersFile) {
+		if opts.ErrorsJSON {
+			return fmt.Errorf("-errors-json is not supported for YAML inventories")
+		}
+		return validateInventory(config, out)
+	}
+	if isCSVInventory(config.ServersFile) {
+		if opts.ErrorsJSON {
+			return fmt.Errorf("-errors-json is not supported for CSV inventories")
+		}
+		return validateCSVInventory(config, out)
+	}
+
+	files, err := readServersFiles(config.ServersFile, config.ServersRecursive)
+	if err != nil {
+		return fmt.Errorf("failed to read servers list: %v", err)
+	}
+	// Line numbers count from the start of each file of a directory
+	dir := isServersDir(config.ServersFile)
+	valid := 0
+	var issues []ValidationIssue
+	for _, file := range files {
+		fileValid, fileIssues := validateServerLines(file.Lines)
+		for i := range fileIssues {
+			if dir {
+				fileIssues[i].File = file.Path
+			}
+		}
+		valid += fileValid
+		issues = append(issues, fileIssues...)
+	}
+	if opts.ErrorsJSON {
+		if err := writeIssuesJSON(out, issues); err != nil {
+			return err
+		}
+		if len(issues) > 0 {
+			return fmt.Errorf("%d invalid lines in %s", len(issues), config.ServersFile)
+		}
+		return nil
+	}
+	for _, issue := range issues {
+		file := issue.File
+		if file == "" {
+			file = config.ServersFile
+		}
+		fmt.Fprintf(out, "%s line %d: %s\n", file, issue.Line, issue.Message)
+	}
+	if len(issues) > 0 {
+		return fmt.Errorf("%d invalid lines in %s", len(issues), config.ServersFile)
+	}
+	fmt.Fprintf(out, "%s: %d servers, no issues\n", config.ServersFile, valid)
+	return nil
+}
+
+// writeIssuesJSON prints issues as a JSON array, empty when there are none
+func writeIssuesJSON(out io.Writer, issues []ValidationIssue) error {
+	if issues == nil {
+		issues = []ValidationIssue{}
+	}
+	data, err := json.MarshalIndent(issues, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(out, string(data))
+	return err
+}
+
+// validateInventory checks the addresses of a YAML inventory's hosts
+func validateInventory(config *Config, out io.Writer) error {
+	entries, err := loadServerEntries(config)
+	if err != nil {
+		return err
+	}
+	invalid := 0
+	for _, entry := range entries {
+		if err := validateServerAddress(entry.Address); err != nil {
+			fmt.Fprintf(out, "%s host %s: %v\n", config.ServersFile, entry.name(), err)
+			invalid++
+		}
+	}
+	if invalid > 0 {
+		return fmt.Errorf("%d invalid hosts in %s", invalid, config.ServersFile)
+	}
+	fmt.Fprintf(out, "%s: %d servers, no issues\n", config.ServersFile, len(entries))
+	return nil
+}
+
+// validateCSVInventory checks the rows of a CSV inventory, failing on rows a
+// scan would skip as well as on invalid addresses
+func validateCSVInventory(config *Config, out io.Writer) error {
+	data, err := os.ReadFile(config.ServersFile)
+	if err != nil {
+		return fmt.Errorf("failed to read inventory: %v", err)
+	}
+	entries, issues, err := parseCSVInventory(data, config.CSVColumns)
+	if err != nil {
+		return fmt.Errorf("failed to parse inventory: %v", err)
+	}
+	for _, issue := range issues {
+		fmt.Fprintf(out, "%s line %d: %s\n", config.ServersFile, issue.Line, issue.Message)
+	}
+	invalid := len(issues)
+	for _, entry := range entries {
+		if err := validateServerAddress(entry.Address); err != nil {
+			fmt.Fprintf(out, "%s host %s: %v\n", config.ServersFile, entry.name(), err)
+			invalid++
+		}
+	}
+	if invalid > 0 {
+		return fmt.Errorf("%d invalid rows in %s", invalid, config.ServersFile)
+	}
+	fmt.Fprintf(out, "%s: %d servers, no issues\n", config.ServersFile, len(entries))
+	return nil
+}
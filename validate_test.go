@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Test that invalid lines are reported with their line numbers
+func TestValidateServerLines(t *testing.T) {
+	lines := []string{
+		"# fleet",
+		"server1.example.com app=memcache",
+		"tcp://redis.example.com:6379",
+		"server2.example.com app",
+		"tcp://redis.example.com",
+		"https://",
+		"",
+	}
+	valid, issues := validateServerLines(lines)
+	if valid != 2 {
+		t.Errorf("Expected 2 valid servers, got %d", valid)
+	}
+	if len(issues) != 3 {
+		t.Fatalf("Expected 3 issues, got %+v", issues)
+	}
+	for i, line := range []int{4, 5, 6} {
+		if issues[i].Line != line {
+			t.Errorf("Issue %d: expected line %d, got %d", i, line, issues[i].Line)
+		}
+	}
+}
+
+// Test that the validate command fails on an invalid servers list
+func TestRunValidate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "servers.txt")
+	if err := os.WriteFile(path, []byte("server1.example.com\nserver2.example.com bad\n"), 0644); err != nil {
+		t.Fatalf("Failed to write servers list: %v", err)
+	}
+
+	var buf bytes.Buffer
+	err := runValidate([]string{"-servers", path}, NewDefaultConfig(), &buf)
+	if err == nil {
+		t.Fatal("Expected an error for an invalid line")
+	}
+	if !strings.Contains(buf.String(), "line 2") {
+		t.Errorf("Expected line 2 to be reported, got %q", buf.String())
+	}
+}
+
+// Test that the issues of a directory of lists name their file and count
+// lines from the start of it
+func TestRunValidateDirectory(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"a.txt": "server1.example.com\nserver2.example.com\nserver3.example.com\n",
+		"b.txt": "server4.example.com\nserver5.example.com bad\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := runValidate([]string{"-servers", dir}, NewDefaultConfig(), &buf); err == nil {
+		t.Fatal("Expected an error for an invalid line")
+	}
+	if expected := filepath.Join(dir, "b.txt") + " line 2:"; !strings.Contains(buf.String(), expected) {
+		t.Errorf("Expected %q to be reported, got %q", expected, buf.String())
+	}
+
+	buf.Reset()
+	runValidate([]string{"-servers", dir, "-errors-json"}, NewDefaultConfig(), &buf)
+	var issues []ValidationIssue
+	if err := json.Unmarshal(buf.Bytes(), &issues); err != nil || len(issues) != 1 {
+		t.Fatalf("Expected one JSON diagnostic, got %q: %v", buf.String(), err)
+	}
+	if issues[0].File != filepath.Join(dir, "b.txt") || issues[0].Line != 2 {
+		t.Errorf("Expected line 2 of b.txt, got %+v", issues[0])
+	}
+}
+
+// Test that -errors-json prints the issues as JSON diagnostics locating each
+// malformed line
+func TestRunValidateErrorsJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "servers.txt")
+	lines := []string{
+		"server1.example.com app=memcache",
+		"server2.example.com app=memcache bad",
+		`server3.example.com note="rack #4`,
+		"https:// app=memcache",
+		"  server4.example.com timeout=soon",
+	}
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatalf("Failed to write servers list: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := runValidate([]string{"-servers", path, "-errors-json"}, NewDefaultConfig(), &buf); err == nil {
+		t.Fatal("Expected an error for the invalid lines")
+	}
+	var issues []ValidationIssue
+	if err := json.Unmarshal(buf.Bytes(), &issues); err != nil {
+		t.Fatalf("Expected JSON diagnostics, got %q: %v", buf.String(), err)
+	}
+	expected := []ValidationIssue{
+		{Line: 2, Column: 34, Message: `invalid tag "bad", expected key=value`, Raw: lines[1]},
+		{Line: 3, Column: 26, Message: "unterminated quote", Raw: lines[2]},
+		{Line: 4, Column: 1, Message: `invalid address "https://": missing host`, Raw: lines[3]},
+		{Line: 5, Column: 23, Message: `invalid timeout "soon", expected a positive duration such as 5s`, Raw: lines[4]},
+	}
+	if !reflect.DeepEqual(issues, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, issues)
+	}
+
+	valid := filepath.Join(t.TempDir(), "valid.txt")
+	if err := os.WriteFile(valid, []byte("server1.example.com\n"), 0644); err != nil {
+		t.Fatalf("Failed to write servers list: %v", err)
+	}
+	buf.Reset()
+	if err := runValidate([]string{"-servers", valid, "-errors-json"}, NewDefaultConfig(), &buf); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if strings.TrimSpace(buf.String()) != "[]" {
+		t.Errorf("Expected an empty array, got %q", buf.String())
+	}
+}
@@ -0,0 +1,20 @@
+package main
+
+// annotateVolumeShares sets the share of its application's requests served by
+// each version, in percent. Versions of an application that served no
+// requests at all are left at 0.
+func annotateVolumeShares(aggregation map[string]map[string]AggregatedData) {
+	for app, versions := range aggregation {
+		var total int64
+		for _, data := range versions {
+			total += data.TotalRequests
+		}
+		for version, data := range versions {
+			data.VolumeShare = 0
+			if total > 0 {
+				data.VolumeShare = float64(data.TotalRequests) / float64(total) * 100
+			}
+			aggregation[app][version] = data
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// Test that the volume shares of an application's versions add up to 100%
+func TestAnnotateVolumeShares(t *testing.T) {
+	aggregation := aggregateData([]AggregatedData{
+		{Application: "Web", Version: "1.0", TotalRequests: 900, TotalSuccesses: 900},
+		{Application: "Web", Version: "1.1-canary", TotalRequests: 100, TotalSuccesses: 99},
+		{Application: "Idle", Version: "1.0"},
+		{Application: "Idle", Version: "2.0"},
+	})
+	annotateVolumeShares(aggregation)
+
+	web := aggregation["Web"]
+	if web["1.0"].VolumeShare != 90 || web["1.1-canary"].VolumeShare != 10 {
+		t.Errorf("Expected a 90/10 split, got %v and %v", web["1.0"].VolumeShare, web["1.1-canary"].VolumeShare)
+	}
+	if sum := web["1.0"].VolumeShare + web["1.1-canary"].VolumeShare; math.Abs(sum-100) > 1e-9 {
+		t.Errorf("Expected the shares to sum to 100%%, got %v", sum)
+	}
+
+	for version, data := range aggregation["Idle"] {
+		if data.VolumeShare != 0 || math.IsNaN(data.VolumeShare) {
+			t.Errorf("Expected no share for an application without traffic, got %v for %s", data.VolumeShare, version)
+		}
+	}
+}
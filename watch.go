@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// scanState holds the state carried between watch cycles
+type scanState struct {
+	// burnRate tracks error budget burn, nil when SLO_TARGET is unset
+	burnRate *burnRateTracker
+	// metrics exposes the latest cycle on METRICS_ADDR, nil when unset
+	metrics *metricsRegistry
+	// self serves the tool's own liveness and readiness on METRICS_ADDR, nil
+	// when unset
+	self *selfCheck
+	// writer delivers each cycle's report to the configured output
+	writer ReportWriter
+	// notifier posts alerts to WEBHOOK_URL, nil when unset
+	notifier *webhookNotifier
+	// responses caches health responses for conditional requests, nil when
+	// CONDITIONAL_REQUESTS is disabled
+	responses *responseCache
+	// breaker skips servers with an open circuit, nil when CIRCUIT_THRESHOLD
+	// is unset
+	breaker *circuitBreaker
+	// stream writes each result to STREAM_OUTPUT as it arrives, nil when unset
+	stream *resultStream
+	// baseline is the BASELINE_FILE report, nil when unset
+	baseline *Report
+	// sloTargets holds the per-service targets of SLO_FILE, nil when unset
+	sloTargets sloTargets
+	// dns caches host lookups for DNS_CACHE_MAX_AGE, nil when unset
+	dns *dnsCache
+	// bastion tunnels connections through BASTION_HOST, nil when unset
+	bastion *bastionDialer
+	// uptimes detects uptimes going backwards between cycles
+	uptimes *uptimeTracker
+	// deltas works out the requests served between cycles, nil when
+	// REQUEST_DELTAS is disabled
+	deltas *requestDeltaTracker
+	// servers caches the parsed servers list, nil when SERVERS_CACHE is
+	// disabled
+	servers *serverListCache
+	// kafka publishes each cycle's results to KAFKA_TOPIC, nil when
+	// KAFKA_BROKERS is unset
+	kafka kafkaWriter
+	// identities pins each server's application/version across cycles, nil
+	// when PIN_IDENTITY is off
+	identities *identityPinner
+	// otel records fetch spans and metrics for OTEL_EXPORTER_OTLP_ENDPOINT,
+	// nil when unset
+	otel *otelRecorder
+	// token is the bearer token of AUTH_TOKEN_COMMAND, nil when unset
+	token *commandToken
+}
+
+// newScanState creates the state for a run according to config
+func newScanState(ctx context.Context, config *Config) (*scanState, error) {
+	writer, err := newReportWriter(config)
+	if err != nil {
+		return nil, err
+	}
+	state := &scanState{writer: writer, uptimes: newUptimeTracker(config)}
+	// An error further down releases what was already opened, such as the
+	// bastion's SSH client or the stream's file
+	ready := false
+	defer func() {
+		if !ready {
+			state.release(config)
+		}
+	}()
+	if config.RequestDeltas {
+		state.deltas = newRequestDeltaTracker(config.CounterResetGrace)
+	}
+	if config.CacheServers {
+		state.servers = newServerListCache()
+	}
+	if config.PinIdentity != PinIdentityOff {
+		state.identities = newIdentityPinner(config)
+	}
+	if config.SLOTarget > 0 {
+		state.burnRate = newBurnRateTracker(config)
+	}
+	if config.MetricsAddr != "" {
+		state.metrics = newMetricsRegistry(config)
+		state.self = newSelfCheck(config)
+	}
+	if config.WebhookURL != "" {
+		state.notifier = newWebhookNotifier(ctx, config)
+	}
+	if config.ConditionalRequests {
+		state.responses = newResponseCache(config.MaxBodyBytes)
+	}
+	if config.CircuitThreshold > 0 {
+		state.breaker = newCircuitBreaker(config)
+	}
+	if config.DNSCacheMaxAge > 0 {
+		state.dns = newDNSCache(config)
+	}
+	if config.BastionHost != "" {
+		if state.bastion, err = newBastionDialer(config); err != nil {
+			return nil, err
+		}
+	}
+	if config.BaselineFile != "" {
+		baseline, err := loadReport(config.BaselineFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load baseline: %v", err)
+		}
+		state.baseline = &baseline
+	}
+	if config.SLOFile != "" {
+		if state.sloTargets, err = loadSLOTargets(config.SLOFile); err != nil {
+			return nil, err
+		}
+	}
+	if config.StreamOutput != "" {
+		if state.stream, err = newResultStream(config.StreamOutput); err != nil {
+			return nil, err
+		}
+	}
+	if config.AuthTokenCommand != "" {
+		state.token = newCommandToken(config)
+	}
+	if config.OTLPEndpoint != "" {
+		if state.otel, err = newOTLPRecorder(ctx, config); err != nil {
+			return nil, err
+		}
+	}
+	if len(config.KafkaBrokers) > 0 {
+		writer, err := newKafkaWriter(config)
+		if err != nil {
+			return nil, err
+		}
+		state.kafka = writer
+	}
+	ready = true
+	return state, nil
+}
+
+// release closes what newScanState opened for a state discarded before its
+// first cycle
+func (s *scanState) release(config *Config) {
+	if s.notifier != nil {
+		s.notifier.Close(config.WebhookFlushTimeout)
+	}
+	if s.stream != nil {
+		s.stream.Close()
+	}
+	if s.bastion != nil {
+		s.bastion.Close()
+	}
+	if s.otel != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), config.HTTPTimeout)
+		s.otel.Shutdown(ctx)
+		cancel()
+	}
+}
+
+// Close flushes anything still pending before the process exits. With StatsD
+// or a Pushgateway configured it then waits METRICS_FLUSH_DELAY so the last
+// batch can drain from the network buffers.
+func (s *scanState) Close(config *Config) {
+	if s.notifier != nil {
+		s.notifier.Close(config.WebhookFlushTimeout)
+	}
+	if s.stream != nil {
+		s.stream.Close()
+	}
+	if s.bastion != nil {
+		s.bastion.Close()
+	}
+	if s.kafka != nil {
+		if err := s.kafka.Close(); err != nil {
+			fmt.Fprintf(config.Console, "Error closing Kafka producer: %v\n", err)
+		}
+	}
+	if s.otel != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), config.HTTPTimeout)
+		if err := s.otel.Shutdown(ctx); err != nil {
+			fmt.Fprintf(config.Console, "Error flushing OpenTelemetry exporter: %v\n", err)
+		}
+		cancel()
+	}
+	if config.StatsdAddr != "" || config.PushgatewayURL != "" {
+		time.Sleep(config.MetricsFlushDelay)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// errCycleAbandoned is returned when the watchdog gives up on a stuck cycle
+var errCycleAbandoned = fmt.Errorf("scan cycle abandoned by the watchdog")
+
+// errCycleStillRunning is returned instead of starting a cycle while an
+// abandoned one has yet to return
+var errCycleStillRunning = fmt.Errorf("abandoned scan cycle still running, skipping this cycle")
+
+// cycleWatchdog runs scan cycles bounded by RunTimeout. A cycle's context is
+// canceled once RunTimeout passes so in-flight requests stop; if the cycle
+// still has not returned after WatchdogFactor times RunTimeout it is
+// abandoned with a warning so a wedged cycle cannot hang the process. An
+// abandoned cycle keeps using the scan state until it returns, so the next
+// cycle and closing the state first wait for it, for as long again.
+type cycleWatchdog struct {
+	config *Config
+	// abandoned is closed once the last abandoned cycle returns, and is nil
+	// when no cycle is outstanding
+	abandoned chan struct{}
+}
+
+// newCycleWatchdog creates a watchdog for the cycles of a scan
+func newCycleWatchdog(config *Config) *cycleWatchdog {
+	return &cycleWatchdog{config: config}
+}
+
+// limit is how long a cycle, or an abandoned cycle being waited for, may run
+func (w *cycleWatchdog) limit() time.Duration {
+	return time.Duration(float64(w.config.RunTimeout) * w.config.WatchdogFactor)
+}
+
+// Run runs a single cycle. Without a RunTimeout the cycle runs unbounded.
+func (w *cycleWatchdog) Run(ctx context.Context, cycle func(ctx context.Context) (*cycleOutcome, error)) (*cycleOutcome, error) {
+	if w.config.RunTimeout <= 0 {
+		return cycle(ctx)
+	}
+	if !w.Wait() {
+		return nil, errCycleStillRunning
+	}
+
+	cycleCtx, cancel := context.WithTimeout(ctx, w.config.RunTimeout)
+	defer cancel()
+
+	type cycleResult struct {
+		outcome *cycleOutcome
+		err     error
+	}
+	done := make(chan cycleResult, 1)
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		outcome, err := cycle(cycleCtx)
+		done <- cycleResult{outcome, err}
+	}()
+
+	limit := w.limit()
+	timer := time.NewTimer(limit)
+	defer timer.Stop()
+	select {
+	case result := <-done:
+		return result.outcome, result.err
+	case <-timer.C:
+		cancel()
+		w.abandoned = finished
+		fmt.Fprintf(w.config.Console, "Warning: scan cycle still running after %v (RUN_TIMEOUT %v), abandoning it\n", limit, w.config.RunTimeout)
+		return nil, errCycleAbandoned
+	}
+}
+
+// Wait waits for an abandoned cycle to return, up to the watchdog limit. It
+// reports false, with a warning, if the cycle is still running.
+func (w *cycleWatchdog) Wait() bool {
+	if w.abandoned == nil {
+		return true
+	}
+	timer := time.NewTimer(w.limit())
+	defer timer.Stop()
+	select {
+	case <-w.abandoned:
+		w.abandoned = nil
+		return true
+	case <-timer.C:
+		fmt.Fprintf(w.config.Console, "Warning: abandoned scan cycle still running after a further %v\n", w.limit())
+		return false
+	}
+}
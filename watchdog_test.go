@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Test that the watchdog abandons a stuck cycle, cancels it, and waits for it
+// to return before running the next cycle
+func TestWatchdogAbandonsStuckCycle(t *testing.T) {
+	config := NewDefaultConfig()
+	config.RunTimeout = 20 * time.Millisecond
+	config.WatchdogFactor = 2
+	watchdog := newCycleWatchdog(config)
+
+	release := make(chan struct{})
+	canceled := make(chan struct{})
+	stuck := func(ctx context.Context) (*cycleOutcome, error) {
+		<-ctx.Done()
+		close(canceled)
+		<-release // ignores its context, like a wedged goroutine
+		return &cycleOutcome{}, nil
+	}
+
+	start := time.Now()
+	if _, err := watchdog.Run(context.Background(), stuck); !errors.Is(err, errCycleAbandoned) {
+		t.Fatalf("Expected the stuck cycle to be abandoned, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the watchdog to fire after about 40ms, took %v", elapsed)
+	}
+	select {
+	case <-canceled:
+	default:
+		t.Error("Expected the context of the abandoned cycle to be canceled")
+	}
+
+	ran := false
+	healthy := func(ctx context.Context) (*cycleOutcome, error) {
+		ran = true
+		return &cycleOutcome{}, nil
+	}
+	if _, err := watchdog.Run(context.Background(), healthy); !errors.Is(err, errCycleStillRunning) || ran {
+		t.Fatalf("Expected the next cycle skipped while the abandoned one runs, got %v", err)
+	}
+
+	close(release)
+	if outcome, err := watchdog.Run(context.Background(), healthy); err != nil || outcome == nil || !ran {
+		t.Errorf("Expected the next cycle to run once the abandoned one returned, got %v, %v", outcome, err)
+	}
+	if !watchdog.Wait() {
+		t.Error("Expected nothing left to wait for")
+	}
+}
+
+// Test that RUN_TIMEOUT cancels the in-flight requests of a slow cycle so it
+// finishes, and cleans up, before the watchdog fires
+func TestRunTimeoutCancelsCycle(t *testing.T) {
+	hang := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-hang:
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+	defer close(hang)
+
+	serversFile := filepath.Join(t.TempDir(), "servers.txt")
+	if err := os.WriteFile(serversFile, []byte(slow.URL+"\n"), 0644); err != nil {
+		t.Fatalf("Failed to write servers file: %v", err)
+	}
+
+	config := NewDefaultConfig()
+	config.ServersFile = serversFile
+	config.FailuresFile = ""
+	config.RequestDelay = 0
+	config.RunTimeout = 100 * time.Millisecond
+	config.WatchdogFactor = 20
+	writer := &fakeReportWriter{}
+	state := &scanState{writer: writer}
+
+	outcome, err := newCycleWatchdog(config).Run(context.Background(), func(ctx context.Context) (*cycleOutcome, error) {
+		return runCycle(ctx, config, state)
+	})
+	if err != nil {
+		t.Fatalf("Expected the cycle to finish once canceled, got %v", err)
+	}
+	if len(outcome.Results) != 1 || outcome.Results[0].ErrorClass != ErrorClassTimeout {
+		t.Errorf("Expected the slow server to time out, got %+v", outcome.Results)
+	}
+	if len(writer.reports) != 1 {
+		t.Errorf("Expected the report of the canceled cycle to be written, got %d", len(writer.reports))
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// ReportWriter delivers a finished report to an output target
+type ReportWriter interface {
+	Write(ctx context.Context, report Report) error
+}
+
+// newReportWriter selects the writer for OUTPUT_FILE: "-" writes to stdout,
+// s3://bucket/key uploads to S3 and anything else is a local file path
+func newReportWriter(config *Config) (ReportWriter, error) {
+	if config.OutputFile == "-" {
+		return &stdoutReportWriter{out: os.Stdout, config: config}, nil
+	}
+	target, isS3, err := parseS3Target(config.OutputFile)
+	if err != nil {
+		return nil, err
+	}
+	if isS3 {
+		if isOutputTemplate(config.OutputFile) {
+			return nil, fmt.Errorf("output templates are only supported for local files, got %s", config.OutputFile)
+		}
+		return &s3ReportWriter{uploader: newS3UploaderFromEnv(config), target: target, config: config}, nil
+	}
+
+	// A templated path is validated by expanding it for the first cycle, and
+	// its directory created so the writability check has something to probe
+	path := config.OutputFile
+	if isOutputTemplate(path) {
+		if path, err = expandOutputTemplate(path, newOutputTemplateData(config, time.Now(), 1)); err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, fmt.Errorf("cannot create output directory for %s: %v", config.OutputFile, err)
+		}
+	}
+	if err := checkWritableDir(filepath.Dir(path)); err != nil {
+		// The dashboard owns stdout, so TUI cannot fall back to it
+		if !config.OutputFallbackStdout || usesDashboard(config) {
+			return nil, fmt.Errorf("cannot write report to %s: %v", config.OutputFile, err)
+		}
+		// From here on the report owns stdout, so logs move to stderr
+		config.Console = os.Stderr
+		fmt.Fprintf(config.Console, "Warning: cannot write report to %s (%v), writing it to stdout instead\n", config.OutputFile, err)
+		return &stdoutReportWriter{out: os.Stdout, config: config}, nil
+	}
+	return &fileReportWriter{path: config.OutputFile, config: config}, nil
+}
+
+// routeConsole sends the logs of a run to stderr when the report or the result
+// stream is written to stdout, so the output can be piped into a parser
+func routeConsole(config *Config) {
+	if config.OutputFile == "-" || config.StreamOutput == "-" {
+		config.Console = os.Stderr
+	}
+}
+
+// checkWritableDir verifies that files can be created in dir by creating and
+// removing a probe file, so a read-only output directory is reported before
+// the scan instead of after it
+func checkWritableDir(dir string) error {
+	probe, err := os.CreateTemp(dir, ".write-check-*")
+	if err != nil {
+		return fmt.Errorf("output directory %s is not writable: %v", dir, err)
+	}
+	probe.Close()
+	return os.Remove(probe.Name())
+}
+
+// fileReportWriter writes the report to a local file, keeping timestamped
+// history when KEEP_HISTORY is set. A templated path is expanded on every
+// write and its directory created.
+type fileReportWriter struct {
+	path   string
+	config *Config
+	cycles int64
+}
+
+func (w *fileReportWriter) Write(ctx context.Context, report Report) error {
+	data, err := encodeReport(report, w.config)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	path := w.path
+	if isOutputTemplate(path) {
+		meta := newOutputTemplateData(w.config, now, atomic.AddInt64(&w.cycles, 1))
+		if path, err = expandOutputTemplate(path, meta); err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+	}
+	if compressOutput(path, w.config) {
+		if data, err = gzipBytes(data); err != nil {
+			return err
+		}
+	}
+	if w.config.KeepHistory > 0 {
+		return saveReportWithHistory(path, data, w.config.KeepHistory, now)
+	}
+	return writeFileAtomic(path, data)
+}
+
+// stdoutReportWriter prints the report
+type stdoutReportWriter struct {
+	out    io.Writer
+	config *Config
+}
+
+func (w *stdoutReportWriter) Write(ctx context.Context, report Report) error {
+	data, err := encodeReport(report, w.config)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w.out, string(data))
+	return err
+}
+
+// s3ReportWriter uploads the report to an S3-compatible bucket
+type s3ReportWriter struct {
+	uploader *s3Uploader
+	target   s3Target
+	config   *Config
+}
+
+func (w *s3ReportWriter) Write(ctx context.Context, report Report) error {
+	data, err := encodeReport(report, w.config)
+	if err != nil {
+		return err
+	}
+	return w.uploader.Put(ctx, w.target, data)
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeReportWriter records the reports passed to it and fails with err when set
+type fakeReportWriter struct {
+	reports []Report
+	err     error
+}
+
+func (w *fakeReportWriter) Write(ctx context.Context, report Report) error {
+	w.reports = append(w.reports, report)
+	return w.err
+}
+
+// Test that a scan cycle hands its report to the configured writer
+func TestRunCycleReportWriter(t *testing.T) {
+	server := setupMockServer()
+	defer server.Close()
+
+	serversFile := filepath.Join(t.TempDir(), "servers.txt")
+	if err := os.WriteFile(serversFile, []byte(server.URL+"\n"+server.URL+"\n"), 0644); err != nil {
+		t.Fatalf("Failed to write servers file: %v", err)
+	}
+
+	config := NewDefaultConfig()
+	config.ServersFile = serversFile
+	config.RequestDelay = 0
+	writer := &fakeReportWriter{}
+	state := &scanState{writer: writer}
+
+	if _, err := runCycle(context.Background(), config, state); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(writer.reports) != 1 {
+		t.Fatalf("Expected 1 report, got %d", len(writer.reports))
+	}
+	agg, exists := writer.reports[0].Applications["Memcache2"]["1.0.1"]
+	if !exists {
+		t.Fatalf("Expected Memcache2 1.0.1 in the report, got %v", writer.reports[0].Applications)
+	}
+	if agg.TotalRequests != 2*5194800029 || agg.Severity != SeverityCritical {
+		t.Errorf("Expected both servers aggregated and annotated, got %+v", agg)
+	}
+}
+
+// Test that a server listed in several files of a directory is checked once
+func TestRunCycleDirectoryDedupe(t *testing.T) {
+	server := setupMockServer()
+	defer server.Close()
+
+	dir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(server.URL+"\n"), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	config := NewDefaultConfig()
+	config.ServersFile = dir
+	config.RequestDelay = 0
+	writer := &fakeReportWriter{}
+	state := &scanState{writer: writer}
+
+	if _, err := runCycle(context.Background(), config, state); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if agg := writer.reports[0].Applications["Memcache2"]["1.0.1"]; agg.TotalRequests != 5194800029 {
+		t.Errorf("Expected the server counted once, got %+v", agg)
+	}
+}
+
+// Test that the writer is selected from OUTPUT_FILE
+func TestNewReportWriter(t *testing.T) {
+	config := NewDefaultConfig()
+
+	for output, expected := range map[string]string{
+		"report.json":        "*main.fileReportWriter",
+		"-":                  "*main.stdoutReportWriter",
+		"s3://bucket/report": "*main.s3ReportWriter",
+	} {
+		config.OutputFile = output
+		writer, err := newReportWriter(config)
+		if err != nil {
+			t.Fatalf("Output %s: expected no error, got %v", output, err)
+		}
+		if got := fmt.Sprintf("%T", writer); got != expected {
+			t.Errorf("Output %s: expected %s, got %s", output, expected, got)
+		}
+	}
+
+	var buf bytes.Buffer
+	stdout := &stdoutReportWriter{out: &buf, config: config}
+	if err := stdout.Write(context.Background(), Report{Applications: map[string]map[string]AggregatedData{}}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	var decoded Report
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Errorf("Expected stdout writer to print the JSON report, got %v", err)
+	}
+}
+
+// Test that logs move to stderr only when the report or the stream is
+// written to stdout
+func TestRouteConsole(t *testing.T) {
+	config := NewDefaultConfig()
+	routeConsole(config)
+	if config.Console != os.Stdout {
+		t.Errorf("Expected logs on stdout with a file report")
+	}
+
+	config.OutputFile = "-"
+	routeConsole(config)
+	if config.Console != os.Stderr {
+		t.Errorf("Expected logs on stderr with the report on stdout")
+	}
+
+	config = NewDefaultConfig()
+	config.StreamOutput = "-"
+	routeConsole(config)
+	if config.Console != os.Stderr {
+		t.Errorf("Expected logs on stderr with the result stream on stdout")
+	}
+}
+
+// Test that the report write and the StatsD push complete independently of
+// each other's failures, with only the write failing the cycle
+func TestPublishReport(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	report := Report{Applications: aggregateData([]AggregatedData{
+		{Application: "Memcache2", Version: "1.0.1", TotalRequests: 10, TotalSuccesses: 9},
+	})}
+	config := NewDefaultConfig()
+
+	// A failing write is reported, but the push still goes out
+	config.StatsdAddr = listener.LocalAddr().String()
+	writer := &fakeReportWriter{err: fmt.Errorf("disk full")}
+	err = publishReport(context.Background(), config, &scanState{writer: writer}, report)
+	if err == nil || !strings.Contains(err.Error(), "disk full") {
+		t.Errorf("Expected the write error, got %v", err)
+	}
+	buf := make([]byte, statsdMaxPacketSize)
+	listener.SetReadDeadline(time.Now().Add(time.Second))
+	if n, _, err := listener.ReadFrom(buf); err != nil || !strings.Contains(string(buf[:n]), "healthcheck.success_rate:90|g") {
+		t.Errorf("Expected the StatsD push despite the failed write, got %q, %v", buf[:n], err)
+	}
+
+	// A failing push is only logged and the report is still written
+	config.StatsdAddr = "invalid-host-name.invalid:8125"
+	writer = &fakeReportWriter{}
+	if err := publishReport(context.Background(), config, &scanState{writer: writer}, report); err != nil {
+		t.Errorf("Expected a failed push not to fail the cycle, got %v", err)
+	}
+	if len(writer.reports) != 1 {
+		t.Errorf("Expected the report written despite the failed push, got %d reports", len(writer.reports))
+	}
+}
+
+// Test that an unwritable output directory is reported before the scan, or
+// falls back to stdout when enabled
+func TestNewReportWriterUnwritableDir(t *testing.T) {
+	dir := t.TempDir()
+	readOnly := filepath.Join(dir, "readonly")
+	if err := os.Mkdir(readOnly, 0555); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	// A file standing in for a directory is unwritable even for root
+	notADir := filepath.Join(dir, "file")
+	if err := os.WriteFile(notADir, nil, 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	targets := []string{filepath.Join(notADir, "report.json")}
+	if os.Geteuid() != 0 {
+		targets = append(targets, filepath.Join(readOnly, "report.json"))
+	}
+	for _, target := range targets {
+		config := NewDefaultConfig()
+		config.OutputFile = target
+		_, err := newReportWriter(config)
+		if err == nil || !strings.Contains(err.Error(), "is not writable") {
+			t.Errorf("Output %s: expected an early not writable error, got %v", target, err)
+		}
+
+		config.OutputFallbackStdout = true
+		writer, err := newReportWriter(config)
+		if err != nil {
+			t.Fatalf("Output %s: expected the stdout fallback, got %v", target, err)
+		}
+		if _, ok := writer.(*stdoutReportWriter); !ok {
+			t.Errorf("Output %s: expected a stdout writer, got %T", target, writer)
+		}
+		if config.Console != os.Stderr {
+			t.Errorf("Output %s: expected logs to move to stderr with the stdout fallback", target)
+		}
+	}
+
+	entries, err := os.ReadDir(readOnly)
+	if err != nil || len(entries) != 0 {
+		t.Errorf("Expected no probe files left behind, got %v, %v", entries, err)
+	}
+}